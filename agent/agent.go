@@ -9,7 +9,10 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -21,6 +24,7 @@ import (
 	"github.com/tomasmach/vespra/config"
 	"github.com/tomasmach/vespra/llm"
 	"github.com/tomasmach/vespra/memory"
+	"github.com/tomasmach/vespra/netguard"
 	"github.com/tomasmach/vespra/soul"
 	"github.com/tomasmach/vespra/tools"
 )
@@ -81,16 +85,25 @@ func sanitizeHistory(msgs []llm.Message) []llm.Message {
 
 // ChannelAgent is a per-channel conversation goroutine.
 type ChannelAgent struct {
-	channelID string
-	serverID  string
-
-	cfgStore   *config.Store
-	llm        *llm.Client
-	httpClient *http.Client
-	resources  *AgentResources
-	logger     *slog.Logger
+	channelID   string
+	serverID    string
+	persona     *config.PersonaConfig // nil unless the agent has personas
+	memoryScope string                // server ID, or the persona's namespace
+	signReplies bool                  // persona shares the agent's bot; prefix replies with its name
+
+	cfgStore    *config.Store
+	llm         *llm.Client
+	httpClient  *http.Client // attachment and embed downloads
+	fetchClient *http.Client // web_fetch; nil uses httpClient
+	resources   *AgentResources
+	files       *fileTextCache    // texts of read attachments, shared through resources
+	plugins     *tools.PluginHost // nil disables plugin tools
+	webCache    *tools.Cache      // nil disables caching of fetches and searches
+	logger      *slog.Logger
 
 	soulText          string
+	soulPath          string         // file soulText was loaded from; "" = built-in default
+	soulModTime       time.Time      // modification time of soulPath when loaded
 	history           []llm.Message  // capped to cfg.Agent.HistoryLimit
 	turnCount         int            // incremented each completed turn; triggers background extraction
 	lastActive        atomic.Int64   // UnixNano; written by agent goroutine, read by Status()
@@ -98,8 +111,7 @@ type ChannelAgent struct {
 	extractionWg      sync.WaitGroup // tracks in-flight memory extraction goroutines
 	searchRunning     atomic.Bool    // prevents concurrent web searches
 	searchWg          sync.WaitGroup // tracks in-flight web search goroutines
-	imageRunning      atomic.Bool    // prevents concurrent image generations
-	imageWg           sync.WaitGroup // tracks in-flight image generation goroutines
+	imageWg           sync.WaitGroup // tracks queued and in-flight image generation goroutines
 	sendTimestamps    []time.Time    // sliding window for outgoing rate limit
 
 	ctx        context.Context               // agent's own context; set at the start of run()
@@ -176,9 +188,13 @@ func formatMessageContent(content, botID, botName string) string {
 
 // historyUserContent formats the text content for a user message in history,
 // annotating reply-to context when the message is a Discord reply and
-// sanitizing bot mentions into readable form.
-func historyUserContent(m *discordgo.Message, botID, botName string) string {
+// sanitizing bot mentions into readable form. files holds the texts of
+// attachments the agent read; it may be nil.
+func historyUserContent(files *fileTextCache, m *discordgo.Message, botID, botName string) string {
 	content := resolveMentions(formatMessageContent(m.Content, botID, botName), m.Mentions)
+	if labels := fileLabels(files, m); labels != "" {
+		content = strings.TrimSpace(content + labels)
+	}
 	if m.ReferencedMessage != nil && m.ReferencedMessage.Author != nil {
 		refContent := resolveMentions(formatMessageContent(m.ReferencedMessage.Content, botID, botName), m.ReferencedMessage.Mentions)
 		if len(refContent) > 200 {
@@ -195,6 +211,9 @@ func historyUserContent(m *discordgo.Message, botID, botName string) string {
 			if hasGifEmbeds(m.ReferencedMessage) {
 				labels = append(labels, "[gif]")
 			}
+			if len(fileAttachmentNames(m.ReferencedMessage)) > 0 {
+				labels = append(labels, "[file]")
+			}
 			if len(labels) > 0 {
 				refContent = strings.Join(labels, ", ")
 			}
@@ -208,6 +227,24 @@ func historyUserContent(m *discordgo.Message, botID, botName string) string {
 	return fmt.Sprintf("%s: %s", m.Author.Username, content)
 }
 
+// fileLabels adds the text and PDF attachments of m to history and logs: the
+// fenced text a turn read from each file, or an [attached file: name] label
+// for files not read yet, whose contents travel as separate message parts.
+func fileLabels(files *fileTextCache, m *discordgo.Message) string {
+	var sb strings.Builder
+	for _, att := range m.Attachments {
+		if !isReadableAttachment(att) {
+			continue
+		}
+		if text, ok := files.get(att.ID); ok && att.ID != "" {
+			sb.WriteString("\n" + text)
+		} else {
+			fmt.Fprintf(&sb, " [attached file: %s]", att.Filename)
+		}
+	}
+	return sb.String()
+}
+
 const maxVideoBytes = 50 * 1024 * 1024 // 50 MB
 const maxImageEditSourceImages = 14
 
@@ -236,8 +273,8 @@ func classifyAttachments(attachments []*discordgo.MessageAttachment) (images, vi
 // buildUserMessage converts a Discord message into an llm.Message, downloading
 // any image, video attachments, or GIF embed thumbnails as base64 data URLs for vision content parts.
 // Discord CDN URLs require authentication, so media must be fetched server-side.
-func buildUserMessage(ctx context.Context, httpClient *http.Client, msg *discordgo.MessageCreate, botID, botName string) llm.Message {
-	text := historyUserContent(msg.Message, botID, botName)
+func buildUserMessage(ctx context.Context, httpClient *http.Client, files *fileTextCache, msg *discordgo.MessageCreate, botID, botName string) llm.Message {
+	text := historyUserContent(files, msg.Message, botID, botName)
 
 	images, videos := classifyAttachments(msg.Attachments)
 	if msg.ReferencedMessage != nil {
@@ -423,19 +460,94 @@ func (a *ChannelAgent) rateLimitedSendFn(raw func(string) error) func(string) er
 	}
 }
 
-func newChannelAgent(channelID, serverID string, cfgStore *config.Store, llmClient *llm.Client, resources *AgentResources) *ChannelAgent {
-	return &ChannelAgent{
-		channelID:  channelID,
-		serverID:   serverID,
-		cfgStore:   cfgStore,
-		llm:        llmClient,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
-		resources:  resources,
-		soulText:   soul.Load(cfgStore.Get(), serverID),
-		msgCh:      make(chan *discordgo.MessageCreate, 100),
-		internalCh: make(chan string, 10),
-		logger:     slog.With("server_id", serverID, "channel_id", channelID),
+func newChannelAgent(channelID, serverID string, persona *config.PersonaConfig, cfgStore *config.Store, llmClient *llm.Client, httpClient *http.Client, resources *AgentResources) *ChannelAgent {
+	a := &ChannelAgent{
+		channelID:   channelID,
+		serverID:    serverID,
+		persona:     persona,
+		memoryScope: serverID,
+		cfgStore:    cfgStore,
+		llm:         llmClient,
+		httpClient:  httpClient,
+		resources:   resources,
+		files:       resources.files,
+		msgCh:       make(chan *discordgo.MessageCreate, 100),
+		internalCh:  make(chan string, 10),
+		logger:      slog.With("server_id", serverID, "channel_id", channelID),
+	}
+	if persona != nil {
+		a.memoryScope = persona.MemoryScope(serverID)
+		a.signReplies = resources.PersonaSessions[persona.ID] == nil
+		a.logger = a.logger.With("persona", persona.ID)
+	}
+	if a.files == nil {
+		a.files = newFileTextCache()
+	}
+	a.refreshSoul()
+	return a
+}
+
+// discordMediaDomains serve attachments and embed thumbnails; media downloads
+// may always reach them, whatever tools.network.allow_domains lists.
+var discordMediaDomains = []string{"cdn.discordapp.com", "media.discordapp.net"}
+
+// newGuardedClient returns an HTTP client for attachment, embed and web_fetch
+// downloads. It refuses non-public addresses and applies the tools.network
+// domain lists of the current config, with alwaysAllow added to a non-empty
+// allow list.
+func newGuardedClient(cfgStore *config.Store, alwaysAllow ...string) *http.Client {
+	return netguard.NewClient(func() netguard.Policy {
+		n := cfgStore.Get().Tools.Network
+		allow := n.AllowDomains
+		if len(allow) > 0 {
+			allow = append(slices.Clip(allow), alwaysAllow...)
+		}
+		return netguard.Policy{AllowDomains: allow, DenyDomains: n.DenyDomains, AllowPrivate: n.AllowPrivateNetworks}
+	}, 30*time.Second)
+}
+
+// newWebCache opens the page and search cache described by tools.cache, or
+// returns nil if it is disabled or cannot be opened.
+func newWebCache(cfg *config.Config) *tools.Cache {
+	if cfg.Tools.Cache.MaxSizeMB < 0 {
+		return nil
 	}
+	dir := config.ExpandPath(cfg.Tools.Cache.Dir)
+	if dir == "" {
+		dir = filepath.Join(config.ResolveDataDir(cfg.Memory.DBPath), "webcache")
+	}
+	cache, err := tools.NewCache(dir, int64(cfg.Tools.Cache.MaxSizeMB)<<20)
+	if err != nil {
+		slog.Warn("web cache disabled", "error", err, "dir", dir)
+		return nil
+	}
+	return cache
+}
+
+// refreshSoul resolves the soul for this channel (persona soul, per-channel or
+// per-category named soul, then agent, global, default) and reloads it when the
+// selected file or its modification time changed, so soul edits apply without a restart.
+func (a *ChannelAgent) refreshSoul() {
+	var path string
+	if a.persona != nil {
+		path = soul.PersonaPath(a.cfgStore.Path(), a.resources.Config.ID, a.persona)
+	}
+	if path == "" {
+		path = soul.ResolvePath(a.cfgStore.Get(), a.cfgStore.Path(), a.serverID, channelLineage(a.resources.Session, a.channelID))
+	}
+	var modTime time.Time
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+	}
+	if a.soulText != "" && path == a.soulPath && modTime.Equal(a.soulModTime) {
+		return
+	}
+	a.soulText = soul.LoadPath(path)
+	a.soulPath = path
+	a.soulModTime = modTime
+	a.logger.Info("soul loaded", "path", path)
 }
 
 func (a *ChannelAgent) run(ctx context.Context) {
@@ -571,24 +683,46 @@ func (a *ChannelAgent) backfillHistory(ctx context.Context, beforeID string) []l
 		a.logger.Warn("failed to backfill channel history", "error", err)
 		return nil
 	}
-	botID := a.resources.Session.State.User.ID
-	botName := a.resources.Session.State.User.Username
+	botID, botName := a.botIdentity()
+	allowBots := botChannel(a.resources.Config, channelLineage(a.resources.Session, a.channelID)) != nil
 	// msgs is newest-first; reverse to chronological order
 	history := make([]llm.Message, 0, len(msgs))
 	for i := len(msgs) - 1; i >= 0; i-- {
 		m := msgs[i]
-		if m.Author == nil || m.Content == "" {
+		if m.Author == nil || (m.Content == "" && len(fileAttachmentNames(m)) == 0) {
 			continue
 		}
 		if m.Author.ID == botID {
+			if m.Content == "" {
+				continue
+			}
 			history = append(history, llm.Message{Role: "assistant", Content: m.Content})
-		} else if !m.Author.Bot {
-			history = append(history, llm.Message{Role: "user", Content: historyUserContent(m, botID, botName)})
+		} else if !m.Author.Bot || allowBots {
+			history = append(history, llm.Message{Role: "user", Content: historyUserContent(a.files, m, botID, botName)})
 		}
 	}
 	return history
 }
 
+// botIdentity returns the Discord user ID the agent speaks as and the name it
+// answers to: the persona's name for personas, else the bot's username.
+func (a *ChannelAgent) botIdentity() (id, name string) {
+	u := a.resources.Session.State.User
+	if a.persona != nil {
+		return u.ID, a.persona.Name
+	}
+	return u.ID, u.Username
+}
+
+// sign prefixes text with the persona's name when the persona shares the
+// agent's bot user, so readers can tell the personas apart.
+func (a *ChannelAgent) sign(text string) string {
+	if !a.signReplies {
+		return text
+	}
+	return "**" + a.persona.Name + ":** " + text
+}
+
 // isAddressedToBot reports whether a Discord message is directly addressed to
 // the bot via DM, @mention, reply, or plain-text name mention.
 func isAddressedToBot(m *discordgo.MessageCreate, botID, botName string) bool {
@@ -726,8 +860,7 @@ func (a *ChannelAgent) handleMessage(ctx context.Context, msg *discordgo.Message
 
 	cfg := a.cfgStore.Get()
 	mode := cfg.ResolveResponseMode(a.serverID, msg.ChannelID)
-	botID := a.resources.Session.State.User.ID
-	botName := a.resources.Session.State.User.Username
+	botID, botName := a.botIdentity()
 	addressed := isAddressedToBot(msg, botID, botName)
 
 	switch mode {
@@ -760,10 +893,12 @@ func (a *ChannelAgent) handleMessage(ctx context.Context, msg *discordgo.Message
 		userID = msg.Author.ID
 	}
 	memories := a.recallMemories(ctx, cfg, userID, msg.Content)
-	systemPrompt := a.buildSystemPrompt(cfg, mode, msg.ChannelID, memories, botName, addressed, directedAtOther)
+	reference := a.recallKnowledge(ctx, cfg, msg.Content)
+	a.refreshSoul()
+	systemPrompt := a.buildSystemPrompt(cfg, mode, msg.ChannelID, memories, reference, botName, addressed, directedAtOther)
 
 	sendFn := a.rateLimitedSendFn(func(content string) error {
-		_, err := a.resources.Session.ChannelMessageSend(msg.ChannelID, content)
+		_, err := a.resources.Session.ChannelMessageSend(msg.ChannelID, a.sign(content))
 		return err
 	})
 	reactFn := func(emoji string) error {
@@ -773,9 +908,14 @@ func (a *ChannelAgent) handleMessage(ctx context.Context, msg *discordgo.Message
 	if a.imageGenConfigured(cfg) {
 		sourceImageURLs = collectImageDataURLs(ctx, a.httpClient, msg.Message)
 	}
-	reg := tools.NewDefaultRegistry(a.resources.Memory, a.serverID, cfg.Agent.MemoryDedupThreshold, cfg.Agent.MemoryRecallLimit, sendFn, reactFn, a.webSearchDeps(), a.imageGenDeps(a.makeSendImageFn(msg.ChannelID), sendFn, sourceImageURLs, msg.ChannelID, msg.ID), cfg.Agent.MaxReplyParts)
+	reg := tools.NewDefaultRegistry(a.resources.Memory, a.memoryScope, cfg.Agent.MemoryDedupThreshold, cfg.Agent.MemoryRecallLimit, sendFn, reactFn, a.webSearchDeps(), a.imageGenDeps(a.makeSendImageFn(msg.ChannelID), sendFn, sourceImageURLs, msg), cfg.Agent.MaxReplyParts, a.agentToolsDeps(ctx, toolPolicies(cfg, a.serverID, channelLineage(a.resources.Session, msg.ChannelID))))
+	if userID != "" {
+		reg.Requesters = []string{userID}
+	}
+	a.registerExternalTools(ctx, reg)
 
-	userMsg := buildUserMessage(ctx, a.httpClient, msg, botID, botName)
+	userMsg := buildUserMessage(ctx, a.httpClient, a.files, msg, botID, botName)
+	appendContentParts(&userMsg, a.textAttachmentParts(ctx, cfg, []*discordgo.Message{msg.Message}))
 	a.annotateAndStripMedia(ctx, cfg, &userMsg)
 	llmMsgs := make([]llm.Message, len(a.history), len(a.history)+1)
 	copy(llmMsgs, a.history)
@@ -787,7 +927,7 @@ func (a *ChannelAgent) handleMessage(ctx context.Context, msg *discordgo.Message
 		sendFn:          sendFn,
 		reg:             reg,
 		llmMsgs:         llmMsgs,
-		userMsgText:     historyUserContent(msg.Message, botID, botName),
+		userMsgText:     historyUserContent(a.files, msg.Message, botID, botName),
 		addressed:       addressed,
 		directedAtOther: directedAtOther,
 	})
@@ -797,23 +937,13 @@ func (a *ChannelAgent) handleMessage(ctx context.Context, msg *discordgo.Message
 // then removes the raw media blobs so the main chat model only sees the text
 // description.
 func (a *ChannelAgent) annotateAndStripMedia(ctx context.Context, cfg *config.Config, msg *llm.Message) {
-	if hasMediaParts(msg.ContentParts) && cfg.LLM.VisionModel != "" &&
+	if llm.HasMedia(msg.ContentParts) && cfg.LLM.VisionModel != "" &&
 		(cfg.LLM.MediaDescriptions == nil || *cfg.LLM.MediaDescriptions) {
 		a.annotateMediaDescription(ctx, cfg, msg)
 		stripMediaParts(msg)
 	}
 }
 
-// hasMediaParts reports whether parts contains at least one image or video part.
-func hasMediaParts(parts []llm.ContentPart) bool {
-	for _, p := range parts {
-		if p.Type == "image_url" || p.Type == "video_url" {
-			return true
-		}
-	}
-	return false
-}
-
 // stripMediaParts removes image and video content parts from msg, keeping only
 // text parts. Called after annotateMediaDescription so that the main chat model
 // sees the injected text description without the raw media blobs — preventing
@@ -865,13 +995,13 @@ func (a *ChannelAgent) annotateMediaDescription(ctx context.Context, cfg *config
 }
 
 // buildCombinedContent builds the combined user content string for a batch of coalesced messages.
-func buildCombinedContent(msgs []*discordgo.MessageCreate, botID, botName string) string {
+func buildCombinedContent(files *fileTextCache, msgs []*discordgo.MessageCreate, botID, botName string) string {
 	firstTime := msgs[0].Timestamp
 	lines := make([]string, 0, len(msgs)+2)
 	lines = append(lines, fmt.Sprintf("[%d messages arrived rapidly in quick succession]", len(msgs)))
 	lines = append(lines, "")
 	for _, m := range msgs {
-		line := historyUserContent(m.Message, botID, botName)
+		line := historyUserContent(files, m.Message, botID, botName)
 		gap := m.Timestamp.Sub(firstTime)
 		if gap >= time.Second {
 			secs := int(gap.Seconds())
@@ -891,8 +1021,7 @@ func (a *ChannelAgent) handleMessages(ctx context.Context, msgs []*discordgo.Mes
 	a.lastActive.Store(time.Now().UnixNano())
 
 	cfg := a.cfgStore.Get()
-	botID := a.resources.Session.State.User.ID
-	botName := a.resources.Session.State.User.Username
+	botID, botName := a.botIdentity()
 	lastMsg := msgs[len(msgs)-1]
 	mode := cfg.ResolveResponseMode(a.serverID, lastMsg.ChannelID)
 
@@ -948,11 +1077,13 @@ func (a *ChannelAgent) handleMessages(ctx context.Context, msgs []*discordgo.Mes
 		lastAuthorID = lastMsg.Author.ID
 	}
 	memories := a.recallMemories(ctx, cfg, lastAuthorID, recallQuery)
+	reference := a.recallKnowledge(ctx, cfg, recallQuery)
+	a.refreshSoul()
 
-	systemPrompt := a.buildSystemPrompt(cfg, mode, lastMsg.ChannelID, memories, botName, anyAddressed, allDirectedAtOther)
+	systemPrompt := a.buildSystemPrompt(cfg, mode, lastMsg.ChannelID, memories, reference, botName, anyAddressed, allDirectedAtOther)
 
 	sendFn := a.rateLimitedSendFn(func(content string) error {
-		_, err := a.resources.Session.ChannelMessageSend(lastMsg.ChannelID, content)
+		_, err := a.resources.Session.ChannelMessageSend(lastMsg.ChannelID, a.sign(content))
 		return err
 	})
 	reactFn := func(emoji string) error {
@@ -962,9 +1093,20 @@ func (a *ChannelAgent) handleMessages(ctx context.Context, msgs []*discordgo.Mes
 	if a.imageGenConfigured(cfg) {
 		sourceImageURLs = collectImageDataURLsFromMessages(ctx, a.httpClient, msgs)
 	}
-	reg := tools.NewDefaultRegistry(a.resources.Memory, a.serverID, cfg.Agent.MemoryDedupThreshold, cfg.Agent.MemoryRecallLimit, sendFn, reactFn, a.webSearchDeps(), a.imageGenDeps(a.makeSendImageFn(lastMsg.ChannelID), sendFn, sourceImageURLs, lastMsg.ChannelID, lastMsg.ID), cfg.Agent.MaxReplyParts)
+	reg := tools.NewDefaultRegistry(a.resources.Memory, a.memoryScope, cfg.Agent.MemoryDedupThreshold, cfg.Agent.MemoryRecallLimit, sendFn, reactFn, a.webSearchDeps(), a.imageGenDeps(a.makeSendImageFn(lastMsg.ChannelID), sendFn, sourceImageURLs, lastMsg), cfg.Agent.MaxReplyParts, a.agentToolsDeps(ctx, toolPolicies(cfg, a.serverID, channelLineage(a.resources.Session, lastMsg.ChannelID))))
+	for _, m := range msgs {
+		if m.Author != nil && !slices.Contains(reg.Requesters, m.Author.ID) {
+			reg.Requesters = append(reg.Requesters, m.Author.ID)
+		}
+	}
+	a.registerExternalTools(ctx, reg)
 
 	combinedUserMsg := a.buildCombinedUserMessage(ctx, msgs, botID, botName)
+	discordMsgs := make([]*discordgo.Message, len(msgs))
+	for i, m := range msgs {
+		discordMsgs[i] = m.Message
+	}
+	appendContentParts(&combinedUserMsg, a.textAttachmentParts(ctx, cfg, discordMsgs))
 	a.annotateAndStripMedia(ctx, cfg, &combinedUserMsg)
 
 	llmMsgs := make([]llm.Message, len(a.history), len(a.history)+1)
@@ -973,7 +1115,7 @@ func (a *ChannelAgent) handleMessages(ctx context.Context, msgs []*discordgo.Mes
 
 	userLogLines := make([]string, 0, len(msgs))
 	for _, m := range msgs {
-		userLogLines = append(userLogLines, historyUserContent(m.Message, botID, botName))
+		userLogLines = append(userLogLines, historyUserContent(a.files, m.Message, botID, botName))
 	}
 
 	a.processTurn(ctx, cfg, turnParams{
@@ -1002,7 +1144,7 @@ func (a *ChannelAgent) handleInternalMessage(ctx context.Context, content string
 	// Build a focused system prompt — no soul/personality/memories to avoid
 	// the LLM re-generating its earlier conversational response.
 	var sb strings.Builder
-	botName := a.resources.Session.State.User.Username
+	_, botName := a.botIdentity()
 	if botName != "" {
 		fmt.Fprintf(&sb, "Your Discord username is %s.\n\n", botName)
 	}
@@ -1012,7 +1154,7 @@ func (a *ChannelAgent) handleInternalMessage(ctx context.Context, content string
 	}
 
 	sendFn := a.rateLimitedSendFn(func(text string) error {
-		_, err := a.resources.Session.ChannelMessageSend(a.channelID, text)
+		_, err := a.resources.Session.ChannelMessageSend(a.channelID, a.sign(text))
 		return err
 	})
 	reactFn := func(emoji string) error { return nil }
@@ -1052,18 +1194,28 @@ func (a *ChannelAgent) recallMemories(ctx context.Context, cfg *config.Config, u
 	var userMems []memory.MemoryRow
 	if userID != "" {
 		var err error
-		userMems, err = a.resources.Memory.RecallByUser(ctx, a.serverID, userID, limit/2)
+		userMems, err = a.resources.Memory.RecallByUser(ctx, a.memoryScope, userID, limit/2)
 		if err != nil {
 			a.logger.Warn("user memory recall error", "error", err)
 		}
 	}
-	contentMems, err := a.resources.Memory.Recall(ctx, contentQuery, a.serverID, limit, cfg.Agent.MemoryRecallThreshold)
+	contentMems, err := a.resources.Memory.Recall(ctx, contentQuery, a.memoryScope, limit, cfg.Agent.MemoryRecallThreshold)
 	if err != nil {
 		a.logger.Warn("content memory recall error", "error", err)
 	}
 	return mergeMemories(userMems, contentMems, limit)
 }
 
+// recallKnowledge returns the knowledge base passages most relevant to the
+// turn. Knowledge belongs to the agent, so personas share it.
+func (a *ChannelAgent) recallKnowledge(ctx context.Context, cfg *config.Config, query string) []memory.KnowledgeChunk {
+	chunks, err := a.resources.Memory.SearchKnowledge(ctx, query, a.serverID, cfg.Agent.KnowledgeRecallLimit, cfg.Agent.MemoryRecallThreshold)
+	if err != nil {
+		a.logger.Warn("knowledge recall error", "error", err)
+	}
+	return chunks
+}
+
 // mergeMemories combines user-specific and content-relevant memories,
 // deduplicating by ID. User-specific memories appear first. Result is
 // capped at limit.
@@ -1093,8 +1245,8 @@ func mergeMemories(userMems, contentMems []memory.MemoryRow, limit int) []memory
 }
 
 // buildSystemPrompt assembles the system prompt from the soul text, memories,
-// language override, and response mode.
-func (a *ChannelAgent) buildSystemPrompt(cfg *config.Config, mode, channelID string, memories []memory.MemoryRow, botName string, addressed, directedAtOther bool) string {
+// knowledge base passages, language override, and response mode.
+func (a *ChannelAgent) buildSystemPrompt(cfg *config.Config, mode, channelID string, memories []memory.MemoryRow, reference []memory.KnowledgeChunk, botName string, addressed, directedAtOther bool) string {
 	var sb strings.Builder
 	if botName != "" {
 		fmt.Fprintf(&sb, "Your Discord username is %s.\n\n", botName)
@@ -1132,6 +1284,12 @@ func (a *ChannelAgent) buildSystemPrompt(cfg *config.Config, mode, channelID str
 			fmt.Fprintf(&sb, "- [%s] (importance: %.1f, %s) %s\n", m.ID, m.Importance, ageStr, m.Content)
 		}
 	}
+	if len(reference) > 0 {
+		sb.WriteString("\n\n## Reference\nPassages from this server's knowledge base. Answer from them rather than guessing, and cite the bracketed source of any passage you use.\n")
+		for _, c := range reference {
+			fmt.Fprintf(&sb, "\n[%s]\n%s\n", c.Citation(), c.Content)
+		}
+	}
 	if lang := cfg.ResolveLanguage(a.serverID, channelID); lang != "" {
 		fmt.Fprintf(&sb, "\n\nAlways respond in %s.", lang)
 	}
@@ -1150,7 +1308,7 @@ func (a *ChannelAgent) buildSystemPrompt(cfg *config.Config, mode, channelID str
 // buildCombinedUserMessage builds an LLM user message from a batch of coalesced
 // Discord messages, collecting text, image, and video attachments.
 func (a *ChannelAgent) buildCombinedUserMessage(ctx context.Context, msgs []*discordgo.MessageCreate, botID, botName string) llm.Message {
-	combinedContent := buildCombinedContent(msgs, botID, botName)
+	combinedContent := buildCombinedContent(a.files, msgs, botID, botName)
 
 	var mediaParts []llm.ContentPart
 	for _, m := range msgs {
@@ -1236,31 +1394,143 @@ func (a *ChannelAgent) chatOptions() *llm.ChatOptions {
 	return &llm.ChatOptions{Provider: agentCfg.Provider, Model: agentCfg.Model, MaxTokens: maxTokens}
 }
 
-// webSearchDeps returns the dependency bundle for the async web search tool,
-// or nil if web search is not configured (no GLM key or Brave key).
-func (a *ChannelAgent) webSearchDeps() *tools.WebSearchDeps {
+// registerExternalTools adds the tools of the plugins and MCP servers the agent
+// opted into to reg. Plugin processes and MCP connections are shared by all
+// channels of the agent.
+func (a *ChannelAgent) registerExternalTools(ctx context.Context, reg *tools.Registry) {
+	agentCfg := a.currentAgentConfig()
+	if a.plugins == nil || agentCfg == nil {
+		return
+	}
 	cfg := a.cfgStore.Get()
+	var specs []tools.PluginSpec
+	for _, name := range agentCfg.Plugins {
+		for _, p := range cfg.Tools.Plugins {
+			if p.Name != name {
+				continue
+			}
+			specs = append(specs, tools.PluginSpec{
+				Name:    p.Name,
+				Command: config.ExpandPath(p.Command),
+				Args:    p.Args,
+				Env:     expandEnvList(p.Env),
+				Timeout: time.Duration(p.TimeoutSeconds) * time.Second,
+			})
+		}
+	}
+	a.plugins.Register(ctx, reg, a.serverID, specs)
 
-	// Check if search is configured at all
-	hasGLM := cfg.LLM.GLMKey != ""
-	hasBrave := cfg.Tools.Search.Provider == "brave" && cfg.Tools.Search.APIKey != ""
+	var selections []tools.MCPSelection
+	for _, sel := range agentCfg.MCP {
+		for _, m := range cfg.Tools.MCP {
+			if m.Name != sel.Server {
+				continue
+			}
+			spec := tools.MCPServerSpec{
+				Name:    m.Name,
+				Args:    m.Args,
+				Env:     expandEnvList(m.Env),
+				URL:     m.URL,
+				Timeout: time.Duration(m.TimeoutSeconds) * time.Second,
+			}
+			if m.Command != "" {
+				spec.Command = config.ExpandPath(m.Command)
+			}
+			if len(m.Headers) > 0 {
+				spec.Headers = make(map[string]string, len(m.Headers))
+				for k, v := range m.Headers {
+					spec.Headers[k] = os.ExpandEnv(v)
+				}
+			}
+			selections = append(selections, tools.MCPSelection{Server: spec, Tools: sel.Tools})
+		}
+	}
+	a.plugins.RegisterMCP(ctx, reg, a.serverID, selections)
+}
 
-	if !hasGLM && !hasBrave {
-		slog.Warn("web_search tool disabled: no search provider configured", "server_id", a.serverID)
+// expandEnvList turns an env table into sorted KEY=VALUE entries with $VAR
+// references expanded. The stable order keeps unchanged specs on their process.
+func expandEnvList(env map[string]string) []string {
+	out := make([]string, 0, len(env))
+	for k, v := range env {
+		out = append(out, k+"="+os.ExpandEnv(v))
+	}
+	slices.Sort(out)
+	return out
+}
+
+// agentToolsDeps returns the agent's declarative tools, the given tool policies
+// and its knowledge base for the registry, or nil if there are none. Header
+// values are expanded from the environment here so secrets never have to be
+// written into the config file.
+func (a *ChannelAgent) agentToolsDeps(ctx context.Context, policies []tools.ToolPolicy) *tools.AgentToolsDeps {
+	var httpTools []config.HTTPToolConfig
+	if agentCfg := a.currentAgentConfig(); agentCfg != nil {
+		httpTools = agentCfg.Tools.HTTP
+	}
+	var knowledgeScope string
+	if a.resources.Memory != nil {
+		has, err := a.resources.Memory.HasKnowledge(ctx, a.serverID)
+		if err != nil {
+			a.logger.Warn("knowledge base check failed", "error", err)
+		}
+		if has {
+			knowledgeScope = a.serverID
+		}
+	}
+	if len(httpTools) == 0 && len(policies) == 0 && knowledgeScope == "" {
 		return nil
 	}
+	deps := &tools.AgentToolsDeps{Policies: policies, KnowledgeScope: knowledgeScope}
+	for _, t := range httpTools {
+		spec := tools.HTTPToolSpec{
+			Name:        t.Name,
+			Description: t.Description,
+			Method:      t.Method,
+			URL:         t.URL,
+			Extract:     t.Extract,
+			MaxLength:   t.MaxLength,
+			Timeout:     time.Duration(t.TimeoutSeconds) * time.Second,
+		}
+		if t.Parameters != nil {
+			params, err := json.Marshal(t.Parameters)
+			if err != nil {
+				slog.Warn("http tool skipped: invalid parameters schema", "error", err, "server_id", a.serverID, "tool", t.Name)
+				continue
+			}
+			spec.Parameters = params
+		}
+		if len(t.Headers) > 0 {
+			spec.Headers = make(map[string]string, len(t.Headers))
+			for k, v := range t.Headers {
+				spec.Headers[k] = os.ExpandEnv(v)
+			}
+		}
+		deps.HTTP = append(deps.HTTP, spec)
+	}
+	return deps
+}
+
+// webSearchDeps returns the dependency bundle for the web search tool,
+// or nil if none of the configured search providers is usable.
+func (a *ChannelAgent) webSearchDeps() *tools.WebSearchDeps {
+	cfg := a.cfgStore.Get()
 
-	// Resolve the model: use the agent's configured model when available.
-	model := cfg.LLM.Model
-	if agentCfg := a.currentAgentConfig(); agentCfg != nil && agentCfg.Model != "" {
-		model = agentCfg.Model
+	providers := a.searchProviders(cfg)
+	if len(providers) == 0 {
+		slog.Warn("web_search tool disabled: no search provider configured", "server_id", a.serverID)
+		return nil
 	}
 
-	// Use Brave timeout if configured, otherwise use web timeout
+	// Use the search timeout if configured, otherwise use web timeout
 	timeout := cfg.Tools.WebTimeoutSeconds
 	if cfg.Tools.Search.Timeout > 0 {
 		timeout = cfg.Tools.Search.Timeout
 	}
+	fetchClient := a.fetchClient
+	if fetchClient == nil {
+		fetchClient = a.httpClient
+	}
 
 	return &tools.WebSearchDeps{
 		DeliverResult: func(result string) {
@@ -1270,90 +1540,133 @@ func (a *ChannelAgent) webSearchDeps() *tools.WebSearchDeps {
 				a.logger.Warn("internal channel full, dropping web search result")
 			}
 		},
-		LLM:            a.llm,
-		Model:          model,
 		Ctx:            a.ctx,
 		SearchWg:       &a.searchWg,
 		SearchRunning:  &a.searchRunning,
 		TimeoutSeconds: timeout,
-		SearchProvider: cfg.Tools.Search.Provider,
-		SearchAPIKey:   cfg.Tools.Search.APIKey,
+		Providers:      providers,
+		Sync:           cfg.ResolveSearchMode(a.serverID) == config.SearchModeSync,
+		HTTPClient:     fetchClient,
+		Cache:          a.webCache,
+		SearchCacheTTL: time.Duration(cfg.Tools.Cache.SearchTTLMinutes) * time.Minute,
 	}
 }
 
+// searchProviders builds the agent's search providers in fallback order: the
+// agent's own list, else tools.search.providers, else tools.search.provider.
+// Providers missing their credentials are skipped.
+func (a *ChannelAgent) searchProviders(cfg *config.Config) []tools.SearchProvider {
+	names := []string{cfg.Tools.Search.Provider}
+	if len(cfg.Tools.Search.Providers) > 0 {
+		names = cfg.Tools.Search.Providers
+	}
+	if agentCfg := a.currentAgentConfig(); agentCfg != nil && len(agentCfg.Search.Providers) > 0 {
+		names = agentCfg.Search.Providers
+	}
+
+	// Search APIs are declared by the operator, so like the image providers
+	// they bypass the outbound network policy meant for model-chosen URLs.
+	var providers []tools.SearchProvider
+	for _, name := range names {
+		switch name {
+		case "brave":
+			if cfg.Tools.Search.APIKey != "" {
+				providers = append(providers, tools.NewBraveSearch(cfg.Tools.Search.APIKey, nil))
+			}
+		case "glm":
+			if cfg.LLM.GLMKey != "" {
+				providers = append(providers, tools.NewGLMSearch(cfg.LLM.GLMBaseURL, cfg.LLM.GLMKey, nil))
+			}
+		case "searxng":
+			// SearXNG is usually self-hosted on the local network.
+			if cfg.Tools.Search.SearXNGURL != "" {
+				providers = append(providers, tools.NewSearXNGSearch(cfg.Tools.Search.SearXNGURL, nil))
+			}
+		case "knowledge":
+			providers = append(providers, tools.NewKnowledgeSearch(a.resources.Memory, a.serverID, cfg.Agent.MemoryRecallThreshold))
+		}
+	}
+	return providers
+}
+
 func (a *ChannelAgent) makeSendImageFn(channelID string) tools.SendImageFunc {
-	return func(filename string, data io.Reader, caption string) error {
-		_, err := a.resources.Session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
-			Content: caption,
-			Files:   []*discordgo.File{{Name: filename, Reader: data}},
-		})
-		return err
+	return func(files []tools.ImageFile, caption string) (string, error) {
+		msg := &discordgo.MessageSend{Content: caption}
+		for _, f := range files {
+			msg.Files = append(msg.Files, &discordgo.File{Name: f.Name, Reader: f.Data})
+		}
+		sent, err := a.resources.Session.ChannelMessageSendComplex(channelID, msg)
+		if err != nil {
+			return "", err
+		}
+		return sent.ID, nil
 	}
 }
 
 func (a *ChannelAgent) imageGenConfigured(cfg *config.Config) bool {
-	if cfg.Tools.Image.APIKey != "" {
-		return true
-	}
-	if agentCfg := a.currentAgentConfig(); agentCfg != nil && agentCfg.Image.APIKey != "" {
-		return true
-	}
-	return false
+	return cfg.ResolveImageConfig(a.serverID).Usable()
 }
 
-func (a *ChannelAgent) imageGenDeps(sendImage tools.SendImageFunc, sendText tools.SendFunc, sourceImageURLs []string, sourceChannelID, sourceMessageID string) *tools.ImageGenDeps {
+func (a *ChannelAgent) imageGenDeps(sendImage tools.SendImageFunc, sendText tools.SendFunc, sourceImageURLs []string, msg *discordgo.MessageCreate) *tools.ImageGenDeps {
 	cfg := a.cfgStore.Get()
 
 	// Resolve per-agent overrides over global config.
-	apiKey := cfg.Tools.Image.APIKey
-	model := cfg.Tools.Image.Model
-	editModel := cfg.Tools.Image.EditModel
-	resolution := cfg.Tools.Image.Resolution
-	safetyChecker := true
-	if cfg.Tools.Image.EnableSafetyChecker != nil {
-		safetyChecker = *cfg.Tools.Image.EnableSafetyChecker
-	}
-	if agentCfg := a.currentAgentConfig(); agentCfg != nil {
-		if agentCfg.Image.APIKey != "" {
-			apiKey = agentCfg.Image.APIKey
-		}
-		if agentCfg.Image.Model != "" {
-			model = agentCfg.Image.Model
-		}
-		if agentCfg.Image.EditModel != "" {
-			editModel = agentCfg.Image.EditModel
-		}
-		if agentCfg.Image.Resolution != "" {
-			resolution = agentCfg.Image.Resolution
-		}
-		if agentCfg.Image.EnableSafetyChecker != nil {
-			safetyChecker = *agentCfg.Image.EnableSafetyChecker
-		}
+	img := cfg.ResolveImageConfig(a.serverID)
+	if !img.Usable() || a.resources.Images == nil {
+		return nil
 	}
 
-	if apiKey == "" {
-		return nil
+	// Without a message (tool reports), the agent's defaults apply.
+	var userID, sourceChannelID, sourceMessageID string
+	safety := cfg.ResolveImageSafety(a.serverID, nil)
+	var allowUnscreened bool
+	dailyLimit := img.DailyLimit
+	if msg != nil {
+		userID, sourceChannelID, sourceMessageID = msg.Author.ID, msg.ChannelID, msg.ID
+		lineage := channelLineage(a.resources.Session, msg.ChannelID)
+		safety = cfg.ResolveImageSafety(a.serverID, lineage)
+		allowUnscreened = cfg.ResolveImageAllowUnscreened(a.serverID, lineage)
+		if safety == config.ImageSafetyNSFW && msg.GuildID != "" && !channelNSFW(a.resources.Session, msg.ChannelID) {
+			safety = config.ImageSafetyStrict
+		}
+		dailyLimit = cfg.ResolveImageDailyLimit(a.serverID, userID, memberRoles(a.resources.Session, msg))
 	}
 	return &tools.ImageGenDeps{
 		SendImage:       sendImage,
 		SendText:        sendText,
 		ImageWg:         &a.imageWg,
-		ImageRunning:    &a.imageRunning,
+		Queue:           a.resources.Images,
 		Ctx:             a.ctx,
-		APIKey:          apiKey,
-		Model:           model,
-		EditModel:       editModel,
+		Provider:        newImageProvider(img),
 		SourceImageURLs: sourceImageURLs,
-		Resolution:      resolution,
-		SafetyChecker:   safetyChecker,
+		Resolution:      img.Resolution,
+		SafetyChecker:   safety != config.ImageSafetyNSFW,
+		AllowUnscreened: allowUnscreened,
+		Disabled:        safety == config.ImageSafetyDisabled,
+		DailyLimit:      dailyLimit,
 		TimeoutSeconds:  cfg.Tools.Image.TimeoutSeconds,
 		VisualStore:     a.resources.Memory,
-		ServerID:        a.serverID,
+		ServerID:        a.memoryScope,
+		GalleryServerID: a.serverID,
+		UserID:          userID,
 		SourceChannelID: sourceChannelID,
 		SourceMessageID: sourceMessageID,
 	}
 }
 
+// newImageProvider returns the image provider img selects. Image APIs are
+// declared by the operator, so they bypass the outbound network policy.
+func newImageProvider(img config.ImageConfig) tools.ImageProvider {
+	switch img.Provider {
+	case config.ImageProviderOpenAI:
+		return tools.NewOpenAIImageProvider(img.BaseURL, img.APIKey, img.Model, img.EditModel, img.Moderated, nil)
+	case config.ImageProviderA1111:
+		return tools.NewA1111ImageProvider(img.BaseURL, img.Model, nil)
+	default:
+		return tools.NewFalImageProvider(img.BaseURL, img.APIKey, img.Model, img.EditModel, nil)
+	}
+}
+
 // processTurn runs the tool-call loop, applies content suppression, logs the
 // conversation, sends the reply, and updates history. Both handleMessage and
 // handleMessages delegate here after preparing their inputs.
@@ -1515,7 +1828,7 @@ func (a *ChannelAgent) processTurn(ctx context.Context, cfg *config.Config, tp t
 	}
 
 	if assistantContent != "" && !tp.reg.Replied {
-		parts := tools.SplitAndCapMessage(assistantContent, 2000, cfg.Agent.MaxReplyParts)
+		parts := tools.SplitAndCapMessage(tp.reg.Cite(assistantContent), 2000, cfg.Agent.MaxReplyParts)
 		for _, p := range parts {
 			if err := tp.sendFn(p); err != nil {
 				a.logger.Error("send message", "error", err)
@@ -1588,7 +1901,7 @@ func (a *ChannelAgent) runMemoryExtraction(ctx context.Context, history []llm.Me
 	}
 
 	snapshot := stripImageParts(history)
-	reg := tools.NewMemoryOnlyRegistry(a.resources.Memory, a.serverID, a.cfgStore.Get().Agent.MemoryDedupThreshold, a.cfgStore.Get().Agent.MemoryRecallLimit)
+	reg := tools.NewMemoryOnlyRegistry(a.resources.Memory, a.memoryScope, a.cfgStore.Get().Agent.MemoryDedupThreshold, a.cfgStore.Get().Agent.MemoryRecallLimit)
 
 	a.extractionWg.Add(1)
 	go func() {
@@ -1638,12 +1951,7 @@ func stripImageParts(history []llm.Message) []llm.Message {
 		if len(snapshot[i].ContentParts) == 0 {
 			continue
 		}
-		for _, p := range snapshot[i].ContentParts {
-			if p.Type == "text" {
-				snapshot[i].Content = p.Text
-				break
-			}
-		}
+		snapshot[i].Content = llm.JoinText(snapshot[i].ContentParts)
 		snapshot[i].ContentParts = nil
 	}
 	return snapshot
@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -14,6 +18,8 @@ import (
 
 	"github.com/tomasmach/vespra/config"
 	"github.com/tomasmach/vespra/llm"
+	"github.com/tomasmach/vespra/memory"
+	"github.com/tomasmach/vespra/netguard"
 	"github.com/tomasmach/vespra/tools"
 )
 
@@ -47,7 +53,7 @@ func imageServer(t *testing.T, fakeData []byte) (*httptest.Server, func()) {
 }
 
 func TestBuildUserMessageTextOnly(t *testing.T) {
-	m := buildUserMessage(context.Background(), nil, msg("hello"), "", "")
+	m := buildUserMessage(context.Background(), nil, nil, msg("hello"), "", "")
 	if m.Role != "user" {
 		t.Errorf("expected role=user, got %q", m.Role)
 	}
@@ -65,7 +71,7 @@ func TestBuildUserMessageWithImage(t *testing.T) {
 	defer cleanup()
 
 	a := attachment("image/png", srv.URL+"/img.png")
-	m := buildUserMessage(context.Background(), srv.Client(), msg("look", a), "", "")
+	m := buildUserMessage(context.Background(), srv.Client(), nil, msg("look", a), "", "")
 	if len(m.ContentParts) != 2 {
 		t.Fatalf("expected 2 content parts, got %d", len(m.ContentParts))
 	}
@@ -82,7 +88,7 @@ func TestBuildUserMessageWithImage(t *testing.T) {
 }
 
 func TestBuildUserMessageNonImageAttachmentIgnored(t *testing.T) {
-	m := buildUserMessage(context.Background(), nil, msg("file", attachment("application/pdf", "https://cdn.example.com/doc.pdf")), "", "")
+	m := buildUserMessage(context.Background(), nil, nil, msg("file", attachment("application/zip", "https://cdn.example.com/archive.zip")), "", "")
 	if len(m.ContentParts) != 0 {
 		t.Errorf("expected no content parts for non-image, got %d", len(m.ContentParts))
 	}
@@ -96,7 +102,7 @@ func TestBuildUserMessageMixedAttachments(t *testing.T) {
 	srv, cleanup := imageServer(t, fakeData)
 	defer cleanup()
 
-	m := buildUserMessage(context.Background(), srv.Client(), msg("mixed",
+	m := buildUserMessage(context.Background(), srv.Client(), nil, msg("mixed",
 		attachment("image/jpeg", srv.URL+"/photo.jpg"),
 		attachment("application/pdf", "https://cdn.example.com/doc.pdf"),
 		attachment("image/webp", srv.URL+"/pic.webp"),
@@ -109,7 +115,7 @@ func TestBuildUserMessageMixedAttachments(t *testing.T) {
 func TestBuildUserMessageImageDownloadFails(t *testing.T) {
 	// Use an unreachable URL to simulate download failure
 	a := attachment("image/png", "http://127.0.0.1:1") // nothing listening
-	m := buildUserMessage(context.Background(), &http.Client{}, msg("look", a), "", "")
+	m := buildUserMessage(context.Background(), &http.Client{}, nil, msg("look", a), "", "")
 	// All images failed → falls back to plain text
 	if len(m.ContentParts) != 0 {
 		t.Errorf("expected no content parts when download fails, got %d", len(m.ContentParts))
@@ -124,7 +130,7 @@ func TestBuildUserMessageEmptyText(t *testing.T) {
 	srv, cleanup := imageServer(t, fakeData)
 	defer cleanup()
 
-	m := buildUserMessage(context.Background(), srv.Client(), msg("", attachment("image/gif", srv.URL+"/anim.gif")), "", "")
+	m := buildUserMessage(context.Background(), srv.Client(), nil, msg("", attachment("image/gif", srv.URL+"/anim.gif")), "", "")
 	if len(m.ContentParts) != 2 {
 		t.Fatalf("expected 2 parts, got %d", len(m.ContentParts))
 	}
@@ -142,7 +148,7 @@ func TestHistoryUserContentNoReply(t *testing.T) {
 		Author:  &discordgo.User{Username: "alice"},
 		Content: "hello",
 	}
-	got := historyUserContent(m, "", "")
+	got := historyUserContent(nil, m, "", "")
 	want := "alice: hello"
 	if got != want {
 		t.Errorf("got %q, want %q", got, want)
@@ -158,7 +164,7 @@ func TestHistoryUserContentWithReply(t *testing.T) {
 			Content: "What do you think?",
 		},
 	}
-	got := historyUserContent(m, "", "")
+	got := historyUserContent(nil, m, "", "")
 	want := `alice (replying to bob: "What do you think?"): I agree`
 	if got != want {
 		t.Errorf("got %q, want %q", got, want)
@@ -177,7 +183,7 @@ func TestHistoryUserContentReplyWithImageOnly(t *testing.T) {
 			},
 		},
 	}
-	got := historyUserContent(m, "", "")
+	got := historyUserContent(nil, m, "", "")
 	want := `alice (replying to bob: "[image]"): nice`
 	if got != want {
 		t.Errorf("got %q, want %q", got, want)
@@ -191,7 +197,7 @@ func TestHistoryUserContentReplyNoAuthor(t *testing.T) {
 		Content:           "hello",
 		ReferencedMessage: &discordgo.Message{},
 	}
-	got := historyUserContent(m, "", "")
+	got := historyUserContent(nil, m, "", "")
 	want := "alice: hello"
 	if got != want {
 		t.Errorf("got %q, want %q", got, want)
@@ -217,7 +223,7 @@ func TestBuildUserMessageReferencedImage(t *testing.T) {
 			ReferencedMessage: refMsg,
 		},
 	}
-	result := buildUserMessage(context.Background(), srv.Client(), m, "", "")
+	result := buildUserMessage(context.Background(), srv.Client(), nil, m, "", "")
 	if len(result.ContentParts) != 2 {
 		t.Fatalf("expected 2 content parts (text + ref image), got %d", len(result.ContentParts))
 	}
@@ -299,7 +305,7 @@ func TestBuildCombinedContentHeader(t *testing.T) {
 		msgAt("bob", "world", now),
 		msgAt("alice", "again", now),
 	}
-	got := buildCombinedContent(msgs, "", "")
+	got := buildCombinedContent(nil, msgs, "", "")
 	firstLine := strings.Split(got, "\n")[0]
 	want := "[3 messages arrived rapidly in quick succession]"
 	if firstLine != want {
@@ -314,7 +320,7 @@ func TestBuildCombinedContentMessageLines(t *testing.T) {
 		msgAt("bob", "world", now),
 		msgAt("alice", "again", now),
 	}
-	got := buildCombinedContent(msgs, "", "")
+	got := buildCombinedContent(nil, msgs, "", "")
 	lines := strings.Split(got, "\n")
 	// lines[0] = header, lines[1] = blank, lines[2..4] = messages
 	if len(lines) != 5 {
@@ -341,7 +347,7 @@ func TestBuildCombinedContentTimestampOnlyWhenGapAtLeastOneSecond(t *testing.T)
 		msgAt("bob", "quick", base.Add(500*time.Millisecond)),
 		msgAt("alice", "later", base.Add(2*time.Second)),
 	}
-	got := buildCombinedContent(msgs, "", "")
+	got := buildCombinedContent(nil, msgs, "", "")
 	lines := strings.Split(got, "\n")
 	// lines[2] = first message (no timestamp, it is the reference)
 	// lines[3] = second message (gap < 1s, no timestamp)
@@ -364,7 +370,7 @@ func TestBuildCombinedContentSingleMessage(t *testing.T) {
 	msgs := []*discordgo.MessageCreate{
 		msgAt("alice", "solo", now),
 	}
-	got := buildCombinedContent(msgs, "", "")
+	got := buildCombinedContent(nil, msgs, "", "")
 	if !strings.HasPrefix(got, "[1 messages arrived rapidly in quick succession]") {
 		t.Errorf("unexpected output for single message: %q", got)
 	}
@@ -389,7 +395,7 @@ func TestHistoryUserContentReplyWithVideoOnly(t *testing.T) {
 			},
 		},
 	}
-	got := historyUserContent(m, "", "")
+	got := historyUserContent(nil, m, "", "")
 	want := `alice (replying to bob: "[video]"): nice`
 	if got != want {
 		t.Errorf("got %q, want %q", got, want)
@@ -409,7 +415,7 @@ func TestHistoryUserContentReplyWithImageAndVideo(t *testing.T) {
 			},
 		},
 	}
-	got := historyUserContent(m, "", "")
+	got := historyUserContent(nil, m, "", "")
 	want := `alice (replying to bob: "[image], [video]"): cool`
 	if got != want {
 		t.Errorf("got %q, want %q", got, want)
@@ -422,7 +428,7 @@ func TestBuildUserMessageWithVideo(t *testing.T) {
 	defer cleanup()
 
 	a := attachment("video/mp4", srv.URL+"/clip.mp4")
-	m := buildUserMessage(context.Background(), srv.Client(), msg("watch this", a), "", "")
+	m := buildUserMessage(context.Background(), srv.Client(), nil, msg("watch this", a), "", "")
 	if len(m.ContentParts) != 2 {
 		t.Fatalf("expected 2 content parts, got %d", len(m.ContentParts))
 	}
@@ -457,7 +463,7 @@ func TestBuildUserMessageReferencedVideo(t *testing.T) {
 			ReferencedMessage: refMsg,
 		},
 	}
-	result := buildUserMessage(context.Background(), srv.Client(), m, "", "")
+	result := buildUserMessage(context.Background(), srv.Client(), nil, m, "", "")
 	if len(result.ContentParts) != 2 {
 		t.Fatalf("expected 2 content parts (text + ref video), got %d", len(result.ContentParts))
 	}
@@ -475,7 +481,7 @@ func TestBuildUserMessageReferencedVideo(t *testing.T) {
 
 func TestBuildUserMessageVideoSkippedWhenTooLarge(t *testing.T) {
 	a := attachmentWithSize("video/mp4", "https://cdn.example.com/huge.mp4", maxVideoBytes+1)
-	m := buildUserMessage(context.Background(), &http.Client{}, msg("big video", a), "", "")
+	m := buildUserMessage(context.Background(), &http.Client{}, nil, msg("big video", a), "", "")
 	// oversized video skipped → falls back to plain text
 	if len(m.ContentParts) != 0 {
 		t.Errorf("expected no content parts for oversized video, got %d", len(m.ContentParts))
@@ -531,7 +537,7 @@ func TestHistoryUserContentReplyWithGif(t *testing.T) {
 			},
 		},
 	}
-	got := historyUserContent(m, "", "")
+	got := historyUserContent(nil, m, "", "")
 	want := `alice (replying to bob: "[gif]"): look`
 	if got != want {
 		t.Errorf("got %q, want %q", got, want)
@@ -558,7 +564,7 @@ func TestBuildUserMessageWithGifEmbed(t *testing.T) {
 			},
 		},
 	}
-	m := buildUserMessage(context.Background(), srv.Client(), gifMsg, "", "")
+	m := buildUserMessage(context.Background(), srv.Client(), nil, gifMsg, "", "")
 	if len(m.ContentParts) != 2 {
 		t.Fatalf("expected 2 content parts (text + gif thumbnail), got %d", len(m.ContentParts))
 	}
@@ -586,7 +592,7 @@ func TestBuildUserMessageGifEmbedNoThumbnail(t *testing.T) {
 			},
 		},
 	}
-	m := buildUserMessage(context.Background(), nil, gifMsg, "", "")
+	m := buildUserMessage(context.Background(), nil, nil, gifMsg, "", "")
 	if len(m.ContentParts) != 0 {
 		t.Errorf("expected no content parts for gifv embed with nil thumbnail, got %d", len(m.ContentParts))
 	}
@@ -648,6 +654,58 @@ func TestBuildCombinedUserMessageWithGifEmbed(t *testing.T) {
 	}
 }
 
+func TestSearchProvidersBypassNetworkPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"search_result":[{"title":"Go","link":"https://go.dev","content":"The Go language."}]}`))
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{
+		LLM:   config.LLMConfig{GLMKey: "glm-key", GLMBaseURL: srv.URL},
+		Tools: config.ToolsConfig{Search: config.SearchConfig{Provider: "glm"}},
+	}
+	cfg.Tools.Network.AllowDomains = []string{"wikipedia.org"}
+	cfgStore := config.NewStoreFromConfig(cfg)
+	a := &ChannelAgent{cfgStore: cfgStore, httpClient: newGuardedClient(cfgStore)}
+
+	providers := a.searchProviders(cfg)
+	if len(providers) != 1 {
+		t.Fatalf("got %d providers, want 1", len(providers))
+	}
+	results, err := providers[0].Search(context.Background(), "golang", 5)
+	if err != nil {
+		t.Fatalf("Search with a restrictive allow_domains: %v", err)
+	}
+	if len(results) != 1 || results[0].URL != "https://go.dev" {
+		t.Errorf("results = %+v", results)
+	}
+}
+
+func TestMediaDownloadsReachDiscordCDN(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Tools.Network.AllowDomains = []string{"wikipedia.org"}
+	cfg.Tools.Network.DenyDomains = []string{"media.discordapp.net"}
+	cfgStore := config.NewStoreFromConfig(cfg)
+	media := newGuardedClient(cfgStore, discordMediaDomains...)
+	fetch := newGuardedClient(cfgStore)
+
+	for rawURL, want := range map[string][2]bool{ // media, web_fetch allowed
+		"https://cdn.discordapp.com/attachments/1/2/app.log": {true, false},
+		"https://media.discordapp.net/attachments/1/2/a.png": {false, false}, // denied wins
+		"https://en.wikipedia.org/wiki/Go":                   {true, true},
+		"https://example.com/":                               {false, false},
+	} {
+		u, _ := url.Parse(rawURL)
+		if got := netguard.CheckURL(media, u) == nil; got != want[0] {
+			t.Errorf("media client allows %s = %v, want %v", rawURL, got, want[0])
+		}
+		if got := netguard.CheckURL(fetch, u) == nil; got != want[1] {
+			t.Errorf("fetch client allows %s = %v, want %v", rawURL, got, want[1])
+		}
+	}
+}
+
 func TestFormatMessageContent(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -931,10 +989,60 @@ func TestSendAllowedWindowExpiry(t *testing.T) {
 	}
 }
 
+func TestRefreshSoulPerChannelAndHotReload(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.toml")
+	cfgText := "[bot]\ntoken=\"x\"\n[llm]\nopenrouter_key=\"test\"\n" +
+		"[[agents]]\nid=\"bot1\"\nserver_id=\"srv1\"\n" +
+		"[[agents.channels]]\nid=\"support\"\nsoul=\"helper\"\n"
+	if err := os.WriteFile(cfgPath, []byte(cfgText), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	soulPath := filepath.Join(dir, "souls", "bot1", "helper.md")
+	if err := os.MkdirAll(filepath.Dir(soulPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(soulPath, []byte("You are terse."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfgStore, err := config.NewStore(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAgent := func(channelID string) *ChannelAgent {
+		return &ChannelAgent{channelID: channelID, serverID: "srv1", cfgStore: cfgStore, resources: &AgentResources{}, logger: slog.Default()}
+	}
+
+	support := newAgent("support")
+	support.refreshSoul()
+	if support.soulText != "You are terse." {
+		t.Fatalf("support soul = %q, want helper soul", support.soulText)
+	}
+	lounge := newAgent("lounge")
+	lounge.refreshSoul()
+	if lounge.soulText == support.soulText || lounge.soulPath != "" {
+		t.Fatalf("unconfigured channel should use the default soul, got path %q", lounge.soulPath)
+	}
+
+	// Edit the soul file; the next refresh picks up the new content.
+	if err := os.WriteFile(soulPath, []byte("You are very terse."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(soulPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	support.refreshSoul()
+	if support.soulText != "You are very terse." {
+		t.Errorf("soul after edit = %q, want reloaded content", support.soulText)
+	}
+}
+
 func TestBuildSystemPromptSmartAddressed(t *testing.T) {
 	a := &ChannelAgent{soulText: "You are a test bot."}
 	cfg := &config.Config{}
-	got := a.buildSystemPrompt(cfg, "smart", "test-chan", nil, "TestBot", true, false)
+	got := a.buildSystemPrompt(cfg, "smart", "test-chan", nil, nil, "TestBot", true, false)
 	if !strings.Contains(got, "MUST respond") {
 		t.Errorf("expected smart+addressed prompt to contain 'MUST respond', got:\n%s", got)
 	}
@@ -943,7 +1051,7 @@ func TestBuildSystemPromptSmartAddressed(t *testing.T) {
 func TestBuildSystemPromptSmartNotAddressed(t *testing.T) {
 	a := &ChannelAgent{soulText: "You are a test bot."}
 	cfg := &config.Config{}
-	got := a.buildSystemPrompt(cfg, "smart", "test-chan", nil, "TestBot", false, false)
+	got := a.buildSystemPrompt(cfg, "smart", "test-chan", nil, nil, "TestBot", false, false)
 	if !strings.Contains(got, "Decide whether to respond") {
 		t.Errorf("expected smart+not-addressed prompt to contain 'Decide whether to respond', got:\n%s", got)
 	}
@@ -952,7 +1060,7 @@ func TestBuildSystemPromptSmartNotAddressed(t *testing.T) {
 func TestBuildSystemPromptNonSmart(t *testing.T) {
 	a := &ChannelAgent{soulText: "You are a test bot."}
 	cfg := &config.Config{}
-	got := a.buildSystemPrompt(cfg, "always", "test-chan", nil, "TestBot", false, false)
+	got := a.buildSystemPrompt(cfg, "always", "test-chan", nil, nil, "TestBot", false, false)
 	if strings.Contains(got, "smart mode") {
 		t.Errorf("non-smart prompt should not contain 'smart mode', got:\n%s", got)
 	}
@@ -961,7 +1069,7 @@ func TestBuildSystemPromptNonSmart(t *testing.T) {
 func TestBuildSystemPromptSmartDirectedAtOther(t *testing.T) {
 	a := &ChannelAgent{soulText: "You are a test bot."}
 	cfg := &config.Config{}
-	got := a.buildSystemPrompt(cfg, "smart", "test-chan", nil, "TestBot", false, true)
+	got := a.buildSystemPrompt(cfg, "smart", "test-chan", nil, nil, "TestBot", false, true)
 	if !strings.Contains(got, "MUST stay silent") {
 		t.Errorf("expected directed-at-other prompt to contain 'MUST stay silent', got:\n%s", got)
 	}
@@ -970,10 +1078,28 @@ func TestBuildSystemPromptSmartDirectedAtOther(t *testing.T) {
 	}
 }
 
+func TestBuildSystemPromptReference(t *testing.T) {
+	a := &ChannelAgent{soulText: "You are a test bot."}
+	cfg := &config.Config{}
+	reference := []memory.KnowledgeChunk{
+		{Document: "rules.md", Heading: "Voice channels", Content: "No soundboards after midnight."},
+		{Document: "faq.txt", Seq: 2, Content: "The server was founded in 2019."},
+	}
+	got := a.buildSystemPrompt(cfg, "always", "test-chan", nil, reference, "TestBot", false, false)
+	for _, want := range []string{"## Reference", "[rules.md › Voice channels]\nNo soundboards after midnight.", "[faq.txt #3]\nThe server was founded in 2019."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt missing %q, got:\n%s", want, got)
+		}
+	}
+	if plain := a.buildSystemPrompt(cfg, "always", "test-chan", nil, nil, "TestBot", false, false); strings.Contains(plain, "## Reference") {
+		t.Errorf("prompt without passages should have no Reference section, got:\n%s", plain)
+	}
+}
+
 func TestBuildSystemPromptSmartAddressedOverridesDirectedAtOther(t *testing.T) {
 	a := &ChannelAgent{soulText: "You are a test bot."}
 	cfg := &config.Config{}
-	got := a.buildSystemPrompt(cfg, "smart", "test-chan", nil, "TestBot", true, true)
+	got := a.buildSystemPrompt(cfg, "smart", "test-chan", nil, nil, "TestBot", true, true)
 	if !strings.Contains(got, "MUST respond") {
 		t.Errorf("addressed should override directedAtOther, expected 'MUST respond', got:\n%s", got)
 	}
@@ -1347,3 +1473,42 @@ func TestShouldSendFallback(t *testing.T) {
 		})
 	}
 }
+
+func TestNewChannelAgentPersona(t *testing.T) {
+	cfgStore := config.NewStoreFromConfig(&config.Config{})
+	ownBot := &discordgo.Session{State: discordgo.NewState()}
+	ownBot.State.User = &discordgo.User{ID: "bot-max", Username: "max-bot"}
+	shared := &discordgo.Session{State: discordgo.NewState()}
+	shared.State.User = &discordgo.User{ID: "bot-vespra", Username: "vespra"}
+	res := &AgentResources{
+		Config:          &config.AgentConfig{ID: "bot1"},
+		Session:         shared,
+		PersonaSessions: map[string]*discordgo.Session{"max": ownBot},
+	}
+
+	luna := &config.PersonaConfig{ID: "luna", Name: "Luna"}
+	a := newChannelAgent("chan1", "srv1", luna, cfgStore, nil, nil, res.forPersona(luna))
+	if a.memoryScope != "srv1#luna" {
+		t.Errorf("memoryScope = %q, want srv1#luna", a.memoryScope)
+	}
+	if id, name := a.botIdentity(); id != "bot-vespra" || name != "Luna" {
+		t.Errorf("botIdentity = %q, %q; want bot-vespra, Luna", id, name)
+	}
+	if got := a.sign("hi"); got != "**Luna:** hi" {
+		t.Errorf("sign = %q, want persona name prefix on the shared bot", got)
+	}
+
+	maxP := &config.PersonaConfig{ID: "max", Name: "Max"}
+	b := newChannelAgent("chan1", "srv1", maxP, cfgStore, nil, nil, res.forPersona(maxP))
+	if id, _ := b.botIdentity(); id != "bot-max" {
+		t.Errorf("botIdentity id = %q, want the persona's own bot", id)
+	}
+	if got := b.sign("hi"); got != "hi" {
+		t.Errorf("sign = %q, want no prefix on the persona's own bot", got)
+	}
+
+	plain := newChannelAgent("chan1", "srv1", nil, cfgStore, nil, nil, res)
+	if plain.memoryScope != "srv1" {
+		t.Errorf("memoryScope = %q, want srv1", plain.memoryScope)
+	}
+}
@@ -0,0 +1,355 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bwmarrin/discordgo"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+
+	"github.com/tomasmach/vespra/config"
+	"github.com/tomasmach/vespra/llm"
+	"github.com/tomasmach/vespra/pdftext"
+)
+
+const (
+	maxTextAttachmentBytes = 256 * 1024 // read at most this much of each file, or text of each PDF
+	maxPDFAttachmentBytes  = 20 << 20   // PDFs larger than this are skipped
+	maxTextAttachments     = 5          // per turn; further files are only named
+	maxSummaryInputBytes   = 64 * 1024  // excerpt of an oversized file sent for summarization
+	attachmentSummaryTime  = 60 * time.Second
+	maxRememberedFiles     = 64 // read attachments whose text history keeps
+)
+
+// textAttachmentLanguages maps the extensions of text-like attachments to the
+// language tag of their code fence.
+var textAttachmentLanguages = map[string]string{
+	".txt": "", ".md": "markdown", ".markdown": "markdown", ".log": "", ".csv": "csv",
+	".go": "go", ".py": "python", ".js": "javascript", ".ts": "typescript", ".tsx": "tsx", ".jsx": "jsx",
+	".rs": "rust", ".c": "c", ".h": "c", ".cpp": "cpp", ".hpp": "cpp", ".java": "java", ".kt": "kotlin",
+	".rb": "ruby", ".php": "php", ".cs": "csharp", ".swift": "swift", ".lua": "lua", ".sql": "sql",
+	".sh": "bash", ".ps1": "powershell", ".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml",
+	".ini": "ini", ".cfg": "ini", ".conf": "", ".xml": "xml", ".html": "html", ".css": "css",
+	".diff": "diff", ".patch": "diff",
+}
+
+const attachmentSummaryPrompt = `You summarize a file a user shared in a chat, for an assistant who will answer questions about it but cannot read it in full. In at most 250 words, say what the file is and list the details most likely to matter: errors, warnings and stack traces with their line numbers or timestamps, key definitions, settings and figures. Quote short snippets verbatim when they are important.`
+
+// isTextAttachment reports whether a Discord attachment is a text or code file
+// the model can read.
+func isTextAttachment(a *discordgo.MessageAttachment) bool {
+	ct, _, _ := strings.Cut(a.ContentType, ";")
+	ct = strings.TrimSpace(ct)
+	if strings.HasPrefix(ct, "image/") || strings.HasPrefix(ct, "video/") {
+		return false
+	}
+	if _, ok := textAttachmentLanguages[strings.ToLower(path.Ext(a.Filename))]; ok {
+		return true
+	}
+	switch ct {
+	case "application/json", "application/xml", "application/x-yaml", "application/toml":
+		return true
+	}
+	return strings.HasPrefix(ct, "text/")
+}
+
+// isPDFAttachment reports whether a Discord attachment is a PDF document.
+func isPDFAttachment(a *discordgo.MessageAttachment) bool {
+	ct, _, _ := strings.Cut(a.ContentType, ";")
+	return strings.TrimSpace(ct) == "application/pdf" || strings.EqualFold(path.Ext(a.Filename), ".pdf")
+}
+
+// isReadableAttachment reports whether the text of an attachment can be
+// added to the conversation.
+func isReadableAttachment(a *discordgo.MessageAttachment) bool {
+	return isTextAttachment(a) || isPDFAttachment(a)
+}
+
+// fileAttachmentNames returns the names of a message's readable attachments.
+func fileAttachmentNames(m *discordgo.Message) []string {
+	var names []string
+	for _, a := range m.Attachments {
+		if isReadableAttachment(a) {
+			names = append(names, a.Filename)
+		}
+	}
+	return names
+}
+
+// fileTextCache remembers the text each read attachment added to a turn, by
+// attachment ID, so that history rebuilt from the channel and conversation
+// logs carry the file as the model read it. Each agent has its own, shared by
+// its channels and personas (see AgentResources), keeping the texts of its
+// last maxRememberedFiles attachments.
+type fileTextCache struct {
+	mu    sync.Mutex
+	texts map[string]string
+	order []string // oldest first
+}
+
+func newFileTextCache() *fileTextCache {
+	return &fileTextCache{texts: make(map[string]string)}
+}
+
+func (c *fileTextCache) put(id, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.texts[id]; !ok {
+		c.order = append(c.order, id)
+	}
+	c.texts[id] = text
+	if len(c.order) > maxRememberedFiles {
+		delete(c.texts, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// get returns the text remembered for an attachment. A nil cache remembers
+// nothing.
+func (c *fileTextCache) get(id string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	text, ok := c.texts[id]
+	return text, ok
+}
+
+// textFile is a downloaded text attachment.
+type textFile struct {
+	name      string
+	lang      string
+	text      string
+	size      int  // reported size of the attachment in bytes
+	truncated bool // only the first maxTextAttachmentBytes were read
+}
+
+// downloadTextAttachment fetches at most maxTextAttachmentBytes of a text
+// attachment and decodes it to UTF-8. For PDFs, the text of the pages is
+// extracted.
+func downloadTextAttachment(ctx context.Context, client *http.Client, a *discordgo.MessageAttachment) (textFile, error) {
+	if isPDFAttachment(a) && a.Size > maxPDFAttachmentBytes {
+		return textFile{}, fmt.Errorf("PDF is larger than %d MB", maxPDFAttachmentBytes>>20)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return textFile{}, fmt.Errorf("build request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return textFile{}, fmt.Errorf("fetch attachment: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return textFile{}, fmt.Errorf("fetch attachment: HTTP %d", resp.StatusCode)
+	}
+	if isPDFAttachment(a) {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxPDFAttachmentBytes))
+		if err != nil {
+			return textFile{}, fmt.Errorf("read attachment: %w", err)
+		}
+		res, err := pdftext.Extract(data, pdftext.Options{MaxChars: maxTextAttachmentBytes})
+		if err != nil {
+			return textFile{}, err
+		}
+		return textFile{name: a.Filename, text: res.Text, size: max(a.Size, len(data)), truncated: res.Truncated}, nil
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTextAttachmentBytes+1))
+	if err != nil {
+		return textFile{}, fmt.Errorf("read attachment: %w", err)
+	}
+	truncated := len(data) > maxTextAttachmentBytes
+	if truncated {
+		data = data[:maxTextAttachmentBytes]
+	}
+	text, err := decodeText(data)
+	if err != nil {
+		return textFile{}, err
+	}
+	return textFile{
+		name:      a.Filename,
+		lang:      textAttachmentLanguages[strings.ToLower(path.Ext(a.Filename))],
+		text:      strings.ReplaceAll(text, "\r\n", "\n"),
+		size:      max(a.Size, len(data)),
+		truncated: truncated,
+	}, nil
+}
+
+// decodeText converts file contents to UTF-8. It honours UTF-8 and UTF-16
+// byte order marks, accepts valid UTF-8 as is, rejects data that looks
+// binary, and reads anything else as Windows-1252, the usual encoding of
+// legacy text files.
+func decodeText(data []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return strings.ToValidUTF8(string(data[3:]), "\uFFFD"), nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		out, err := unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM).NewDecoder().Bytes(data)
+		if err != nil {
+			return "", fmt.Errorf("decode UTF-16: %w", err)
+		}
+		return string(out), nil
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("file looks binary")
+	}
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	// A read cut short by the size cap may end inside a UTF-8 sequence.
+	if trimmed := trimPartialRune(data); utf8.Valid(trimmed) {
+		return string(trimmed), nil
+	}
+	out, err := charmap.Windows1252.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", fmt.Errorf("decode Windows-1252: %w", err)
+	}
+	return string(out), nil
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence at the end of data.
+func trimPartialRune(data []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(data); i++ {
+		if utf8.RuneStart(data[len(data)-i]) {
+			if !utf8.FullRune(data[len(data)-i:]) {
+				return data[:len(data)-i]
+			}
+			break
+		}
+	}
+	return data
+}
+
+// estimateTokens roughly converts text length to model tokens.
+func estimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// fence wraps text in a code fence longer than any backtick run inside it.
+func fence(lang, text string) string {
+	ticks := "```"
+	for strings.Contains(text, ticks) {
+		ticks += "`"
+	}
+	return ticks + lang + "\n" + strings.TrimRight(text, "\n") + "\n" + ticks
+}
+
+// excerpt shortens text to about maxBytes, keeping its beginning and end, the
+// parts of logs and source files that usually matter most.
+func excerpt(text string, maxBytes int) string {
+	if len(text) <= maxBytes {
+		return text
+	}
+	head := strings.ToValidUTF8(text[:maxBytes*3/4], "")
+	tail := strings.ToValidUTF8(text[len(text)-maxBytes/4:], "")
+	if i := strings.LastIndexByte(head, '\n'); i > len(head)/2 {
+		head = head[:i]
+	}
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)/2 {
+		tail = tail[i+1:]
+	}
+	omitted := len(text) - len(head) - len(tail)
+	return fmt.Sprintf("%s\n[... %d bytes omitted ...]\n%s", head, omitted, tail)
+}
+
+// textAttachmentParts downloads the text and PDF attachments of msgs (and the messages
+// they reply to) and returns one fenced text part per file. Files are inlined
+// while they fit in the configured token budget; larger ones are summarized.
+func (a *ChannelAgent) textAttachmentParts(ctx context.Context, cfg *config.Config, msgs []*discordgo.Message) []llm.ContentPart {
+	var atts []*discordgo.MessageAttachment
+	seen := make(map[string]bool)
+	add := func(m *discordgo.Message) {
+		for _, att := range m.Attachments {
+			if isReadableAttachment(att) && !seen[att.ID] {
+				seen[att.ID] = true
+				atts = append(atts, att)
+			}
+		}
+	}
+	for _, m := range msgs {
+		add(m)
+		if m.ReferencedMessage != nil {
+			add(m.ReferencedMessage)
+		}
+	}
+	if len(atts) > maxTextAttachments {
+		a.logger.Info("too many text attachments, reading the first ones", "count", len(atts), "max", maxTextAttachments)
+		atts = atts[:maxTextAttachments]
+	}
+
+	budget := cfg.Agent.AttachmentTokenBudget
+	var parts []llm.ContentPart
+	for _, att := range atts {
+		f, err := downloadTextAttachment(ctx, a.httpClient, att)
+		if err != nil {
+			a.logger.Warn("failed to read text attachment, skipping", "error", err, "file", att.Filename)
+			parts = append(parts, llm.ContentPart{Type: "text", Text: fmt.Sprintf("[Attached file %s could not be read: %s]", att.Filename, err)})
+			continue
+		}
+		var text string
+		if tokens := estimateTokens(f.text); !f.truncated && tokens <= budget {
+			budget -= tokens
+			text = fmt.Sprintf("Attached file %s:\n%s", f.name, fence(f.lang, f.text))
+		} else {
+			text = a.summarizeTextFile(ctx, f)
+		}
+		if att.ID != "" {
+			a.files.put(att.ID, text)
+		}
+		parts = append(parts, llm.ContentPart{Type: "text", Text: text})
+	}
+	return parts
+}
+
+// appendContentParts adds parts to msg, converting a plain-text message into
+// content parts first.
+func appendContentParts(msg *llm.Message, parts []llm.ContentPart) {
+	if len(parts) == 0 {
+		return
+	}
+	if len(msg.ContentParts) == 0 {
+		msg.ContentParts = []llm.ContentPart{{Type: "text", Text: msg.Content}}
+		msg.Content = ""
+	}
+	msg.ContentParts = append(msg.ContentParts, parts...)
+}
+
+// auxChatOptions returns ChatOptions for auxiliary completions: the agent's
+// provider and model overrides without the max_tokens cap of main replies.
+func (a *ChannelAgent) auxChatOptions() *llm.ChatOptions {
+	agentCfg := a.currentAgentConfig()
+	if agentCfg == nil || (agentCfg.Provider == "" && agentCfg.Model == "") {
+		return nil
+	}
+	return &llm.ChatOptions{Provider: agentCfg.Provider, Model: agentCfg.Model}
+}
+
+// summarizeTextFile describes a file too large to inline. If summarization
+// fails, a short excerpt is used instead.
+func (a *ChannelAgent) summarizeTextFile(ctx context.Context, f textFile) string {
+	header := fmt.Sprintf("Attached file %s (%d KB) is too long to include in full.", f.name, (f.size+1023)/1024)
+
+	ctx, cancel := context.WithTimeout(ctx, attachmentSummaryTime)
+	defer cancel()
+	choice, err := a.llm.Chat(ctx, []llm.Message{
+		{Role: "system", Content: attachmentSummaryPrompt},
+		{Role: "user", Content: fmt.Sprintf("File %s:\n%s", f.name, fence(f.lang, excerpt(f.text, maxSummaryInputBytes)))},
+	}, nil, a.auxChatOptions())
+	if summary := strings.TrimSpace(choice.Message.Content); err == nil && summary != "" {
+		return header + " Summary:\n" + summary
+	}
+	if err != nil {
+		a.logger.Warn("attachment summary failed, using an excerpt", "error", err, "file", f.name)
+	}
+	return header + " Excerpt:\n" + fence(f.lang, excerpt(f.text, 4096))
+}
@@ -0,0 +1,199 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/tomasmach/vespra/config"
+	"github.com/tomasmach/vespra/llm"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{"utf8", []byte("héllo"), "héllo", false},
+		{"utf8 bom", []byte("\xEF\xBB\xBFhi"), "hi", false},
+		{"utf16 le", []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, "hi", false},
+		{"utf16 be", []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, "hi", false},
+		{"windows-1252", []byte("caf\xE9 \x80"), "café €", false},
+		{"cut mid rune", []byte("ok \xC5"), "ok ", false},
+		{"binary", []byte("PK\x03\x04\x00\x00"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeText(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeText err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("decodeText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFence(t *testing.T) {
+	if got := fence("go", "package main\n"); got != "```go\npackage main\n```" {
+		t.Errorf("fence = %q", got)
+	}
+	if got := fence("md", "see ```code```"); !strings.HasPrefix(got, "````md\n") || !strings.HasSuffix(got, "\n````") {
+		t.Errorf("fence did not lengthen around inner backticks: %q", got)
+	}
+}
+
+func TestIsTextAttachment(t *testing.T) {
+	tests := []struct {
+		filename, contentType string
+		want                  bool
+	}{
+		{"main.go", "", true},
+		{"notes.TXT", "text/plain; charset=utf-8", true},
+		{"data", "application/json", true},
+		{"readme", "text/markdown", true},
+		{"photo.png", "image/png", false},
+		{"clip.txt", "video/mp4", false},
+		{"archive.zip", "application/zip", false},
+	}
+	for _, tt := range tests {
+		a := &discordgo.MessageAttachment{Filename: tt.filename, ContentType: tt.contentType}
+		if got := isTextAttachment(a); got != tt.want {
+			t.Errorf("isTextAttachment(%q, %q) = %v, want %v", tt.filename, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryUserContentFileLabels(t *testing.T) {
+	// Files no turn has read yet are only named.
+	m := msg("", &discordgo.MessageAttachment{ID: "unread", Filename: "app.log", ContentType: "text/plain"})
+	if got := historyUserContent(nil, m.Message, "", ""); got != "alice: [attached file: app.log]" {
+		t.Errorf("historyUserContent = %q", got)
+	}
+
+	reply := msg("what is wrong here?")
+	reply.ReferencedMessage = &discordgo.Message{
+		Author:      &discordgo.User{Username: "bob"},
+		Attachments: []*discordgo.MessageAttachment{{Filename: "main.go"}},
+	}
+	if got := historyUserContent(nil, reply.Message, "", ""); !strings.Contains(got, `replying to bob: "[file]"`) {
+		t.Errorf("historyUserContent = %q, want a [file] label for the replied-to message", got)
+	}
+}
+
+func TestTextAttachmentParts(t *testing.T) {
+	files := map[string]string{
+		"/small.go": "package main\n\nfunc main() {}\n",
+		"/big.log":  strings.Repeat("INFO all good\n", 200) + "ERROR disk full\n",
+		"/blob.txt": "\x00\x01\x02",
+	}
+	fileSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(files[r.URL.Path])) //nolint:errcheck
+	}))
+	defer fileSrv.Close()
+
+	var summaryRequest string
+	llmSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req) //nolint:errcheck
+		summaryRequest = req.Messages[len(req.Messages)-1].Content
+		json.NewEncoder(w).Encode(map[string]any{ //nolint:errcheck
+			"choices": []map[string]any{{"message": map[string]any{"role": "assistant", "content": "A log ending in a disk full error."}}},
+		})
+	}))
+	defer llmSrv.Close()
+
+	cfg := &config.Config{
+		LLM:   config.LLMConfig{BaseURL: llmSrv.URL, RequestTimeoutSeconds: 5},
+		Agent: config.TurnConfig{AttachmentTokenBudget: 100},
+	}
+	cfgStore := config.NewStoreFromConfig(cfg)
+	a := &ChannelAgent{httpClient: fileSrv.Client(), files: newFileTextCache(), llm: llm.New(cfgStore), cfgStore: cfgStore, logger: slog.Default()}
+
+	m := &discordgo.Message{Attachments: []*discordgo.MessageAttachment{
+		{ID: "1", Filename: "small.go", URL: fileSrv.URL + "/small.go"},
+		{ID: "2", Filename: "big.log", URL: fileSrv.URL + "/big.log", Size: 2815},
+		{ID: "3", Filename: "blob.txt", URL: fileSrv.URL + "/blob.txt"},
+		{ID: "4", Filename: "cat.png", ContentType: "image/png", URL: fileSrv.URL + "/cat.png"},
+	}}
+	parts := a.textAttachmentParts(context.Background(), cfg, []*discordgo.Message{m})
+	if len(parts) != 3 {
+		t.Fatalf("got %d parts, want 3: %+v", len(parts), parts)
+	}
+	if want := "Attached file small.go:\n```go\npackage main\n\nfunc main() {}\n```"; parts[0].Text != want {
+		t.Errorf("small file part = %q, want %q", parts[0].Text, want)
+	}
+	if !strings.Contains(parts[1].Text, "too long to include in full") || !strings.HasSuffix(parts[1].Text, "A log ending in a disk full error.") {
+		t.Errorf("big file part = %q, want a summary", parts[1].Text)
+	}
+	if !strings.Contains(summaryRequest, "ERROR disk full") {
+		t.Errorf("summary request did not include the file: %q", summaryRequest)
+	}
+	if !strings.Contains(parts[2].Text, "blob.txt could not be read") {
+		t.Errorf("binary file part = %q", parts[2].Text)
+	}
+
+	userMsg := llm.Message{Role: "user", Content: "alice: have a look"}
+	appendContentParts(&userMsg, parts[:1])
+	if userMsg.Content != "" || len(userMsg.ContentParts) != 2 || userMsg.ContentParts[0].Text != "alice: have a look" {
+		t.Errorf("appendContentParts = %+v", userMsg)
+	}
+}
+
+func TestPDFAttachmentPart(t *testing.T) {
+	const doc = "%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >> endobj\n" +
+		"4 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n" +
+		"5 0 obj << /Length 43 >>\nstream\nBT /F1 12 Tf 72 700 Td (Invoice total) Tj ET\nendstream\nendobj\n" +
+		"trailer << /Root 1 0 R >>\n%%EOF\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(doc)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cfg := &config.Config{Agent: config.TurnConfig{AttachmentTokenBudget: 1000}}
+	a := &ChannelAgent{httpClient: srv.Client(), files: newFileTextCache(), logger: slog.Default()}
+	m := &discordgo.Message{Attachments: []*discordgo.MessageAttachment{
+		{ID: "1", Filename: "invoice.pdf", ContentType: "application/pdf", URL: srv.URL},
+	}}
+	parts := a.textAttachmentParts(context.Background(), cfg, []*discordgo.Message{m})
+	if want := "Attached file invoice.pdf:\n```\n[Page 1]\nInvoice total\n```"; len(parts) != 1 || parts[0].Text != want {
+		t.Errorf("parts = %+v, want one part %q", parts, want)
+	}
+	// History carries the text the turn read, not just the file name.
+	if got := historyUserContent(a.files, msg("see attached", m.Attachments...).Message, "", ""); got != "alice: see attached\n"+parts[0].Text {
+		t.Errorf("historyUserContent = %q", got)
+	}
+}
+
+func TestFileTextsAreKeptPerAgent(t *testing.T) {
+	cfgStore := config.NewStoreFromConfig(&config.Config{})
+	shared := &AgentResources{Config: &config.AgentConfig{}, files: newFileTextCache()}
+	luna := &config.PersonaConfig{ID: "luna"}
+	a := newChannelAgent("chan1", "srv1", nil, cfgStore, nil, nil, shared)
+	persona := newChannelAgent("chan2", "srv1", luna, cfgStore, nil, nil, shared.forPersona(luna))
+	other := newChannelAgent("chan3", "srv2", nil, cfgStore, nil, nil, &AgentResources{Config: &config.AgentConfig{}})
+
+	a.files.put("1", "Attached file notes.txt:\nsecret")
+	if _, ok := persona.files.get("1"); !ok {
+		t.Error("a persona of the same agent does not see the file text")
+	}
+	if _, ok := other.files.get("1"); ok {
+		t.Error("another agent sees the file text")
+	}
+}
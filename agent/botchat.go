@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/tomasmach/vespra/config"
+)
+
+// Bot-to-bot loop guard defaults, used when a channel's limits are zero.
+const (
+	defaultMaxBotTurns = 6
+	defaultBotCooldown = 5 * time.Minute
+
+	// botChainIdle is how long a chain that is not cooling down is kept
+	// without bot messages before pruneBotChains drops it.
+	botChainIdle = time.Hour
+)
+
+// botChain tracks the bot-authored messages in a channel since a human last spoke.
+type botChain struct {
+	depth         int       // consecutive bot turns accepted since the last human message
+	cooldownUntil time.Time // bot messages are dropped until then
+	lastMessage   time.Time // last bot message seen in the channel
+}
+
+// botChannel returns the closest channel entry in lineage that opts in to bot
+// messages, or nil when bots are not allowed there.
+func botChannel(cfg *config.AgentConfig, lineage []string) *config.ChannelConfig {
+	if cfg == nil {
+		return nil
+	}
+	for _, id := range lineage {
+		for i := range cfg.Channels {
+			if cfg.Channels[i].ID == id && cfg.Channels[i].AllowBots {
+				return &cfg.Channels[i]
+			}
+		}
+	}
+	return nil
+}
+
+// allowBotMessage applies the loop guards to a bot-authored message and reports
+// whether it may be delivered. Bot messages are only processed in channels with
+// allow_bots. Each accepted one deepens the channel's chain; once the depth
+// passes max_bot_turns the channel cools down and bot messages are dropped until
+// the cooldown ends or a human speaks (see resetBotChain).
+// Must be called with r.mu held.
+func (r *Router) allowBotMessage(resources *AgentResources, msg *discordgo.MessageCreate, now time.Time) bool {
+	ch := botChannel(resources.Config, channelLineage(resources.Session, msg.ChannelID))
+	if ch == nil {
+		return false
+	}
+	maxTurns := defaultMaxBotTurns
+	if ch.MaxBotTurns > 0 {
+		maxTurns = ch.MaxBotTurns
+	}
+	cooldown := defaultBotCooldown
+	if ch.BotCooldownSeconds > 0 {
+		cooldown = time.Duration(ch.BotCooldownSeconds) * time.Second
+	}
+
+	c := r.botChains[msg.ChannelID]
+	if c == nil {
+		c = &botChain{}
+		r.botChains[msg.ChannelID] = c
+	}
+	c.lastMessage = now
+	if now.Before(c.cooldownUntil) {
+		slog.Debug("bot message dropped: channel cooling down", "channel_id", msg.ChannelID, "author_id", msg.Author.ID, "until", c.cooldownUntil)
+		return false
+	}
+	if !c.cooldownUntil.IsZero() {
+		*c = botChain{lastMessage: now} // cooldown over; start a fresh chain
+	}
+
+	c.depth++
+	if c.depth > maxTurns {
+		c.cooldownUntil = now.Add(cooldown)
+		slog.Info("bot conversation loop guard tripped", "channel_id", msg.ChannelID, "author_id", msg.Author.ID, "depth", c.depth, "max_bot_turns", maxTurns, "cooldown", cooldown)
+		return false
+	}
+	slog.Debug("bot message accepted", "channel_id", msg.ChannelID, "author_id", msg.Author.ID, "depth", c.depth, "max_bot_turns", maxTurns)
+	return true
+}
+
+// resetBotChain clears a channel's bot chain when a human speaks.
+// Must be called with r.mu held.
+func (r *Router) resetBotChain(channelID string) {
+	if c, ok := r.botChains[channelID]; ok {
+		if c.depth > 0 {
+			slog.Debug("bot conversation chain reset by human message", "channel_id", channelID, "depth", c.depth)
+		}
+		delete(r.botChains, channelID)
+	}
+}
+
+// pruneBotChains drops the chains of channels where no human spoke to reset
+// them: those whose cooldown has expired, which the next bot message would
+// restart anyway, and those idle for botChainIdle.
+// Must be called with r.mu held.
+func (r *Router) pruneBotChains(now time.Time) {
+	for channelID, c := range r.botChains {
+		if c.cooldownUntil.IsZero() && now.Sub(c.lastMessage) <= botChainIdle {
+			continue
+		}
+		if now.Before(c.cooldownUntil) {
+			continue
+		}
+		delete(r.botChains, channelID)
+	}
+}
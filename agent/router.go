@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"slices"
 	"strings"
 	"sync"
@@ -14,38 +15,219 @@ import (
 	"github.com/tomasmach/vespra/config"
 	"github.com/tomasmach/vespra/llm"
 	"github.com/tomasmach/vespra/memory"
+	"github.com/tomasmach/vespra/tools"
 )
 
+// Anti-spam defaults, used when an agent's [agents.spam] fields are zero.
 const (
-	spamWindow    = 30 * time.Second
-	spamThreshold = 10
-	spamCooldown  = 60 * time.Minute
+	defaultSpamWindow      = 30 * time.Second
+	defaultSpamThreshold   = 10
+	defaultSpamCooldown    = 60 * time.Minute
+	defaultSpamMaxCooldown = 24 * time.Hour
+)
+
+const (
+	// spamOffenseMemory is how long after a block expires it still counts as a
+	// prior offense when escalating the next cooldown.
+	spamOffenseMemory = 24 * time.Hour
+	// spamCleanupInterval is how often stale spam records are pruned.
+	spamCleanupInterval = 10 * time.Minute
+	// maxSpamWindow bounds the configurable window; records idle for longer are stale.
+	maxSpamWindow = time.Hour
 )
 
 type spamRecord struct {
 	timestamps   []time.Time
 	blockedUntil time.Time
+	offenses     int // consecutive blocks, reset once spamOffenseMemory passes without one
+}
+
+// spamPolicy is an agent's anti-spam configuration with defaults applied.
+type spamPolicy struct {
+	disabled    bool
+	window      time.Duration
+	threshold   int
+	cooldown    time.Duration
+	maxCooldown time.Duration
+	exemptRoles []string
+}
+
+// resolveSpamPolicy applies defaults to the agent's spam config. cfg may be nil.
+func resolveSpamPolicy(cfg *config.AgentConfig) spamPolicy {
+	p := spamPolicy{
+		window:      defaultSpamWindow,
+		threshold:   defaultSpamThreshold,
+		cooldown:    defaultSpamCooldown,
+		maxCooldown: defaultSpamMaxCooldown,
+	}
+	if cfg == nil {
+		return p
+	}
+	sc := cfg.Spam
+	p.disabled = sc.Disabled
+	p.exemptRoles = sc.ExemptRoles
+	if sc.WindowSeconds > 0 {
+		p.window = time.Duration(sc.WindowSeconds) * time.Second
+	}
+	if sc.Threshold > 0 {
+		p.threshold = sc.Threshold
+	}
+	if sc.CooldownMinutes > 0 {
+		p.cooldown = time.Duration(sc.CooldownMinutes) * time.Minute
+	}
+	if sc.MaxCooldownMinutes > 0 {
+		p.maxCooldown = time.Duration(sc.MaxCooldownMinutes) * time.Minute
+	}
+	if p.maxCooldown < p.cooldown {
+		p.maxCooldown = p.cooldown
+	}
+	return p
+}
+
+// cooldownFor returns the block duration for the nth offense: the base
+// cooldown doubles with each repeat offense, capped at maxCooldown.
+func (p spamPolicy) cooldownFor(offenses int) time.Duration {
+	d := p.cooldown
+	for i := 1; i < offenses && d < p.maxCooldown; i++ {
+		d *= 2
+	}
+	return min(d, p.maxCooldown)
+}
+
+// exempt reports whether any of the member's roles is exempt from the policy.
+func (p spamPolicy) exempt(roles []string) bool {
+	return containsAny(p.exemptRoles, roles)
+}
+
+// accessAllowed evaluates an agent's access rules for a message author.
+// channels lists the message channel followed by its ancestors (thread parent,
+// category). Deny rules win; non-empty allow lists must match.
+func accessAllowed(a *config.AccessConfig, userID string, roles, channels []string) bool {
+	if slices.Contains(a.DenyUsers, userID) || containsAny(a.DenyRoles, roles) || containsAny(a.DenyChannels, channels) {
+		return false
+	}
+	if len(a.AllowChannels) > 0 && !containsAny(a.AllowChannels, channels) {
+		return false
+	}
+	if len(a.AllowUsers) > 0 || len(a.AllowRoles) > 0 {
+		return slices.Contains(a.AllowUsers, userID) || containsAny(a.AllowRoles, roles)
+	}
+	return true
+}
+
+// containsAny reports whether list contains any of the values.
+func containsAny(list, values []string) bool {
+	for _, v := range values {
+		if slices.Contains(list, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// memberRoles returns the author's role IDs. The member attached to the
+// gateway event is preferred since it reflects roles at send time; the
+// session state cache is the fallback when the event carries no member.
+func memberRoles(session *discordgo.Session, msg *discordgo.MessageCreate) []string {
+	if msg.Member != nil {
+		return msg.Member.Roles
+	}
+	if session == nil || session.State == nil || msg.GuildID == "" {
+		return nil
+	}
+	m, err := session.State.Member(msg.GuildID, msg.Author.ID)
+	if err != nil {
+		return nil
+	}
+	return m.Roles
+}
+
+// channelLineage returns channelID followed by its cached ancestors: a
+// thread's parent channel and a channel's category.
+func channelLineage(session *discordgo.Session, channelID string) []string {
+	lineage := []string{channelID}
+	if session == nil || session.State == nil {
+		return lineage
+	}
+	for range 2 {
+		ch, err := session.State.Channel(lineage[len(lineage)-1])
+		if err != nil || ch.ParentID == "" {
+			break
+		}
+		lineage = append(lineage, ch.ParentID)
+	}
+	return lineage
+}
+
+// channelNSFW reports whether Discord marks channelID age-restricted. Threads
+// follow their parent channel. Channels missing from the state cache count as
+// not age-restricted.
+func channelNSFW(session *discordgo.Session, channelID string) bool {
+	if session == nil || session.State == nil {
+		return false
+	}
+	ch, err := session.State.Channel(channelID)
+	if err != nil {
+		return false
+	}
+	if ch.IsThread() {
+		parent, err := session.State.Channel(ch.ParentID)
+		return err == nil && parent.NSFW
+	}
+	return ch.NSFW
 }
 
 // ChannelStatus describes the current state of an active channel agent.
 type ChannelStatus struct {
 	ChannelID  string    `json:"channel_id"`
 	ServerID   string    `json:"server_id"`
+	Persona    string    `json:"persona,omitempty"`
 	LastActive time.Time `json:"last_active"`
 	QueueDepth int       `json:"queue_depth"`
 }
 
 // AgentResources holds the config, memory store, and Discord session for a configured agent.
 type AgentResources struct {
-	Config  *config.AgentConfig
-	Memory  *memory.Store
-	Session *discordgo.Session
+	Config          *config.AgentConfig
+	Memory          *memory.Store
+	Session         *discordgo.Session
+	PersonaSessions map[string]*discordgo.Session // keyed by persona ID; only personas with their own token
+	Images          *tools.ImageQueue             // image generations of all the agent's channels
+
+	files *fileTextCache // texts of read attachments; set by the router on first delivery
+}
+
+// forPersona returns the resources a persona's channel agents use: the agent's
+// config and memory with the persona's own session, if it has one.
+func (res *AgentResources) forPersona(p *config.PersonaConfig) *AgentResources {
+	if p == nil {
+		return res
+	}
+	out := *res
+	if s := res.PersonaSessions[p.ID]; s != nil {
+		out.Session = s
+	}
+	return &out
+}
+
+// personaStickyWindow is how long an unaddressed message keeps going to the
+// persona last addressed in the same channel.
+const personaStickyWindow = 10 * time.Minute
+
+// seenMessageTTL bounds how long message IDs are remembered for deduplication.
+// Personas with their own token share guilds with the agent's bot, so the same
+// message arrives once per session.
+const seenMessageTTL = time.Minute
+
+type personaPick struct {
+	id string
+	at time.Time
 }
 
 // Router manages per-channel ChannelAgents.
 type Router struct {
 	mu               sync.Mutex
-	agents           map[string]*ChannelAgent // keyed by channelID
+	agents           map[string]*ChannelAgent // keyed by agentKey(channelID, persona)
 	ctx              context.Context
 	cfgStore         *config.Store
 	llm              *llm.Client
@@ -54,6 +236,14 @@ type Router struct {
 	dmMemory         *memory.Store
 	wg               sync.WaitGroup
 	spamMap          map[string]*spamRecord // key: "serverID:userID", protected by mu
+	lastPersona      map[string]personaPick // keyed by channelID, protected by mu
+	seen             map[string]time.Time   // message ID → first delivery, protected by mu
+	botChains        map[string]*botChain   // keyed by channelID, protected by mu
+	plugins          *tools.PluginHost
+	httpClient       *http.Client                             // attachment and embed downloads, restricted by tools.network
+	fetchClient      *http.Client                             // web_fetch, restricted by tools.network
+	webCache         *tools.Cache                             // shared by all agents; nil when disabled
+	personaSessions  map[string]map[string]*discordgo.Session // server ID → sessions opened at startup
 }
 
 // NewRouter creates a new Router. Returns an error if the DM memory store cannot be opened,
@@ -64,7 +254,7 @@ func NewRouter(ctx context.Context, cfgStore *config.Store, llmClient *llm.Clien
 	if err != nil {
 		return nil, fmt.Errorf("open DM memory store: %w", err)
 	}
-	return &Router{
+	r := &Router{
 		agents:           make(map[string]*ChannelAgent),
 		ctx:              ctx,
 		cfgStore:         cfgStore,
@@ -73,7 +263,25 @@ func NewRouter(ctx context.Context, cfgStore *config.Store, llmClient *llm.Clien
 		agentsByServerID: agentsByServerID,
 		dmMemory:         dmMem,
 		spamMap:          make(map[string]*spamRecord),
-	}, nil
+		lastPersona:      make(map[string]personaPick),
+		seen:             make(map[string]time.Time),
+		botChains:        make(map[string]*botChain),
+		plugins:          tools.NewPluginHost(ctx),
+		httpClient:       newGuardedClient(cfgStore, discordMediaDomains...),
+		fetchClient:      newGuardedClient(cfgStore),
+		webCache:         newWebCache(cfg),
+	}
+	r.restoreSpamBlocks(dmMem)
+	r.personaSessions = make(map[string]map[string]*discordgo.Session)
+	for serverID, res := range agentsByServerID {
+		r.restoreSpamBlocks(res.Memory)
+		if len(res.PersonaSessions) > 0 {
+			r.personaSessions[serverID] = res.PersonaSessions
+		}
+	}
+	r.wg.Add(1)
+	go r.spamCleanupLoop()
+	return r, nil
 }
 
 // Route delivers a message to the appropriate channel agent, spawning one if needed.
@@ -87,6 +295,10 @@ func (r *Router) Route(msg *discordgo.MessageCreate) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if !r.firstDelivery(msg.ID, time.Now()) {
+		return // already routed via another persona's bot session
+	}
+
 	resources, ok := r.agentsByServerID[serverID]
 	if !ok {
 		resources = r.tryHotLoad(serverID)
@@ -100,47 +312,203 @@ func (r *Router) Route(msg *discordgo.MessageCreate) {
 		return
 	}
 
-	// Check spam rate limit.
-	blocked, justBlocked := r.checkSpam(serverID, msg.Author.ID)
-	if blocked {
-		if justBlocked && resources.Session != nil {
-			go resources.Session.ChannelMessageSend(channelID, fmt.Sprintf("<@%s> You've been sending too many messages. I'll be back in %s.", msg.Author.ID, spamCooldown))
+	// Bot authors only get through in opted-in channels, subject to the loop
+	// guards, and only when some persona answers from another account.
+	if msg.Author.Bot {
+		if !answerableBot(resources, msg.Author.ID) || !r.allowBotMessage(resources, msg, time.Now()) {
+			return
 		}
+	} else {
+		r.resetBotChain(channelID)
+	}
+
+	// Check role, user and channel access rules.
+	roles := memberRoles(resources.Session, msg)
+	if resources.Config != nil && !accessAllowed(&resources.Config.Access, msg.Author.ID, roles, channelLineage(resources.Session, channelID)) {
+		slog.Debug("message denied by access rules", "server_id", serverID, "channel_id", channelID, "user_id", msg.Author.ID)
 		return
 	}
 
-	if agent, ok := r.agents[channelID]; ok {
+	// Check spam rate limit. Bots are bounded by the loop guards instead.
+	policy := resolveSpamPolicy(resources.Config)
+	if !msg.Author.Bot && !policy.disabled && !policy.exempt(roles) {
+		blocked, justBlocked := r.checkSpam(serverID, msg.Author.ID, policy)
+		if blocked {
+			if justBlocked {
+				r.onSpamBlock(resources, channelID, serverID, msg.Author.ID)
+			}
+			return
+		}
+	}
+
+	for _, p := range r.selectPersonas(resources, msg) {
+		r.deliver(channelID, serverID, p, resources, msg)
+	}
+}
+
+// agentKey identifies the channel agent of a persona (nil for agents without personas) in a channel.
+func agentKey(channelID string, p *config.PersonaConfig) string {
+	if p == nil {
+		return channelID
+	}
+	return channelID + "#" + p.ID
+}
+
+// deliver hands msg to the channel agent for persona p, spawning one if needed.
+// Must be called with r.mu held.
+func (r *Router) deliver(channelID, serverID string, p *config.PersonaConfig, resources *AgentResources, msg *discordgo.MessageCreate) {
+	key := agentKey(channelID, p)
+	if agent, ok := r.agents[key]; ok {
 		select {
 		case agent.msgCh <- msg:
 			return
 		default:
 			// buffer full or agent gone — respawn
 			slog.Warn("agent buffer full or gone, respawning", "channel_id", channelID)
-			delete(r.agents, channelID)
+			delete(r.agents, key)
 		}
 	}
 
 	// spawn new agent
+	if resources.files == nil {
+		resources.files = newFileTextCache()
+	}
 	agentCtx, agentCancel := context.WithCancel(r.ctx)
-	a := newChannelAgent(channelID, serverID, r.cfgStore, r.llm, resources)
+	a := newChannelAgent(channelID, serverID, p, r.cfgStore, r.llm, r.httpClient, resources.forPersona(p))
 	a.cancel = agentCancel
-	r.agents[channelID] = a
+	a.plugins = r.plugins
+	a.webCache = r.webCache
+	a.fetchClient = r.fetchClient
+	r.agents[key] = a
 	r.wg.Add(1)
 	go func() {
 		defer r.wg.Done()
 		defer agentCancel()
 		a.run(agentCtx)
 		r.mu.Lock()
-		if r.agents[channelID] == a {
-			delete(r.agents, channelID)
+		if r.agents[key] == a {
+			delete(r.agents, key)
 		}
 		r.mu.Unlock()
 	}()
 	a.msgCh <- msg // guaranteed to succeed (buffer just created, size 100)
 }
 
+// selectPersonas returns the personas that should handle msg, or a single nil
+// entry for agents without personas. Every persona addressed by mention, reply
+// or name gets the message. Otherwise — including a bare mention of the shared
+// bot — it goes to the persona last addressed in the channel within
+// personaStickyWindow, falling back to the default persona.
+// Must be called with r.mu held.
+func (r *Router) selectPersonas(resources *AgentResources, msg *discordgo.MessageCreate) []*config.PersonaConfig {
+	if resources.Config == nil || len(resources.Config.Personas) == 0 {
+		return []*config.PersonaConfig{nil}
+	}
+	personas := resources.Config.Personas
+	now := time.Now()
+	// A persona never answers its own messages in bot-to-bot channels.
+	self := func(p *config.PersonaConfig) bool {
+		return msg.Author.ID == personaAccount(resources, p)
+	}
+
+	var addressed []*config.PersonaConfig
+	for i := range personas {
+		p := &personas[i]
+		if self(p) {
+			continue
+		}
+		if s := resources.PersonaSessions[p.ID]; s != nil {
+			if isAddressedToBot(msg, sessionUserID(s), p.Name) {
+				addressed = append(addressed, p)
+			}
+		} else if containsBotName(msg.Content, p.Name) {
+			addressed = append(addressed, p)
+		}
+	}
+	if len(addressed) > 0 {
+		r.lastPersona[msg.ChannelID] = personaPick{id: addressed[0].ID, at: now}
+		return addressed
+	}
+
+	fallback := resources.Config.DefaultPersona()
+	if pick, ok := r.lastPersona[msg.ChannelID]; ok && now.Sub(pick.at) < personaStickyWindow {
+		for i := range personas {
+			if personas[i].ID == pick.id {
+				fallback = &personas[i]
+			}
+		}
+	}
+	if self(fallback) {
+		fallback = nil
+		for i := range personas {
+			if !self(&personas[i]) {
+				fallback = &personas[i]
+				break
+			}
+		}
+		if fallback == nil {
+			return nil
+		}
+	}
+	return []*config.PersonaConfig{fallback}
+}
+
+// personaAccount returns the bot user ID persona p answers from: its own
+// session when it has a token, the agent's shared session otherwise.
+func personaAccount(resources *AgentResources, p *config.PersonaConfig) string {
+	if s := resources.PersonaSessions[p.ID]; s != nil {
+		return sessionUserID(s)
+	}
+	return sessionUserID(resources.Session)
+}
+
+// answerableBot reports whether a message by bot userID has anyone to answer
+// it: the agent's own bot never answers itself, and with personas at least
+// one must answer from another account.
+func answerableBot(resources *AgentResources, userID string) bool {
+	if resources.Config == nil || len(resources.Config.Personas) == 0 {
+		return userID != sessionUserID(resources.Session)
+	}
+	for i := range resources.Config.Personas {
+		if personaAccount(resources, &resources.Config.Personas[i]) != userID {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionUserID returns the bot user ID of a session, or "" before it is ready.
+func sessionUserID(s *discordgo.Session) string {
+	if s == nil || s.State == nil || s.State.User == nil {
+		return ""
+	}
+	return s.State.User.ID
+}
+
+// firstDelivery records msg ID and reports whether this is its first arrival.
+// Must be called with r.mu held.
+func (r *Router) firstDelivery(messageID string, now time.Time) bool {
+	if messageID == "" {
+		return true
+	}
+	if _, ok := r.seen[messageID]; ok {
+		return false
+	}
+	if len(r.seen) >= 1000 {
+		for id, at := range r.seen {
+			if now.Sub(at) > seenMessageTTL {
+				delete(r.seen, id)
+			}
+		}
+	}
+	r.seen[messageID] = now
+	return true
+}
+
 // MemoryForServer returns the memory store for a configured server, or nil if not configured.
+// Persona memory scopes ("<server_id>#<persona id>") resolve to their agent's store.
 func (r *Router) MemoryForServer(serverID string) *memory.Store {
+	serverID, _, _ = strings.Cut(serverID, "#")
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if res, ok := r.agentsByServerID[serverID]; ok {
@@ -165,7 +533,7 @@ func (r *Router) tryHotLoad(serverID string) *AgentResources {
 			slog.Error("DM memory store not initialized", "server_id", serverID)
 			return nil
 		}
-		res := &AgentResources{Config: &config.AgentConfig{}, Memory: r.dmMemory, Session: r.defaultSession}
+		res := &AgentResources{Config: &config.AgentConfig{}, Memory: r.dmMemory, Session: r.defaultSession, Images: tools.NewImageQueue(cfg.ResolveImageConfig(serverID).Concurrency)}
 		r.agentsByServerID[serverID] = res
 		slog.Info("created DM agent resources", "server_id", serverID)
 		return res
@@ -186,14 +554,32 @@ func (r *Router) tryHotLoad(serverID string) *AgentResources {
 			slog.Error("failed to hot-load memory store for agent", "agent", a.ID, "error", err)
 			return nil
 		}
-		res := &AgentResources{Config: a, Memory: mem, Session: r.defaultSession}
+		res := &AgentResources{Config: a, Memory: mem, Session: r.defaultSession, PersonaSessions: r.personaSessions[serverID], Images: tools.NewImageQueue(cfg.ResolveImageConfig(serverID).Concurrency)}
+		for _, p := range a.Personas {
+			if p.Token != "" && res.PersonaSessions[p.ID] == nil {
+				slog.Warn("persona has custom token and was added after startup; restart required", "agent", a.ID, "persona", p.ID)
+			}
+		}
 		r.agentsByServerID[serverID] = res
+		r.restoreSpamBlocks(mem)
 		slog.Info("hot-loaded agent from config", "agent", a.ID, "server_id", serverID)
 		return res
 	}
 	return nil
 }
 
+// ApplyConfig brings the resources of loaded agents in line with a reloaded
+// cfg; for now that is the concurrency of their image queues.
+func (r *Router) ApplyConfig(cfg *config.Config) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for serverID, res := range r.agentsByServerID {
+		if res.Images != nil {
+			res.Images.SetLimit(cfg.ResolveImageConfig(serverID).Concurrency)
+		}
+	}
+}
+
 // UnloadAgent removes a hot-loaded agent from the in-memory cache.
 // The next message to that server will find no entry and be silently ignored.
 func (r *Router) UnloadAgent(serverID string) {
@@ -207,15 +593,21 @@ func (r *Router) UnloadAgent(serverID string) {
 func (r *Router) RestartAgent(serverID string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	for channelID, a := range r.agents {
+	for key, a := range r.agents {
 		if a.serverID == serverID {
 			a.cancel()
-			delete(r.agents, channelID)
+			delete(r.agents, key)
 		}
 	}
 	delete(r.agentsByServerID, serverID)
 }
 
+// WebCacheStats returns the hit counters and size of the page and search
+// cache shared by the agents.
+func (r *Router) WebCacheStats() tools.CacheStats {
+	return r.webCache.Stats()
+}
+
 // Status returns a snapshot of all active channel agents.
 func (r *Router) Status() []ChannelStatus {
 	r.mu.Lock()
@@ -223,9 +615,14 @@ func (r *Router) Status() []ChannelStatus {
 
 	statuses := make([]ChannelStatus, 0, len(r.agents))
 	for _, a := range r.agents {
+		var persona string
+		if a.persona != nil {
+			persona = a.persona.ID
+		}
 		statuses = append(statuses, ChannelStatus{
 			ChannelID:  a.channelID,
 			ServerID:   a.serverID,
+			Persona:    persona,
 			LastActive: time.Unix(0, a.lastActive.Load()),
 			QueueDepth: len(a.msgCh),
 		})
@@ -237,7 +634,7 @@ func (r *Router) Status() []ChannelStatus {
 // Must be called with r.mu held.
 // Returns (blocked, justBlocked): blocked=true means the message should be dropped;
 // justBlocked=true means this call is what triggered the block (send a notification).
-func (r *Router) checkSpam(serverID, userID string) (blocked bool, justBlocked bool) {
+func (r *Router) checkSpam(serverID, userID string, policy spamPolicy) (blocked bool, justBlocked bool) {
 	key := serverID + ":" + userID
 	now := time.Now()
 
@@ -252,24 +649,165 @@ func (r *Router) checkSpam(serverID, userID string) (blocked bool, justBlocked b
 	}
 
 	// Trim timestamps outside the window.
-	cutoff := now.Add(-spamWindow)
+	cutoff := now.Add(-policy.window)
 	i := 0
 	for i < len(rec.timestamps) && rec.timestamps[i].Before(cutoff) {
 		i++
 	}
 	rec.timestamps = append(rec.timestamps[i:], now)
 
-	if len(rec.timestamps) >= spamThreshold {
-		rec.blockedUntil = now.Add(spamCooldown)
+	if len(rec.timestamps) >= policy.threshold {
+		if now.Sub(rec.blockedUntil) > spamOffenseMemory {
+			rec.offenses = 0
+		}
+		rec.offenses++
+		rec.blockedUntil = now.Add(policy.cooldownFor(rec.offenses))
 		rec.timestamps = rec.timestamps[:0]
-		slog.Warn("spam block applied", "server_id", serverID, "user_id", userID)
+		slog.Warn("spam block applied", "server_id", serverID, "user_id", userID, "offenses", rec.offenses, "until", rec.blockedUntil)
 		return true, true
 	}
 
 	return false, false
 }
 
-// WaitForDrain waits for all active agents to finish, up to 30 seconds.
+// onSpamBlock notifies the user about a fresh block and persists it so it
+// survives restarts. Must be called with r.mu held. The block is saved before
+// returning, under the same lock as Unblock's delete, so an unblock can never
+// be overtaken by the save it lifts; the notification is sent in a goroutine.
+func (r *Router) onSpamBlock(resources *AgentResources, channelID, serverID, userID string) {
+	rec := r.spamMap[serverID+":"+userID]
+	block := memory.SpamBlock{ServerID: serverID, UserID: userID, BlockedUntil: rec.blockedUntil, Offenses: rec.offenses}
+	if resources.Session != nil {
+		wait := time.Until(block.BlockedUntil).Round(time.Minute)
+		go resources.Session.ChannelMessageSend(channelID, fmt.Sprintf("<@%s> You've been sending too many messages. I'll be back in %s.", userID, wait))
+	}
+	if resources.Memory != nil {
+		if err := resources.Memory.SaveSpamBlock(r.ctx, block); err != nil {
+			slog.Error("failed to persist spam block", "error", err, "server_id", serverID, "user_id", userID)
+		}
+	}
+}
+
+// restoreSpamBlocks loads persisted blocks from mem into spamMap, including
+// recently expired ones so their offense counts still escalate.
+// Must be called with r.mu held or before the router is shared.
+func (r *Router) restoreSpamBlocks(mem *memory.Store) {
+	if mem == nil {
+		return
+	}
+	blocks, err := mem.ListSpamBlocks(r.ctx, time.Now().Add(-spamOffenseMemory))
+	if err != nil {
+		slog.Error("failed to restore spam blocks", "error", err)
+		return
+	}
+	for _, b := range blocks {
+		key := b.ServerID + ":" + b.UserID
+		if _, ok := r.spamMap[key]; ok {
+			continue
+		}
+		r.spamMap[key] = &spamRecord{blockedUntil: b.BlockedUntil, offenses: b.Offenses}
+	}
+}
+
+// spamCleanupLoop periodically prunes stale spam records until the router context ends.
+func (r *Router) spamCleanupLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(spamCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			r.pruneSpam(time.Now())
+		}
+	}
+}
+
+// pruneSpam drops in-memory records that have no recent messages and no
+// offense that still counts towards escalation, then deletes the matching
+// persisted blocks. Stale bot conversation chains are dropped too.
+func (r *Router) pruneSpam(now time.Time) {
+	r.mu.Lock()
+	r.pruneBotChains(now)
+	for key, rec := range r.spamMap {
+		if rec.offenses > 0 && now.Sub(rec.blockedUntil) <= spamOffenseMemory {
+			continue
+		}
+		if n := len(rec.timestamps); n > 0 && now.Sub(rec.timestamps[n-1]) <= maxSpamWindow {
+			continue
+		}
+		delete(r.spamMap, key)
+	}
+	stores := []*memory.Store{r.dmMemory}
+	for _, res := range r.agentsByServerID {
+		if res.Memory != nil && !slices.Contains(stores, res.Memory) {
+			stores = append(stores, res.Memory)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, mem := range stores {
+		if mem == nil {
+			continue
+		}
+		if err := mem.PruneSpamBlocks(r.ctx, now.Add(-spamOffenseMemory)); err != nil {
+			slog.Warn("failed to prune spam blocks", "error", err)
+		}
+	}
+}
+
+// SpamBlocks returns the currently active spam blocks for a server, soonest expiry first.
+func (r *Router) SpamBlocks(serverID string) []memory.SpamBlock {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.agentsByServerID[serverID]; !ok {
+		r.tryHotLoad(serverID) // restores persisted blocks for agents not yet loaded
+	}
+
+	now := time.Now()
+	prefix := serverID + ":"
+	blocks := []memory.SpamBlock{}
+	for key, rec := range r.spamMap {
+		userID, ok := strings.CutPrefix(key, prefix)
+		if !ok || !now.Before(rec.blockedUntil) {
+			continue
+		}
+		blocks = append(blocks, memory.SpamBlock{ServerID: serverID, UserID: userID, BlockedUntil: rec.blockedUntil, Offenses: rec.offenses})
+	}
+	slices.SortFunc(blocks, func(a, b memory.SpamBlock) int { return a.BlockedUntil.Compare(b.BlockedUntil) })
+	return blocks
+}
+
+// Unblock lifts a user's spam block on a server and clears their offense history.
+// Returns false if the user was not blocked.
+func (r *Router) Unblock(ctx context.Context, serverID, userID string) (bool, error) {
+	// The delete runs under r.mu so that it is ordered against the save in
+	// onSpamBlock.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resources, ok := r.agentsByServerID[serverID]
+	if !ok {
+		resources = r.tryHotLoad(serverID)
+	}
+	key := serverID + ":" + userID
+	rec, found := r.spamMap[key]
+	wasBlocked := found && time.Now().Before(rec.blockedUntil)
+	delete(r.spamMap, key)
+
+	if resources != nil && resources.Memory != nil {
+		if err := resources.Memory.DeleteSpamBlock(ctx, serverID, userID); err != nil {
+			return wasBlocked, err
+		}
+	}
+	if wasBlocked {
+		slog.Info("spam block lifted", "server_id", serverID, "user_id", userID)
+	}
+	return wasBlocked, nil
+}
+
+// WaitForDrain waits for all active agents and the spam cleanup loop to
+// finish, up to 30 seconds. The router context must be cancelled first.
 func (r *Router) WaitForDrain() {
 	done := make(chan struct{})
 	go func() {
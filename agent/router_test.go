@@ -2,7 +2,9 @@ package agent
 
 import (
 	"context"
+	"fmt"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
@@ -10,6 +12,8 @@ import (
 
 	"github.com/tomasmach/vespra/config"
 	"github.com/tomasmach/vespra/llm"
+	"github.com/tomasmach/vespra/memory"
+	"github.com/tomasmach/vespra/tools"
 )
 
 func newTestRouter(t *testing.T) *Router {
@@ -106,10 +110,12 @@ func registerFakeAgent(t *testing.T, r *Router, serverID string, ignoreUsers []s
 func TestSpamBlockAfterThreshold(t *testing.T) {
 	r := newTestRouter(t)
 
-	// Call checkSpam spamThreshold-1 times — should not be blocked yet.
+	policy := resolveSpamPolicy(nil)
+
+	// Call checkSpam threshold-1 times — should not be blocked yet.
 	r.mu.Lock()
-	for i := 0; i < spamThreshold-1; i++ {
-		blocked, _ := r.checkSpam("srv1", "user1")
+	for i := 0; i < defaultSpamThreshold-1; i++ {
+		blocked, _ := r.checkSpam("srv1", "user1", policy)
 		if blocked {
 			r.mu.Unlock()
 			t.Fatalf("user blocked early at call %d", i+1)
@@ -117,7 +123,7 @@ func TestSpamBlockAfterThreshold(t *testing.T) {
 	}
 
 	// The threshold-th call triggers the block.
-	blocked, justBlocked := r.checkSpam("srv1", "user1")
+	blocked, justBlocked := r.checkSpam("srv1", "user1", policy)
 	r.mu.Unlock()
 
 	if !blocked {
@@ -129,7 +135,7 @@ func TestSpamBlockAfterThreshold(t *testing.T) {
 
 	// Subsequent call should return blocked but not justBlocked.
 	r.mu.Lock()
-	blocked2, justBlocked2 := r.checkSpam("srv1", "user1")
+	blocked2, justBlocked2 := r.checkSpam("srv1", "user1", policy)
 	r.mu.Unlock()
 
 	if !blocked2 {
@@ -148,7 +154,7 @@ func TestSpamBlockExpires(t *testing.T) {
 	r.spamMap["srv1:user1"] = &spamRecord{
 		blockedUntil: time.Now().Add(-1 * time.Second),
 	}
-	blocked, _ := r.checkSpam("srv1", "user1")
+	blocked, _ := r.checkSpam("srv1", "user1", resolveSpamPolicy(nil))
 	r.mu.Unlock()
 
 	if blocked {
@@ -156,6 +162,180 @@ func TestSpamBlockExpires(t *testing.T) {
 	}
 }
 
+func TestSpamPolicyFromConfig(t *testing.T) {
+	p := resolveSpamPolicy(&config.AgentConfig{Spam: config.SpamConfig{
+		WindowSeconds:      5,
+		Threshold:          3,
+		CooldownMinutes:    10,
+		MaxCooldownMinutes: 30,
+	}})
+	if p.window != 5*time.Second || p.threshold != 3 {
+		t.Errorf("window/threshold = %v/%d, want 5s/3", p.window, p.threshold)
+	}
+	want := []time.Duration{10 * time.Minute, 20 * time.Minute, 30 * time.Minute, 30 * time.Minute}
+	for i, w := range want {
+		if got := p.cooldownFor(i + 1); got != w {
+			t.Errorf("cooldownFor(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestSpamCooldownEscalates(t *testing.T) {
+	r := newTestRouter(t)
+	policy := resolveSpamPolicy(&config.AgentConfig{Spam: config.SpamConfig{Threshold: 1, CooldownMinutes: 10}})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A block that expired recently counts as a prior offense.
+	r.spamMap["srv1:user1"] = &spamRecord{blockedUntil: time.Now().Add(-time.Minute), offenses: 1}
+	if blocked, justBlocked := r.checkSpam("srv1", "user1", policy); !blocked || !justBlocked {
+		t.Fatalf("checkSpam = %v/%v, want blocked", blocked, justBlocked)
+	}
+	rec := r.spamMap["srv1:user1"]
+	if rec.offenses != 2 {
+		t.Errorf("offenses = %d, want 2", rec.offenses)
+	}
+	if remaining := time.Until(rec.blockedUntil); remaining < 19*time.Minute {
+		t.Errorf("second offense cooldown = %v, want ~20m", remaining)
+	}
+
+	// An offense older than spamOffenseMemory is forgotten.
+	r.spamMap["srv1:user2"] = &spamRecord{blockedUntil: time.Now().Add(-spamOffenseMemory - time.Minute), offenses: 3}
+	r.checkSpam("srv1", "user2", policy)
+	if got := r.spamMap["srv1:user2"].offenses; got != 1 {
+		t.Errorf("offenses after long quiet period = %d, want 1", got)
+	}
+}
+
+func TestSpamPolicyExemptRoles(t *testing.T) {
+	p := resolveSpamPolicy(&config.AgentConfig{Spam: config.SpamConfig{ExemptRoles: []string{"mods"}}})
+	if !p.exempt([]string{"everyone", "mods"}) {
+		t.Error("member with exempt role should be exempt")
+	}
+	if p.exempt([]string{"everyone"}) {
+		t.Error("member without exempt role should not be exempt")
+	}
+	if p.exempt(nil) {
+		t.Error("DM messages (no roles) should not be exempt")
+	}
+}
+
+func TestSpamBlocksAndUnblock(t *testing.T) {
+	r := newTestRouter(t)
+	registerFakeAgent(t, r, "srv1", nil)
+
+	r.mu.Lock()
+	r.spamMap["srv1:user1"] = &spamRecord{blockedUntil: time.Now().Add(time.Hour), offenses: 2}
+	r.spamMap["srv1:user2"] = &spamRecord{blockedUntil: time.Now().Add(-time.Minute), offenses: 1}
+	r.spamMap["srv2:user1"] = &spamRecord{blockedUntil: time.Now().Add(time.Hour), offenses: 1}
+	r.mu.Unlock()
+
+	blocks := r.SpamBlocks("srv1")
+	if len(blocks) != 1 || blocks[0].UserID != "user1" || blocks[0].Offenses != 2 {
+		t.Fatalf("SpamBlocks = %+v, want only active block for user1", blocks)
+	}
+
+	ok, err := r.Unblock(context.Background(), "srv1", "user1")
+	if err != nil || !ok {
+		t.Fatalf("Unblock = %v, %v; want true, nil", ok, err)
+	}
+	if blocks := r.SpamBlocks("srv1"); len(blocks) != 0 {
+		t.Errorf("SpamBlocks after Unblock = %+v, want none", blocks)
+	}
+	if ok, _ := r.Unblock(context.Background(), "srv1", "user1"); ok {
+		t.Error("second Unblock should report no active block")
+	}
+}
+
+func TestSpamBlockPersistsAcrossRouters(t *testing.T) {
+	r := newTestRouter(t)
+	mem, err := memory.New(&config.MemoryConfig{DBPath: filepath.Join(t.TempDir(), "agent.db")}, r.llm)
+	if err != nil {
+		t.Fatalf("memory.New: %v", err)
+	}
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := mem.SaveSpamBlock(context.Background(), memory.SpamBlock{ServerID: "srv1", UserID: "user1", BlockedUntil: until, Offenses: 2}); err != nil {
+		t.Fatalf("SaveSpamBlock: %v", err)
+	}
+
+	r2, err := NewRouter(context.Background(), r.cfgStore, r.llm, nil, map[string]*AgentResources{
+		"srv1": {Config: &config.AgentConfig{}, Memory: mem},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	blocks := r2.SpamBlocks("srv1")
+	if len(blocks) != 1 || !blocks[0].BlockedUntil.Equal(until) || blocks[0].Offenses != 2 {
+		t.Fatalf("restored blocks = %+v, want user1 until %v", blocks, until)
+	}
+
+	if _, err := r2.Unblock(context.Background(), "srv1", "user1"); err != nil {
+		t.Fatalf("Unblock: %v", err)
+	}
+	rows, err := mem.ListSpamBlocks(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatalf("ListSpamBlocks: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("persisted blocks after Unblock = %+v, want none", rows)
+	}
+}
+
+func TestUnblockRightAfterBlockLeavesNothingPersisted(t *testing.T) {
+	r := newTestRouter(t)
+	mem, err := memory.New(&config.MemoryConfig{DBPath: filepath.Join(t.TempDir(), "agent.db")}, r.llm)
+	if err != nil {
+		t.Fatalf("memory.New: %v", err)
+	}
+	resources := &AgentResources{Config: &config.AgentConfig{}, Memory: mem}
+	r.mu.Lock()
+	r.agentsByServerID["srv1"] = resources
+	r.mu.Unlock()
+
+	policy := resolveSpamPolicy(nil)
+	r.mu.Lock()
+	for range defaultSpamThreshold {
+		if _, justBlocked := r.checkSpam("srv1", "user1", policy); justBlocked {
+			r.onSpamBlock(resources, "chan1", "srv1", "user1")
+		}
+	}
+	r.mu.Unlock()
+
+	if ok, err := r.Unblock(context.Background(), "srv1", "user1"); err != nil || !ok {
+		t.Fatalf("Unblock = %v, %v; want true, nil", ok, err)
+	}
+	rows, err := mem.ListSpamBlocks(context.Background(), time.Time{})
+	if err != nil {
+		t.Fatalf("ListSpamBlocks: %v", err)
+	}
+	if len(rows) != 0 {
+		t.Errorf("persisted blocks after Unblock = %+v, want none", rows)
+	}
+}
+
+func TestPruneSpamDropsStaleRecords(t *testing.T) {
+	r := newTestRouter(t)
+	now := time.Now()
+
+	r.mu.Lock()
+	r.spamMap["srv1:idle"] = &spamRecord{timestamps: []time.Time{now.Add(-2 * maxSpamWindow)}}
+	r.spamMap["srv1:recent"] = &spamRecord{timestamps: []time.Time{now.Add(-time.Second)}}
+	r.spamMap["srv1:offender"] = &spamRecord{blockedUntil: now.Add(-time.Hour), offenses: 1}
+	r.spamMap["srv1:forgiven"] = &spamRecord{blockedUntil: now.Add(-spamOffenseMemory - time.Hour), offenses: 1}
+	r.mu.Unlock()
+
+	r.pruneSpam(now)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, want := range map[string]bool{"srv1:idle": false, "srv1:recent": true, "srv1:offender": true, "srv1:forgiven": false} {
+		if _, ok := r.spamMap[key]; ok != want {
+			t.Errorf("spamMap[%q] present = %v, want %v", key, ok, want)
+		}
+	}
+}
+
 func TestRestartAgentEvictsChannelAgents(t *testing.T) {
 	r := newTestRouter(t)
 	registerFakeAgent(t, r, "srv1", nil)
@@ -213,3 +393,454 @@ func TestIgnoreUserDropsMessage(t *testing.T) {
 		t.Error("ignored user message should not spawn an agent")
 	}
 }
+
+func TestAccessAllowed(t *testing.T) {
+	// "Only respond to @Members in #general, never to @Muted", plus a VIP user.
+	access := &config.AccessConfig{
+		AllowRoles:    []string{"members"},
+		DenyRoles:     []string{"muted"},
+		AllowUsers:    []string{"vip"},
+		DenyUsers:     []string{"troll"},
+		AllowChannels: []string{"general", "support-category"},
+		DenyChannels:  []string{"support-private"},
+	}
+	tests := []struct {
+		name     string
+		userID   string
+		roles    []string
+		channels []string
+		want     bool
+	}{
+		{"member in allowed channel", "u1", []string{"members"}, []string{"general"}, true},
+		{"member elsewhere", "u1", []string{"members"}, []string{"random"}, false},
+		{"non-member", "u1", []string{"guests"}, []string{"general"}, false},
+		{"muted member", "u1", []string{"members", "muted"}, []string{"general"}, false},
+		{"allowed user without role", "vip", nil, []string{"general"}, true},
+		{"denied user with role", "troll", []string{"members"}, []string{"general"}, false},
+		{"channel in allowed category", "u1", []string{"members"}, []string{"help", "support-category"}, true},
+		{"thread under denied channel", "u1", []string{"members"}, []string{"thread1", "support-private", "support-category"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := accessAllowed(access, tt.userID, tt.roles, tt.channels); got != tt.want {
+				t.Errorf("accessAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !accessAllowed(&config.AccessConfig{}, "anyone", nil, []string{"any"}) {
+		t.Error("empty access rules should allow everyone")
+	}
+}
+
+func TestRouteDeniedByAccessRulesDropsMessage(t *testing.T) {
+	r := newTestRouter(t)
+	r.mu.Lock()
+	r.agentsByServerID["srv1"] = &AgentResources{
+		Config: &config.AgentConfig{Access: config.AccessConfig{DenyRoles: []string{"muted"}}},
+	}
+	r.mu.Unlock()
+
+	msg := fakeMsg("srv1", "chan1", "user1")
+	msg.Member = &discordgo.Member{Roles: []string{"muted"}}
+	r.Route(msg)
+
+	r.mu.Lock()
+	_, exists := r.agents["chan1"]
+	_, tracked := r.spamMap["srv1:user1"]
+	r.mu.Unlock()
+	if exists {
+		t.Error("denied message should not spawn an agent")
+	}
+	if tracked {
+		t.Error("denied message should not count towards spam limits")
+	}
+}
+
+func TestMemberRolesFallsBackToState(t *testing.T) {
+	state := discordgo.NewState()
+	if err := state.GuildAdd(&discordgo.Guild{ID: "srv1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.MemberAdd(&discordgo.Member{GuildID: "srv1", User: &discordgo.User{ID: "user1"}, Roles: []string{"members"}}); err != nil {
+		t.Fatal(err)
+	}
+	session := &discordgo.Session{State: state}
+
+	msg := fakeMsg("srv1", "chan1", "user1")
+	if got := memberRoles(session, msg); !slices.Equal(got, []string{"members"}) {
+		t.Errorf("memberRoles from state = %v, want [members]", got)
+	}
+	msg.Member = &discordgo.Member{Roles: []string{"fresh"}}
+	if got := memberRoles(session, msg); !slices.Equal(got, []string{"fresh"}) {
+		t.Errorf("memberRoles from event = %v, want [fresh]", got)
+	}
+}
+
+func TestChannelLineageIncludesThreadParentAndCategory(t *testing.T) {
+	state := discordgo.NewState()
+	if err := state.GuildAdd(&discordgo.Guild{ID: "srv1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []*discordgo.Channel{
+		{ID: "cat", GuildID: "srv1", Type: discordgo.ChannelTypeGuildCategory},
+		{ID: "general", GuildID: "srv1", ParentID: "cat"},
+		{ID: "thread", GuildID: "srv1", ParentID: "general", Type: discordgo.ChannelTypeGuildPublicThread},
+	} {
+		if err := state.ChannelAdd(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := channelLineage(&discordgo.Session{State: state}, "thread")
+	if want := []string{"thread", "general", "cat"}; !slices.Equal(got, want) {
+		t.Errorf("channelLineage = %v, want %v", got, want)
+	}
+}
+
+func TestChannelNSFWFollowsThreadParent(t *testing.T) {
+	state := discordgo.NewState()
+	if err := state.GuildAdd(&discordgo.Guild{ID: "srv1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ch := range []*discordgo.Channel{
+		{ID: "general", GuildID: "srv1"},
+		{ID: "lounge", GuildID: "srv1", NSFW: true},
+		{ID: "lounge-thread", GuildID: "srv1", ParentID: "lounge", Type: discordgo.ChannelTypeGuildPublicThread},
+		{ID: "general-thread", GuildID: "srv1", ParentID: "general", Type: discordgo.ChannelTypeGuildPublicThread},
+	} {
+		if err := state.ChannelAdd(ch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session := &discordgo.Session{State: state}
+
+	for channelID, want := range map[string]bool{"general": false, "lounge": true, "lounge-thread": true, "general-thread": false, "uncached": false} {
+		if got := channelNSFW(session, channelID); got != want {
+			t.Errorf("channelNSFW(%s) = %v, want %v", channelID, got, want)
+		}
+	}
+}
+
+func TestSelectPersonas(t *testing.T) {
+	r := newTestRouter(t)
+	ownBot := &discordgo.Session{State: discordgo.NewState()}
+	ownBot.State.User = &discordgo.User{ID: "bot-max"}
+	res := &AgentResources{
+		Config: &config.AgentConfig{Personas: []config.PersonaConfig{
+			{ID: "luna", Name: "Luna"},
+			{ID: "max", Name: "Maxwell", Default: true},
+		}},
+		PersonaSessions: map[string]*discordgo.Session{"max": ownBot},
+	}
+	msg := func(channelID, content string) *discordgo.MessageCreate {
+		m := fakeMsg("srv1", channelID, "user1")
+		m.Content = content
+		return m
+	}
+	ids := func(ps []*config.PersonaConfig) []string {
+		var out []string
+		for _, p := range ps {
+			out = append(out, p.ID)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		msg  *discordgo.MessageCreate
+		want []string
+	}{
+		{"unaddressed goes to default persona", msg("chan1", "hello"), []string{"max"}},
+		{"addressed by name", msg("chan1", "Luna, how are you?"), []string{"luna"}},
+		{"sticky after being addressed", msg("chan1", "and what about tomorrow?"), []string{"luna"}},
+		{"sticky is per channel", msg("chan2", "hello"), []string{"max"}},
+		{"mention of own bot user", msg("chan1", "<@bot-max> hi"), []string{"max"}},
+		{"both addressed", msg("chan1", "Luna and Maxwell, hi"), []string{"luna", "max"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.mu.Lock()
+			got := ids(r.selectPersonas(res, tt.msg))
+			r.mu.Unlock()
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selectPersonas = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The sticky pick expires after personaStickyWindow.
+	r.mu.Lock()
+	r.lastPersona["chan1"] = personaPick{id: "luna", at: time.Now().Add(-personaStickyWindow - time.Second)}
+	got := ids(r.selectPersonas(res, msg("chan1", "hello")))
+	r.mu.Unlock()
+	if !slices.Equal(got, []string{"max"}) {
+		t.Errorf("after sticky window: selectPersonas = %v, want [max]", got)
+	}
+}
+
+func TestSelectPersonasWithoutPersonas(t *testing.T) {
+	r := newTestRouter(t)
+	r.mu.Lock()
+	got := r.selectPersonas(&AgentResources{Config: &config.AgentConfig{}}, fakeMsg("srv1", "chan1", "user1"))
+	r.mu.Unlock()
+	if len(got) != 1 || got[0] != nil {
+		t.Errorf("selectPersonas = %v, want a single nil persona", got)
+	}
+}
+
+func TestFirstDeliveryDeduplicatesMessages(t *testing.T) {
+	r := newTestRouter(t)
+	now := time.Now()
+	if !r.firstDelivery("m1", now) {
+		t.Fatal("first arrival of m1 reported as duplicate")
+	}
+	if r.firstDelivery("m1", now) {
+		t.Error("second arrival of m1 not reported as duplicate")
+	}
+	if !r.firstDelivery("m2", now) {
+		t.Error("m2 reported as duplicate")
+	}
+}
+
+func TestPruneSpamDropsStaleBotChains(t *testing.T) {
+	r := newTestRouter(t)
+	now := time.Now()
+
+	r.mu.Lock()
+	r.botChains["cooling"] = &botChain{depth: 7, cooldownUntil: now.Add(time.Minute), lastMessage: now}
+	r.botChains["cooled"] = &botChain{depth: 7, cooldownUntil: now.Add(-time.Minute), lastMessage: now.Add(-2 * time.Minute)}
+	r.botChains["active"] = &botChain{depth: 2, lastMessage: now.Add(-time.Minute)}
+	r.botChains["idle"] = &botChain{depth: 2, lastMessage: now.Add(-2 * botChainIdle)}
+	r.mu.Unlock()
+
+	r.pruneSpam(now)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for channelID, want := range map[string]bool{"cooling": true, "cooled": false, "active": true, "idle": false} {
+		if _, ok := r.botChains[channelID]; ok != want {
+			t.Errorf("chain %s kept = %v, want %v", channelID, ok, want)
+		}
+	}
+}
+
+func TestRouteDropsBotMessagesOutsideOptedInChannels(t *testing.T) {
+	r := newTestRouter(t)
+	registerFakeAgent(t, r, "srv1", nil)
+
+	msg := fakeMsg("srv1", "chan1", "other-bot")
+	msg.Author.Bot = true
+	r.Route(msg)
+
+	r.mu.Lock()
+	_, exists := r.agents["chan1"]
+	r.mu.Unlock()
+	if exists {
+		t.Error("bot message in a channel without allow_bots should not spawn an agent")
+	}
+}
+
+func TestBotLoopGuard(t *testing.T) {
+	r := newTestRouter(t)
+	res := &AgentResources{Config: &config.AgentConfig{Channels: []config.ChannelConfig{
+		{ID: "roleplay", AllowBots: true, MaxBotTurns: 2, BotCooldownSeconds: 60},
+	}}}
+	botMsg := func(channelID string) *discordgo.MessageCreate {
+		m := fakeMsg("srv1", channelID, "other-bot")
+		m.Author.Bot = true
+		return m
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.allowBotMessage(res, botMsg("general"), now) {
+		t.Error("bot message allowed in a channel without allow_bots")
+	}
+	for turn := 1; turn <= 2; turn++ {
+		if !r.allowBotMessage(res, botMsg("roleplay"), now) {
+			t.Fatalf("bot turn %d dropped, want allowed up to max_bot_turns", turn)
+		}
+	}
+	if r.allowBotMessage(res, botMsg("roleplay"), now) {
+		t.Fatal("bot turn past max_bot_turns allowed")
+	}
+	if r.allowBotMessage(res, botMsg("roleplay"), now.Add(30*time.Second)) {
+		t.Error("bot message allowed during cooldown")
+	}
+	if !r.allowBotMessage(res, botMsg("roleplay"), now.Add(61*time.Second)) {
+		t.Error("bot message dropped after cooldown ended")
+	}
+
+	// A human message resets the chain.
+	r.allowBotMessage(res, botMsg("roleplay"), now.Add(62*time.Second))
+	r.resetBotChain("roleplay")
+	if !r.allowBotMessage(res, botMsg("roleplay"), now.Add(63*time.Second)) {
+		t.Error("bot message dropped after a human reset the chain")
+	}
+	if got := r.botChains["roleplay"].depth; got != 1 {
+		t.Errorf("depth after reset = %d, want 1", got)
+	}
+}
+
+func TestRoutePersonasTalkToEachOther(t *testing.T) {
+	r := newTestRouter(t)
+	luna := &discordgo.Session{State: discordgo.NewState()}
+	luna.State.User = &discordgo.User{ID: "bot-luna"}
+	maxwell := &discordgo.Session{State: discordgo.NewState()}
+	maxwell.State.User = &discordgo.User{ID: "bot-max"}
+	inbox := map[string]chan *discordgo.MessageCreate{}
+	r.mu.Lock()
+	r.agentsByServerID["srv1"] = &AgentResources{
+		Config: &config.AgentConfig{
+			Personas: []config.PersonaConfig{{ID: "luna", Name: "Luna", Default: true}, {ID: "max", Name: "Maxwell"}},
+			Channels: []config.ChannelConfig{{ID: "roleplay", AllowBots: true}},
+		},
+		PersonaSessions: map[string]*discordgo.Session{"luna": luna, "max": maxwell},
+	}
+	for _, id := range []string{"luna", "max"} {
+		inbox[id] = make(chan *discordgo.MessageCreate, 100)
+		r.agents["roleplay#"+id] = &ChannelAgent{channelID: "roleplay", serverID: "srv1", msgCh: inbox[id], cancel: func() {}}
+	}
+	r.mu.Unlock()
+
+	for i, content := range []string{"Maxwell, what do you think?", "Luna here, talking to myself."} {
+		msg := fakeMsg("srv1", "roleplay", "bot-luna")
+		msg.ID = fmt.Sprintf("luna-%d", i)
+		msg.Author.Bot = true
+		msg.Content = content
+		r.Route(msg)
+	}
+
+	if n := len(inbox["max"]); n != 2 {
+		t.Errorf("Maxwell received %d of Luna's messages, want 2", n)
+	}
+	if n := len(inbox["luna"]); n != 0 {
+		t.Errorf("Luna received %d of her own messages, want 0", n)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.spamMap) != 0 {
+		t.Errorf("persona messages were spam-tracked: %v", r.spamMap)
+	}
+}
+
+func TestRouteDropsMessagesOnlyOwnAccountWouldAnswer(t *testing.T) {
+	r := newTestRouter(t)
+	shared := &discordgo.Session{State: discordgo.NewState()}
+	shared.State.User = &discordgo.User{ID: "bot-vespra"}
+	r.mu.Lock()
+	r.agentsByServerID["srv1"] = &AgentResources{
+		Config: &config.AgentConfig{
+			Personas: []config.PersonaConfig{{ID: "luna", Name: "Luna", Default: true}, {ID: "max", Name: "Maxwell"}},
+			Channels: []config.ChannelConfig{{ID: "roleplay", AllowBots: true}},
+		},
+		Session: shared,
+	}
+	r.mu.Unlock()
+
+	// Both personas answer from the shared bot, which wrote the message.
+	msg := fakeMsg("srv1", "roleplay", "bot-vespra")
+	msg.Author.Bot = true
+	msg.Content = "Maxwell, your turn."
+	r.Route(msg)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.agents) != 0 {
+		t.Errorf("the shared bot's own message spawned agents: %v", r.agents)
+	}
+	if c := r.botChains["roleplay"]; c != nil && c.depth > 0 {
+		t.Errorf("the shared bot's own message deepened the bot chain to %d", c.depth)
+	}
+}
+
+func TestRouteSkipsSpamTrackingForBots(t *testing.T) {
+	r := newTestRouter(t)
+	registerFakeAgent(t, r, "srv1", nil)
+
+	for i := range defaultSpamThreshold + 1 {
+		msg := fakeMsg("srv1", "chan1", "other-bot")
+		msg.ID = fmt.Sprintf("bot-%d", i)
+		msg.Author.Bot = true
+		r.Route(msg)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.spamMap) != 0 {
+		t.Errorf("bot messages outside opted-in channels were spam-tracked: %v", r.spamMap)
+	}
+}
+
+func TestToolReportAppliesPolicies(t *testing.T) {
+	r := newTestRouter(t)
+	cfg := r.cfgStore.Get()
+	cfg.Tools.Image.APIKey = "fal-key"
+	cfg.Agents = []config.AgentConfig{{
+		ID:       "a1",
+		ServerID: "srv1",
+		Tools:    config.AgentToolsConfig{ToolPolicy: config.ToolPolicy{Deny: []string{"memory_forget"}}},
+		Channels: []config.ChannelConfig{
+			{ID: "work", Tools: config.ToolPolicy{Deny: []string{"generate_image", "react"}}},
+			{ID: "lab", Tools: config.ToolPolicy{Allow: []string{"memory_*"}}},
+		},
+	}}
+	r.mu.Lock()
+	r.agentsByServerID["srv1"] = &AgentResources{Config: &cfg.Agents[0], Images: tools.NewImageQueue(1)}
+	r.mu.Unlock()
+
+	report, ok := r.ToolReport(context.Background(), "srv1")
+	if !ok {
+		t.Fatal("ToolReport found no agent")
+	}
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"catalog", report.Tools, []string{"generate_image", "memory_forget", "memory_recall", "memory_save", "memory_update", "react", "reply"}},
+		{"default", report.Default, []string{"generate_image", "memory_recall", "memory_save", "memory_update", "react", "reply"}},
+		{"deny in channel", report.Channels["work"], []string{"memory_recall", "memory_save", "memory_update", "reply"}},
+		{"allow keeps reply", report.Channels["lab"], []string{"memory_recall", "memory_save", "memory_update", "reply"}},
+	}
+	for _, tt := range tests {
+		if !slices.Equal(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if _, ok := r.ToolReport(context.Background(), "unknown"); ok {
+		t.Error("ToolReport reported tools for an unconfigured server")
+	}
+}
+
+func TestImageQueueConcurrencyFollowsConfig(t *testing.T) {
+	r := newTestRouter(t)
+	cfg := r.cfgStore.Get()
+	cfg.Tools.Image = config.ImageConfig{APIKey: "fal-key", Concurrency: 2}
+	cfg.Agents = []config.AgentConfig{{ID: "a1", ServerID: "srv1", DBPath: filepath.Join(t.TempDir(), "srv1.db"), Image: config.AgentImageConfig{Concurrency: 3}}}
+
+	if mem := r.MemoryForServer("srv1"); mem == nil {
+		t.Fatal("agent not hot-loaded")
+	}
+	r.MemoryForServer("DM:u1")
+	r.mu.Lock()
+	agentQueue, dmQueue := r.agentsByServerID["srv1"].Images, r.agentsByServerID["DM:u1"].Images
+	r.mu.Unlock()
+	if agentQueue.Limit() != 3 || dmQueue.Limit() != 2 {
+		t.Fatalf("limits = %d, %d; want the resolved concurrency 3, 2", agentQueue.Limit(), dmQueue.Limit())
+	}
+
+	// Reports only read the config.
+	cfg.Agents[0].Image.Concurrency = 5
+	r.ToolReport(context.Background(), "srv1")
+	if got := agentQueue.Limit(); got != 3 {
+		t.Errorf("limit after ToolReport = %d, want 3", got)
+	}
+
+	r.ApplyConfig(cfg)
+	if got := agentQueue.Limit(); got != 5 {
+		t.Errorf("limit after ApplyConfig = %d, want 5", got)
+	}
+}
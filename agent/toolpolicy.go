@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/tomasmach/vespra/config"
+	"github.com/tomasmach/vespra/tools"
+)
+
+// toolPolicies returns the tool policies that apply in a channel, converted for
+// the registry. See config.ResolveToolPolicies.
+func toolPolicies(cfg *config.Config, serverID string, lineage []string) []tools.ToolPolicy {
+	resolved := cfg.ResolveToolPolicies(serverID, lineage)
+	if len(resolved) == 0 {
+		return nil
+	}
+	policies := make([]tools.ToolPolicy, len(resolved))
+	for i, p := range resolved {
+		policies[i] = tools.ToolPolicy{Allow: p.Allow, Deny: p.Deny}
+	}
+	return policies
+}
+
+// ToolReport lists the tools an agent offers the model, with and without its
+// channel overrides.
+type ToolReport struct {
+	Tools    []string            `json:"tools"`    // everything the agent can offer before policies apply
+	Default  []string            `json:"default"`  // offered in channels without a tools override
+	Channels map[string][]string `json:"channels"` // offered in each configured channel, keyed by channel ID
+}
+
+// ToolReport resolves which tools the agent for serverID offers in each of its
+// configured channels. Plugins and MCP servers the agent uses are started if
+// they are not running yet; ones that are not ready before ctx is done are
+// left out. Returns false if no agent is configured for serverID.
+func (r *Router) ToolReport(ctx context.Context, serverID string) (ToolReport, bool) {
+	r.mu.Lock()
+	resources := r.agentsByServerID[serverID]
+	if resources == nil {
+		resources = r.tryHotLoad(serverID)
+	}
+	r.mu.Unlock()
+	if resources == nil {
+		return ToolReport{}, false
+	}
+
+	// A bare agent builds the same registry a channel turn would, minus the
+	// policies, so the catalog matches what the model can be offered.
+	a := &ChannelAgent{
+		serverID:    serverID,
+		memoryScope: serverID,
+		cfgStore:    r.cfgStore,
+		resources:   resources,
+		plugins:     r.plugins,
+		webCache:    r.webCache,
+		fetchClient: r.fetchClient,
+		ctx:         ctx,
+		logger:      slog.With("server_id", serverID),
+	}
+	reg := tools.NewDefaultRegistry(resources.Memory, serverID, 0, 0, nil, nil, a.webSearchDeps(), a.imageGenDeps(nil, nil, nil, nil), 0, a.agentToolsDeps(ctx, nil))
+	a.registerExternalTools(ctx, reg)
+
+	cfg := r.cfgStore.Get()
+	report := ToolReport{
+		Tools:    reg.Names(),
+		Channels: make(map[string][]string),
+	}
+	report.Default = effectiveTools(report.Tools, toolPolicies(cfg, serverID, nil))
+	if agentCfg := a.currentAgentConfig(); agentCfg != nil {
+		for _, ch := range agentCfg.Channels {
+			report.Channels[ch.ID] = effectiveTools(report.Tools, toolPolicies(cfg, serverID, []string{ch.ID}))
+		}
+	}
+	return report, true
+}
+
+// effectiveTools returns the names that every policy allows.
+func effectiveTools(names []string, policies []tools.ToolPolicy) []string {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		if tools.PoliciesAllow(policies, name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
@@ -17,7 +17,10 @@ type AgentOps interface {
 	UpsertAgent(input config.AgentConfig) error
 	UpdateAgentMode(serverID, mode string) error
 	UpdateAgentChannel(serverID, channelID, mode string) error
+	UpdateAgentChannelSoul(serverID, channelID, soulName string) error
+	UpdateAgentChannelBots(serverID, channelID string, allow bool) error
 	UpdateAgentLanguage(serverID, language string) error
+	ModifyAgentAccess(serverID string, modify func(*config.AccessConfig)) (config.AccessConfig, error)
 	CfgStore() *config.Store
 }
 
@@ -112,7 +115,9 @@ func (b *Bot) onMessageCreate(s *discordgo.Session, msg *discordgo.MessageCreate
 	if msg.Author == nil {
 		return
 	}
-	if msg.Author.ID == s.State.User.ID || msg.Author.Bot {
+	// Other bots' messages are passed on; the router drops them outside channels
+	// that opt in to bot-to-bot conversation.
+	if msg.Author.ID == s.State.User.ID {
 		return
 	}
 	// Skip Discord system messages (pins, joins, boosts, etc.); only handle actual user messages.
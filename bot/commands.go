@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 
@@ -22,6 +24,26 @@ var modeChoices = []*discordgo.ApplicationCommandOptionChoice{
 	{Name: "none", Value: config.ModeNone},
 }
 
+// accessTargetOptions are the optional role/user/channel targets shared by the /access subcommands.
+var accessTargetOptions = []*discordgo.ApplicationCommandOption{
+	{
+		Type:        discordgo.ApplicationCommandOptionRole,
+		Name:        "role",
+		Description: "A role",
+	},
+	{
+		Type:        discordgo.ApplicationCommandOptionUser,
+		Name:        "user",
+		Description: "A user",
+	},
+	{
+		Type:         discordgo.ApplicationCommandOptionChannel,
+		Name:         "channel",
+		Description:  "A channel or category",
+		ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildCategory},
+	},
+}
+
 // commandDefinitions is the full set of slash commands registered for each guild.
 var commandDefinitions = []*discordgo.ApplicationCommand{
 	{
@@ -83,6 +105,45 @@ var commandDefinitions = []*discordgo.ApplicationCommand{
 					},
 				},
 			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "soul",
+				Description: "Use a named soul for a channel or every channel in a category",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "The channel or category to configure",
+						Required:     true,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildCategory},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionString,
+						Name:        "soul",
+						Description: "Soul name from the agent's soul library (leave empty to clear)",
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "bots",
+				Description: "Let the bot answer other bots in a channel or category",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionChannel,
+						Name:         "channel",
+						Description:  "The channel or category to configure",
+						Required:     true,
+						ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText, discordgo.ChannelTypeGuildCategory},
+					},
+					{
+						Type:        discordgo.ApplicationCommandOptionBoolean,
+						Name:        "enabled",
+						Description: "Whether bot messages are processed",
+						Required:    true,
+					},
+				},
+			},
 		},
 	},
 	{
@@ -141,6 +202,61 @@ var commandDefinitions = []*discordgo.ApplicationCommand{
 		Description:              "Restart the agent, clearing all active channel sessions",
 		DefaultMemberPermissions: &manageGuildPerm,
 	},
+	{
+		Name:                     "access",
+		Description:              "Control who the bot answers and where",
+		DefaultMemberPermissions: &manageGuildPerm,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "allow",
+				Description: "Only answer the given roles/users, or only in the given channels",
+				Options:     accessTargetOptions,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "deny",
+				Description: "Never answer the given role/user, or never in the given channel",
+				Options:     accessTargetOptions,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "remove",
+				Description: "Remove a role/user/channel from both allow and deny rules",
+				Options:     accessTargetOptions,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "show",
+				Description: "Show the current access rules",
+			},
+		},
+	},
+	{
+		Name:                     "spam",
+		Description:              "Inspect and lift anti-spam blocks",
+		DefaultMemberPermissions: &manageGuildPerm,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "list",
+				Description: "List users currently blocked for spamming",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "unblock",
+				Description: "Lift a user's spam block and reset their offense count",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionUser,
+						Name:        "user",
+						Description: "The user to unblock",
+						Required:    true,
+					},
+				},
+			},
+		},
+	},
 }
 
 // RegisterCommands bulk-overwrites all slash commands for a guild.
@@ -188,6 +304,10 @@ func (b *Bot) handleSlashCommand(s *discordgo.Session, i *discordgo.InteractionC
 		b.handleMemory(s, i)
 	case "restart":
 		b.handleRestart(s, i)
+	case "access":
+		b.handleAccess(s, i)
+	case "spam":
+		b.handleSpam(s, i)
 	}
 }
 
@@ -234,6 +354,45 @@ func (b *Bot) handleChannel(s *discordgo.Session, i *discordgo.InteractionCreate
 			return
 		}
 		respondEphemeral(s, i, fmt.Sprintf("Channel override removed for <#%s>.", channelID))
+	case "soul":
+		var channelID, soulName string
+		for _, opt := range opts {
+			switch opt.Name {
+			case "channel":
+				channelID = opt.ChannelValue(s).ID
+			case "soul":
+				soulName = opt.StringValue()
+			}
+		}
+		if err := b.ops.UpdateAgentChannelSoul(i.GuildID, channelID, soulName); err != nil {
+			respondEphemeral(s, i, fmt.Sprintf("Failed to set channel soul: %v", err))
+			return
+		}
+		if soulName == "" {
+			respondEphemeral(s, i, fmt.Sprintf("Soul selection cleared for <#%s>.", channelID))
+		} else {
+			respondEphemeral(s, i, fmt.Sprintf("<#%s> now uses the **%s** soul.", channelID, soulName))
+		}
+	case "bots":
+		var channelID string
+		var enabled bool
+		for _, opt := range opts {
+			switch opt.Name {
+			case "channel":
+				channelID = opt.ChannelValue(s).ID
+			case "enabled":
+				enabled = opt.BoolValue()
+			}
+		}
+		if err := b.ops.UpdateAgentChannelBots(i.GuildID, channelID, enabled); err != nil {
+			respondEphemeral(s, i, fmt.Sprintf("Failed to update bot conversation: %v", err))
+			return
+		}
+		if enabled {
+			respondEphemeral(s, i, fmt.Sprintf("Bot-to-bot conversation enabled in <#%s>.", channelID))
+		} else {
+			respondEphemeral(s, i, fmt.Sprintf("Bot-to-bot conversation disabled in <#%s>.", channelID))
+		}
 	}
 }
 
@@ -275,6 +434,12 @@ func (b *Bot) handleStatus(s *discordgo.Session, i *discordgo.InteractionCreate)
 		} else {
 			for _, ch := range a.Channels {
 				channelLines += fmt.Sprintf("\n  <#%s> (%s)", ch.ID, ch.ResponseMode)
+				if ch.Soul != "" {
+					channelLines += fmt.Sprintf(" soul: %s", ch.Soul)
+				}
+				if ch.AllowBots {
+					channelLines += " bots: on"
+				}
 			}
 		}
 
@@ -360,3 +525,130 @@ func (b *Bot) handleRestart(s *discordgo.Session, i *discordgo.InteractionCreate
 	b.router.RestartAgent(i.GuildID)
 	respondEphemeral(s, i, "Agent restarted. All channel sessions cleared.")
 }
+
+func (b *Bot) handleAccess(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	sub, opts := subcommandData(i)
+
+	if sub == "show" {
+		var access config.AccessConfig
+		for _, a := range b.ops.CfgStore().Get().Agents {
+			if a.ServerID == i.GuildID {
+				access = a.Access
+				break
+			}
+		}
+		respondEphemeral(s, i, formatAccess(access))
+		return
+	}
+
+	var roleID, userID, channelID string
+	for _, opt := range opts {
+		switch opt.Name {
+		case "role":
+			roleID = opt.RoleValue(nil, "").ID
+		case "user":
+			userID = opt.UserValue(nil).ID
+		case "channel":
+			channelID = opt.ChannelValue(nil).ID
+		}
+	}
+	if roleID == "" && userID == "" && channelID == "" {
+		respondEphemeral(s, i, "Pick at least one role, user, or channel.")
+		return
+	}
+
+	// The change is applied to the latest rules under the config write lock,
+	// so concurrent edits from other admins or the web UI are kept.
+	access, err := b.ops.ModifyAgentAccess(i.GuildID, func(access *config.AccessConfig) {
+		// Each target lives in at most one of its allow/deny lists.
+		type rule struct {
+			id          string
+			allow, deny *[]string
+		}
+		for _, r := range []rule{
+			{roleID, &access.AllowRoles, &access.DenyRoles},
+			{userID, &access.AllowUsers, &access.DenyUsers},
+			{channelID, &access.AllowChannels, &access.DenyChannels},
+		} {
+			if r.id == "" {
+				continue
+			}
+			*r.allow = slices.DeleteFunc(*r.allow, func(v string) bool { return v == r.id })
+			*r.deny = slices.DeleteFunc(*r.deny, func(v string) bool { return v == r.id })
+			switch sub {
+			case "allow":
+				*r.allow = append(*r.allow, r.id)
+			case "deny":
+				*r.deny = append(*r.deny, r.id)
+			}
+		}
+	})
+	if err != nil {
+		respondEphemeral(s, i, fmt.Sprintf("Failed to update access rules: %v", err))
+		return
+	}
+	respondEphemeral(s, i, "Access rules updated.\n\n"+formatAccess(access))
+}
+
+// formatAccess renders access rules as Discord mentions.
+func formatAccess(a config.AccessConfig) string {
+	var sb strings.Builder
+	sb.WriteString("**Access rules**")
+	empty := true
+	line := func(label, format string, ids []string) {
+		if len(ids) == 0 {
+			return
+		}
+		empty = false
+		mentions := make([]string, len(ids))
+		for n, id := range ids {
+			mentions[n] = fmt.Sprintf(format, id)
+		}
+		fmt.Fprintf(&sb, "\n%s: %s", label, strings.Join(mentions, ", "))
+	}
+	line("Allowed roles", "<@&%s>", a.AllowRoles)
+	line("Denied roles", "<@&%s>", a.DenyRoles)
+	line("Allowed users", "<@%s>", a.AllowUsers)
+	line("Denied users", "<@%s>", a.DenyUsers)
+	line("Allowed channels", "<#%s>", a.AllowChannels)
+	line("Denied channels", "<#%s>", a.DenyChannels)
+	if empty {
+		sb.WriteString("\nNone — the bot answers everyone, everywhere its response mode allows.")
+	}
+	return sb.String()
+}
+
+func (b *Bot) handleSpam(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	sub, opts := subcommandData(i)
+	switch sub {
+	case "list":
+		blocks := b.router.SpamBlocks(i.GuildID)
+		if len(blocks) == 0 {
+			respondEphemeral(s, i, "No users are currently blocked.")
+			return
+		}
+		result := fmt.Sprintf("**%d blocked users**\n", len(blocks))
+		for _, blk := range blocks {
+			result += fmt.Sprintf("\n<@%s> until <t:%d:R> (offense %d)", blk.UserID, blk.BlockedUntil.Unix(), blk.Offenses)
+		}
+		respondEphemeral(s, i, result)
+
+	case "unblock":
+		var userID string
+		for _, opt := range opts {
+			if opt.Name == "user" {
+				userID = opt.UserValue(nil).ID
+			}
+		}
+		ok, err := b.router.Unblock(context.Background(), i.GuildID, userID)
+		if err != nil {
+			respondEphemeral(s, i, fmt.Sprintf("Failed to unblock user: %v", err))
+			return
+		}
+		if !ok {
+			respondEphemeral(s, i, fmt.Sprintf("<@%s> is not blocked.", userID))
+			return
+		}
+		respondEphemeral(s, i, fmt.Sprintf("<@%s> unblocked.", userID))
+	}
+}
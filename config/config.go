@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
@@ -40,7 +43,9 @@ type Config struct {
 }
 
 type WebConfig struct {
-	Addr string `toml:"addr"` // default ":8080"
+	Addr      string `toml:"addr"`                // default ":8080"
+	AuthToken string `toml:"auth_token" json:"-"` // bearer token required by the memory MCP endpoint
+	MCP       bool   `toml:"mcp"`                 // serve agent memory over MCP at /api/agents/{id}/mcp
 }
 
 type BotConfig struct {
@@ -81,6 +86,8 @@ type TurnConfig struct {
 	MemoryRecallLimit        int     `toml:"memory_recall_limit"`
 	MemoryDedupThreshold     float64 `toml:"memory_dedup_threshold"`
 	MemoryRecallThreshold    float64 `toml:"memory_recall_threshold"`
+	KnowledgeRecallLimit     int     `toml:"knowledge_recall_limit"`  // knowledge base passages in the system prompt
+	AttachmentTokenBudget    int     `toml:"attachment_token_budget"` // text attachments inlined per turn; larger files are summarized
 	SendRateLimit            int     `toml:"send_rate_limit"`
 	SendRateWindowSeconds    int     `toml:"send_rate_window_seconds"`
 	MaxReplyParts            int     `toml:"max_reply_parts"`
@@ -91,49 +98,287 @@ type ResponseConfig struct {
 }
 
 type ToolsConfig struct {
-	WebTimeoutSeconds int          `toml:"web_timeout_seconds"`
-	Search            SearchConfig `toml:"search"`
-	Image             ImageConfig  `toml:"image"`
+	WebTimeoutSeconds int            `toml:"web_timeout_seconds"`
+	Search            SearchConfig   `toml:"search"`
+	Image             ImageConfig    `toml:"image"`
+	Plugins           []PluginConfig `toml:"plugins"`
+	MCP               []MCPConfig    `toml:"mcp"`
+	DM                ToolPolicy     `toml:"dm"` // tool policy for direct messages
+	Network           NetworkConfig  `toml:"network"`
+	Cache             CacheConfig    `toml:"cache"`
+}
+
+// CacheConfig sizes the on-disk cache that web_fetch and web_search share
+// across agents. Fetched pages are kept as long as their Cache-Control,
+// Expires or ETag headers allow; search results for SearchTTLMinutes. The
+// directory and size are read at startup.
+type CacheConfig struct {
+	Dir              string `toml:"dir"`                // default <data dir>/webcache
+	MaxSizeMB        int    `toml:"max_size_mb"`        // default 100; negative disables the cache
+	SearchTTLMinutes int    `toml:"search_ttl_minutes"` // default 60; negative disables search caching
+}
+
+// NetworkConfig limits where web_fetch and media downloads may connect.
+// Loopback, private and link-local addresses are always refused unless
+// AllowPrivateNetworks is set.
+type NetworkConfig struct {
+	AllowDomains         []string `toml:"allow_domains"` // when set, only these domains and their subdomains
+	DenyDomains          []string `toml:"deny_domains"`
+	AllowPrivateNetworks bool     `toml:"allow_private_networks"`
+}
+
+// PluginConfig declares an external tool plugin: an executable speaking the
+// stdio JSON-RPC protocol documented in tools/plugin.go. Agents opt in by name.
+type PluginConfig struct {
+	Name           string            `toml:"name"`
+	Command        string            `toml:"command"`
+	Args           []string          `toml:"args"`
+	Env            map[string]string `toml:"env"`             // values are expanded with $VAR from Vespra's environment
+	TimeoutSeconds int               `toml:"timeout_seconds"` // per call, default 30
+}
+
+// MCPConfig declares a Model Context Protocol server, launched over stdio
+// (command) or reached over streamable HTTP (url). Agents opt in by name.
+type MCPConfig struct {
+	Name           string            `toml:"name"`
+	Command        string            `toml:"command"`
+	Args           []string          `toml:"args"`
+	Env            map[string]string `toml:"env"`             // values are expanded with $VAR from Vespra's environment
+	URL            string            `toml:"url"`             // streamable HTTP endpoint
+	Headers        map[string]string `toml:"headers"`         // values are expanded with $VAR, e.g. "Bearer $TOKEN"
+	TimeoutSeconds int               `toml:"timeout_seconds"` // per call, default 30
 }
 
 type ImageConfig struct {
+	Provider            string `toml:"provider"` // "fal" (default) | "openai" | "a1111"
+	BaseURL             string `toml:"base_url"` // API base URL; required for a1111
 	APIKey              string `toml:"api_key" json:"-"`
 	Model               string `toml:"model"`
 	EditModel           string `toml:"edit_model"`
 	Resolution          string `toml:"resolution"`
 	EnableSafetyChecker *bool  `toml:"enable_safety_checker"`
+	Moderated           bool   `toml:"moderated"` // an openai base_url other than api.openai.com screens its output
 	TimeoutSeconds      int    `toml:"timeout_seconds"`
+	Concurrency         int    `toml:"concurrency"` // generations an agent runs at once, default 1; the rest queue
+	DailyLimit          int    `toml:"daily_limit"` // images each user may generate per UTC day; 0 is unlimited
 }
 
+// Image generation providers.
+const (
+	ImageProviderFal    = "fal"
+	ImageProviderOpenAI = "openai"
+	ImageProviderA1111  = "a1111"
+)
+
+var validImageProviders = map[string]bool{ImageProviderFal: true, ImageProviderOpenAI: true, ImageProviderA1111: true}
+
+// Image safety levels of a channel. NSFW output is only ever sent in channels
+// Discord marks age-restricted and in DMs; elsewhere nsfw acts as strict.
+const (
+	ImageSafetyStrict   = "strict"   // the provider's safety checker is on and flagged images are withheld
+	ImageSafetyNSFW     = "nsfw"     // no safety checker; flagged images are sent behind spoilers
+	ImageSafetyDisabled = "disabled" // no image generation
+)
+
+var validImageSafety = map[string]bool{ImageSafetyStrict: true, ImageSafetyNSFW: true, ImageSafetyDisabled: true}
+
+// SearchConfig configures web_search. Providers lists the search backends in
+// fallback order; when it is empty, Provider is used alone.
 type SearchConfig struct {
-	Provider string `toml:"provider"` // "brave" | "glm" (default)
-	APIKey   string `toml:"api_key" json:"-"`
-	Timeout  int    `toml:"timeout_seconds"` // default 30
+	Provider   string   `toml:"provider"` // "brave" | "glm" (default) | "searxng" | "knowledge"
+	Providers  []string `toml:"providers"`
+	Mode       string   `toml:"mode"` // "async" (default) | "sync"
+	APIKey     string   `toml:"api_key" json:"-"`
+	SearXNGURL string   `toml:"searxng_url"`
+	Timeout    int      `toml:"timeout_seconds"` // default 30
+}
+
+// Search modes. Async searches answer in a later turn; sync searches return
+// their results to the model within the turn.
+const (
+	SearchModeAsync = "async"
+	SearchModeSync  = "sync"
+)
+
+// validSearchProviders lists the names accepted in search provider lists.
+var validSearchProviders = map[string]bool{"brave": true, "glm": true, "searxng": true, "knowledge": true}
+
+// validateSearchProviders checks that every name is a known search provider.
+func validateSearchProviders(names []string) error {
+	for _, name := range names {
+		if !validSearchProviders[name] {
+			return fmt.Errorf("search provider %q is invalid (must be brave, glm, searxng, or knowledge)", name)
+		}
+	}
+	return nil
+}
+
+// AgentSearchConfig overrides the web_search settings for one agent.
+type AgentSearchConfig struct {
+	Providers []string `toml:"providers,omitempty" json:"providers,omitempty"`
+	Mode      string   `toml:"mode,omitempty" json:"mode,omitempty"` // "" inherits tools.search.mode
+}
+
+// validateSearchMode checks a search mode; empty means the default.
+func validateSearchMode(mode string) error {
+	if mode != "" && mode != SearchModeAsync && mode != SearchModeSync {
+		return fmt.Errorf("search mode %q is invalid (must be async or sync)", mode)
+	}
+	return nil
 }
 
 type AgentConfig struct {
-	ID           string           `toml:"id" json:"id"`
-	ServerID     string           `toml:"server_id" json:"server_id"`
-	Token        string           `toml:"token" json:"-"`
-	SoulFile     string           `toml:"soul_file" json:"soul_file,omitempty"`
-	DBPath       string           `toml:"db_path" json:"db_path,omitempty"`
-	ResponseMode string           `toml:"response_mode" json:"response_mode,omitempty"`
-	Language     string           `toml:"language" json:"language,omitempty"`
-	Provider     string           `toml:"provider" json:"provider,omitempty"` // "openrouter" | "glm" | "fireworks" | "" (inherit global)
-	Model        string           `toml:"model" json:"model,omitempty"`       // model name override; "" = use global
-	IgnoreUsers  []string         `toml:"ignore_users,omitempty" json:"ignore_users,omitempty"`
-	Channels     []ChannelConfig  `toml:"channels" json:"channels,omitempty"`
-	Image        AgentImageConfig `toml:"image" json:"image,omitempty"`
+	ID           string            `toml:"id" json:"id"`
+	ServerID     string            `toml:"server_id" json:"server_id"`
+	Token        string            `toml:"token" json:"-"`
+	SoulFile     string            `toml:"soul_file" json:"soul_file,omitempty"`
+	DBPath       string            `toml:"db_path" json:"db_path,omitempty"`
+	ResponseMode string            `toml:"response_mode" json:"response_mode,omitempty"`
+	Language     string            `toml:"language" json:"language,omitempty"`
+	Provider     string            `toml:"provider" json:"provider,omitempty"` // "openrouter" | "glm" | "fireworks" | "" (inherit global)
+	Model        string            `toml:"model" json:"model,omitempty"`       // model name override; "" = use global
+	IgnoreUsers  []string          `toml:"ignore_users,omitempty" json:"ignore_users,omitempty"`
+	Channels     []ChannelConfig   `toml:"channels" json:"channels,omitempty"`
+	Image        AgentImageConfig  `toml:"image" json:"image,omitempty"`
+	Spam         SpamConfig        `toml:"spam" json:"spam,omitempty"`
+	Access       AccessConfig      `toml:"access" json:"access,omitempty"`
+	Personas     []PersonaConfig   `toml:"personas,omitempty" json:"personas,omitempty"`
+	Plugins      []string          `toml:"plugins,omitempty" json:"plugins,omitempty"` // names from [[tools.plugins]]
+	MCP          []AgentMCPConfig  `toml:"mcp,omitempty" json:"mcp,omitempty"`
+	Tools        AgentToolsConfig  `toml:"tools" json:"tools,omitempty"`
+	Search       AgentSearchConfig `toml:"search" json:"search,omitempty"`
+}
+
+// AgentToolsConfig holds per-agent tool definitions and the agent's tool policy.
+type AgentToolsConfig struct {
+	ToolPolicy
+	HTTP []HTTPToolConfig `toml:"http,omitempty" json:"http,omitempty"`
+}
+
+// ToolPolicy limits the tools offered to the model. Entries are tool names or
+// glob patterns such as "wiki_*". Deny wins; a non-empty allow list must match.
+// The reply tool is always offered.
+type ToolPolicy struct {
+	Allow []string `toml:"allow,omitempty" json:"allow,omitempty"`
+	Deny  []string `toml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+// IsZero reports whether the policy restricts nothing.
+func (p ToolPolicy) IsZero() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+// validate checks that every entry is a usable glob pattern.
+func (p ToolPolicy) validate() error {
+	for _, pattern := range slices.Concat(p.Allow, p.Deny) {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("tool pattern %q is invalid", pattern)
+		}
+	}
+	return nil
+}
+
+// HTTPToolConfig declares a tool that calls an HTTP endpoint. {name}
+// placeholders in URL are filled from the arguments; the remaining arguments go
+// in the query string (GET, DELETE) or a JSON body.
+type HTTPToolConfig struct {
+	Name           string            `toml:"name" json:"name"`
+	Description    string            `toml:"description" json:"description"`
+	Parameters     map[string]any    `toml:"parameters,omitempty" json:"parameters,omitempty"` // JSON schema as a TOML table
+	Method         string            `toml:"method,omitempty" json:"method,omitempty"`         // default GET
+	URL            string            `toml:"url" json:"url"`
+	Headers        map[string]string `toml:"headers,omitempty" json:"headers,omitempty"`                 // values are expanded with $VAR from Vespra's environment
+	Extract        string            `toml:"extract,omitempty" json:"extract,omitempty"`                 // JSONPath into the response, e.g. "$.data[0].name"
+	MaxLength      int               `toml:"max_length,omitempty" json:"max_length,omitempty"`           // characters returned to the model, default 8000
+	TimeoutSeconds int               `toml:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"` // default 15
+}
+
+// AgentMCPConfig exposes one [[tools.mcp]] server to an agent. Tools limits
+// which of the server's tools are offered ("read_resource" for its
+// resources); empty means all.
+type AgentMCPConfig struct {
+	Server string   `toml:"server" json:"server"`
+	Tools  []string `toml:"tools,omitempty" json:"tools,omitempty"`
+}
+
+// PersonaConfig is one of several characters an agent can play on its server.
+// Each persona has its own soul, addressing name and memory namespace, and
+// optionally its own bot token; without one it speaks through the agent's bot.
+type PersonaConfig struct {
+	ID       string `toml:"id" json:"id"`                                   // memory namespace key
+	Name     string `toml:"name" json:"name"`                               // name users address the persona by
+	Soul     string `toml:"soul,omitempty" json:"soul,omitempty"`           // named soul in souls/<agent id>/
+	SoulFile string `toml:"soul_file,omitempty" json:"soul_file,omitempty"` // used when soul is empty
+	Token    string `toml:"token,omitempty" json:"-"`
+	Default  bool   `toml:"default,omitempty" json:"default,omitempty"` // handles unaddressed messages
+}
+
+// MemoryScope returns the memory namespace of the persona on serverID.
+func (p *PersonaConfig) MemoryScope(serverID string) string {
+	return serverID + "#" + p.ID
+}
+
+// DefaultPersona returns the persona marked default, else the first one,
+// or nil when the agent has no personas.
+func (a *AgentConfig) DefaultPersona() *PersonaConfig {
+	for i := range a.Personas {
+		if a.Personas[i].Default {
+			return &a.Personas[i]
+		}
+	}
+	if len(a.Personas) > 0 {
+		return &a.Personas[0]
+	}
+	return nil
+}
+
+// AccessConfig restricts who the agent answers and where.
+// Deny rules always win. A non-empty allow list admits only matching entries;
+// users match allow_users or allow_roles, channels match allow_channels by
+// channel, thread parent, or category ID.
+type AccessConfig struct {
+	AllowUsers    []string `toml:"allow_users,omitempty" json:"allow_users,omitempty"`
+	DenyUsers     []string `toml:"deny_users,omitempty" json:"deny_users,omitempty"`
+	AllowRoles    []string `toml:"allow_roles,omitempty" json:"allow_roles,omitempty"`
+	DenyRoles     []string `toml:"deny_roles,omitempty" json:"deny_roles,omitempty"`
+	AllowChannels []string `toml:"allow_channels,omitempty" json:"allow_channels,omitempty"`
+	DenyChannels  []string `toml:"deny_channels,omitempty" json:"deny_channels,omitempty"`
+}
+
+// SpamConfig holds per-agent anti-spam settings.
+// Zero values fall back to the built-in defaults in the agent router.
+type SpamConfig struct {
+	Disabled           bool     `toml:"disabled" json:"disabled,omitempty"`
+	WindowSeconds      int      `toml:"window_seconds" json:"window_seconds,omitempty"`             // default 30, max 3600
+	Threshold          int      `toml:"threshold" json:"threshold,omitempty"`                       // messages per window, default 10
+	CooldownMinutes    int      `toml:"cooldown_minutes" json:"cooldown_minutes,omitempty"`         // first offense, default 60
+	MaxCooldownMinutes int      `toml:"max_cooldown_minutes" json:"max_cooldown_minutes,omitempty"` // escalation cap, default 1440
+	ExemptRoles        []string `toml:"exempt_roles,omitempty" json:"exempt_roles,omitempty"`       // role IDs never rate limited
 }
 
 // AgentImageConfig holds per-agent image generation overrides.
 // Non-zero fields override the global [tools.image] settings.
 type AgentImageConfig struct {
+	Provider            string `toml:"provider" json:"provider,omitempty"` // "" inherits tools.image.provider
+	BaseURL             string `toml:"base_url" json:"base_url,omitempty"`
 	APIKey              string `toml:"api_key" json:"-"`
 	Model               string `toml:"model" json:"model,omitempty"`
 	EditModel           string `toml:"edit_model" json:"edit_model,omitempty"`
 	Resolution          string `toml:"resolution" json:"resolution,omitempty"`
 	EnableSafetyChecker *bool  `toml:"enable_safety_checker" json:"enable_safety_checker,omitempty"`
+	Moderated           bool   `toml:"moderated" json:"moderated,omitempty"`     // see ImageConfig.Moderated
+	Concurrency         int    `toml:"concurrency" json:"concurrency,omitempty"` // 0 inherits tools.image.concurrency
+	DailyLimit          int    `toml:"daily_limit" json:"daily_limit,omitempty"` // 0 inherits tools.image.daily_limit
+
+	Limits []ImageLimit `toml:"limits,omitempty" json:"limits,omitempty"` // per-user and per-role exceptions to daily_limit
+}
+
+// ImageLimit sets the daily image limit of one user or of a role's members.
+// A DailyLimit of 0 lifts the limit.
+type ImageLimit struct {
+	User       string `toml:"user,omitempty" json:"user,omitempty"`
+	Role       string `toml:"role,omitempty" json:"role,omitempty"`
+	DailyLimit int    `toml:"daily_limit" json:"daily_limit"`
 }
 
 // ResolveDBPath returns the DB path for this agent.
@@ -146,9 +391,79 @@ func (a *AgentConfig) ResolveDBPath(defaultDBPath string) string {
 	return filepath.Join(ResolveDataDir(defaultDBPath), "agents", a.ServerID, "memory.db")
 }
 
+// ChannelConfig holds per-channel overrides. ID may also be a category ID,
+// in which case Soul and the bot conversation settings apply to every channel
+// in that category.
 type ChannelConfig struct {
 	ID           string `toml:"id" json:"id"`
 	ResponseMode string `toml:"response_mode" json:"response_mode,omitempty"`
+	Soul         string `toml:"soul,omitempty" json:"soul,omitempty"` // named soul from souls/<agent id>/<soul>.md
+
+	// Bot-to-bot conversation; off unless allow_bots is set. Zero limits use the agent router defaults.
+	AllowBots          bool `toml:"allow_bots,omitempty" json:"allow_bots,omitempty"`
+	MaxBotTurns        int  `toml:"max_bot_turns,omitempty" json:"max_bot_turns,omitempty"`               // bot messages in a row without a human, default 6
+	BotCooldownSeconds int  `toml:"bot_cooldown_seconds,omitempty" json:"bot_cooldown_seconds,omitempty"` // pause after max_bot_turns, default 300
+
+	Tools ToolPolicy `toml:"tools,omitempty" json:"tools,omitzero"` // narrows the agent's tool policy in this channel
+
+	ImageSafety string `toml:"image_safety,omitempty" json:"image_safety,omitempty"` // "strict" | "nsfw" | "disabled"; "" follows enable_safety_checker
+	// AllowUnscreenedImages lets strict channels use image providers that
+	// cannot screen results (such as Automatic1111); flagged images are still withheld.
+	AllowUnscreenedImages bool `toml:"allow_unscreened_images,omitempty" json:"allow_unscreened_images,omitempty"`
+}
+
+var soulNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ValidSoulName reports whether name is a safe soul file stem.
+func ValidSoulName(name string) bool {
+	return soulNameRe.MatchString(name)
+}
+
+var urlPlaceholderRe = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// validHTTPMethods are the methods an HTTP tool may use.
+var validHTTPMethods = map[string]bool{"": true, "GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+// validateHTTPTools checks an agent's [[agents.tools.http]] entries.
+func validateHTTPTools(defs []HTTPToolConfig) error {
+	names := make(map[string]bool, len(defs))
+	for _, t := range defs {
+		if !soulNameRe.MatchString(t.Name) {
+			return fmt.Errorf("http tool name %q is invalid (use letters, digits, - and _ only)", t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("http tool %q is declared twice", t.Name)
+		}
+		names[t.Name] = true
+		if t.Description == "" {
+			return fmt.Errorf("http tool %s: description is required", t.Name)
+		}
+		if !strings.HasPrefix(t.URL, "http://") && !strings.HasPrefix(t.URL, "https://") {
+			return fmt.Errorf("http tool %s: url must be http or https", t.Name)
+		}
+		if !validHTTPMethods[strings.ToUpper(t.Method)] {
+			return fmt.Errorf("http tool %s: method %q is invalid (must be GET, POST, PUT, PATCH or DELETE)", t.Name, t.Method)
+		}
+		if t.Extract != "" && !strings.HasPrefix(t.Extract, "$") {
+			return fmt.Errorf("http tool %s: extract must be a JSONPath starting with $", t.Name)
+		}
+		if t.MaxLength < 0 || t.TimeoutSeconds < 0 {
+			return fmt.Errorf("http tool %s: max_length and timeout_seconds must not be negative", t.Name)
+		}
+		var props map[string]any
+		if t.Parameters != nil {
+			if typ, _ := t.Parameters["type"].(string); typ != "object" {
+				return fmt.Errorf("http tool %s: parameters must be a JSON schema with type = \"object\"", t.Name)
+			}
+			props, _ = t.Parameters["properties"].(map[string]any)
+		}
+		for _, m := range urlPlaceholderRe.FindAllStringSubmatch(t.URL, -1) {
+			if _, ok := props[m[1]]; !ok {
+				return fmt.Errorf("http tool %s: url placeholder {%s} is not a declared parameter", t.Name, m[1])
+			}
+		}
+	}
+	return nil
 }
 
 // ResolveDataDir returns the directory that should contain all DB files.
@@ -187,6 +502,10 @@ func Load(path string) (*Config, error) {
 		cfg.Tools.Image.APIKey = v
 		slog.Info("fal api key overridden by env var", "FAL_API_KEY", "***")
 	}
+	if v := os.Getenv("VESPRA_WEB_TOKEN"); v != "" {
+		cfg.Web.AuthToken = v
+		slog.Info("web auth token overridden by env var", "VESPRA_WEB_TOKEN", "***")
+	}
 	if v := os.Getenv("BRAVE_API_KEY"); v != "" {
 		cfg.Tools.Search.APIKey = v
 		slog.Info("brave api key overridden by env var", "BRAVE_API_KEY", "***")
@@ -232,6 +551,12 @@ func Load(path string) (*Config, error) {
 	if cfg.Agent.MemoryRecallLimit <= 0 {
 		cfg.Agent.MemoryRecallLimit = 15
 	}
+	if cfg.Agent.KnowledgeRecallLimit <= 0 {
+		cfg.Agent.KnowledgeRecallLimit = 4
+	}
+	if cfg.Agent.AttachmentTokenBudget <= 0 {
+		cfg.Agent.AttachmentTokenBudget = 8000
+	}
 	if cfg.Agent.MemoryDedupThreshold <= 0 {
 		cfg.Agent.MemoryDedupThreshold = 0.85
 	}
@@ -256,10 +581,19 @@ func Load(path string) (*Config, error) {
 	if cfg.Tools.Search.Provider == "" {
 		cfg.Tools.Search.Provider = "glm"
 	}
-	if cfg.Tools.Image.Model == "" {
+	if cfg.Tools.Cache.MaxSizeMB == 0 {
+		cfg.Tools.Cache.MaxSizeMB = 100
+	}
+	if cfg.Tools.Cache.SearchTTLMinutes == 0 {
+		cfg.Tools.Cache.SearchTTLMinutes = 60
+	}
+	if cfg.Tools.Image.Provider == "" {
+		cfg.Tools.Image.Provider = ImageProviderFal
+	}
+	if cfg.Tools.Image.Provider == ImageProviderFal && cfg.Tools.Image.Model == "" {
 		cfg.Tools.Image.Model = "fal-ai/flux/schnell"
 	}
-	if cfg.Tools.Image.EditModel == "" {
+	if cfg.Tools.Image.Provider == ImageProviderFal && cfg.Tools.Image.EditModel == "" {
 		cfg.Tools.Image.EditModel = "fal-ai/nano-banana-2/edit"
 	}
 	if cfg.Tools.Image.Resolution == "" {
@@ -268,6 +602,9 @@ func Load(path string) (*Config, error) {
 	if cfg.Tools.Image.TimeoutSeconds <= 0 {
 		cfg.Tools.Image.TimeoutSeconds = 120
 	}
+	if cfg.Tools.Image.Concurrency == 0 {
+		cfg.Tools.Image.Concurrency = 1
+	}
 	if cfg.Response.DefaultMode == "" {
 		cfg.Response.DefaultMode = ModeSmart
 	}
@@ -284,6 +621,67 @@ func Load(path string) (*Config, error) {
 	if !ValidModes[cfg.Response.DefaultMode] {
 		return nil, fmt.Errorf("response.default_mode %q is invalid (must be smart, mention, all, or none)", cfg.Response.DefaultMode)
 	}
+	plugins := make(map[string]bool, len(cfg.Tools.Plugins))
+	for _, p := range cfg.Tools.Plugins {
+		if p.Name == "" || p.Command == "" {
+			return nil, fmt.Errorf("tools.plugins: name and command are required")
+		}
+		if plugins[p.Name] {
+			return nil, fmt.Errorf("tools.plugins: plugin %q is declared twice", p.Name)
+		}
+		if p.TimeoutSeconds < 0 {
+			return nil, fmt.Errorf("tools.plugins: plugin %s timeout_seconds must not be negative", p.Name)
+		}
+		plugins[p.Name] = true
+	}
+	if err := cfg.Tools.DM.validate(); err != nil {
+		return nil, fmt.Errorf("tools.dm: %w", err)
+	}
+	for _, d := range slices.Concat(cfg.Tools.Network.AllowDomains, cfg.Tools.Network.DenyDomains) {
+		if strings.TrimSpace(d) == "" || strings.ContainsAny(d, "/: ") {
+			return nil, fmt.Errorf("tools.network: %q is not a domain name", d)
+		}
+	}
+	if err := validateSearchProviders(append([]string{cfg.Tools.Search.Provider}, cfg.Tools.Search.Providers...)); err != nil {
+		return nil, fmt.Errorf("tools.search: %w", err)
+	}
+	if !validImageProviders[cfg.Tools.Image.Provider] {
+		return nil, fmt.Errorf("tools.image: provider %q is invalid (must be fal, openai, or a1111)", cfg.Tools.Image.Provider)
+	}
+	if cfg.Tools.Image.Concurrency < 0 {
+		return nil, fmt.Errorf("tools.image: concurrency must not be negative")
+	}
+	if cfg.Tools.Image.DailyLimit < 0 {
+		return nil, fmt.Errorf("tools.image: daily_limit must not be negative")
+	}
+	if err := validateSearchMode(cfg.Tools.Search.Mode); err != nil {
+		return nil, fmt.Errorf("tools.search: %w", err)
+	}
+	if u := cfg.Tools.Search.SearXNGURL; u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return nil, fmt.Errorf("tools.search: searxng_url must be http or https")
+	}
+	if cfg.Web.MCP && cfg.Web.AuthToken == "" {
+		return nil, fmt.Errorf("web.mcp requires web.auth_token")
+	}
+	mcpServers := make(map[string]bool, len(cfg.Tools.MCP))
+	for _, m := range cfg.Tools.MCP {
+		if m.Name == "" {
+			return nil, fmt.Errorf("tools.mcp: name is required")
+		}
+		if mcpServers[m.Name] {
+			return nil, fmt.Errorf("tools.mcp: server %q is declared twice", m.Name)
+		}
+		if (m.Command == "") == (m.URL == "") {
+			return nil, fmt.Errorf("tools.mcp: server %s needs exactly one of command or url", m.Name)
+		}
+		if m.URL != "" && !strings.HasPrefix(m.URL, "http://") && !strings.HasPrefix(m.URL, "https://") {
+			return nil, fmt.Errorf("tools.mcp: server %s url must be http or https", m.Name)
+		}
+		if m.TimeoutSeconds < 0 {
+			return nil, fmt.Errorf("tools.mcp: server %s timeout_seconds must not be negative", m.Name)
+		}
+		mcpServers[m.Name] = true
+	}
 	validProviders := map[string]bool{"openrouter": true, "glm": true, "fireworks": true}
 	for _, agent := range cfg.Agents {
 		if agent.ServerID == "" {
@@ -301,10 +699,90 @@ func Load(path string) (*Config, error) {
 		if agent.Provider == "fireworks" && cfg.LLM.FireworksKey == "" {
 			return nil, fmt.Errorf("agent %s uses provider %q but llm.fireworks_key is not configured", agent.ID, agent.Provider)
 		}
+		if agent.Spam.WindowSeconds < 0 || agent.Spam.Threshold < 0 || agent.Spam.CooldownMinutes < 0 || agent.Spam.MaxCooldownMinutes < 0 {
+			return nil, fmt.Errorf("agent %s spam settings must not be negative", agent.ID)
+		}
+		if err := agent.Tools.ToolPolicy.validate(); err != nil {
+			return nil, fmt.Errorf("agent %s tools: %w", agent.ID, err)
+		}
+		if err := validateSearchProviders(agent.Search.Providers); err != nil {
+			return nil, fmt.Errorf("agent %s search: %w", agent.ID, err)
+		}
+		if err := validateSearchMode(agent.Search.Mode); err != nil {
+			return nil, fmt.Errorf("agent %s search: %w", agent.ID, err)
+		}
+		if agent.Image.Provider != "" && !validImageProviders[agent.Image.Provider] {
+			return nil, fmt.Errorf("agent %s image provider %q is invalid (must be fal, openai, or a1111)", agent.ID, agent.Image.Provider)
+		}
+		if agent.Image.Concurrency < 0 {
+			return nil, fmt.Errorf("agent %s image concurrency must not be negative", agent.ID)
+		}
+		if agent.Image.DailyLimit < 0 {
+			return nil, fmt.Errorf("agent %s image daily_limit must not be negative", agent.ID)
+		}
+		for _, l := range agent.Image.Limits {
+			if (l.User == "") == (l.Role == "") {
+				return nil, fmt.Errorf("agent %s image limits: each entry needs exactly one of user or role", agent.ID)
+			}
+			if l.DailyLimit < 0 {
+				return nil, fmt.Errorf("agent %s image limits: daily_limit must not be negative", agent.ID)
+			}
+		}
+		if agent.Spam.WindowSeconds > 3600 {
+			return nil, fmt.Errorf("agent %s spam.window_seconds (%d) must not exceed 3600", agent.ID, agent.Spam.WindowSeconds)
+		}
 		for _, ch := range agent.Channels {
 			if ch.ResponseMode != "" && !ValidModes[ch.ResponseMode] {
 				return nil, fmt.Errorf("agent %s channel %s response_mode %q is invalid (must be smart, mention, all, or none)", agent.ID, ch.ID, ch.ResponseMode)
 			}
+			if ch.Soul != "" && !ValidSoulName(ch.Soul) {
+				return nil, fmt.Errorf("agent %s channel %s soul %q is invalid (use letters, digits, - and _ only)", agent.ID, ch.ID, ch.Soul)
+			}
+			if ch.MaxBotTurns < 0 || ch.BotCooldownSeconds < 0 {
+				return nil, fmt.Errorf("agent %s channel %s bot conversation limits must not be negative", agent.ID, ch.ID)
+			}
+			if err := ch.Tools.validate(); err != nil {
+				return nil, fmt.Errorf("agent %s channel %s tools: %w", agent.ID, ch.ID, err)
+			}
+			if ch.ImageSafety != "" && !validImageSafety[ch.ImageSafety] {
+				return nil, fmt.Errorf("agent %s channel %s image_safety %q is invalid (must be strict, nsfw, or disabled)", agent.ID, ch.ID, ch.ImageSafety)
+			}
+		}
+		for _, name := range agent.Plugins {
+			if !plugins[name] {
+				return nil, fmt.Errorf("agent %s plugin %q is not declared in [[tools.plugins]]", agent.ID, name)
+			}
+		}
+		if err := validateHTTPTools(agent.Tools.HTTP); err != nil {
+			return nil, fmt.Errorf("agent %s: %w", agent.ID, err)
+		}
+		for _, m := range agent.MCP {
+			if !mcpServers[m.Server] {
+				return nil, fmt.Errorf("agent %s mcp server %q is not declared in [[tools.mcp]]", agent.ID, m.Server)
+			}
+		}
+		personaIDs := make(map[string]bool, len(agent.Personas))
+		defaults := 0
+		for _, p := range agent.Personas {
+			if !ValidSoulName(p.ID) {
+				return nil, fmt.Errorf("agent %s persona id %q is invalid (use letters, digits, - and _ only)", agent.ID, p.ID)
+			}
+			if personaIDs[p.ID] {
+				return nil, fmt.Errorf("agent %s persona id %q is duplicated", agent.ID, p.ID)
+			}
+			personaIDs[p.ID] = true
+			if strings.TrimSpace(p.Name) == "" {
+				return nil, fmt.Errorf("agent %s persona %s: name is required", agent.ID, p.ID)
+			}
+			if p.Soul != "" && !ValidSoulName(p.Soul) {
+				return nil, fmt.Errorf("agent %s persona %s soul %q is invalid (use letters, digits, - and _ only)", agent.ID, p.ID, p.Soul)
+			}
+			if p.Default {
+				defaults++
+			}
+		}
+		if defaults > 1 {
+			return nil, fmt.Errorf("agent %s has %d default personas (at most one allowed)", agent.ID, defaults)
 		}
 	}
 
@@ -360,6 +838,11 @@ func NewStore(path string) (*Store, error) {
 	return &Store{cfg: cfg, path: path}, nil
 }
 
+// Path returns the config file path, or "" for stores built with NewStoreFromConfig.
+func (s *Store) Path() string {
+	return s.path
+}
+
 func (s *Store) Get() *Config {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -397,6 +880,38 @@ func (cfg *Config) ResolveResponseMode(serverID, channelID string) string {
 	return cfg.Response.DefaultMode
 }
 
+// ResolveToolPolicies returns the tool policies that apply in a channel, all of
+// which must allow a tool. lineage lists the channel followed by its ancestors
+// (thread parent, category). DMs (server IDs prefixed with "DM:") use
+// tools.dm; otherwise the agent's policy applies, narrowed by the closest
+// channel entry in lineage that sets one.
+func (cfg *Config) ResolveToolPolicies(serverID string, lineage []string) []ToolPolicy {
+	var policies []ToolPolicy
+	if strings.HasPrefix(serverID, "DM:") {
+		if !cfg.Tools.DM.IsZero() {
+			policies = append(policies, cfg.Tools.DM)
+		}
+		return policies
+	}
+	for _, agent := range cfg.Agents {
+		if agent.ServerID != serverID {
+			continue
+		}
+		if !agent.Tools.ToolPolicy.IsZero() {
+			policies = append(policies, agent.Tools.ToolPolicy)
+		}
+		for _, id := range lineage {
+			for _, ch := range agent.Channels {
+				if ch.ID == id && !ch.Tools.IsZero() {
+					return append(policies, ch.Tools)
+				}
+			}
+		}
+		break
+	}
+	return policies
+}
+
 // ResolveLanguage returns the configured language for a server.
 // Priority: agent-level > "" (no language override).
 func (cfg *Config) ResolveLanguage(serverID, channelID string) string {
@@ -408,3 +923,150 @@ func (cfg *Config) ResolveLanguage(serverID, channelID string) string {
 	}
 	return ""
 }
+
+// ResolveImageConfig returns the image generation settings for serverID:
+// the agent's [agents.image] fields over tools.image. An agent that picks a
+// different provider inherits none of the global provider's key, base URL or
+// models.
+func (cfg *Config) ResolveImageConfig(serverID string) ImageConfig {
+	img := cfg.Tools.Image
+	for _, agent := range cfg.Agents {
+		if agent.ServerID != serverID {
+			continue
+		}
+		o := agent.Image
+		if o.Provider != "" && o.Provider != img.Provider {
+			img.Provider = o.Provider
+			img.APIKey, img.BaseURL, img.Model, img.EditModel = "", "", "", ""
+			img.Moderated = false
+		}
+		if o.BaseURL != "" {
+			img.BaseURL = o.BaseURL
+		}
+		if o.APIKey != "" {
+			img.APIKey = o.APIKey
+		}
+		if o.Model != "" {
+			img.Model = o.Model
+		}
+		if o.EditModel != "" {
+			img.EditModel = o.EditModel
+		}
+		if o.Moderated {
+			img.Moderated = true
+		}
+		if o.Resolution != "" {
+			img.Resolution = o.Resolution
+		}
+		if o.EnableSafetyChecker != nil {
+			img.EnableSafetyChecker = o.EnableSafetyChecker
+		}
+		if o.Concurrency > 0 {
+			img.Concurrency = o.Concurrency
+		}
+		if o.DailyLimit > 0 {
+			img.DailyLimit = o.DailyLimit
+		}
+		break
+	}
+	return img
+}
+
+// ResolveImageDailyLimit returns how many images userID may generate per UTC
+// day on serverID, 0 for no limit. An entry in the agent's image limits that
+// names the user wins; otherwise the most generous entry among the user's
+// roles applies, and without one the resolved daily_limit.
+func (cfg *Config) ResolveImageDailyLimit(serverID, userID string, roles []string) int {
+	for _, agent := range cfg.Agents {
+		if agent.ServerID != serverID {
+			continue
+		}
+		for _, l := range agent.Image.Limits {
+			if l.User != "" && l.User == userID {
+				return l.DailyLimit
+			}
+		}
+		best := -1
+		for _, l := range agent.Image.Limits {
+			if l.Role == "" || !slices.Contains(roles, l.Role) {
+				continue
+			}
+			if l.DailyLimit == 0 {
+				return 0
+			}
+			best = max(best, l.DailyLimit)
+		}
+		if best >= 0 {
+			return best
+		}
+		break
+	}
+	return cfg.ResolveImageConfig(serverID).DailyLimit
+}
+
+// ResolveImageSafety returns the configured image safety level of a channel.
+// lineage lists the channel followed by its ancestors (thread parent,
+// category); the closest entry that sets image_safety wins. Without one, the
+// resolved enable_safety_checker picks strict (the default) or nsfw. The
+// caller still applies Discord's age-restricted flag.
+func (cfg *Config) ResolveImageSafety(serverID string, lineage []string) string {
+	for _, agent := range cfg.Agents {
+		if agent.ServerID != serverID {
+			continue
+		}
+		for _, id := range lineage {
+			for _, ch := range agent.Channels {
+				if ch.ID == id && ch.ImageSafety != "" {
+					return ch.ImageSafety
+				}
+			}
+		}
+		break
+	}
+	if checker := cfg.ResolveImageConfig(serverID).EnableSafetyChecker; checker != nil && !*checker {
+		return ImageSafetyNSFW
+	}
+	return ImageSafetyStrict
+}
+
+// ResolveImageAllowUnscreened reports whether a channel, or one of its
+// ancestors in lineage, sets allow_unscreened_images.
+func (cfg *Config) ResolveImageAllowUnscreened(serverID string, lineage []string) bool {
+	for _, agent := range cfg.Agents {
+		if agent.ServerID != serverID {
+			continue
+		}
+		for _, id := range lineage {
+			for _, ch := range agent.Channels {
+				if ch.ID == id && ch.AllowUnscreenedImages {
+					return true
+				}
+			}
+		}
+		break
+	}
+	return false
+}
+
+// Usable reports whether the settings are enough to reach the provider: a
+// local a1111 server needs its base URL, hosted providers an API key.
+func (img ImageConfig) Usable() bool {
+	if img.Provider == ImageProviderA1111 {
+		return img.BaseURL != ""
+	}
+	return img.APIKey != ""
+}
+
+// ResolveSearchMode returns the web_search mode for serverID: the agent's
+// mode, else tools.search.mode, else async.
+func (cfg *Config) ResolveSearchMode(serverID string) string {
+	for _, agent := range cfg.Agents {
+		if agent.ServerID == serverID && agent.Search.Mode != "" {
+			return agent.Search.Mode
+		}
+	}
+	if cfg.Tools.Search.Mode != "" {
+		return cfg.Tools.Search.Mode
+	}
+	return SearchModeAsync
+}
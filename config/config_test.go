@@ -3,6 +3,8 @@ package config_test
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/tomasmach/vespra/config"
@@ -112,6 +114,51 @@ edit_model = "custom/edit-model"
 	}
 }
 
+func TestLoadImageProvider(t *testing.T) {
+	const base = `
+[bot]
+token = "test-token"
+
+[llm]
+openrouter_key = "test-key"
+`
+	tests := []struct {
+		name      string
+		extra     string
+		wantModel string
+		wantErr   bool
+	}{
+		{"fal defaults", "", "fal-ai/flux/schnell", false},
+		{"openai has no fal defaults", "[tools.image]\nprovider = \"openai\"\n", "", false},
+		{"unknown provider", "[tools.image]\nprovider = \"midjourney\"\n", "", true},
+		{"unknown agent provider", "[[agents]]\nid = \"a\"\nserver_id = \"s\"\n[agents.image]\nprovider = \"midjourney\"\n", "", true},
+		{"negative concurrency", "[tools.image]\nconcurrency = -1\n", "", true},
+		{"negative agent concurrency", "[[agents]]\nid = \"a\"\nserver_id = \"s\"\n[agents.image]\nconcurrency = -2\n", "", true},
+		{"negative daily limit", "[tools.image]\ndaily_limit = -1\n", "", true},
+		{"limit with user and role", "[[agents]]\nid = \"a\"\nserver_id = \"s\"\n[[agents.image.limits]]\nuser = \"u\"\nrole = \"r\"\ndaily_limit = 5\n", "", true},
+		{"role limit", "[[agents]]\nid = \"a\"\nserver_id = \"s\"\n[[agents.image.limits]]\nrole = \"r\"\ndaily_limit = 5\n", "fal-ai/flux/schnell", false},
+		{"unknown channel image safety", "[[agents]]\nid = \"a\"\nserver_id = \"s\"\n[[agents.channels]]\nid = \"c\"\nimage_safety = \"loose\"\n", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgFile := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(cfgFile, []byte(base+tt.extra), 0o600); err != nil {
+				t.Fatalf("write temp config: %v", err)
+			}
+			cfg, err := config.Load(cfgFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Tools.Image.Model != tt.wantModel {
+				t.Errorf("Tools.Image.Model = %q, want %q", cfg.Tools.Image.Model, tt.wantModel)
+			}
+			if err == nil && cfg.Tools.Image.Concurrency != 1 {
+				t.Errorf("Tools.Image.Concurrency = %d, want default 1", cfg.Tools.Image.Concurrency)
+			}
+		})
+	}
+}
+
 func TestResolveLanguage(t *testing.T) {
 	cfg := &config.Config{
 		Agents: []config.AgentConfig{
@@ -166,3 +213,382 @@ func TestResolveResponseModeEmptyChannelOverride(t *testing.T) {
 		t.Errorf("expected agent-level 'mention' when channel override is empty, got %q", got)
 	}
 }
+
+func TestLoadPersonas(t *testing.T) {
+	const base = `
+[bot]
+token = "test-token"
+
+[llm]
+openrouter_key = "test-key"
+
+[[agents]]
+id = "agent-1"
+server_id = "server-1"
+`
+	tests := []struct {
+		name     string
+		personas string
+		wantErr  bool
+	}{
+		{"valid", "[[agents.personas]]\nid = \"luna\"\nname = \"Luna\"\n[[agents.personas]]\nid = \"max\"\nname = \"Max\"\ndefault = true\n", false},
+		{"missing name", "[[agents.personas]]\nid = \"luna\"\n", true},
+		{"invalid id", "[[agents.personas]]\nid = \"../luna\"\nname = \"Luna\"\n", true},
+		{"duplicate id", "[[agents.personas]]\nid = \"luna\"\nname = \"Luna\"\n[[agents.personas]]\nid = \"luna\"\nname = \"Moon\"\n", true},
+		{"two defaults", "[[agents.personas]]\nid = \"a\"\nname = \"A\"\ndefault = true\n[[agents.personas]]\nid = \"b\"\nname = \"B\"\ndefault = true\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgFile := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(cfgFile, []byte(base+tt.personas), 0o600); err != nil {
+				t.Fatalf("write temp config: %v", err)
+			}
+			cfg, err := config.Load(cfgFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Agents[0].DefaultPersona().ID != "max" {
+				t.Errorf("DefaultPersona = %q, want max", cfg.Agents[0].DefaultPersona().ID)
+			}
+		})
+	}
+}
+
+func TestLoadMCPServers(t *testing.T) {
+	const base = `
+[bot]
+token = "test-token"
+
+[llm]
+openrouter_key = "test-key"
+
+[[agents]]
+id = "agent-1"
+server_id = "server-1"
+`
+	tests := []struct {
+		name    string
+		extra   string
+		wantErr bool
+	}{
+		{"stdio and http", "[[tools.mcp]]\nname = \"fs\"\ncommand = \"mcp-fs\"\n[[tools.mcp]]\nname = \"wiki\"\nurl = \"http://localhost:8000/mcp\"\n[[agents.mcp]]\nserver = \"wiki\"\ntools = [\"search\"]\n", false},
+		{"both command and url", "[[tools.mcp]]\nname = \"fs\"\ncommand = \"mcp-fs\"\nurl = \"http://localhost:8000/mcp\"\n", true},
+		{"neither command nor url", "[[tools.mcp]]\nname = \"fs\"\n", true},
+		{"bad url scheme", "[[tools.mcp]]\nname = \"wiki\"\nurl = \"ftp://localhost/mcp\"\n", true},
+		{"duplicate name", "[[tools.mcp]]\nname = \"fs\"\ncommand = \"a\"\n[[tools.mcp]]\nname = \"fs\"\ncommand = \"b\"\n", true},
+		{"undeclared agent server", "[[agents.mcp]]\nserver = \"missing\"\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgFile := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(cfgFile, []byte(base+tt.extra), 0o600); err != nil {
+				t.Fatalf("write temp config: %v", err)
+			}
+			if _, err := config.Load(cfgFile); (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadHTTPTools(t *testing.T) {
+	const base = `
+[bot]
+token = "test-token"
+
+[llm]
+openrouter_key = "test-key"
+
+[[agents]]
+id = "agent-1"
+server_id = "server-1"
+`
+	const valid = `
+[[agents.tools.http]]
+name = "ticket"
+description = "Look up a ticket"
+url = "https://tickets.internal/api/{id}"
+headers = { Authorization = "Bearer $TICKETS_TOKEN" }
+extract = "$.summary"
+[agents.tools.http.parameters]
+type = "object"
+required = ["id"]
+[agents.tools.http.parameters.properties.id]
+type = "string"
+`
+	tests := []struct {
+		name    string
+		extra   string
+		wantErr bool
+	}{
+		{"valid", valid, false},
+		{"undeclared placeholder", "[[agents.tools.http]]\nname = \"t\"\ndescription = \"d\"\nurl = \"https://x/{id}\"\n", true},
+		{"bad method", "[[agents.tools.http]]\nname = \"t\"\ndescription = \"d\"\nurl = \"https://x\"\nmethod = \"TRACE\"\n", true},
+		{"bad name", "[[agents.tools.http]]\nname = \"my tool\"\ndescription = \"d\"\nurl = \"https://x\"\n", true},
+		{"missing description", "[[agents.tools.http]]\nname = \"t\"\nurl = \"https://x\"\n", true},
+		{"bad extract", "[[agents.tools.http]]\nname = \"t\"\ndescription = \"d\"\nurl = \"https://x\"\nextract = \"data.name\"\n", true},
+		{"non-object schema", "[[agents.tools.http]]\nname = \"t\"\ndescription = \"d\"\nurl = \"https://x\"\nparameters = { type = \"string\" }\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgFile := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(cfgFile, []byte(base+tt.extra), 0o600); err != nil {
+				t.Fatalf("write temp config: %v", err)
+			}
+			cfg, err := config.Load(cfgFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Agents[0].Tools.HTTP[0].Headers["Authorization"] != "Bearer $TICKETS_TOKEN" {
+				t.Errorf("headers = %v, want $VAR references kept unexpanded in config", cfg.Agents[0].Tools.HTTP[0].Headers)
+			}
+		})
+	}
+}
+
+func TestResolveToolPolicies(t *testing.T) {
+	cfgFile := filepath.Join(t.TempDir(), "config.toml")
+	content := `
+[bot]
+token = "test-token"
+
+[llm]
+openrouter_key = "test-key"
+
+[tools.dm]
+deny = ["web_fetch"]
+
+[[agents]]
+id = "agent-1"
+server_id = "server-1"
+
+[agents.tools]
+deny = ["memory_forget"]
+
+[[agents.channels]]
+id = "category-1"
+tools = { deny = ["generate_image"] }
+
+[[agents.channels]]
+id = "thread-1"
+response_mode = "all"
+`
+	if err := os.WriteFile(cfgFile, []byte(content), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+	cfg, err := config.Load(cfgFile)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		serverID string
+		lineage  []string
+		want     []config.ToolPolicy
+	}{
+		{"agent policy only", "server-1", []string{"chan-9"}, []config.ToolPolicy{{Deny: []string{"memory_forget"}}}},
+		{"closest channel with a policy", "server-1", []string{"thread-1", "category-1"}, []config.ToolPolicy{{Deny: []string{"memory_forget"}}, {Deny: []string{"generate_image"}}}},
+		{"DM", "DM:user-1", []string{"dm-chan"}, []config.ToolPolicy{{Deny: []string{"web_fetch"}}}},
+		{"unknown server", "server-2", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cfg.ResolveToolPolicies(tt.serverID, tt.lineage)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveToolPolicies(%q, %v) = %v, want %v", tt.serverID, tt.lineage, got, tt.want)
+			}
+		})
+	}
+
+	bad := strings.Replace(content, `deny = ["memory_forget"]`, `deny = ["memory_["]`, 1)
+	if err := os.WriteFile(cfgFile, []byte(bad), 0o600); err != nil {
+		t.Fatalf("write temp config: %v", err)
+	}
+	if _, err := config.Load(cfgFile); err == nil {
+		t.Error("Load() accepted a malformed tool pattern")
+	}
+}
+
+func TestLoadSearchProviders(t *testing.T) {
+	const base = `
+[bot]
+token = "test-token"
+
+[llm]
+openrouter_key = "test-key"
+
+[[agents]]
+id = "agent-1"
+server_id = "server-1"
+`
+	tests := []struct {
+		name    string
+		extra   string
+		wantErr bool
+	}{
+		{"global and agent lists", "[agents.search]\nproviders = [\"knowledge\", \"brave\"]\n[tools.search]\nproviders = [\"searxng\", \"glm\"]\nsearxng_url = \"http://searx.lan:8888\"\n", false},
+		{"unknown global provider", "[tools.search]\nproviders = [\"bing\"]\n", true},
+		{"unknown single provider", "[tools.search]\nprovider = \"bing\"\n", true},
+		{"unknown agent provider", "[agents.search]\nproviders = [\"bing\"]\n", true},
+		{"bad searxng url", "[tools.search]\nsearxng_url = \"searx.lan\"\n", true},
+		{"unknown mode", "[tools.search]\nmode = \"later\"\n", true},
+		{"sync agent mode", "[agents.search]\nmode = \"sync\"\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgFile := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(cfgFile, []byte(base+tt.extra), 0o600); err != nil {
+				t.Fatalf("write temp config: %v", err)
+			}
+			if _, err := config.Load(cfgFile); (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveSearchMode(t *testing.T) {
+	cfg := &config.Config{
+		Tools: config.ToolsConfig{Search: config.SearchConfig{Mode: config.SearchModeSync}},
+		Agents: []config.AgentConfig{
+			{ServerID: "server1", Search: config.AgentSearchConfig{Mode: config.SearchModeAsync}},
+			{ServerID: "server2"},
+		},
+	}
+	if got := cfg.ResolveSearchMode("server1"); got != config.SearchModeAsync {
+		t.Errorf("agent override = %q", got)
+	}
+	if got := cfg.ResolveSearchMode("server2"); got != config.SearchModeSync {
+		t.Errorf("global mode = %q", got)
+	}
+	if got := (&config.Config{}).ResolveSearchMode("server1"); got != config.SearchModeAsync {
+		t.Errorf("default = %q", got)
+	}
+}
+
+func TestResolveImageConfig(t *testing.T) {
+	cfg := &config.Config{
+		Tools: config.ToolsConfig{Image: config.ImageConfig{
+			Provider: config.ImageProviderFal, APIKey: "fal-key", Model: "fal-ai/flux/schnell", Resolution: "1K", Concurrency: 1, Moderated: true,
+		}},
+		Agents: []config.AgentConfig{
+			{ServerID: "local", Image: config.AgentImageConfig{Provider: config.ImageProviderA1111, BaseURL: "http://127.0.0.1:7860"}},
+			{ServerID: "fal", Image: config.AgentImageConfig{Provider: config.ImageProviderFal, Model: "fal-ai/flux/dev", Concurrency: 3}},
+			{ServerID: "openai", Image: config.AgentImageConfig{Provider: config.ImageProviderOpenAI}},
+		},
+	}
+
+	local := cfg.ResolveImageConfig("local")
+	if local.Provider != config.ImageProviderA1111 || local.APIKey != "" || local.Model != "" || local.Moderated || local.Resolution != "1K" || local.Concurrency != 1 || !local.Usable() {
+		t.Errorf("local = %+v", local)
+	}
+	if got := cfg.ResolveImageConfig("fal"); got.APIKey != "fal-key" || got.Model != "fal-ai/flux/dev" || got.Concurrency != 3 {
+		t.Errorf("fal = %+v", got)
+	}
+	if got := cfg.ResolveImageConfig("openai"); got.Usable() {
+		t.Errorf("openai without a key should not be usable: %+v", got)
+	}
+	if got := cfg.ResolveImageConfig("unknown"); got.Model != "fal-ai/flux/schnell" || !got.Usable() {
+		t.Errorf("global = %+v", got)
+	}
+}
+
+func TestResolveImageDailyLimit(t *testing.T) {
+	cfg := &config.Config{
+		Tools: config.ToolsConfig{Image: config.ImageConfig{DailyLimit: 10}},
+		Agents: []config.AgentConfig{{
+			ServerID: "srv1",
+			Image: config.AgentImageConfig{DailyLimit: 5, Limits: []config.ImageLimit{
+				{Role: "members", DailyLimit: 8},
+				{Role: "boosters", DailyLimit: 20},
+				{Role: "mods", DailyLimit: 0},
+				{User: "artist", DailyLimit: 50},
+				{User: "spammer", DailyLimit: 1},
+			}},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		serverID string
+		userID   string
+		roles    []string
+		want     int
+	}{
+		{"agent default", "srv1", "u1", nil, 5},
+		{"role limit", "srv1", "u1", []string{"members"}, 8},
+		{"most generous role", "srv1", "u1", []string{"members", "boosters"}, 20},
+		{"unlimited role", "srv1", "u1", []string{"boosters", "mods"}, 0},
+		{"user limit wins over roles", "srv1", "spammer", []string{"mods"}, 1},
+		{"user limit", "srv1", "artist", nil, 50},
+		{"global default", "other", "u1", []string{"members"}, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.ResolveImageDailyLimit(tt.serverID, tt.userID, tt.roles); got != tt.want {
+				t.Errorf("ResolveImageDailyLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveImageSafety(t *testing.T) {
+	off := false
+	cfg := &config.Config{
+		Agents: []config.AgentConfig{
+			{ServerID: "srv1", Channels: []config.ChannelConfig{
+				{ID: "lounge", ImageSafety: config.ImageSafetyNSFW},
+				{ID: "cat", ImageSafety: config.ImageSafetyDisabled},
+				{ID: "art"},
+			}},
+			{ServerID: "srv2", Image: config.AgentImageConfig{EnableSafetyChecker: &off}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		serverID string
+		lineage  []string
+		want     string
+	}{
+		{"channel level", "srv1", []string{"lounge"}, config.ImageSafetyNSFW},
+		{"inherited from category", "srv1", []string{"general", "cat"}, config.ImageSafetyDisabled},
+		{"closest entry wins", "srv1", []string{"lounge", "cat"}, config.ImageSafetyNSFW},
+		{"entry without level", "srv1", []string{"art"}, config.ImageSafetyStrict},
+		{"safety checker off", "srv2", []string{"any"}, config.ImageSafetyNSFW},
+		{"default", "unknown", []string{"any"}, config.ImageSafetyStrict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.ResolveImageSafety(tt.serverID, tt.lineage); got != tt.want {
+				t.Errorf("ResolveImageSafety() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveImageAllowUnscreened(t *testing.T) {
+	cfg := &config.Config{
+		Agents: []config.AgentConfig{
+			{ServerID: "srv1", Channels: []config.ChannelConfig{
+				{ID: "gpu-art", AllowUnscreenedImages: true},
+				{ID: "general"},
+			}},
+		},
+	}
+	for _, tt := range []struct {
+		name    string
+		lineage []string
+		want    bool
+	}{
+		{"channel", []string{"gpu-art"}, true},
+		{"thread inherits", []string{"thread", "gpu-art"}, true},
+		{"not set", []string{"general"}, false},
+		{"no entry", []string{"other"}, false},
+	} {
+		if got := cfg.ResolveImageAllowUnscreened("srv1", tt.lineage); got != tt.want {
+			t.Errorf("%s: ResolveImageAllowUnscreened() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -28,7 +28,13 @@ type Message struct {
 
 // MarshalJSON serializes content as a string when no image parts are present,
 // or as a content-part array when images are included (OpenAI vision format).
+// Text-only parts are joined into one string, since not every provider
+// accepts the array form.
 func (m Message) MarshalJSON() ([]byte, error) {
+	if len(m.ContentParts) > 0 && !HasMedia(m.ContentParts) {
+		m.Content = JoinText(m.ContentParts)
+		m.ContentParts = nil
+	}
 	if len(m.ContentParts) > 0 {
 		return json.Marshal(struct {
 			Role       string        `json:"role"`
@@ -72,6 +78,27 @@ func (m *Message) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// HasMedia reports whether parts contains an image or video.
+func HasMedia(parts []ContentPart) bool {
+	for _, p := range parts {
+		if p.Type == "image_url" || p.Type == "video_url" {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinText returns the text parts of a message separated by blank lines.
+func JoinText(parts []ContentPart) string {
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
 // ContentPart is a single element in a multimodal message content array.
 type ContentPart struct {
 	Type     string    `json:"type"`
@@ -193,7 +220,7 @@ func (c *Client) Chat(ctx context.Context, messages []Message, tools []ToolDefin
 
 	last := len(messages) - 1
 	switch {
-	case last >= 0 && len(messages[last].ContentParts) > 0 && cfg.VisionModel != "":
+	case last >= 0 && HasMedia(messages[last].ContentParts) && cfg.VisionModel != "":
 		// Vision model takes priority over per-agent provider. Default to the
 		// OpenRouter endpoint/key, but if VisionBaseURL matches the GLM base, use
 		// the GLM key instead.
@@ -295,10 +322,27 @@ func (c *Client) DescribeMedia(ctx context.Context, parts []ContentPart) (string
 }
 
 func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
+	vecs, err := c.embed(ctx, text, 1)
+	if err != nil {
+		return nil, err
+	}
+	return vecs[0], nil
+}
+
+// EmbedBatch embeds several texts in one request and returns their vectors
+// in the order of texts.
+func (c *Client) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	return c.embed(ctx, texts, len(texts))
+}
+
+func (c *Client) embed(ctx context.Context, input any, n int) ([][]float32, error) {
 	cfg := c.cfgStore.Get().LLM
 	body := map[string]any{
 		"model": cfg.EmbeddingModel,
-		"input": text,
+		"input": input,
 	}
 
 	respBody, err := c.post(ctx, c.embeddingBase()+"/embeddings", c.chatKey(), body)
@@ -309,6 +353,7 @@ func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
 
 	var result struct {
 		Data []struct {
+			Index     *int      `json:"index"`
 			Embedding []float32 `json:"embedding"`
 		} `json:"data"`
 	}
@@ -318,7 +363,23 @@ func (c *Client) Embed(ctx context.Context, text string) ([]float32, error) {
 	if len(result.Data) == 0 {
 		return nil, fmt.Errorf("no embedding data in response")
 	}
-	return result.Data[0].Embedding, nil
+	if n == 1 {
+		return [][]float32{result.Data[0].Embedding}, nil
+	}
+	if len(result.Data) != n {
+		return nil, fmt.Errorf("got %d embeddings for %d inputs", len(result.Data), n)
+	}
+	vecs := make([][]float32, n)
+	for i, d := range result.Data {
+		if d.Index != nil {
+			i = *d.Index
+		}
+		if i < 0 || i >= n || vecs[i] != nil {
+			return nil, fmt.Errorf("invalid embedding index %d", i)
+		}
+		vecs[i] = d.Embedding
+	}
+	return vecs, nil
 }
 
 // cancelOnClose wraps an io.ReadCloser to call a cancel function on Close.
@@ -400,10 +461,10 @@ func (c *Client) post(ctx context.Context, url, key string, body any) (io.ReadCl
 	return nil, lastErr
 }
 
-// messagesHaveImages reports whether any message contains image content parts.
+// messagesHaveImages reports whether any message contains image or video content parts.
 func messagesHaveImages(messages []Message) bool {
 	for i := range messages {
-		if len(messages[i].ContentParts) > 0 {
+		if HasMedia(messages[i].ContentParts) {
 			return true
 		}
 	}
@@ -420,12 +481,10 @@ func stripImages(messages []Message) []Message {
 		if len(out[i].ContentParts) == 0 {
 			continue
 		}
-		var text string
+		text := JoinText(out[i].ContentParts)
 		var imageCount, videoCount int
 		for _, p := range out[i].ContentParts {
 			switch p.Type {
-			case "text":
-				text = p.Text
 			case "image_url":
 				imageCount++
 			case "video_url":
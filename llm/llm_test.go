@@ -61,6 +61,28 @@ func clientWithBaseURL(t *testing.T, baseURL string) *llm.Client {
 	return llm.New(cfgStore)
 }
 
+func TestEmbedBatchOrdersByIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Input) != 2 {
+			t.Errorf("input = %v (%v), want two texts in one request", req.Input, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[2]},{"index":0,"embedding":[1]}]}`))
+	}))
+	defer srv.Close()
+
+	vecs, err := clientWithBaseURL(t, srv.URL).EmbedBatch(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("EmbedBatch: %v", err)
+	}
+	if len(vecs) != 2 || vecs[0][0] != 1 || vecs[1][0] != 2 {
+		t.Errorf("vecs = %v, want [[1] [2]]", vecs)
+	}
+}
+
 func TestChatRetriesOn5xx(t *testing.T) {
 	// Speed up retries in this test
 	t.Cleanup(llm.SetRetryDelays([]time.Duration{0, 0}))
@@ -749,3 +771,23 @@ func TestMessageMarshalContentParts(t *testing.T) {
 		t.Errorf("expected second part type=image_url, got %v", second["type"])
 	}
 }
+
+func TestMessageMarshalTextOnlyParts(t *testing.T) {
+	msg := llm.Message{
+		Role: "user",
+		ContentParts: []llm.ContentPart{
+			{Type: "text", Text: "alice: what's wrong with this?"},
+			{Type: "text", Text: "File main.go:\n```go\npackage main\n```"},
+		},
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	json.Unmarshal(data, &out)
+	want := "alice: what's wrong with this?\n\nFile main.go:\n```go\npackage main\n```"
+	if out["content"] != want {
+		t.Errorf("content = %#v, want joined string %q", out["content"], want)
+	}
+}
@@ -12,16 +12,23 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/bwmarrin/discordgo"
+
 	"github.com/tomasmach/vespra/agent"
 	"github.com/tomasmach/vespra/bot"
 	"github.com/tomasmach/vespra/config"
 	"github.com/tomasmach/vespra/llm"
 	"github.com/tomasmach/vespra/logstore"
 	"github.com/tomasmach/vespra/memory"
+	"github.com/tomasmach/vespra/tools"
 	"github.com/tomasmach/vespra/web"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "mcp" {
+		os.Exit(runMCP(os.Args[2:]))
+	}
+
 	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn, error")
 	logFormat := flag.String("log-format", "text", "Log format: text or json")
 	configPath := flag.String("config", "", "Path to config file")
@@ -56,7 +63,8 @@ func main() {
 
 	// Build per-agent resources
 	agentsByServerID := make(map[string]*agent.AgentResources, len(cfg.Agents))
-	var customBots []*bot.Bot // bots with their own tokens (need separate stop)
+	var customBots []*bot.Bot  // bots with their own tokens (need separate stop)
+	var personaBots []*bot.Bot // persona bots; route messages but register no slash commands
 
 	for i := range cfg.Agents {
 		agentCfg := &cfg.Agents[i]
@@ -71,6 +79,7 @@ func main() {
 			Config:  agentCfg,
 			Memory:  mem,
 			Session: nil, // filled in below
+			Images:  tools.NewImageQueue(cfg.ResolveImageConfig(agentCfg.ServerID).Concurrency),
 		}
 
 		if agentCfg.Token != "" {
@@ -82,6 +91,23 @@ func main() {
 			customBots = append(customBots, b)
 			agentsByServerID[agentCfg.ServerID].Session = b.Session()
 		}
+
+		for _, p := range agentCfg.Personas {
+			if p.Token == "" {
+				continue
+			}
+			b, err := bot.New(p.Token)
+			if err != nil {
+				slog.Error("failed to create bot for persona", "agent", agentCfg.ID, "persona", p.ID, "error", err)
+				os.Exit(1)
+			}
+			personaBots = append(personaBots, b)
+			res := agentsByServerID[agentCfg.ServerID]
+			if res.PersonaSessions == nil {
+				res.PersonaSessions = make(map[string]*discordgo.Session)
+			}
+			res.PersonaSessions[p.ID] = b.Session()
+		}
 	}
 
 	slog.Info("agents initialized", "count", len(agentsByServerID))
@@ -123,6 +149,10 @@ func main() {
 	for _, b := range customBots {
 		b.SetOps(webServer)
 	}
+	for _, b := range personaBots {
+		b.SetRouter(router)
+	}
+	customBots = append(customBots, personaBots...)
 
 	// Start all bots
 	if err := defaultBot.Start(); err != nil {
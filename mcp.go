@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/tomasmach/vespra/config"
+	"github.com/tomasmach/vespra/llm"
+	"github.com/tomasmach/vespra/memory"
+	"github.com/tomasmach/vespra/tools"
+)
+
+// runMCP implements `vespra mcp -agent <id>`: it serves one agent's memory over
+// MCP on stdin/stdout, for desktop assistants that launch MCP servers as
+// subprocesses. It opens the agent's database directly, so it works whether
+// or not the bot is running. Logs go to stderr to keep stdout for the protocol.
+func runMCP(args []string) int {
+	fs := flag.NewFlagSet("mcp", flag.ContinueOnError)
+	agentID := fs.String("agent", "", "ID of the agent whose memory to serve (required)")
+	personaID := fs.String("persona", "", "Serve this persona's memories instead of the agent's")
+	configPath := fs.String("config", "", "Path to config file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	if *agentID == "" {
+		fmt.Fprintln(os.Stderr, "usage: vespra mcp -agent <id> [-persona <id>] [-config <path>]")
+		return 2
+	}
+
+	cfgPath := config.Resolve()
+	if *configPath != "" {
+		cfgPath = *configPath
+	}
+	cfgStore, err := config.NewStore(cfgPath)
+	if err != nil {
+		slog.Error("failed to load config", "error", err, "path", cfgPath)
+		return 1
+	}
+	cfg := cfgStore.Get()
+
+	var agentCfg *config.AgentConfig
+	for i := range cfg.Agents {
+		if cfg.Agents[i].ID == *agentID {
+			agentCfg = &cfg.Agents[i]
+		}
+	}
+	if agentCfg == nil {
+		slog.Error("agent not found", "agent", *agentID)
+		return 1
+	}
+	scope := agentCfg.ServerID
+	if *personaID != "" {
+		var persona *config.PersonaConfig
+		for i := range agentCfg.Personas {
+			if agentCfg.Personas[i].ID == *personaID {
+				persona = &agentCfg.Personas[i]
+			}
+		}
+		if persona == nil {
+			slog.Error("persona not found", "agent", *agentID, "persona", *personaID)
+			return 1
+		}
+		scope = persona.MemoryScope(agentCfg.ServerID)
+	}
+
+	mem, err := memory.New(&config.MemoryConfig{DBPath: agentCfg.ResolveDBPath(cfg.Memory.DBPath)}, llm.New(cfgStore))
+	if err != nil {
+		slog.Error("failed to open memory store", "agent", *agentID, "error", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+	reg := tools.NewMemoryServerRegistry(mem, scope, cfg.Agent.MemoryDedupThreshold, cfg.Agent.MemoryRecallLimit)
+	if err := tools.NewMCPServer("vespra-memory", "1.0", reg).ServeStdio(ctx, os.Stdin, os.Stdout); err != nil && ctx.Err() == nil {
+		slog.Error("mcp server", "error", err)
+		return 1
+	}
+	return 0
+}
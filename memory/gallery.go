@@ -0,0 +1,280 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrGeneratedImageNotFound is returned when a generated image ID does not
+// exist or belongs to a different server.
+var ErrGeneratedImageNotFound = errors.New("generated image not found")
+
+// GeneratedImageSaveOptions describes a generated image to keep in the gallery.
+type GeneratedImageSaveOptions struct {
+	ServerID    string
+	JobID       string
+	Index       int // position within the job, starting at 1
+	Prompt      string
+	Provider    string
+	Model       string
+	AspectRatio string
+	Resolution  string
+	Seed        int64
+	UserID      string
+	ChannelID   string
+	MessageID   string // Discord message the image was sent in
+	Safety      string // safety level of the channel; "" when unknown
+	ContentType string
+	Data        []byte
+}
+
+// GeneratedImageListOptions filters the gallery returned by ListGeneratedImages.
+type GeneratedImageListOptions struct {
+	ServerID string
+	UserID   string
+	JobID    string
+	Query    string // matched against the prompt
+	Limit    int
+	Offset   int
+}
+
+// GeneratedImageRow is metadata for an image in the gallery.
+type GeneratedImageRow struct {
+	ID          string    `json:"id"`
+	ServerID    string    `json:"server_id"`
+	JobID       string    `json:"job_id,omitempty"`
+	Index       int       `json:"index"`
+	Prompt      string    `json:"prompt"`
+	Provider    string    `json:"provider,omitempty"`
+	Model       string    `json:"model,omitempty"`
+	AspectRatio string    `json:"aspect_ratio,omitempty"`
+	Resolution  string    `json:"resolution,omitempty"`
+	Seed        int64     `json:"seed,omitempty"`
+	UserID      string    `json:"user_id,omitempty"`
+	ChannelID   string    `json:"channel_id,omitempty"`
+	MessageID   string    `json:"message_id,omitempty"`
+	Safety      string    `json:"safety,omitempty"` // "" for images saved before levels were recorded
+	ContentType string    `json:"content_type"`
+	FilePath    string    `json:"-"`
+	SizeBytes   int64     `json:"size_bytes"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const generatedImageColumns = `g.id, g.server_id, COALESCE(g.job_id, ''), g.idx, g.prompt, COALESCE(g.provider, ''), COALESCE(g.model, ''),
+	COALESCE(g.aspect_ratio, ''), COALESCE(g.resolution, ''), g.seed, COALESCE(g.user_id, ''), COALESCE(g.channel_id, ''),
+	COALESCE(g.message_id, ''), COALESCE(s.level, ''), g.content_type, g.file_path, g.size_bytes, g.created_at`
+
+const generatedImageFrom = `generated_images g LEFT JOIN generated_image_safety s ON s.image_id = g.id`
+
+// SaveGeneratedImage stores a generated image file and its metadata and
+// returns the new gallery ID.
+func (s *Store) SaveGeneratedImage(ctx context.Context, opts GeneratedImageSaveOptions) (string, error) {
+	if opts.ServerID == "" {
+		return "", fmt.Errorf("serverID is required")
+	}
+	if len(opts.Data) == 0 {
+		return "", fmt.Errorf("image data is required")
+	}
+	ext, err := visualFileExtension(opts.ContentType)
+	if err != nil {
+		ext, opts.ContentType = ".png", "image/png"
+	}
+	id, err := newID()
+	if err != nil {
+		return "", fmt.Errorf("generate id: %w", err)
+	}
+	if err := os.MkdirAll(s.galleryDir, 0o755); err != nil {
+		return "", fmt.Errorf("create gallery dir: %w", err)
+	}
+	filePath := filepath.Join(s.galleryDir, id+ext)
+	if err := os.WriteFile(filePath, opts.Data, 0o600); err != nil {
+		return "", fmt.Errorf("write generated image file: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		_ = os.Remove(filePath)
+		return "", fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO generated_images
+		 (id, server_id, job_id, idx, prompt, provider, model, aspect_ratio, resolution, seed, user_id, channel_id, message_id, content_type, file_path, size_bytes, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, opts.ServerID, opts.JobID, max(opts.Index, 1), strings.TrimSpace(opts.Prompt), opts.Provider, opts.Model, opts.AspectRatio,
+		opts.Resolution, opts.Seed, opts.UserID, opts.ChannelID, opts.MessageID, strings.ToLower(opts.ContentType), filePath,
+		len(opts.Data), time.Now().UTC(),
+	); err != nil {
+		_ = os.Remove(filePath)
+		return "", fmt.Errorf("insert generated image: %w", err)
+	}
+	if opts.Safety != "" {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO generated_image_safety (image_id, level) VALUES (?, ?)`, id, opts.Safety,
+		); err != nil {
+			_ = os.Remove(filePath)
+			return "", fmt.Errorf("insert generated image safety: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		_ = os.Remove(filePath)
+		return "", fmt.Errorf("commit generated image: %w", err)
+	}
+	return id, nil
+}
+
+// ListGeneratedImages returns gallery images, newest first, and the total
+// number of matches.
+func (s *Store) ListGeneratedImages(ctx context.Context, opts GeneratedImageListOptions) ([]GeneratedImageRow, int, error) {
+	if opts.ServerID == "" {
+		return nil, 0, fmt.Errorf("ServerID is required")
+	}
+	if opts.Limit == 0 {
+		opts.Limit = 50
+	}
+
+	where := "g.server_id = ?"
+	args := []any{opts.ServerID}
+	if opts.UserID != "" {
+		where += " AND g.user_id = ?"
+		args = append(args, opts.UserID)
+	}
+	if opts.JobID != "" {
+		where += " AND g.job_id = ?"
+		args = append(args, opts.JobID)
+	}
+	for _, word := range strings.Fields(opts.Query) {
+		where += ` AND lower(g.prompt) LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLIKE(strings.ToLower(word))+"%")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM generated_images g WHERE "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count generated images: %w", err)
+	}
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+generatedImageColumns+` FROM `+generatedImageFrom+` WHERE `+where+` ORDER BY g.created_at DESC, g.idx LIMIT ? OFFSET ?`,
+		append(args, opts.Limit, opts.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list generated images: %w", err)
+	}
+	defer rows.Close()
+	out, err := scanGeneratedImageRows(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, total, nil
+}
+
+// imageUsageDays is how long daily image usage is kept.
+const imageUsageDays = 7
+
+// AddImageUsage adds n images to what userID generated on serverID on the
+// UTC day of at. Usage is kept apart from the gallery, so deleting gallery
+// images does not lower it.
+func (s *Store) AddImageUsage(ctx context.Context, serverID, userID string, at time.Time, n int) error {
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO image_usage (server_id, user_id, day, images) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(server_id, user_id, day) DO UPDATE SET images = images + excluded.images`,
+		serverID, userID, usageDay(at), n,
+	); err != nil {
+		return fmt.Errorf("add image usage: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM image_usage WHERE day < ?`, usageDay(at.AddDate(0, 0, -imageUsageDays)),
+	); err != nil {
+		return fmt.Errorf("prune image usage: %w", err)
+	}
+	return nil
+}
+
+// ImageUsage returns how many images userID generated on serverID on the
+// UTC day of at.
+func (s *Store) ImageUsage(ctx context.Context, serverID, userID string, at time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT images FROM image_usage WHERE server_id = ? AND user_id = ? AND day = ?`,
+		serverID, userID, usageDay(at),
+	).Scan(&n)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("get image usage: %w", err)
+	}
+	return n, nil
+}
+
+func usageDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// GetGeneratedImage returns one gallery image by ID.
+func (s *Store) GetGeneratedImage(ctx context.Context, serverID, id string) (GeneratedImageRow, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+generatedImageColumns+` FROM `+generatedImageFrom+` WHERE g.id = ? AND g.server_id = ?`,
+		id, serverID,
+	)
+	if err != nil {
+		return GeneratedImageRow{}, fmt.Errorf("get generated image: %w", err)
+	}
+	defer rows.Close()
+	out, err := scanGeneratedImageRows(rows)
+	if err != nil {
+		return GeneratedImageRow{}, err
+	}
+	if len(out) == 0 {
+		return GeneratedImageRow{}, ErrGeneratedImageNotFound
+	}
+	return out[0], nil
+}
+
+// DeleteGeneratedImage removes a gallery image and its stored file.
+func (s *Store) DeleteGeneratedImage(ctx context.Context, serverID, id string) error {
+	row, err := s.GetGeneratedImage(ctx, serverID, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM generated_images WHERE id = ? AND server_id = ?`, id, serverID); err != nil {
+		return fmt.Errorf("delete generated image: %w", err)
+	}
+	if err := os.Remove(row.FilePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove generated image file: %w", err)
+	}
+	return nil
+}
+
+func scanGeneratedImageRows(rows *sql.Rows) ([]GeneratedImageRow, error) {
+	var out []GeneratedImageRow
+	for rows.Next() {
+		var row GeneratedImageRow
+		if err := rows.Scan(
+			&row.ID,
+			&row.ServerID,
+			&row.JobID,
+			&row.Index,
+			&row.Prompt,
+			&row.Provider,
+			&row.Model,
+			&row.AspectRatio,
+			&row.Resolution,
+			&row.Seed,
+			&row.UserID,
+			&row.ChannelID,
+			&row.MessageID,
+			&row.Safety,
+			&row.ContentType,
+			&row.FilePath,
+			&row.SizeBytes,
+			&row.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan generated image: %w", err)
+		}
+		out = append(out, row)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGeneratedImageGallery(t *testing.T) {
+	store := newTestVisualStore(t)
+	ctx := context.Background()
+
+	save := func(prompt, userID string, index int) string {
+		t.Helper()
+		id, err := store.SaveGeneratedImage(ctx, GeneratedImageSaveOptions{
+			ServerID:    "srv1",
+			JobID:       "job1",
+			Index:       index,
+			Prompt:      prompt,
+			Provider:    "fal",
+			Model:       "fal-ai/flux/schnell",
+			AspectRatio: "16:9",
+			Seed:        42,
+			UserID:      userID,
+			ChannelID:   "chan1",
+			MessageID:   "msg1",
+			ContentType: "image/png",
+			Data:        []byte(prompt),
+		})
+		if err != nil {
+			t.Fatalf("SaveGeneratedImage() error: %v", err)
+		}
+		return id
+	}
+	dragon := save("A red Dragon over the mountains", "user1", 1)
+	save("a cat in a hat", "user2", 2)
+
+	rows, total, err := store.ListGeneratedImages(ctx, GeneratedImageListOptions{ServerID: "srv1", Query: "dragon mountains"})
+	if err != nil {
+		t.Fatalf("ListGeneratedImages() error: %v", err)
+	}
+	if total != 1 || len(rows) != 1 || rows[0].ID != dragon {
+		t.Fatalf("query rows = %+v, total %d; want the dragon", rows, total)
+	}
+	row := rows[0]
+	if row.Model != "fal-ai/flux/schnell" || row.AspectRatio != "16:9" || row.Seed != 42 || row.UserID != "user1" || row.MessageID != "msg1" {
+		t.Errorf("row metadata = %+v", row)
+	}
+	if data, err := os.ReadFile(row.FilePath); err != nil || string(data) != "A red Dragon over the mountains" {
+		t.Errorf("stored file = %q, %v", data, err)
+	}
+
+	if _, total, _ := store.ListGeneratedImages(ctx, GeneratedImageListOptions{ServerID: "srv1", JobID: "job1"}); total != 2 {
+		t.Errorf("job total = %d, want 2", total)
+	}
+	if _, total, _ := store.ListGeneratedImages(ctx, GeneratedImageListOptions{ServerID: "srv2"}); total != 0 {
+		t.Errorf("other server total = %d, want 0", total)
+	}
+
+	if err := store.DeleteGeneratedImage(ctx, "srv2", dragon); !errors.Is(err, ErrGeneratedImageNotFound) {
+		t.Errorf("delete from other server error = %v, want not found", err)
+	}
+	if err := store.DeleteGeneratedImage(ctx, "srv1", dragon); err != nil {
+		t.Fatalf("DeleteGeneratedImage() error: %v", err)
+	}
+	if _, err := os.Stat(row.FilePath); !os.IsNotExist(err) {
+		t.Errorf("file still exists after delete: %v", err)
+	}
+	if _, err := store.GetGeneratedImage(ctx, "srv1", dragon); !errors.Is(err, ErrGeneratedImageNotFound) {
+		t.Errorf("get after delete error = %v, want not found", err)
+	}
+}
+
+func TestImageUsage(t *testing.T) {
+	store := newTestVisualStore(t)
+	ctx := context.Background()
+	day := time.Date(2026, 3, 14, 23, 30, 0, 0, time.UTC)
+
+	if n, err := store.ImageUsage(ctx, "srv1", "user1", day); err != nil || n != 0 {
+		t.Fatalf("ImageUsage before any images = %d, %v; want 0", n, err)
+	}
+	for _, n := range []int{2, 1} {
+		if err := store.AddImageUsage(ctx, "srv1", "user1", day, n); err != nil {
+			t.Fatalf("AddImageUsage: %v", err)
+		}
+	}
+	if err := store.AddImageUsage(ctx, "srv1", "user1", day.Add(time.Hour), 4); err != nil {
+		t.Fatalf("AddImageUsage next day: %v", err)
+	}
+
+	for _, tt := range []struct {
+		server, user string
+		at           time.Time
+		want         int
+	}{
+		{"srv1", "user1", day, 3},
+		{"srv1", "user1", day.Add(-23 * time.Hour), 3}, // same UTC day
+		{"srv1", "user1", day.Add(time.Hour), 4},
+		{"srv1", "user2", day, 0},
+		{"srv2", "user1", day, 0},
+	} {
+		if n, err := store.ImageUsage(ctx, tt.server, tt.user, tt.at); err != nil || n != tt.want {
+			t.Errorf("ImageUsage(%s, %s, %s) = %d, %v; want %d", tt.server, tt.user, tt.at, n, err, tt.want)
+		}
+	}
+
+	// Usage older than a week is pruned.
+	if err := store.AddImageUsage(ctx, "srv1", "user1", day.AddDate(0, 0, 10), 1); err != nil {
+		t.Fatalf("AddImageUsage: %v", err)
+	}
+	if n, _ := store.ImageUsage(ctx, "srv1", "user1", day); n != 0 {
+		t.Errorf("ImageUsage after pruning = %d, want 0", n)
+	}
+}
@@ -0,0 +1,453 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tomasmach/vespra/llm"
+)
+
+const (
+	// MaxKnowledgeBytes caps the text of a single knowledge document.
+	MaxKnowledgeBytes   = 1 << 20
+	knowledgeChunkChars = 1200
+	// knowledgeEmbedBatch is how many chunks are embedded per request.
+	knowledgeEmbedBatch = 32
+	// knowledgeEmbedTimeout bounds embedding a whole document.
+	knowledgeEmbedTimeout = 2 * time.Minute
+)
+
+// ErrDocumentNotFound is returned when a knowledge document ID does not exist
+// or belongs to a different server.
+var ErrDocumentNotFound = errors.New("knowledge document not found")
+
+// KnowledgeDocument is an uploaded reference document such as server rules,
+// an FAQ or lore notes. Its text is stored as embedded chunks.
+type KnowledgeDocument struct {
+	ID        string    `json:"id"`
+	ServerID  string    `json:"server_id"`
+	Name      string    `json:"name"`
+	SizeBytes int64     `json:"size_bytes"`
+	Chunks    int       `json:"chunks"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// KnowledgeChunk is one retrievable passage of a knowledge document.
+type KnowledgeChunk struct {
+	ID         string `json:"id"`
+	DocumentID string `json:"document_id"`
+	Document   string `json:"document"`
+	Seq        int    `json:"seq"`
+	Heading    string `json:"heading,omitempty"`
+	Content    string `json:"content"`
+}
+
+// Citation names the chunk's source for the model to cite, e.g.
+// "rules.md › Voice channels" or "faq.txt #3" when there is no heading.
+func (c KnowledgeChunk) Citation() string {
+	if c.Heading != "" {
+		return c.Document + " › " + c.Heading
+	}
+	return fmt.Sprintf("%s #%d", c.Document, c.Seq+1)
+}
+
+// embedChunks embeds chunks in batches, giving up after knowledgeEmbedTimeout.
+func (s *Store) embedChunks(ctx context.Context, chunks []textChunk) ([][]float32, error) {
+	ctx, cancel := context.WithTimeout(ctx, knowledgeEmbedTimeout)
+	defer cancel()
+
+	vecs := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunks); start += knowledgeEmbedBatch {
+		batch := chunks[start:min(start+knowledgeEmbedBatch, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, c := range batch {
+			texts[i] = c.indexText()
+		}
+		batchVecs, err := s.llm.EmbedBatch(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("embed chunks %d-%d: %w", start+1, start+len(batch), err)
+		}
+		vecs = append(vecs, batchVecs...)
+	}
+	return vecs, nil
+}
+
+// AddKnowledge chunks and embeds text and stores it as a document of the
+// server's knowledge base. A document with the same name is replaced.
+func (s *Store) AddKnowledge(ctx context.Context, serverID, name, text string) (KnowledgeDocument, error) {
+	name = strings.TrimSpace(name)
+	if serverID == "" {
+		return KnowledgeDocument{}, fmt.Errorf("serverID is required")
+	}
+	if name == "" {
+		return KnowledgeDocument{}, fmt.Errorf("document name is required")
+	}
+	if len(text) > MaxKnowledgeBytes {
+		return KnowledgeDocument{}, fmt.Errorf("document exceeds %d bytes", MaxKnowledgeBytes)
+	}
+	if !utf8.ValidString(text) {
+		return KnowledgeDocument{}, fmt.Errorf("document is not valid UTF-8 text")
+	}
+	chunks := chunkText(text, knowledgeChunkChars)
+	if len(chunks) == 0 {
+		return KnowledgeDocument{}, fmt.Errorf("document has no text")
+	}
+
+	vecs, err := s.embedChunks(ctx, chunks)
+	if err != nil {
+		return KnowledgeDocument{}, err
+	}
+
+	docID, err := newID()
+	if err != nil {
+		return KnowledgeDocument{}, fmt.Errorf("generate id: %w", err)
+	}
+	doc := KnowledgeDocument{
+		ID:        docID,
+		ServerID:  serverID,
+		Name:      name,
+		SizeBytes: int64(len(text)),
+		Chunks:    len(chunks),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return KnowledgeDocument{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := s.deleteKnowledgeTx(ctx, tx,
+		`SELECT id FROM knowledge_documents WHERE server_id = ? AND name = ?`, serverID, name,
+	); err != nil {
+		return KnowledgeDocument{}, fmt.Errorf("replace document: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO knowledge_documents (id, server_id, name, size_bytes, chunk_count, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?)`,
+		doc.ID, doc.ServerID, doc.Name, doc.SizeBytes, doc.Chunks, doc.CreatedAt,
+	); err != nil {
+		return KnowledgeDocument{}, fmt.Errorf("insert document: %w", err)
+	}
+	for i, c := range chunks {
+		chunkID, err := newID()
+		if err != nil {
+			return KnowledgeDocument{}, fmt.Errorf("generate id: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO knowledge_chunks (id, document_id, server_id, seq, heading, content, vector)
+			 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			chunkID, doc.ID, serverID, i, c.heading, c.content, llm.VectorToBlob(vecs[i]),
+		); err != nil {
+			return KnowledgeDocument{}, fmt.Errorf("insert chunk: %w", err)
+		}
+		if s.fts5Enabled {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO knowledge_fts(chunk_id, content) VALUES (?, ?)`, chunkID, c.indexText(),
+			); err != nil {
+				return KnowledgeDocument{}, fmt.Errorf("insert fts: %w", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return KnowledgeDocument{}, fmt.Errorf("commit transaction: %w", err)
+	}
+	return doc, nil
+}
+
+// ListKnowledge returns the server's knowledge documents ordered by name.
+func (s *Store) ListKnowledge(ctx context.Context, serverID string) ([]KnowledgeDocument, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, server_id, name, size_bytes, chunk_count, created_at
+		 FROM knowledge_documents WHERE server_id = ? ORDER BY name`,
+		serverID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list knowledge documents: %w", err)
+	}
+	defer rows.Close()
+
+	var out []KnowledgeDocument
+	for rows.Next() {
+		var doc KnowledgeDocument
+		if err := rows.Scan(&doc.ID, &doc.ServerID, &doc.Name, &doc.SizeBytes, &doc.Chunks, &doc.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan knowledge document: %w", err)
+		}
+		out = append(out, doc)
+	}
+	return out, rows.Err()
+}
+
+// HasKnowledge reports whether the server has any knowledge documents.
+func (s *Store) HasKnowledge(ctx context.Context, serverID string) (bool, error) {
+	var n int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM (SELECT 1 FROM knowledge_documents WHERE server_id = ? LIMIT 1)`, serverID,
+	).Scan(&n); err != nil {
+		return false, fmt.Errorf("count knowledge documents: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DeleteKnowledge removes a document and its chunks.
+func (s *Store) DeleteKnowledge(ctx context.Context, serverID, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var found string
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM knowledge_documents WHERE id = ? AND server_id = ?`, id, serverID,
+	).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDocumentNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("find document: %w", err)
+	}
+	if err := s.deleteKnowledgeTx(ctx, tx, `SELECT ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteKnowledgeTx deletes the documents whose IDs docQuery selects, along
+// with their chunks and FTS entries.
+func (s *Store) deleteKnowledgeTx(ctx context.Context, tx *sql.Tx, docQuery string, args ...any) error {
+	if s.fts5Enabled {
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM knowledge_fts WHERE chunk_id IN
+			 (SELECT id FROM knowledge_chunks WHERE document_id IN (`+docQuery+`))`, args...,
+		); err != nil {
+			return fmt.Errorf("delete fts: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM knowledge_documents WHERE id IN (`+docQuery+`)`, args...,
+	); err != nil {
+		return fmt.Errorf("delete document: %w", err)
+	}
+	return nil
+}
+
+// SearchKnowledge returns the chunks most relevant to query, merging semantic
+// and keyword rankings with Reciprocal Rank Fusion like Recall does.
+func (s *Store) SearchKnowledge(ctx context.Context, query, serverID string, topN int, simThreshold float64) ([]KnowledgeChunk, error) {
+	// Skip the embedding call entirely for agents without a knowledge base.
+	has, err := s.HasKnowledge(ctx, serverID)
+	if err != nil || !has {
+		return nil, err
+	}
+
+	var semanticIDs []string
+	vec, err := s.llm.Embed(ctx, query)
+	if err != nil {
+		slog.Warn("embed failed, falling back to keyword-only knowledge search", "error", err)
+	} else {
+		embeddings, err := s.knowledgeEmbeddings(ctx, serverID)
+		if err != nil {
+			return nil, fmt.Errorf("load knowledge embeddings: %w", err)
+		}
+		semanticIDs = rankBySimilarity(vec, embeddings, simThreshold)
+	}
+
+	var keywordIDs []string
+	if s.fts5Enabled {
+		keywordIDs, err = s.knowledgeFTSSearch(ctx, query, serverID)
+		if err != nil {
+			slog.Warn("knowledge fts search failed, falling back to LIKE", "error", err)
+			keywordIDs, err = s.knowledgeLikeSearch(ctx, query, serverID)
+		}
+	} else {
+		keywordIDs, err = s.knowledgeLikeSearch(ctx, query, serverID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("keyword search: %w", err)
+	}
+
+	merged := rrfMerge(semanticIDs, keywordIDs)
+	if len(merged) > topN {
+		merged = merged[:topN]
+	}
+
+	out := make([]KnowledgeChunk, 0, len(merged))
+	for _, id := range merged {
+		var c KnowledgeChunk
+		err := s.db.QueryRowContext(ctx,
+			`SELECT c.id, c.document_id, d.name, c.seq, COALESCE(c.heading, ''), c.content
+			 FROM knowledge_chunks c JOIN knowledge_documents d ON d.id = c.document_id
+			 WHERE c.id = ? AND c.server_id = ?`,
+			id, serverID,
+		).Scan(&c.ID, &c.DocumentID, &c.Document, &c.Seq, &c.Heading, &c.Content)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetch chunk %s: %w", id, err)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func (s *Store) knowledgeEmbeddings(ctx context.Context, serverID string) (map[string][]float32, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, vector FROM knowledge_chunks WHERE server_id = ? AND vector IS NOT NULL`, serverID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string][]float32)
+	for rows.Next() {
+		var id string
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			return nil, fmt.Errorf("scan embedding: %w", err)
+		}
+		result[id] = llm.BlobToVector(blob)
+	}
+	return result, rows.Err()
+}
+
+func (s *Store) knowledgeFTSSearch(ctx context.Context, query, serverID string) ([]string, error) {
+	ftsQuery := `"` + strings.ReplaceAll(query, `"`, `""`) + `"`
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT f.chunk_id FROM knowledge_fts f
+		 JOIN knowledge_chunks c ON c.id = f.chunk_id
+		 WHERE c.server_id = ? AND knowledge_fts MATCH ?
+		 ORDER BY rank`,
+		serverID, ftsQuery,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func (s *Store) knowledgeLikeSearch(ctx context.Context, query, serverID string) ([]string, error) {
+	pattern := "%" + escapeLIKE(query) + "%"
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id FROM knowledge_chunks
+		 WHERE server_id = ? AND (content LIKE ? ESCAPE '\' OR heading LIKE ? ESCAPE '\')`,
+		serverID, pattern, pattern,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+// textChunk is a passage of a document and the markdown heading it sits under.
+type textChunk struct {
+	heading string
+	content string
+}
+
+// indexText is what gets embedded and indexed: the heading gives short
+// passages the context of their section.
+func (c textChunk) indexText() string {
+	if c.heading == "" {
+		return c.content
+	}
+	return c.heading + "\n" + c.content
+}
+
+// chunkText splits text into passages of at most maxChars bytes. Paragraphs
+// are kept whole where they fit, and a markdown heading always starts a new
+// chunk so a passage never spans two sections.
+func chunkText(text string, maxChars int) []textChunk {
+	var (
+		out     []textChunk
+		heading string
+		cur     []string // paragraphs of the chunk being built
+		curLen  int
+		para    []string // lines of the paragraph being read
+		inFence bool
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			out = append(out, textChunk{heading: heading, content: strings.Join(cur, "\n\n")})
+		}
+		cur, curLen = nil, 0
+	}
+	endParagraph := func() {
+		if len(para) == 0 {
+			return
+		}
+		for _, piece := range splitLong(strings.Join(para, "\n"), maxChars) {
+			if curLen > 0 && curLen+2+len(piece) > maxChars {
+				flush()
+			}
+			if curLen > 0 {
+				curLen += 2
+			}
+			cur = append(cur, piece)
+			curLen += len(piece)
+		}
+		para = nil
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		if !inFence {
+			if h, ok := markdownHeading(trimmed); ok {
+				endParagraph()
+				flush()
+				heading = h
+				continue
+			}
+			if trimmed == "" {
+				endParagraph()
+				continue
+			}
+		}
+		para = append(para, line)
+	}
+	endParagraph()
+	flush()
+	return out
+}
+
+// markdownHeading returns the text of an ATX heading line such as "## FAQ".
+func markdownHeading(line string) (string, bool) {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > 6 || len(line) == level || line[level] != ' ' {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimRight(line[level:], "#")), true
+}
+
+// splitLong cuts s into pieces of at most maxChars bytes, preferring to cut
+// at whitespace and never splitting a UTF-8 sequence.
+func splitLong(s string, maxChars int) []string {
+	var out []string
+	for len(s) > maxChars {
+		cut := strings.LastIndexAny(s[:maxChars+1], " \n\t")
+		if cut <= 0 {
+			cut = maxChars
+			for cut > 0 && !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+		}
+		out = append(out, strings.TrimSpace(s[:cut]))
+		s = strings.TrimSpace(s[cut:])
+	}
+	if s != "" {
+		out = append(out, s)
+	}
+	return out
+}
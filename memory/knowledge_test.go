@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	long := strings.Repeat("word ", 60) // 300 bytes
+	text := "Intro line.\r\n\r\n# Rules\n\nBe kind.\nNo spam.\n\n## Voice ##\n\n" + long + "\n\n" + long + "\n\n```\n# not a heading\n```\n"
+
+	chunks := chunkText(text, 400)
+	want := []textChunk{
+		{heading: "", content: "Intro line."},
+		{heading: "Rules", content: "Be kind.\nNo spam."},
+		{heading: "Voice", content: strings.TrimSpace(long)},
+		{heading: "Voice", content: strings.TrimSpace(long) + "\n\n```\n# not a heading\n```"},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d: %+v", len(chunks), len(want), chunks)
+	}
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("chunk %d = %+v, want %+v", i, chunks[i], want[i])
+		}
+	}
+
+	for _, piece := range splitLong(strings.Repeat("ž", 300), 101) {
+		if len(piece) > 101 || !strings.HasPrefix(piece, "ž") {
+			t.Errorf("splitLong produced invalid piece %q", piece)
+		}
+	}
+}
+
+func TestKnowledgeAddSearchDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, fakeEmbeddingServer(t, 4))
+
+	if has, err := s.HasKnowledge(ctx, "srv1"); err != nil || has {
+		t.Fatalf("HasKnowledge on empty store = %v, %v", has, err)
+	}
+	if chunks, err := s.SearchKnowledge(ctx, "anything", "srv1", 3, 0); err != nil || len(chunks) != 0 {
+		t.Fatalf("SearchKnowledge on empty store = %v, %v", chunks, err)
+	}
+
+	doc, err := s.AddKnowledge(ctx, "srv1", "rules.md", "# Voice channels\n\nNo soundboards after midnight.\n\n# Art\n\nCredit the artist.")
+	if err != nil {
+		t.Fatalf("AddKnowledge: %v", err)
+	}
+	if doc.Chunks != 2 {
+		t.Errorf("doc.Chunks = %d, want 2", doc.Chunks)
+	}
+	if _, err := s.AddKnowledge(ctx, "srv2", "other.md", "Unrelated server."); err != nil {
+		t.Fatalf("AddKnowledge srv2: %v", err)
+	}
+
+	chunks, err := s.SearchKnowledge(ctx, "soundboards", "srv1", 1, 0)
+	if err != nil {
+		t.Fatalf("SearchKnowledge: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0].Document != "rules.md" || chunks[0].Heading != "Voice channels" {
+		t.Fatalf("SearchKnowledge = %+v, want the voice channels chunk", chunks)
+	}
+	if got := chunks[0].Citation(); got != "rules.md › Voice channels" {
+		t.Errorf("Citation() = %q", got)
+	}
+
+	// Re-uploading under the same name replaces the document.
+	replaced, err := s.AddKnowledge(ctx, "srv1", "rules.md", "Soundboards are allowed.")
+	if err != nil {
+		t.Fatalf("AddKnowledge replace: %v", err)
+	}
+	docs, err := s.ListKnowledge(ctx, "srv1")
+	if err != nil {
+		t.Fatalf("ListKnowledge: %v", err)
+	}
+	if len(docs) != 1 || docs[0].ID != replaced.ID {
+		t.Fatalf("ListKnowledge = %+v, want only the replacement", docs)
+	}
+	chunks, err = s.SearchKnowledge(ctx, "soundboards", "srv1", 5, 0)
+	if err != nil {
+		t.Fatalf("SearchKnowledge: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0].Content != "Soundboards are allowed." || chunks[0].Citation() != "rules.md #1" {
+		t.Fatalf("SearchKnowledge after replace = %+v", chunks)
+	}
+
+	if err := s.DeleteKnowledge(ctx, "srv2", replaced.ID); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("DeleteKnowledge from another server: err = %v, want ErrDocumentNotFound", err)
+	}
+	if err := s.DeleteKnowledge(ctx, "srv1", replaced.ID); err != nil {
+		t.Fatalf("DeleteKnowledge: %v", err)
+	}
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM knowledge_chunks WHERE server_id = 'srv1'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("chunks left after delete: %d (err %v)", n, err)
+	}
+}
+
+func TestAddKnowledgeBatchesEmbeddings(t *testing.T) {
+	var requests atomic.Int32
+	emb := fakeEmbeddingServer(t, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		emb.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	s := newTestStore(t, srv)
+
+	var text strings.Builder
+	for i := range knowledgeEmbedBatch + 8 {
+		fmt.Fprintf(&text, "# Section %d\n\nPassage number %d.\n\n", i, i)
+	}
+	doc, err := s.AddKnowledge(context.Background(), "srv1", "big.md", text.String())
+	if err != nil {
+		t.Fatalf("AddKnowledge: %v", err)
+	}
+	if doc.Chunks != knowledgeEmbedBatch+8 {
+		t.Fatalf("doc.Chunks = %d, want %d", doc.Chunks, knowledgeEmbedBatch+8)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("embedding requests = %d, want 2", got)
+	}
+}
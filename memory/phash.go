@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"  // register decoder for perceptualHash
+	_ "image/jpeg" // register decoder for perceptualHash
+	_ "image/png"  // register decoder for perceptualHash
+	"math/bits"
+)
+
+// nearDuplicateDistance is the largest number of differing perceptual hash
+// bits for two images to count as the same picture. Re-encoded, resized and
+// lightly edited copies stay below it; different photos rarely do.
+const nearDuplicateDistance = 10
+
+// maxHashPixels bounds the images perceptualHash decodes, so that a small
+// file declaring huge dimensions cannot exhaust memory.
+const maxHashPixels = 40_000_000
+
+// perceptualHash returns the 64-bit difference hash (dHash) of an image: it
+// is shrunk to 9x8 grey cells and each bit records whether a cell is brighter
+// than its right neighbour, so the hash survives scaling and recompression.
+// ok is false for images the standard decoders cannot read, such as WebP,
+// and for images larger than maxHashPixels.
+func perceptualHash(data []byte) (hash uint64, ok bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxHashPixels {
+		return 0, false
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, false
+	}
+	b := img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return 0, false
+	}
+
+	var grey [8][9]float64
+	for y := range 8 {
+		y0 := b.Min.Y + y*b.Dy()/8
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/8, y0+1)
+		for x := range 9 {
+			x0 := b.Min.X + x*b.Dx()/9
+			x1 := max(b.Min.X+(x+1)*b.Dx()/9, x0+1)
+			grey[y][x] = meanLuma(img, x0, y0, x1, y1)
+		}
+	}
+	for y := range 8 {
+		for x := range 8 {
+			hash <<= 1
+			if grey[y][x] > grey[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, true
+}
+
+// meanLuma averages the luma of a grid of up to 32x32 pixels sampled from the
+// rectangle (x0,y0)-(x1,y1), which keeps hashing large photos cheap.
+func meanLuma(img image.Image, x0, y0, x1, y1 int) float64 {
+	stepX, stepY := max((x1-x0)/32, 1), max((y1-y0)/32, 1)
+	var sum float64
+	var n int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// hashDistance returns the number of bits in which two perceptual hashes differ.
+func hashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
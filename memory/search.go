@@ -51,24 +51,7 @@ func (s *Store) Recall(ctx context.Context, query, serverID string, topN int, si
 		if err != nil {
 			return nil, fmt.Errorf("load embeddings: %w", err)
 		}
-		results := make([]scored, 0, len(embeddings))
-		for id, emb := range embeddings {
-			if len(emb) != len(vec) {
-				continue
-			}
-			sim := cosine(vec, emb)
-			if simThreshold > 0 && float64(sim) < simThreshold {
-				continue
-			}
-			results = append(results, scored{id, sim})
-		}
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].score > results[j].score
-		})
-		semanticIDs = make([]string, len(results))
-		for i, r := range results {
-			semanticIDs[i] = r.id
-		}
+		semanticIDs = rankBySimilarity(vec, embeddings, simThreshold)
 	}
 
 	// Keyword search: use FTS5 when available, otherwise fall back to LIKE.
@@ -113,6 +96,30 @@ func (s *Store) Recall(ctx context.Context, query, serverID string, topN int, si
 	return out, nil
 }
 
+// rankBySimilarity returns the IDs whose vectors are at least simThreshold
+// cosine-similar to vec, most similar first. A zero threshold keeps all.
+func rankBySimilarity(vec []float32, embeddings map[string][]float32, simThreshold float64) []string {
+	results := make([]scored, 0, len(embeddings))
+	for id, emb := range embeddings {
+		if len(emb) != len(vec) {
+			continue
+		}
+		sim := cosine(vec, emb)
+		if simThreshold > 0 && float64(sim) < simThreshold {
+			continue
+		}
+		results = append(results, scored{id, sim})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.id
+	}
+	return ids
+}
+
 // RecallByUser returns memories associated with a specific user, ordered by
 // importance (descending) then recency. Used for user-specific recall pass.
 func (s *Store) RecallByUser(ctx context.Context, serverID, userID string, limit int) ([]MemoryRow, error) {
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SpamBlock is a persisted anti-spam block for a user on a server.
+type SpamBlock struct {
+	ServerID     string    `json:"server_id"`
+	UserID       string    `json:"user_id"`
+	BlockedUntil time.Time `json:"blocked_until"`
+	Offenses     int       `json:"offenses"`
+}
+
+// SaveSpamBlock inserts or replaces the block for b.ServerID/b.UserID.
+func (s *Store) SaveSpamBlock(ctx context.Context, b SpamBlock) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO spam_blocks (server_id, user_id, blocked_until, offenses) VALUES (?, ?, ?, ?)
+		 ON CONFLICT(server_id, user_id) DO UPDATE SET blocked_until = excluded.blocked_until, offenses = excluded.offenses`,
+		b.ServerID, b.UserID, b.BlockedUntil.UTC(), b.Offenses,
+	)
+	if err != nil {
+		return fmt.Errorf("save spam block: %w", err)
+	}
+	return nil
+}
+
+// ListSpamBlocks returns all blocks whose blocked_until is after since.
+// Pass a time in the past to include recently expired blocks, whose offense
+// counts still matter for escalation.
+func (s *Store) ListSpamBlocks(ctx context.Context, since time.Time) ([]SpamBlock, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT server_id, user_id, blocked_until, offenses FROM spam_blocks WHERE blocked_until > ? ORDER BY blocked_until DESC`,
+		since.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query spam blocks: %w", err)
+	}
+	defer rows.Close()
+
+	var blocks []SpamBlock
+	for rows.Next() {
+		var b SpamBlock
+		if err := rows.Scan(&b.ServerID, &b.UserID, &b.BlockedUntil, &b.Offenses); err != nil {
+			return nil, fmt.Errorf("scan spam block: %w", err)
+		}
+		blocks = append(blocks, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate spam blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+// DeleteSpamBlock removes the block for a user on a server. Deleting a
+// non-existent block is not an error.
+func (s *Store) DeleteSpamBlock(ctx context.Context, serverID, userID string) error {
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM spam_blocks WHERE server_id = ? AND user_id = ?`, serverID, userID,
+	); err != nil {
+		return fmt.Errorf("delete spam block: %w", err)
+	}
+	return nil
+}
+
+// PruneSpamBlocks deletes blocks that expired before cutoff.
+func (s *Store) PruneSpamBlocks(ctx context.Context, cutoff time.Time) error {
+	if _, err := s.db.ExecContext(ctx,
+		`DELETE FROM spam_blocks WHERE blocked_until <= ?`, cutoff.UTC(),
+	); err != nil {
+		return fmt.Errorf("prune spam blocks: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSpamBlocksUpsertAndPrune(t *testing.T) {
+	store := newTestStore(t, nil)
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	if err := store.SaveSpamBlock(ctx, SpamBlock{ServerID: "srv1", UserID: "u1", BlockedUntil: now.Add(time.Hour), Offenses: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSpamBlock(ctx, SpamBlock{ServerID: "srv1", UserID: "u1", BlockedUntil: now.Add(2 * time.Hour), Offenses: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSpamBlock(ctx, SpamBlock{ServerID: "srv1", UserID: "u2", BlockedUntil: now.Add(-48 * time.Hour), Offenses: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := store.ListSpamBlocks(ctx, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0].Offenses != 2 || !blocks[0].BlockedUntil.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("expected upserted block for u1, got %+v", blocks)
+	}
+
+	if err := store.PruneSpamBlocks(ctx, now.Add(-24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	all, err := store.ListSpamBlocks(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].UserID != "u1" {
+		t.Fatalf("expected only u1 after prune, got %+v", all)
+	}
+}
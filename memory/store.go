@@ -69,6 +69,70 @@ CREATE INDEX IF NOT EXISTS idx_visual_memories_server ON visual_memories(server_
 CREATE INDEX IF NOT EXISTS idx_visual_memories_label ON visual_memories(server_id, normalized_label);
 CREATE INDEX IF NOT EXISTS idx_visual_memories_hash ON visual_memories(server_id, normalized_label, sha256);
 
+CREATE TABLE IF NOT EXISTS visual_features (
+    visual_id TEXT PRIMARY KEY REFERENCES visual_memories(id),
+    caption   TEXT,    -- the vision model's description of the image
+    vector    BLOB,    -- embedding of label, description and caption
+    phash     INTEGER  -- perceptual hash; NULL when the image could not be decoded
+);
+
+CREATE TABLE IF NOT EXISTS generated_images (
+    id           TEXT PRIMARY KEY,
+    server_id    TEXT NOT NULL,
+    job_id       TEXT,
+    idx          INTEGER NOT NULL DEFAULT 1,
+    prompt       TEXT NOT NULL,
+    provider     TEXT,
+    model        TEXT,
+    aspect_ratio TEXT,
+    resolution   TEXT,
+    seed         INTEGER NOT NULL DEFAULT 0,
+    user_id      TEXT,
+    channel_id   TEXT,
+    message_id   TEXT,
+    content_type TEXT NOT NULL,
+    file_path    TEXT NOT NULL,
+    size_bytes   INTEGER NOT NULL,
+    created_at   DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_generated_images_server ON generated_images(server_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_generated_images_job ON generated_images(server_id, job_id);
+
+CREATE TABLE IF NOT EXISTS image_usage (
+    server_id TEXT NOT NULL,
+    user_id   TEXT NOT NULL,
+    day       TEXT NOT NULL, -- UTC date, YYYY-MM-DD
+    images    INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (server_id, user_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS generated_image_safety (
+    image_id TEXT PRIMARY KEY REFERENCES generated_images(id) ON DELETE CASCADE,
+    level    TEXT NOT NULL -- safety level of the channel the image was generated in
+);
+
+CREATE TABLE IF NOT EXISTS knowledge_documents (
+    id          TEXT PRIMARY KEY,
+    server_id   TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    size_bytes  INTEGER NOT NULL,
+    chunk_count INTEGER NOT NULL,
+    created_at  DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_knowledge_documents_server ON knowledge_documents(server_id, name);
+
+CREATE TABLE IF NOT EXISTS knowledge_chunks (
+    id          TEXT PRIMARY KEY,
+    document_id TEXT NOT NULL REFERENCES knowledge_documents(id) ON DELETE CASCADE,
+    server_id   TEXT NOT NULL,
+    seq         INTEGER NOT NULL,
+    heading     TEXT,
+    content     TEXT NOT NULL,
+    vector      BLOB
+);
+CREATE INDEX IF NOT EXISTS idx_knowledge_chunks_server ON knowledge_chunks(server_id);
+CREATE INDEX IF NOT EXISTS idx_knowledge_chunks_document ON knowledge_chunks(document_id);
+
 CREATE TABLE IF NOT EXISTS conversations (
     id         INTEGER PRIMARY KEY AUTOINCREMENT,
     channel_id TEXT NOT NULL,
@@ -78,13 +142,22 @@ CREATE TABLE IF NOT EXISTS conversations (
     ts         DATETIME NOT NULL
 );
 CREATE INDEX IF NOT EXISTS idx_conv_channel ON conversations(channel_id);
+
+CREATE TABLE IF NOT EXISTS spam_blocks (
+    server_id     TEXT NOT NULL,
+    user_id       TEXT NOT NULL,
+    blocked_until DATETIME NOT NULL,
+    offenses      INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (server_id, user_id)
+);
 `
 
 type Store struct {
 	db          *sql.DB
 	llm         *llm.Client
-	mediaDir    string
-	fts5Enabled bool // true when the SQLite build includes FTS5 support
+	mediaDir    string // visual memory files
+	galleryDir  string // generated image files
+	fts5Enabled bool   // true when the SQLite build includes FTS5 support
 }
 
 func New(cfg *config.MemoryConfig, llmClient *llm.Client) (*Store, error) {
@@ -112,11 +185,29 @@ func New(cfg *config.MemoryConfig, llmClient *llm.Client) (*Store, error) {
 		slog.Warn("FTS5 not available, falling back to LIKE keyword search (rebuild with -tags sqlite_fts5 for better search)", "error", err)
 		fts5Enabled = false
 	}
+	if fts5Enabled {
+		if _, err := db.ExecContext(context.Background(),
+			`CREATE VIRTUAL TABLE IF NOT EXISTS knowledge_fts USING fts5(chunk_id UNINDEXED, content)`,
+		); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create knowledge fts table: %w", err)
+		}
+		// Index chunks uploaded while the binary lacked FTS5.
+		if _, err := db.ExecContext(context.Background(),
+			`INSERT INTO knowledge_fts(chunk_id, content)
+			 SELECT id, CASE WHEN COALESCE(heading, '') = '' THEN content ELSE heading || char(10) || content END
+			 FROM knowledge_chunks WHERE id NOT IN (SELECT chunk_id FROM knowledge_fts)`,
+		); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("backfill knowledge fts index: %w", err)
+		}
+	}
 
 	s := &Store{
 		db:          db,
 		llm:         llmClient,
 		mediaDir:    filepath.Join(filepath.Dir(path), "media", "visual"),
+		galleryDir:  filepath.Join(filepath.Dir(path), "media", "generated"),
 		fts5Enabled: fts5Enabled,
 	}
 
@@ -413,6 +504,43 @@ func (s *Store) UpdateContent(ctx context.Context, id, serverID, content string)
 	return nil
 }
 
+// Get returns a memory that has not been forgotten, or ErrMemoryNotFound.
+func (s *Store) Get(ctx context.Context, serverID, id string) (MemoryRow, error) {
+	var row MemoryRow
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, content, importance, server_id, COALESCE(user_id, ''), COALESCE(channel_id, ''), created_at
+		 FROM memories WHERE id = ? AND server_id = ? AND forgotten = 0`,
+		id, serverID,
+	).Scan(&row.ID, &row.Content, &row.Importance, &row.ServerID, &row.UserID, &row.ChannelID, &row.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return MemoryRow{}, ErrMemoryNotFound
+	}
+	if err != nil {
+		return MemoryRow{}, fmt.Errorf("get memory: %w", err)
+	}
+	return row, nil
+}
+
+// UpdateImportance changes a memory's importance score. Content, embedding
+// and FTS entry are left alone.
+func (s *Store) UpdateImportance(ctx context.Context, id, serverID string, importance float64) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE memories SET importance = ?, updated_at = ? WHERE id = ? AND server_id = ? AND forgotten = 0`,
+		importance, time.Now().UTC(), id, serverID,
+	)
+	if err != nil {
+		return fmt.Errorf("update importance: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrMemoryNotFound
+	}
+	return nil
+}
+
 // ConversationRow holds a single persisted conversation turn returned by ListConversations.
 type ConversationRow struct {
 	ID        int64     `json:"id"`
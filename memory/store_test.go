@@ -13,7 +13,7 @@ import (
 )
 
 // fakeEmbeddingServer returns a test server that responds to embedding requests
-// with a fixed-dimension vector.
+// with a fixed-dimension vector per input.
 func fakeEmbeddingServer(t *testing.T, dim int) *httptest.Server {
 	t.Helper()
 	vec := make([]float64, dim)
@@ -21,12 +21,20 @@ func fakeEmbeddingServer(t *testing.T, dim int) *httptest.Server {
 		vec[i] = float64(i) / float64(dim+1)
 	}
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input any `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		n := 1
+		if inputs, ok := req.Input.([]any); ok {
+			n = len(inputs)
+		}
+		data := make([]map[string]any, n)
+		for i := range data {
+			data[i] = map[string]any{"index": i, "embedding": vec}
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]any{
-			"data": []map[string]any{
-				{"embedding": vec},
-			},
-		})
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
 	}))
 	t.Cleanup(srv.Close)
 	return srv
@@ -407,3 +415,31 @@ func TestRecallRespectsSimThreshold(t *testing.T) {
 		t.Error("expected results with threshold 0.35 (fake embeds have sim=1.0)")
 	}
 }
+
+func TestGetAndUpdateImportance(t *testing.T) {
+	embSrv := fakeEmbeddingServer(t, 4)
+	store := newTestStore(t, embSrv)
+	ctx := context.Background()
+
+	result, err := store.Save(ctx, "likes tea", "srv1", "user1", "chan1", 0.5, 0)
+	if err != nil {
+		t.Fatalf("Save() error: %v", err)
+	}
+	if err := store.UpdateImportance(ctx, result.ID, "srv1", 0.9); err != nil {
+		t.Fatalf("UpdateImportance() error: %v", err)
+	}
+	row, err := store.Get(ctx, "srv1", result.ID)
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if row.Content != "likes tea" || row.Importance != 0.9 || row.UserID != "user1" {
+		t.Errorf("Get() = %+v, want content kept and importance 0.9", row)
+	}
+
+	if _, err := store.Get(ctx, "srv2", result.ID); !errors.Is(err, ErrMemoryNotFound) {
+		t.Errorf("Get() from another server error = %v, want ErrMemoryNotFound", err)
+	}
+	if err := store.UpdateImportance(ctx, "missing", "srv1", 0.1); !errors.Is(err, ErrMemoryNotFound) {
+		t.Errorf("UpdateImportance() on a missing memory error = %v, want ErrMemoryNotFound", err)
+	}
+}
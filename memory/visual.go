@@ -4,21 +4,34 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
+	"unicode"
+
+	"github.com/tomasmach/vespra/llm"
 )
 
 const (
 	maxVisualImageBytes       = 10 * 1024 * 1024
 	maxVisualMemoriesPerLabel = 5
+	// visualBackfillBatch bounds how many older visual memories one recall
+	// indexes for semantic search.
+	visualBackfillBatch = 10
 )
 
+const visualColumns = `v.id, v.label, v.normalized_label, COALESCE(v.description, ''), COALESCE(f.caption, ''), v.importance, v.server_id,
+	COALESCE(v.user_id, ''), COALESCE(v.channel_id, ''), COALESCE(v.message_id, ''), v.content_type, v.file_path, v.sha256, v.size_bytes, v.created_at`
+
+const visualFrom = `visual_memories v LEFT JOIN visual_features f ON f.visual_id = v.id`
+
 // VisualSaveOptions describes an image reference to persist as visual memory.
 type VisualSaveOptions struct {
 	Label       string
@@ -47,6 +60,7 @@ type VisualMemoryRow struct {
 	Label           string    `json:"label"`
 	NormalizedLabel string    `json:"normalized_label"`
 	Description     string    `json:"description,omitempty"`
+	Caption         string    `json:"caption,omitempty"` // the vision model's description
 	Importance      float64   `json:"importance"`
 	ServerID        string    `json:"server_id"`
 	UserID          string    `json:"user_id,omitempty"`
@@ -59,6 +73,14 @@ type VisualMemoryRow struct {
 	CreatedAt       time.Time `json:"created_at"`
 }
 
+// VisualSaveResult holds the outcome of SaveVisual.
+type VisualSaveResult struct {
+	SaveResult
+	// NearDuplicates lists visual memories under other labels whose images
+	// look the same as the saved one, closest first.
+	NearDuplicates []VisualMemoryRow
+}
+
 func normalizeVisualLabel(label string) string {
 	return strings.ToLower(strings.Join(strings.Fields(strings.TrimSpace(label)), " "))
 }
@@ -79,24 +101,28 @@ func visualFileExtension(contentType string) (string, error) {
 }
 
 // SaveVisual persists a user-provided reference image and searchable metadata.
-func (s *Store) SaveVisual(ctx context.Context, opts VisualSaveOptions) (SaveResult, error) {
+// The vision model describes the image, and the label, description and that
+// caption are embedded for RecallVisual. An image that looks the same as one
+// already saved under the label is not stored again; look-alikes under other
+// labels are reported in the result.
+func (s *Store) SaveVisual(ctx context.Context, opts VisualSaveOptions) (VisualSaveResult, error) {
 	label := strings.TrimSpace(opts.Label)
 	normalizedLabel := normalizeVisualLabel(label)
 	if label == "" || normalizedLabel == "" {
-		return SaveResult{}, fmt.Errorf("label is required")
+		return VisualSaveResult{}, fmt.Errorf("label is required")
 	}
 	if opts.ServerID == "" {
-		return SaveResult{}, fmt.Errorf("serverID is required")
+		return VisualSaveResult{}, fmt.Errorf("serverID is required")
 	}
 	if len(opts.Data) == 0 {
-		return SaveResult{}, fmt.Errorf("image data is required")
+		return VisualSaveResult{}, fmt.Errorf("image data is required")
 	}
 	if len(opts.Data) > maxVisualImageBytes {
-		return SaveResult{}, fmt.Errorf("image exceeds %d bytes", maxVisualImageBytes)
+		return VisualSaveResult{}, fmt.Errorf("image exceeds %d bytes", maxVisualImageBytes)
 	}
 	ext, err := visualFileExtension(opts.ContentType)
 	if err != nil {
-		return SaveResult{}, err
+		return VisualSaveResult{}, err
 	}
 	importance := opts.Importance
 	if importance == 0 {
@@ -113,29 +139,52 @@ func (s *Store) SaveVisual(ctx context.Context, opts VisualSaveOptions) (SaveRes
 		opts.ServerID, normalizedLabel, hash,
 	).Scan(&existingID)
 	if err == nil {
-		return SaveResult{ID: existingID, Status: SaveStatusExists}, nil
+		return VisualSaveResult{SaveResult: SaveResult{ID: existingID, Status: SaveStatusExists}}, nil
 	}
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
-		return SaveResult{}, fmt.Errorf("check visual duplicate: %w", err)
+		return VisualSaveResult{}, fmt.Errorf("check visual duplicate: %w", err)
+	}
+
+	phash, hashed := perceptualHash(opts.Data)
+	var nearDuplicates []VisualMemoryRow
+	if hashed {
+		similar, err := s.nearDuplicateVisuals(ctx, opts.ServerID, phash)
+		if err != nil {
+			return VisualSaveResult{}, fmt.Errorf("check visual near-duplicates: %w", err)
+		}
+		for _, row := range similar {
+			if row.NormalizedLabel == normalizedLabel {
+				return VisualSaveResult{SaveResult: SaveResult{ID: row.ID, Status: SaveStatusExists}}, nil
+			}
+		}
+		nearDuplicates = similar
+	}
+
+	caption := s.describeVisual(ctx, opts.ContentType, opts.Data)
+	var vector []byte
+	if vec, err := s.llm.Embed(ctx, visualIndexText(label, opts.Description, caption)); err != nil {
+		slog.Warn("embed visual memory failed, saving without embedding", "error", err)
+	} else {
+		vector = llm.VectorToBlob(vec)
 	}
 
 	id, err := newID()
 	if err != nil {
-		return SaveResult{}, fmt.Errorf("generate id: %w", err)
+		return VisualSaveResult{}, fmt.Errorf("generate id: %w", err)
 	}
 	if err := os.MkdirAll(s.mediaDir, 0o755); err != nil {
-		return SaveResult{}, fmt.Errorf("create visual media dir: %w", err)
+		return VisualSaveResult{}, fmt.Errorf("create visual media dir: %w", err)
 	}
 	filePath := filepath.Join(s.mediaDir, id+ext)
 	if err := os.WriteFile(filePath, opts.Data, 0o600); err != nil {
-		return SaveResult{}, fmt.Errorf("write visual memory file: %w", err)
+		return VisualSaveResult{}, fmt.Errorf("write visual memory file: %w", err)
 	}
 
 	now := time.Now().UTC()
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		_ = os.Remove(filePath)
-		return SaveResult{}, fmt.Errorf("begin transaction: %w", err)
+		return VisualSaveResult{}, fmt.Errorf("begin transaction: %w", err)
 	}
 	defer tx.Rollback() //nolint:errcheck
 
@@ -147,17 +196,28 @@ func (s *Store) SaveVisual(ctx context.Context, opts VisualSaveOptions) (SaveRes
 		strings.ToLower(opts.ContentType), filePath, hash, len(opts.Data), now, now,
 	); err != nil {
 		_ = os.Remove(filePath)
-		return SaveResult{}, fmt.Errorf("insert visual memory: %w", err)
+		return VisualSaveResult{}, fmt.Errorf("insert visual memory: %w", err)
+	}
+	var phashValue any // NULL for images the decoders cannot read
+	if hashed {
+		phashValue = int64(phash)
+	}
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO visual_features (visual_id, caption, vector, phash) VALUES (?, ?, ?, ?)`,
+		id, caption, vector, phashValue,
+	); err != nil {
+		_ = os.Remove(filePath)
+		return VisualSaveResult{}, fmt.Errorf("insert visual features: %w", err)
 	}
 	if err = tx.Commit(); err != nil {
 		_ = os.Remove(filePath)
-		return SaveResult{}, fmt.Errorf("commit visual memory: %w", err)
+		return VisualSaveResult{}, fmt.Errorf("commit visual memory: %w", err)
 	}
 
 	if err := s.pruneVisualLabel(ctx, opts.ServerID, normalizedLabel); err != nil {
 		slog.Warn("prune visual memories failed", "error", err, "server_id", opts.ServerID, "label", normalizedLabel)
 	}
-	return SaveResult{ID: id, Status: SaveStatusSaved}, nil
+	return VisualSaveResult{SaveResult: SaveResult{ID: id, Status: SaveStatusSaved}, NearDuplicates: nearDuplicates}, nil
 }
 
 func (s *Store) pruneVisualLabel(ctx context.Context, serverID, normalizedLabel string) error {
@@ -210,26 +270,24 @@ func (s *Store) ListVisual(ctx context.Context, opts VisualListOptions) ([]Visua
 		opts.Limit = 50
 	}
 
-	where := "server_id = ? AND forgotten = 0"
+	where := "v.server_id = ? AND v.forgotten = 0"
 	args := []any{opts.ServerID}
 	if opts.UserID != "" {
-		where += " AND user_id = ?"
+		where += " AND v.user_id = ?"
 		args = append(args, opts.UserID)
 	}
 	if opts.Query != "" {
 		q := "%" + escapeLIKE(normalizeVisualLabel(opts.Query)) + "%"
-		where += ` AND (normalized_label LIKE ? ESCAPE '\' OR lower(description) LIKE ? ESCAPE '\')`
-		args = append(args, q, q)
+		where += ` AND (v.normalized_label LIKE ? ESCAPE '\' OR lower(v.description) LIKE ? ESCAPE '\' OR lower(f.caption) LIKE ? ESCAPE '\')`
+		args = append(args, q, q, q)
 	}
 
 	var total int
-	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM visual_memories WHERE "+where, args...).Scan(&total); err != nil {
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+visualFrom+" WHERE "+where, args...).Scan(&total); err != nil {
 		return nil, 0, fmt.Errorf("count visual memories: %w", err)
 	}
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, label, normalized_label, COALESCE(description, ''), importance, server_id, COALESCE(user_id, ''),
-		        COALESCE(channel_id, ''), COALESCE(message_id, ''), content_type, file_path, sha256, size_bytes, created_at
-		 FROM visual_memories WHERE `+where+` ORDER BY created_at DESC LIMIT ? OFFSET ?`,
+		`SELECT `+visualColumns+` FROM `+visualFrom+` WHERE `+where+` ORDER BY v.created_at DESC LIMIT ? OFFSET ?`,
 		append(args, opts.Limit, opts.Offset)...,
 	)
 	if err != nil {
@@ -243,21 +301,229 @@ func (s *Store) ListVisual(ctx context.Context, opts VisualListOptions) ([]Visua
 	return out, total, nil
 }
 
-// RecallVisual returns top visual memories for a query.
-func (s *Store) RecallVisual(ctx context.Context, query, serverID string, topN int) ([]VisualMemoryRow, error) {
+// RecallVisual returns the visual memories that best match a query, ranked
+// like Recall: semantic matches against the embedded label, description and
+// caption are merged with keyword matches by Reciprocal Rank Fusion.
+func (s *Store) RecallVisual(ctx context.Context, query, serverID string, topN int, simThreshold float64) ([]VisualMemoryRow, error) {
 	if topN == 0 {
 		topN = maxVisualMemoriesPerLabel
 	}
-	rows, _, err := s.ListVisual(ctx, VisualListOptions{ServerID: serverID, Query: query, Limit: topN})
-	return rows, err
+	// Skip the embedding call entirely for agents without visual memories.
+	var count int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM visual_memories WHERE server_id = ? AND forgotten = 0`, serverID,
+	).Scan(&count); err != nil {
+		return nil, fmt.Errorf("count visual memories: %w", err)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	s.backfillVisualFeatures(ctx, serverID)
+
+	var semanticIDs []string
+	vec, err := s.llm.Embed(ctx, query)
+	if err != nil {
+		slog.Warn("embed failed, falling back to keyword-only visual search", "error", err)
+	} else {
+		embeddings, err := s.visualEmbeddings(ctx, serverID)
+		if err != nil {
+			return nil, fmt.Errorf("load visual embeddings: %w", err)
+		}
+		semanticIDs = rankBySimilarity(vec, embeddings, simThreshold)
+	}
+	keywordIDs, err := s.visualKeywordSearch(ctx, query, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("keyword search: %w", err)
+	}
+
+	merged := rrfMerge(semanticIDs, keywordIDs)
+	if len(merged) > topN {
+		merged = merged[:topN]
+	}
+	out := make([]VisualMemoryRow, 0, len(merged))
+	for _, id := range merged {
+		row, err := s.GetVisual(ctx, serverID, id)
+		if errors.Is(err, ErrMemoryNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+func (s *Store) visualEmbeddings(ctx context.Context, serverID string) (map[string][]float32, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT f.visual_id, f.vector FROM visual_features f JOIN visual_memories v ON v.id = f.visual_id
+		 WHERE v.server_id = ? AND v.forgotten = 0 AND f.vector IS NOT NULL`,
+		serverID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string][]float32)
+	for rows.Next() {
+		var id string
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			return nil, fmt.Errorf("scan embedding: %w", err)
+		}
+		result[id] = llm.BlobToVector(blob)
+	}
+	return result, rows.Err()
+}
+
+// visualKeywordSearch returns IDs of visual memories whose label appears as
+// words in the query, or whose label, description or caption contains it.
+func (s *Store) visualKeywordSearch(ctx context.Context, query, serverID string) ([]string, error) {
+	pattern := "%" + escapeLIKE(normalizeVisualLabel(query)) + "%"
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT v.id FROM `+visualFrom+`
+		 WHERE v.server_id = ? AND v.forgotten = 0 AND (
+		   instr(?, ' ' || v.normalized_label || ' ') > 0
+		   OR v.normalized_label LIKE ? ESCAPE '\'
+		   OR lower(v.description) LIKE ? ESCAPE '\'
+		   OR lower(f.caption) LIKE ? ESCAPE '\')
+		 ORDER BY v.importance DESC, v.created_at DESC`,
+		serverID, " "+visualSearchText(query)+" ", pattern, pattern, pattern,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+// visualSearchText lowercases text and turns punctuation into spaces, so
+// that "Alice's dog" contains the label "alice" as a word.
+func visualSearchText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// visualIndexText is what gets embedded for a visual memory.
+func visualIndexText(label, description, caption string) string {
+	parts := []string{label}
+	for _, p := range []string{description, caption} {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// describeVisual asks the vision model what an image shows, so it can be
+// recalled by appearance. Returns "" without a vision model or on failure.
+func (s *Store) describeVisual(ctx context.Context, contentType string, data []byte) string {
+	url := fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(data))
+	desc, err := s.llm.DescribeMedia(ctx, []llm.ContentPart{{Type: "image_url", ImageURL: &llm.ImageURL{URL: url}}})
+	if err != nil {
+		slog.Warn("describe visual memory failed", "error", err)
+		return ""
+	}
+	return strings.TrimSpace(desc)
+}
+
+// nearDuplicateVisuals returns the active visual memories whose perceptual
+// hash is within nearDuplicateDistance of phash, closest first.
+func (s *Store) nearDuplicateVisuals(ctx context.Context, serverID string, phash uint64) ([]VisualMemoryRow, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT f.visual_id, f.phash FROM visual_features f JOIN visual_memories v ON v.id = f.visual_id
+		 WHERE v.server_id = ? AND v.forgotten = 0 AND f.phash IS NOT NULL`,
+		serverID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query perceptual hashes: %w", err)
+	}
+	type match struct {
+		id       string
+		distance int
+	}
+	var matches []match
+	for rows.Next() {
+		var id string
+		var other int64
+		if err := rows.Scan(&id, &other); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan perceptual hash: %w", err)
+		}
+		if d := hashDistance(phash, uint64(other)); d <= nearDuplicateDistance {
+			matches = append(matches, match{id, d})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(matches, func(a, b match) int { return a.distance - b.distance })
+
+	out := make([]VisualMemoryRow, 0, len(matches))
+	for _, m := range matches {
+		row, err := s.GetVisual(ctx, serverID, m.id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+// backfillVisualFeatures indexes a batch of visual memories saved before
+// they were embedded and hashed. The vision model is not asked for captions
+// here, to keep recall fast; re-saving an image adds one.
+func (s *Store) backfillVisualFeatures(ctx context.Context, serverID string) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, label, COALESCE(description, ''), file_path FROM visual_memories
+		 WHERE server_id = ? AND forgotten = 0 AND id NOT IN (SELECT visual_id FROM visual_features)
+		 LIMIT ?`,
+		serverID, visualBackfillBatch,
+	)
+	if err != nil {
+		slog.Warn("query unindexed visual memories failed", "error", err)
+		return
+	}
+	type pending struct{ id, label, description, filePath string }
+	var todo []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.label, &p.description, &p.filePath); err != nil {
+			slog.Warn("scan unindexed visual memory failed", "error", err)
+			break
+		}
+		todo = append(todo, p)
+	}
+	rows.Close()
+
+	for _, p := range todo {
+		vec, err := s.llm.Embed(ctx, visualIndexText(p.label, p.description, ""))
+		if err != nil {
+			slog.Warn("embed visual memory failed, backfill postponed", "error", err)
+			return
+		}
+		var phashValue any
+		if data, err := os.ReadFile(p.filePath); err == nil {
+			if phash, ok := perceptualHash(data); ok {
+				phashValue = int64(phash)
+			}
+		}
+		if _, err := s.db.ExecContext(ctx,
+			`INSERT OR IGNORE INTO visual_features (visual_id, caption, vector, phash) VALUES (?, '', ?, ?)`,
+			p.id, llm.VectorToBlob(vec), phashValue,
+		); err != nil {
+			slog.Warn("backfill visual features failed", "error", err, "id", p.id)
+			return
+		}
+	}
 }
 
 // GetVisual returns one active visual memory by ID.
 func (s *Store) GetVisual(ctx context.Context, serverID, id string) (VisualMemoryRow, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, label, normalized_label, COALESCE(description, ''), importance, server_id, COALESCE(user_id, ''),
-		        COALESCE(channel_id, ''), COALESCE(message_id, ''), content_type, file_path, sha256, size_bytes, created_at
-		 FROM visual_memories WHERE id = ? AND server_id = ? AND forgotten = 0`,
+		`SELECT `+visualColumns+` FROM `+visualFrom+` WHERE v.id = ? AND v.server_id = ? AND v.forgotten = 0`,
 		id, serverID,
 	)
 	if err != nil {
@@ -322,6 +588,7 @@ func scanVisualRow(scanner visualScanner, row *VisualMemoryRow) error {
 		&row.Label,
 		&row.NormalizedLabel,
 		&row.Description,
+		&row.Caption,
 		&row.Importance,
 		&row.ServerID,
 		&row.UserID,
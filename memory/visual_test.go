@@ -1,9 +1,21 @@
 package memory
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/tomasmach/vespra/config"
@@ -12,13 +24,18 @@ import (
 
 func newTestVisualStore(t *testing.T) *Store {
 	t.Helper()
-	embSrv := fakeEmbeddingServer(t, 4)
+	return newTestVisualStoreWithLLM(t, fakeEmbeddingServer(t, 4).URL, "")
+}
+
+func newTestVisualStoreWithLLM(t *testing.T, baseURL, visionModel string) *Store {
+	t.Helper()
 	cfg := &config.Config{
 		LLM: config.LLMConfig{
 			OpenRouterKey:         "test",
 			EmbeddingModel:        "test-embed",
+			VisionModel:           visionModel,
 			RequestTimeoutSeconds: 5,
-			BaseURL:               embSrv.URL,
+			BaseURL:               baseURL,
 		},
 		Memory: config.MemoryConfig{DBPath: filepath.Join(t.TempDir(), "memory.db")},
 	}
@@ -143,3 +160,223 @@ func TestForgetVisualHidesAndRemovesFile(t *testing.T) {
 		t.Fatalf("expected file removal, got stat err %v", err)
 	}
 }
+
+// fakeVisualLLMServer embeds text about red hair along one axis and anything
+// else along another, and answers vision requests with the caption set via
+// the returned function.
+func fakeVisualLLMServer(t *testing.T) (*httptest.Server, func(string)) {
+	t.Helper()
+	var mu sync.Mutex
+	caption := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/embeddings") {
+			var body struct {
+				Input string `json:"input"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			vec := []float64{0, 1, 0, 0}
+			if strings.Contains(strings.ToLower(body.Input), "red") {
+				vec = []float64{1, 0, 0, 0}
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": []map[string]any{{"embedding": vec}}})
+			return
+		}
+		mu.Lock()
+		content := caption
+		mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]any{"role": "assistant", "content": content}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(c string) {
+		mu.Lock()
+		caption = c
+		mu.Unlock()
+	}
+}
+
+// testImage draws a size x size image whose brightness follows shade.
+func testImage(t *testing.T, size int, shade func(x, y float64) uint8, asJPEG bool) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			v := shade(float64(x)/float64(size), float64(y)/float64(size))
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if asJPEG {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatalf("encode test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func checkerboard(x, y float64) uint8 {
+	if (int(x*5)+int(y*3))%2 == 0 {
+		return 220
+	}
+	return 30
+}
+
+func diagonalStripes(x, y float64) uint8 {
+	if int((x+2*y)*4)%2 == 0 {
+		return 200
+	}
+	return 60
+}
+
+func TestRecallVisualMatchesDescriptionSemantically(t *testing.T) {
+	srv, setCaption := fakeVisualLLMServer(t)
+	store := newTestVisualStoreWithLLM(t, srv.URL, "test-vision")
+	ctx := context.Background()
+
+	setCaption("A young woman with long red hair holding playing cards")
+	alice, err := store.SaveVisual(ctx, VisualSaveOptions{
+		Label: "Alice", ServerID: "srv1", ContentType: "image/png",
+		Data: testImage(t, 64, checkerboard, false),
+	})
+	if err != nil {
+		t.Fatalf("SaveVisual(Alice) error: %v", err)
+	}
+	setCaption("A bearded man in a blue hoodie")
+	if _, err := store.SaveVisual(ctx, VisualSaveOptions{
+		Label: "Bob", ServerID: "srv1", ContentType: "image/png",
+		Data: testImage(t, 64, diagonalStripes, false),
+	}); err != nil {
+		t.Fatalf("SaveVisual(Bob) error: %v", err)
+	}
+
+	rows, err := store.RecallVisual(ctx, "the red-haired girl from the game night", "srv1", 5, 0.5)
+	if err != nil {
+		t.Fatalf("RecallVisual() error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].ID != alice.ID {
+		t.Fatalf("expected only Alice, got %+v", rows)
+	}
+	if !strings.Contains(rows[0].Caption, "red hair") {
+		t.Fatalf("expected stored caption, got %q", rows[0].Caption)
+	}
+
+	// A label named in a sentence still matches by keyword.
+	rows, err = store.RecallVisual(ctx, "draw Bob's dog", "srv1", 5, 0.5)
+	if err != nil {
+		t.Fatalf("RecallVisual() keyword error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Label != "Bob" {
+		t.Fatalf("expected Bob by keyword, got %+v", rows)
+	}
+}
+
+func TestSaveVisualDetectsNearDuplicates(t *testing.T) {
+	store := newTestVisualStore(t)
+	ctx := context.Background()
+
+	original, err := store.SaveVisual(ctx, VisualSaveOptions{
+		Label: "Alice", ServerID: "srv1", ContentType: "image/png",
+		Data: testImage(t, 64, checkerboard, false),
+	})
+	if err != nil {
+		t.Fatalf("SaveVisual() error: %v", err)
+	}
+
+	// A resized, recompressed copy under the same label is not stored again.
+	resized := testImage(t, 150, checkerboard, true)
+	same, err := store.SaveVisual(ctx, VisualSaveOptions{
+		Label: "alice", ServerID: "srv1", ContentType: "image/jpeg", Data: resized,
+	})
+	if err != nil {
+		t.Fatalf("SaveVisual() resized error: %v", err)
+	}
+	if same.Status != SaveStatusExists || same.ID != original.ID {
+		t.Fatalf("expected resized copy to return existing id, got %+v", same)
+	}
+
+	// Under another label it is saved but reported.
+	other, err := store.SaveVisual(ctx, VisualSaveOptions{
+		Label: "Carol", ServerID: "srv1", ContentType: "image/jpeg", Data: resized,
+	})
+	if err != nil {
+		t.Fatalf("SaveVisual() other label error: %v", err)
+	}
+	if other.Status != SaveStatusSaved {
+		t.Fatalf("expected save under a new label, got %+v", other)
+	}
+	if len(other.NearDuplicates) != 1 || other.NearDuplicates[0].ID != original.ID {
+		t.Fatalf("expected Alice as near-duplicate, got %+v", other.NearDuplicates)
+	}
+
+	distinct, err := store.SaveVisual(ctx, VisualSaveOptions{
+		Label: "Bob", ServerID: "srv1", ContentType: "image/png",
+		Data: testImage(t, 64, diagonalStripes, false),
+	})
+	if err != nil {
+		t.Fatalf("SaveVisual() distinct error: %v", err)
+	}
+	if len(distinct.NearDuplicates) != 0 {
+		t.Fatalf("expected no near-duplicates for a different image, got %+v", distinct.NearDuplicates)
+	}
+}
+
+func TestRecallVisualBackfillsOlderMemories(t *testing.T) {
+	store := newTestVisualStore(t)
+	ctx := context.Background()
+
+	result, err := store.SaveVisual(ctx, VisualSaveOptions{
+		Label: "Alice", ServerID: "srv1", ContentType: "image/png",
+		Data: testImage(t, 32, checkerboard, false),
+	})
+	if err != nil {
+		t.Fatalf("SaveVisual() error: %v", err)
+	}
+	// Simulate a memory saved before visual features existed.
+	if _, err := store.db.Exec(`DELETE FROM visual_features`); err != nil {
+		t.Fatalf("delete features: %v", err)
+	}
+
+	rows, err := store.RecallVisual(ctx, "someone", "srv1", 5, 0)
+	if err != nil {
+		t.Fatalf("RecallVisual() error: %v", err)
+	}
+	if len(rows) != 1 || rows[0].ID != result.ID {
+		t.Fatalf("expected backfilled memory to be recalled semantically, got %+v", rows)
+	}
+	var phash *int64
+	if err := store.db.QueryRow(`SELECT phash FROM visual_features WHERE visual_id = ?`, result.ID).Scan(&phash); err != nil {
+		t.Fatalf("query backfilled features: %v", err)
+	}
+	if phash == nil {
+		t.Fatal("expected backfill to compute the perceptual hash")
+	}
+}
+
+func TestPerceptualHashSkipsHugeImages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := perceptualHash(buf.Bytes()); !ok {
+		t.Fatal("perceptualHash failed on a small image")
+	}
+
+	// Declare 100000x100000 pixels in the IHDR chunk, which follows the
+	// 8-byte signature, and fix up its CRC.
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:20], 100000)
+	binary.BigEndian.PutUint32(data[20:24], 100000)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	if cfg, err := png.DecodeConfig(bytes.NewReader(data)); err != nil || cfg.Width != 100000 {
+		t.Fatalf("patched PNG config = %+v, %v", cfg, err)
+	}
+	if _, ok := perceptualHash(data); ok {
+		t.Error("perceptualHash hashed an image over the pixel cap")
+	}
+}
@@ -0,0 +1,187 @@
+// Package netguard provides an HTTP client for fetching URLs that come from
+// untrusted input, such as links chosen by the model or embedded in Discord
+// messages. It refuses to connect to loopback, private, link-local and other
+// non-public addresses, checked on the resolved IP at dial time so DNS
+// tricks cannot bypass it, and applies a domain allow/deny list to every
+// request, redirects included.
+package netguard
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// maxRedirects bounds redirect chains.
+const maxRedirects = 5
+
+// Policy limits where outbound requests may go.
+type Policy struct {
+	AllowDomains []string // when set, only these domains and their subdomains may be fetched
+	DenyDomains  []string // these domains and their subdomains are never fetched; wins over AllowDomains
+	AllowPrivate bool     // permit loopback, private and link-local addresses
+}
+
+// BlockedError reports a request refused by the policy.
+type BlockedError struct {
+	Target string // host name or IP address
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("blocked request to %s: %s", e.Target, e.Reason)
+}
+
+// nonPublic lists special-purpose ranges that netip's predicates do not
+// cover but that must not be reachable either.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // reserved, including broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which embeds IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"), // local-use NAT64
+	netip.MustParsePrefix("2001::/32"),      // Teredo, which embeds IPv4 addresses
+	netip.MustParsePrefix("2002::/16"),      // 6to4, which embeds IPv4 addresses
+	netip.MustParsePrefix("100::/64"),       // discard-only
+	netip.MustParsePrefix("2001:db8::/32"),  // documentation
+	netip.MustParsePrefix("fec0::/10"),      // deprecated site-local
+}
+
+// CheckAddr returns a *BlockedError if the policy forbids connecting to addr.
+func (p Policy) CheckAddr(addr netip.Addr) error {
+	if p.AllowPrivate {
+		return nil
+	}
+	addr = addr.Unmap()
+	var reason string
+	switch {
+	case addr.IsLoopback():
+		reason = "loopback address"
+	case addr.IsPrivate():
+		reason = "private address"
+	case addr.IsLinkLocalUnicast(), addr.IsLinkLocalMulticast():
+		reason = "link-local address"
+	case addr.IsUnspecified(), addr.IsMulticast(), addr.IsInterfaceLocalMulticast():
+		reason = "non-unicast address"
+	}
+	if reason == "" {
+		for _, prefix := range nonPublic {
+			if prefix.Contains(addr) {
+				reason = "reserved address"
+				break
+			}
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+	return &BlockedError{Target: addr.String(), Reason: reason}
+}
+
+// CheckHost returns a *BlockedError if the domain lists forbid host.
+func (p Policy) CheckHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, d := range p.DenyDomains {
+		if matchDomain(host, d) {
+			return &BlockedError{Target: host, Reason: "domain is denied"}
+		}
+	}
+	if len(p.AllowDomains) == 0 {
+		return nil
+	}
+	for _, d := range p.AllowDomains {
+		if matchDomain(host, d) {
+			return nil
+		}
+	}
+	return &BlockedError{Target: host, Reason: "domain is not in the allow list"}
+}
+
+// matchDomain reports whether host is domain or one of its subdomains.
+// Domains may be written as "example.com", ".example.com" or "*.example.com".
+func matchDomain(host, domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*"), ".")
+	if domain == "" {
+		return false
+	}
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// NewClient returns an HTTP client that enforces the policy returned by
+// policy, which is consulted on every request and connection so config
+// reloads apply immediately. Environment proxy settings are ignored: a proxy
+// would make the dialer see the proxy's address instead of the target's.
+func NewClient(policy func() Policy, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		// Control runs after DNS resolution, once per address tried, so it
+		// sees the IP actually being connected to.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return &BlockedError{Target: address, Reason: "unparseable address"}
+			}
+			return policy().CheckAddr(ap.Addr())
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &guardedTransport{policy: policy, next: transport},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// CheckURL applies the scheme and domain checks of a client made by
+// NewClient to u without sending a request, for callers that answer from a
+// cache. It returns nil for other clients.
+func CheckURL(client *http.Client, u *url.URL) error {
+	t, ok := client.Transport.(*guardedTransport)
+	if !ok {
+		return nil
+	}
+	return t.check(u)
+}
+
+// guardedTransport checks the scheme and host of each request, including
+// every redirect the client follows, before it is sent.
+type guardedTransport struct {
+	policy func() Policy
+	next   http.RoundTripper
+}
+
+func (t *guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.check(req.URL); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+func (t *guardedTransport) check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &BlockedError{Target: u.String(), Reason: "only http and https URLs can be fetched"}
+	}
+	return t.policy().CheckHost(u.Hostname())
+}
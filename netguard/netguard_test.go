@@ -0,0 +1,141 @@
+package netguard
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestClient(p Policy) *http.Client {
+	return NewClient(func() Policy { return p }, 5*time.Second)
+}
+
+func TestClientBlocksLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(Policy{}).Get(srv.URL)
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("err = %v, want *BlockedError", err)
+	}
+	if blocked.Reason != "loopback address" {
+		t.Errorf("Reason = %q, want loopback address", blocked.Reason)
+	}
+}
+
+func TestClientAllowPrivate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	resp, err := newTestClient(Policy{AllowPrivate: true}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestClientChecksRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer target.Close()
+	u, _ := url.Parse(target.URL)
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:"+u.Port()+"/", http.StatusFound)
+	}))
+	defer redirector.Close()
+
+	// The first hop goes to 127.0.0.1, which is not denied; the redirect
+	// names localhost, which is.
+	_, err := newTestClient(Policy{AllowPrivate: true, DenyDomains: []string{"localhost"}}).Get(redirector.URL)
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) || blocked.Target != "localhost" {
+		t.Fatalf("err = %v, want *BlockedError for localhost", err)
+	}
+}
+
+func TestClientAllowList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	_, err := newTestClient(Policy{AllowPrivate: true, AllowDomains: []string{"example.com"}}).Get(srv.URL)
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("err = %v, want *BlockedError", err)
+	}
+}
+
+func TestClientRejectsOtherSchemes(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "file:///etc/passwd", nil)
+	_, err := newTestClient(Policy{AllowPrivate: true}).Do(req)
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) {
+		t.Fatalf("err = %v, want *BlockedError", err)
+	}
+}
+
+func TestCheckAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"10.0.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"255.255.255.255", true},
+		{"::1", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"64:ff9b::a00:1", true},
+		{"8.8.8.8", false},
+		{"2606:4700::1111", false},
+	}
+	for _, tt := range tests {
+		err := Policy{}.CheckAddr(netip.MustParseAddr(tt.addr))
+		if (err != nil) != tt.blocked {
+			t.Errorf("CheckAddr(%s) = %v, want blocked %v", tt.addr, err, tt.blocked)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	p := Policy{
+		AllowDomains: []string{"example.com", "*.wikipedia.org"},
+		DenyDomains:  []string{".internal.example.com"},
+	}
+	tests := []struct {
+		host    string
+		blocked bool
+	}{
+		{"example.com", false},
+		{"WWW.Example.com.", false},
+		{"en.wikipedia.org", false},
+		{"wikipedia.org", false},
+		{"internal.example.com", true},
+		{"db.internal.example.com", true},
+		{"notexample.com", true},
+		{"example.com.evil.net", true},
+	}
+	for _, tt := range tests {
+		err := p.CheckHost(tt.host)
+		if (err != nil) != tt.blocked {
+			t.Errorf("CheckHost(%q) = %v, want blocked %v", tt.host, err, tt.blocked)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package pdftext
+
+import (
+	"math"
+	"reflect"
+	"strings"
+)
+
+// maxFormDepth limits how deeply form XObjects may nest.
+const maxFormDepth = 8
+
+// spaceThreshold is the TJ adjustment, in thousandths of an em, beyond which
+// a gap between two strings is read as a word break.
+const spaceThreshold = 250
+
+// textWriter interprets content streams and collects the text they show. It
+// does not lay out glyphs: a change of baseline starts a new line and any
+// other repositioning between strings separates words.
+type textWriter struct {
+	doc     *document
+	sb      strings.Builder
+	fonts   map[uintptr]map[name]*font // decoders per resource dictionary
+	lineY   float64                    // baseline of the current line
+	leading float64
+	shownY  float64 // baseline of the last shown text
+	shown   bool    // any text has been shown
+	space   bool    // a word break is pending before the next text
+}
+
+func newTextWriter(doc *document) *textWriter {
+	return &textWriter{doc: doc, fonts: make(map[uintptr]map[name]*font)}
+}
+
+// run interprets a content stream with the given resources.
+func (w *textWriter) run(content []byte, resources dict, depth int) {
+	var cur *font
+	fonts := w.fontsFor(resources)
+	l := &lexer{b: content}
+	var operands []any
+	for {
+		tok, err := l.object()
+		if err != nil {
+			return
+		}
+		op, ok := tok.(keyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+		switch op {
+		case "BT":
+			w.moveTo(0)
+		case "Tf":
+			if len(operands) >= 2 {
+				if n, ok := operands[0].(name); ok {
+					cur = fonts(n)
+				}
+			}
+		case "TL":
+			w.leading = number(operands, 0)
+		case "Td":
+			w.moveTo(w.lineY + number(operands, 1))
+		case "TD":
+			ty := number(operands, 1)
+			w.leading = -ty
+			w.moveTo(w.lineY + ty)
+		case "Tm":
+			w.moveTo(number(operands, 5))
+		case "T*":
+			w.moveTo(w.lineY - w.leading)
+		case "Tj":
+			w.show(cur, lastString(operands))
+		case "'", `"`:
+			w.moveTo(w.lineY - w.leading)
+			w.show(cur, lastString(operands))
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			arr, _ := operands[len(operands)-1].(array)
+			for _, v := range arr {
+				switch v := v.(type) {
+				case string:
+					w.show(cur, v)
+				case float64:
+					if v < -spaceThreshold {
+						w.space = true
+					}
+				}
+			}
+		case "Do":
+			if len(operands) > 0 && depth < maxFormDepth {
+				if n, ok := operands[0].(name); ok {
+					w.form(resources, n, depth)
+				}
+			}
+		case "BI":
+			for {
+				t, err := l.object()
+				if err != nil || t == keyword("ID") {
+					break
+				}
+			}
+			l.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// form runs the content of a form XObject.
+func (w *textWriter) form(resources dict, n name, depth int) {
+	xobjects := w.doc.dictOf(resources["XObject"])
+	s, ok := w.doc.resolve(xobjects[n]).(*stream)
+	if !ok {
+		return
+	}
+	if sub, _ := w.doc.resolve(s.dict["Subtype"]).(name); sub != "Form" {
+		return
+	}
+	data, err := w.doc.decode(s)
+	if err != nil {
+		return
+	}
+	formResources := w.doc.dictOf(s.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+	w.run(data, formResources, depth+1)
+}
+
+// fontsFor returns a lookup of the fonts in a resource dictionary, loading
+// each font once.
+func (w *textWriter) fontsFor(resources dict) func(name) *font {
+	key := reflect.ValueOf(resources).Pointer()
+	cache, ok := w.fonts[key]
+	if !ok {
+		cache = make(map[name]*font)
+		w.fonts[key] = cache
+	}
+	return func(n name) *font {
+		if f, ok := cache[n]; ok {
+			return f
+		}
+		var f *font
+		if fd := w.doc.dictOf(w.doc.dictOf(resources["Font"])[n]); fd != nil {
+			f = w.doc.loadFont(fd)
+		}
+		cache[n] = f
+		return f
+	}
+}
+
+// moveTo starts a new text position on baseline y.
+func (w *textWriter) moveTo(y float64) {
+	w.lineY = y
+	w.space = true
+}
+
+func (w *textWriter) show(f *font, s string) {
+	if f == nil || s == "" {
+		return
+	}
+	text := f.decode(s)
+	if text == "" {
+		return
+	}
+	if w.shown {
+		if math.Abs(w.lineY-w.shownY) > 0.01 {
+			w.sb.WriteByte('\n')
+		} else if w.space {
+			w.sb.WriteByte(' ')
+		}
+	}
+	w.sb.WriteString(text)
+	w.shown = true
+	w.shownY = w.lineY
+	w.space = false
+}
+
+// reset prepares the writer for the next page.
+func (w *textWriter) reset() string {
+	text := w.sb.String()
+	w.sb.Reset()
+	w.shown = false
+	w.space = false
+	w.lineY, w.shownY, w.leading = 0, 0, 0
+	return text
+}
+
+func number(operands []any, i int) float64 {
+	if i < len(operands) {
+		if f, ok := operands[i].(float64); ok {
+			return f
+		}
+	}
+	return 0
+}
+
+func lastString(operands []any) string {
+	if len(operands) == 0 {
+		return ""
+	}
+	s, _ := operands[len(operands)-1].(string)
+	return s
+}
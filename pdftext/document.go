@@ -0,0 +1,386 @@
+package pdftext
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+)
+
+// maxDecodedBytes bounds the decompressed size of a single stream, so a
+// small document cannot expand into gigabytes.
+const maxDecodedBytes = 64 << 20
+
+// objHeader matches the "num gen obj" line that starts an indirect object.
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// document holds the objects of a PDF file. Objects are found by scanning
+// the file for their headers rather than through the cross-reference table,
+// which keeps extraction working on damaged or truncated files. Later
+// definitions of an object win, as with incremental updates.
+type document struct {
+	objects  map[int]any
+	trailers []dict // trailer dictionaries and cross-reference stream dictionaries
+}
+
+func parseDocument(data []byte) *document {
+	d := &document{objects: make(map[int]any)}
+	end := 0
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		if m[0] < end {
+			continue // inside the previous object, e.g. in stream data
+		}
+		num, ok := atoi(data[m[2]:m[3]])
+		if !ok {
+			continue
+		}
+		l := &lexer{b: data, pos: m[1], refs: true}
+		obj, err := l.object()
+		if err != nil && obj == nil {
+			continue
+		}
+		if dc, ok := obj.(dict); ok {
+			if s, next, ok := readStream(data, l.pos, dc); ok {
+				obj = s
+				l.pos = next
+				if t, _ := dc["Type"].(name); t == "XRef" {
+					d.trailers = append(d.trailers, dc)
+				}
+			}
+		}
+		d.objects[num] = obj
+		end = l.pos
+	}
+	for i := 0; ; {
+		j := bytes.Index(data[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		l := &lexer{b: data, pos: i + j + len("trailer"), refs: true}
+		if t, _ := l.object(); t != nil {
+			if dc, ok := t.(dict); ok {
+				d.trailers = append(d.trailers, dc)
+			}
+		}
+		i += j + len("trailer")
+	}
+	d.loadObjectStreams()
+	return d
+}
+
+// readStream reads the stream data that follows dictionary dc when the next
+// keyword at pos is "stream". It returns the position after "endstream".
+func readStream(data []byte, pos int, dc dict) (*stream, int, bool) {
+	l := &lexer{b: data, pos: pos}
+	if tok, err := l.token(); err != nil || tok != keyword("stream") {
+		return nil, 0, false
+	}
+	start := l.pos
+	if start < len(data) && data[start] == '\r' {
+		start++
+	}
+	if start < len(data) && data[start] == '\n' {
+		start++
+	}
+	// Trust a direct /Length when "endstream" follows it; otherwise search.
+	if n, ok := dc["Length"].(float64); ok && n >= 0 && start+int(n) <= len(data) {
+		stop := start + int(n)
+		after := &lexer{b: data, pos: stop}
+		if tok, err := after.token(); err == nil && tok == keyword("endstream") {
+			return &stream{dict: dc, data: data[start:stop]}, after.pos, true
+		}
+	}
+	i := bytes.Index(data[start:], []byte("endstream"))
+	if i < 0 {
+		return &stream{dict: dc, data: data[start:]}, len(data), true
+	}
+	stop := start + i
+	body := data[start:stop]
+	body = bytes.TrimSuffix(body, []byte("\n"))
+	body = bytes.TrimSuffix(body, []byte("\r"))
+	return &stream{dict: dc, data: body}, stop + len("endstream"), true
+}
+
+// loadObjectStreams adds the objects compressed into object streams (PDF
+// 1.5+), unless the file also defines them directly.
+func (d *document) loadObjectStreams() {
+	var streams []*stream
+	for _, num := range d.sortedObjectNumbers() {
+		if s, ok := d.objects[num].(*stream); ok {
+			if t, _ := s.dict["Type"].(name); t == "ObjStm" {
+				streams = append(streams, s)
+			}
+		}
+	}
+	for _, s := range streams {
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		n, _ := d.resolve(s.dict["N"]).(float64)
+		first, _ := d.resolve(s.dict["First"]).(float64)
+		if first < 0 || int(first) > len(data) {
+			continue
+		}
+		header := &lexer{b: data[:int(first)]}
+		for i := 0; i < int(n); i++ {
+			numTok, err1 := header.token()
+			offTok, err2 := header.token()
+			num, ok1 := numTok.(float64)
+			off, ok2 := offTok.(float64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			if _, exists := d.objects[int(num)]; exists {
+				continue
+			}
+			pos := int(first) + int(off)
+			if pos < 0 || pos >= len(data) {
+				continue
+			}
+			l := &lexer{b: data, pos: pos, refs: true}
+			if obj, err := l.object(); err == nil {
+				d.objects[int(num)] = obj
+			}
+		}
+	}
+}
+
+// resolve follows indirect references to the object they point at.
+func (d *document) resolve(obj any) any {
+	for i := 0; i < 32; i++ {
+		r, ok := obj.(ref)
+		if !ok {
+			return obj
+		}
+		obj = d.objects[r.num]
+	}
+	return nil
+}
+
+// dictOf resolves obj and returns it as a dictionary, looking through streams
+// to their dictionary.
+func (d *document) dictOf(obj any) dict {
+	switch v := d.resolve(obj).(type) {
+	case dict:
+		return v
+	case *stream:
+		return v.dict
+	}
+	return nil
+}
+
+func (d *document) encrypted() bool {
+	for _, t := range d.trailers {
+		if _, ok := t["Encrypt"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// catalog returns the document catalog, from the newest trailer that names
+// one or, failing that, from any object typed as a catalog.
+func (d *document) catalog() dict {
+	for i := len(d.trailers) - 1; i >= 0; i-- {
+		if c := d.dictOf(d.trailers[i]["Root"]); c != nil {
+			return c
+		}
+	}
+	for _, num := range d.sortedObjectNumbers() {
+		if c, ok := d.objects[num].(dict); ok {
+			if t, _ := c["Type"].(name); t == "Catalog" {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func (d *document) sortedObjectNumbers() []int {
+	nums := make([]int, 0, len(d.objects))
+	for n := range d.objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// page is a page dictionary with its resources, which may be inherited from
+// an ancestor in the page tree.
+type page struct {
+	dict      dict
+	resources dict
+}
+
+// pages returns the pages in reading order. When the page tree is missing or
+// broken, page objects are returned in object number order.
+func (d *document) pages() []page {
+	var out []page
+	seen := make(map[int]bool)
+	var walk func(obj any, resources dict, depth int)
+	walk = func(obj any, resources dict, depth int) {
+		if r, ok := obj.(ref); ok {
+			if seen[r.num] {
+				return
+			}
+			seen[r.num] = true
+		}
+		node := d.dictOf(obj)
+		if node == nil || depth > 64 {
+			return
+		}
+		if r := d.dictOf(node["Resources"]); r != nil {
+			resources = r
+		}
+		kids, isTree := d.resolve(node["Kids"]).(array)
+		if !isTree {
+			out = append(out, page{dict: node, resources: resources})
+			return
+		}
+		for _, k := range kids {
+			walk(k, resources, depth+1)
+		}
+	}
+	if c := d.catalog(); c != nil {
+		walk(c["Pages"], nil, 0)
+	}
+	if len(out) > 0 {
+		return out
+	}
+	for _, num := range d.sortedObjectNumbers() {
+		if p, ok := d.objects[num].(dict); ok {
+			if t, _ := p["Type"].(name); t == "Page" {
+				out = append(out, page{dict: p, resources: d.dictOf(p["Resources"])})
+			}
+		}
+	}
+	return out
+}
+
+// contents returns the decoded content streams of a page, joined.
+func (d *document) contents(p page) []byte {
+	var parts []any
+	switch v := d.resolve(p.dict["Contents"]).(type) {
+	case array:
+		parts = v
+	case *stream:
+		parts = []any{v}
+	}
+	var buf bytes.Buffer
+	for _, part := range parts {
+		s, ok := d.resolve(part).(*stream)
+		if !ok {
+			continue
+		}
+		data, err := d.decode(s)
+		if err != nil {
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// decode applies the stream's filters to its data.
+func (d *document) decode(s *stream) ([]byte, error) {
+	var filters []any
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = []any{f}
+	case array:
+		filters = f
+	}
+	data := s.data
+	for _, f := range filters {
+		var err error
+		switch d.resolve(f) {
+		case name("FlateDecode"), name("Fl"):
+			data, err = inflate(data)
+		case name("ASCIIHexDecode"), name("AHx"):
+			data, err = asciiHexDecode(data)
+		case name("ASCII85Decode"), name("A85"):
+			data, err = ascii85Decode(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if parms := d.dictOf(s.dict["DecodeParms"]); parms != nil {
+		if p, _ := d.resolve(parms["Predictor"]).(float64); p > 1 {
+			return nil, fmt.Errorf("unsupported predictor %v", p)
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data, falling back to raw deflate for streams
+// with a broken header and keeping whatever a truncated stream yields.
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		defer zr.Close()
+		r = zr
+	} else {
+		fr := flate.NewReader(bytes.NewReader(data))
+		defer fr.Close()
+		r = fr
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxDecodedBytes))
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("inflate: %w", err)
+	}
+	return out, nil
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(out, digits); err != nil {
+		return nil, fmt.Errorf("ASCIIHex decode: %w", err)
+	}
+	return out, nil
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)+4) // 'z' expands to four bytes
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, fmt.Errorf("ASCII85 decode: %w", err)
+	}
+	return out[:n], nil
+}
+
+func atoi(b []byte) (int, bool) {
+	if len(b) == 0 || len(b) > 9 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
@@ -0,0 +1,258 @@
+package pdftext
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxRangeEntries caps how many codes a single bfrange may map, so a
+// malformed CMap cannot allocate without bound.
+const maxRangeEntries = 1 << 16
+
+// font turns the bytes of a shown string into text.
+type font struct {
+	codeBytes int               // bytes per character code
+	toUnicode map[uint32]string // from the font's ToUnicode CMap
+	simple    *[256]rune        // encoding of a simple (single-byte) font
+}
+
+// loadFont builds the decoder for a font dictionary.
+func (d *document) loadFont(fd dict) *font {
+	f := &font{codeBytes: 1}
+	subtype, _ := d.resolve(fd["Subtype"]).(name)
+	if subtype == "Type0" {
+		f.codeBytes = 2
+	}
+	if s, ok := d.resolve(fd["ToUnicode"]).(*stream); ok {
+		if data, err := d.decode(s); err == nil {
+			var width int
+			f.toUnicode, width = parseCMap(data)
+			if width > 0 {
+				f.codeBytes = width
+			}
+		}
+	}
+	if subtype != "Type0" {
+		f.simple = d.simpleEncoding(fd["Encoding"])
+	}
+	return f
+}
+
+// simpleEncoding returns the code-to-rune table of a simple font: a base
+// encoding, WinAnsi unless MacRoman is named, with any Differences applied.
+func (d *document) simpleEncoding(enc any) *[256]rune {
+	base := charmap.Windows1252
+	var differences array
+	switch e := d.resolve(enc).(type) {
+	case name:
+		if e == "MacRomanEncoding" {
+			base = charmap.Macintosh
+		}
+	case dict:
+		if b, _ := d.resolve(e["BaseEncoding"]).(name); b == "MacRomanEncoding" {
+			base = charmap.Macintosh
+		}
+		differences, _ = d.resolve(e["Differences"]).(array)
+	}
+	var table [256]rune
+	for i := range table {
+		table[i] = base.DecodeByte(byte(i))
+	}
+	code := 0
+	for _, v := range differences {
+		switch v := d.resolve(v).(type) {
+		case float64:
+			code = int(v)
+		case name:
+			if code >= 0 && code < 256 {
+				if r, ok := glyphRune(string(v)); ok {
+					table[code] = r
+				}
+			}
+			code++
+		}
+	}
+	return &table
+}
+
+// decode converts the bytes of a shown string to text.
+func (f *font) decode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		n := f.codeBytes
+		if i+n > len(s) {
+			n = len(s) - i
+		}
+		var code uint32
+		for _, c := range []byte(s[i : i+n]) {
+			code = code<<8 | uint32(c)
+		}
+		i += n
+		if t, ok := f.toUnicode[code]; ok {
+			sb.WriteString(t)
+			continue
+		}
+		if f.simple != nil && code < 256 {
+			if r := f.simple[code]; r != 0 && r != utf8.RuneError {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	return sb.String()
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap. It
+// also returns the code width from the first codespace range, or 0 if the
+// CMap declares none.
+func parseCMap(data []byte) (map[uint32]string, int) {
+	m := make(map[uint32]string)
+	width := 0
+	l := &lexer{b: data}
+	var operands []any
+	for {
+		tok, err := l.object()
+		if err != nil {
+			return m, width
+		}
+		kw, ok := tok.(keyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			if width == 0 && len(operands) >= 2 {
+				if lo, ok := operands[0].(string); ok && len(lo) > 0 && len(lo) <= 4 {
+					width = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(string)
+				dst, ok2 := operands[i+1].(string)
+				if ok1 && ok2 {
+					m[codeOf(src)] = utf16String(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 {
+					continue
+				}
+				start, end := codeOf(lo), codeOf(hi)
+				if end < start || end-start >= maxRangeEntries {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case string:
+					units := utf16Units(dst)
+					if len(units) == 0 {
+						continue
+					}
+					for c := start; c <= end; c++ {
+						u := append([]uint16(nil), units...)
+						u[len(u)-1] += uint16(c - start)
+						m[c] = string(utf16.Decode(u))
+					}
+				case array:
+					for j, v := range dst {
+						if s, ok := v.(string); ok && start+uint32(j) <= end {
+							m[start+uint32(j)] = utf16String(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func codeOf(s string) uint32 {
+	var code uint32
+	for _, c := range []byte(s) {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func utf16Units(s string) []uint16 {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return units
+}
+
+func utf16String(s string) string {
+	return string(utf16.Decode(utf16Units(s)))
+}
+
+// glyphNames covers the Adobe glyph names that Differences arrays commonly
+// use for ASCII punctuation and typographic characters. Letters and digits,
+// accented letters and uniXXXX names are derived in glyphRune.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')',
+	"asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/',
+	"colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>', "question": '?',
+	"at": '@', "bracketleft": '[', "backslash": '\\', "bracketright": ']', "asciicircum": '^',
+	"underscore": '_', "grave": '`', "braceleft": '{', "bar": '|', "braceright": '}',
+	"asciitilde": '~', "quoteleft": '‘', "quoteright": '’', "quotedblleft": '“',
+	"quotedblright": '”', "quotesinglbase": '‚', "quotedblbase": '„', "endash": '–',
+	"emdash": '—', "bullet": '•', "ellipsis": '…', "dagger": '†', "daggerdbl": '‡',
+	"degree": '°', "copyright": '©', "registered": '®', "trademark": '™', "section": '§',
+	"paragraph": '¶', "euro": '€', "sterling": '£', "yen": '¥', "cent": '¢', "minus": '−',
+	"multiply": '×', "divide": '÷', "periodcentered": '·', "germandbls": 'ß', "ae": 'æ',
+	"AE": 'Æ', "oe": 'œ', "OE": 'Œ', "oslash": 'ø', "Oslash": 'Ø', "dotlessi": 'ı',
+	"guillemotleft": '«', "guillemotright": '»', "nbspace": '\u00A0', "fi": 'ﬁ', "fl": 'ﬂ',
+	"ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "zero": '0', "one": '1', "two": '2', "three": '3',
+	"four": '4', "five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9',
+}
+
+// accents maps the accent suffixes of glyph names such as "eacute" to
+// combining marks.
+var accents = map[string]rune{
+	"grave": '\u0300', "acute": '\u0301', "circumflex": '\u0302', "tilde": '\u0303',
+	"macron": '\u0304', "breve": '\u0306', "dotaccent": '\u0307', "dieresis": '\u0308',
+	"ring": '\u030A', "hungarumlaut": '\u030B', "caron": '\u030C', "cedilla": '\u0327',
+	"ogonek": '\u0328',
+}
+
+// glyphRune maps a glyph name to the character it draws.
+func glyphRune(glyph string) (rune, bool) {
+	if i := strings.IndexByte(glyph, '.'); i > 0 {
+		glyph = glyph[:i] // "a.sc", "one.oldstyle"
+	}
+	if r, ok := glyphNames[glyph]; ok {
+		return r, true
+	}
+	if len(glyph) == 1 {
+		return rune(glyph[0]), true
+	}
+	if hexPart, ok := strings.CutPrefix(glyph, "uni"); ok && len(hexPart) >= 4 {
+		if v, err := strconv.ParseUint(hexPart[:4], 16, 16); err == nil {
+			return rune(v), true
+		}
+	}
+	if hexPart, ok := strings.CutPrefix(glyph, "u"); ok && len(hexPart) >= 4 && len(hexPart) <= 6 {
+		if v, err := strconv.ParseUint(hexPart, 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	if len(glyph) > 1 {
+		if mark, ok := accents[glyph[1:]]; ok {
+			composed := norm.NFC.String(string([]rune{rune(glyph[0]), mark}))
+			if r := []rune(composed); len(r) == 1 {
+				return r[0], true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,297 @@
+package pdftext
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// PDF objects are represented with these types plus float64 (numbers), bool,
+// nil (null) and string (string objects, as raw bytes).
+type (
+	name    string
+	keyword string
+	dict    map[name]any
+	array   []any
+	ref     struct{ num, gen int }
+	stream  struct {
+		dict dict
+		data []byte // still encoded
+	}
+)
+
+var errUnexpectedEOF = errors.New("unexpected end of data")
+
+// lexer reads PDF tokens and objects from a byte slice.
+type lexer struct {
+	b    []byte
+	pos  int
+	refs bool // recognise "n g R" references; off for content streams
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		if isSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' && l.b[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// token returns the next token: a float64, name, string, or keyword.
+// Delimiters of compound objects come back as the keywords "[", "]", "<<",
+// ">>", "{" and "}".
+func (l *lexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return nil, errUnexpectedEOF
+	}
+	c := l.b[l.pos]
+	switch c {
+	case '/':
+		return l.name(), nil
+	case '(':
+		return l.literalString(), nil
+	case '<':
+		if l.pos+1 < len(l.b) && l.b[l.pos+1] == '<' {
+			l.pos += 2
+			return keyword("<<"), nil
+		}
+		return l.hexString(), nil
+	case '>':
+		if l.pos+1 < len(l.b) && l.b[l.pos+1] == '>' {
+			l.pos += 2
+			return keyword(">>"), nil
+		}
+		l.pos++
+		return keyword(">"), nil
+	case '[', ']', '{', '}', ')':
+		l.pos++
+		return keyword([]byte{c}), nil
+	}
+	start := l.pos
+	for l.pos < len(l.b) && !isSpace(l.b[l.pos]) && !isDelim(l.b[l.pos]) {
+		l.pos++
+	}
+	word := string(l.b[start:l.pos])
+	if c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, nil
+		}
+	}
+	return keyword(word), nil
+}
+
+func (l *lexer) name() name {
+	l.pos++ // '/'
+	var buf []byte
+	for l.pos < len(l.b) && !isSpace(l.b[l.pos]) && !isDelim(l.b[l.pos]) {
+		c := l.b[l.pos]
+		if c == '#' && l.pos+2 < len(l.b) {
+			if v, err := strconv.ParseUint(string(l.b[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				buf = append(buf, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		buf = append(buf, c)
+		l.pos++
+	}
+	return name(buf)
+}
+
+func (l *lexer) literalString() string {
+	l.pos++ // '('
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(buf)
+			}
+		case '\\':
+			if l.pos >= len(l.b) {
+				return string(buf)
+			}
+			e := l.b[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
+
+func (l *lexer) hexString() string {
+	l.pos++ // '<'
+	var digits []byte
+	for l.pos < len(l.b) && l.b[l.pos] != '>' {
+		if c := l.b[l.pos]; !isSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++ // '>'
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i+1 < len(digits); i += 2 {
+		v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			continue
+		}
+		out = append(out, byte(v))
+	}
+	return string(out)
+}
+
+// object reads a complete object, assembling arrays, dictionaries and (when
+// l.refs is set) indirect references. Keywords other than delimiters are
+// returned as is, so content stream operators pass through.
+func (l *lexer) object() (any, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case keyword:
+		switch t {
+		case "[":
+			var arr array
+			for {
+				l.skipSpace()
+				if l.pos < len(l.b) && l.b[l.pos] == ']' {
+					l.pos++
+					return arr, nil
+				}
+				v, err := l.object()
+				if err != nil {
+					return arr, err
+				}
+				arr = append(arr, v)
+			}
+		case "<<":
+			d := dict{}
+			for {
+				k, err := l.token()
+				if err != nil {
+					return d, err
+				}
+				if k == keyword(">>") {
+					return d, nil
+				}
+				key, ok := k.(name)
+				if !ok {
+					continue // tolerate junk between entries
+				}
+				v, err := l.object()
+				if err != nil {
+					return d, err
+				}
+				d[key] = v
+			}
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	case float64:
+		if l.refs && t == float64(int(t)) {
+			save := l.pos
+			if gen, err := l.token(); err == nil {
+				if g, ok := gen.(float64); ok {
+					if r, err := l.token(); err == nil && r == keyword("R") {
+						return ref{num: int(t), gen: int(g)}, nil
+					}
+				}
+			}
+			l.pos = save
+		}
+	}
+	return tok, nil
+}
+
+// skipInlineImage moves past the binary data of an inline image, which
+// starts after the ID operator and ends with EI.
+func (l *lexer) skipInlineImage() {
+	if l.pos < len(l.b) && isSpace(l.b[l.pos]) {
+		l.pos++
+	}
+	for i := l.pos; i+2 <= len(l.b); {
+		j := bytes.Index(l.b[i:], []byte("EI"))
+		if j < 0 {
+			break
+		}
+		at := i + j
+		before := at == 0 || isSpace(l.b[at-1])
+		after := at+2 == len(l.b) || isSpace(l.b[at+2]) || isDelim(l.b[at+2])
+		if before && after {
+			l.pos = at + 2
+			return
+		}
+		i = at + 2
+	}
+	l.pos = len(l.b)
+}
@@ -0,0 +1,188 @@
+// Package pdftext extracts plain text from PDF documents. It reads the text
+// operators of each page's content streams and maps character codes to
+// Unicode through the fonts' ToUnicode CMaps and encodings. It does not
+// reconstruct layout or run OCR, so scanned documents yield no text.
+package pdftext
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// ErrNotPDF is returned for data without a PDF header.
+	ErrNotPDF = errors.New("not a PDF document")
+	// ErrEncrypted is returned for password-protected documents.
+	ErrEncrypted = errors.New("PDF is encrypted")
+	// ErrNoText is returned when the selected pages show no text, as with
+	// scanned documents. The Result is still filled in.
+	ErrNoText = errors.New("PDF contains no extractable text")
+)
+
+// Options selects what Extract returns.
+type Options struct {
+	FirstPage int // first page to extract, 1-based; 0 means the first page
+	LastPage  int // last page to extract, inclusive; 0 means the last page
+	MaxChars  int // stop once the text reaches this many bytes; 0 means no limit
+}
+
+// Result is the text of a document.
+type Result struct {
+	Text      string
+	Pages     int  // pages in the document
+	FirstPage int  // first page included in Text
+	LastPage  int  // last page included in Text, possibly only in part
+	Truncated bool // Text was cut at MaxChars
+}
+
+// IsPDF reports whether data has a PDF header. Some producers put
+// junk before the header, so the first kilobyte is searched.
+func IsPDF(data []byte) bool {
+	return bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-"))
+}
+
+// Extract returns the text of the selected pages. Each page is introduced by
+// a "[Page N]" line. Documents that trip up the parser are reported as
+// errors rather than panics, since the input is usually untrusted.
+func Extract(data []byte, opts Options) (res Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			res, err = Result{}, fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+	if !IsPDF(data) {
+		return Result{}, ErrNotPDF
+	}
+	doc := parseDocument(data)
+	if doc.encrypted() {
+		return Result{}, ErrEncrypted
+	}
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return Result{}, errors.New("no pages found")
+	}
+	res = Result{Pages: len(pages), FirstPage: max(opts.FirstPage, 1), LastPage: opts.LastPage}
+	if res.LastPage == 0 || res.LastPage > len(pages) {
+		res.LastPage = len(pages)
+	}
+	if res.FirstPage > len(pages) {
+		return Result{}, fmt.Errorf("page %d is past the end of the document (%d pages)", res.FirstPage, len(pages))
+	}
+	if res.FirstPage > res.LastPage {
+		return Result{}, fmt.Errorf("invalid page range %d-%d", res.FirstPage, res.LastPage)
+	}
+
+	w := newTextWriter(doc)
+	var sb strings.Builder
+	hasText := false
+	for n := res.FirstPage; n <= res.LastPage; n++ {
+		p := pages[n-1]
+		w.run(doc.contents(p), p.resources, 0)
+		text := cleanText(w.reset())
+		hasText = hasText || text != ""
+		if sb.Len() > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "[Page %d]\n%s", n, text)
+		if opts.MaxChars > 0 && sb.Len() > opts.MaxChars {
+			res.LastPage = n
+			res.Truncated = true
+			break
+		}
+	}
+	res.Text = sb.String()
+	if res.Truncated {
+		res.Text = truncate(res.Text, opts.MaxChars)
+	}
+	if !hasText {
+		return res, ErrNoText
+	}
+	return res, nil
+}
+
+// ParsePageRange parses a page selection such as "3", "2-5", "4-" or "-3"
+// into first and last pages for Options. An empty string selects all pages.
+func ParsePageRange(s string) (first, last int, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, nil
+	}
+	lo, hi, isRange := strings.Cut(s, "-")
+	parse := func(v string) (int, error) {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return 0, nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid page number %q", v)
+		}
+		return n, nil
+	}
+	if first, err = parse(lo); err != nil {
+		return 0, 0, err
+	}
+	if !isRange {
+		if first == 0 {
+			return 0, 0, fmt.Errorf("invalid page number %q", s)
+		}
+		return first, first, nil
+	}
+	if last, err = parse(hi); err != nil {
+		return 0, 0, err
+	}
+	if first == 0 && last == 0 {
+		return 0, 0, fmt.Errorf("invalid page range %q", s)
+	}
+	if last != 0 && first > last {
+		return 0, 0, fmt.Errorf("invalid page range %q: start is after end", s)
+	}
+	return first, last, nil
+}
+
+var ligatures = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl")
+
+// cleanText expands ligatures, drops control characters, collapses runs of
+// spaces and keeps at most one blank line between paragraphs.
+func cleanText(s string) string {
+	s = ligatures.Replace(s)
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if r < 0x20 || r == 0x7F || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, s)
+	var out []string
+	blank := false
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
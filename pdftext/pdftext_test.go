@@ -0,0 +1,148 @@
+package pdftext
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	return data
+}
+
+func TestExtractSimple(t *testing.T) {
+	res, err := Extract(readFixture(t, "simple.pdf"), Options{})
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	want := "[Page 1]\nQuarterly Report\nRevenue grew by 12% (year over year).\nCafé menu prices are unchanged.\nHello world" +
+		"\n\n[Page 2]\nSecond page begins here.\nClosing remarks."
+	if res.Text != want {
+		t.Errorf("Text =\n%s\nwant\n%s", res.Text, want)
+	}
+	if res.Pages != 2 || res.FirstPage != 1 || res.LastPage != 2 || res.Truncated {
+		t.Errorf("Result = %+v", res)
+	}
+}
+
+// modern.pdf keeps most objects in a compressed object stream behind a
+// cross-reference stream, nests its page tree with inherited resources, and
+// uses a Type0 font with a ToUnicode CMap, a Differences encoding, a form
+// XObject and an inline image.
+func TestExtractModern(t *testing.T) {
+	res, err := Extract(readFixture(t, "modern.pdf"), Options{})
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	want := "[Page 1]\nHi!\nabc\nž😀\nFooter from a form." +
+		"\n\n[Page 2]\nIt’s a café fine day.\nSecond line" +
+		"\n\n[Page 3]\nAfter the image."
+	if res.Text != want {
+		t.Errorf("Text =\n%s\nwant\n%s", res.Text, want)
+	}
+	if res.Pages != 3 {
+		t.Errorf("Pages = %d, want 3", res.Pages)
+	}
+}
+
+func TestExtractPageRangeAndTruncation(t *testing.T) {
+	data := readFixture(t, "modern.pdf")
+
+	res, err := Extract(data, Options{FirstPage: 2, LastPage: 2})
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if res.Text != "[Page 2]\nIt’s a café fine day.\nSecond line" || res.FirstPage != 2 || res.LastPage != 2 {
+		t.Errorf("page 2 = %+v", res)
+	}
+
+	res, err = Extract(data, Options{FirstPage: 2, MaxChars: 20})
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if !res.Truncated || res.LastPage != 2 || len(res.Text) > 20 || !strings.HasPrefix(res.Text, "[Page 2]\nIt’s") {
+		t.Errorf("truncated = %+v", res)
+	}
+
+	if _, err := Extract(data, Options{FirstPage: 4}); err == nil {
+		t.Error("expected an error for a page past the end")
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	if _, err := Extract([]byte("<html></html>"), Options{}); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("HTML: err = %v, want ErrNotPDF", err)
+	}
+	encrypted := []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+		"trailer\n<< /Root 1 0 R /Encrypt 3 0 R >>\n%%EOF\n")
+	if _, err := Extract(encrypted, Options{}); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("encrypted: err = %v, want ErrEncrypted", err)
+	}
+
+	// A file cut off mid-way still yields the pages whose objects survive.
+	data := readFixture(t, "simple.pdf")
+	res, err := Extract(data[:len(data)*3/4], Options{})
+	if err != nil {
+		t.Fatalf("truncated file: %v", err)
+	}
+	if !strings.Contains(res.Text, "Quarterly Report") {
+		t.Errorf("truncated file text = %q", res.Text)
+	}
+}
+
+// FuzzExtract feeds mutated documents to the parser. A panic inside Extract
+// is reported as a "malformed PDF" error, which the fuzzer treats as a bug.
+func FuzzExtract(f *testing.F) {
+	for _, name := range []string{"simple.pdf", "modern.pdf"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			f.Fatalf("read fixture: %v", err)
+		}
+		f.Add(data)
+		f.Add(data[:len(data)/2])
+	}
+	f.Add([]byte("%PDF-1.4\ntrailer << /Root 1 0 R >>\n%%EOF\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		res, err := Extract(data, Options{MaxChars: 4096})
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "malformed PDF") {
+				t.Fatalf("Extract panicked: %v", err)
+			}
+			return
+		}
+		if res.FirstPage < 1 || res.LastPage > res.Pages {
+			t.Errorf("page range %d-%d of %d pages", res.FirstPage, res.LastPage, res.Pages)
+		}
+	})
+}
+
+func TestParsePageRange(t *testing.T) {
+	tests := []struct {
+		in          string
+		first, last int
+		wantErr     bool
+	}{
+		{"", 0, 0, false},
+		{"3", 3, 3, false},
+		{"2-5", 2, 5, false},
+		{" 4 - ", 4, 0, false},
+		{"-3", 0, 3, false},
+		{"5-2", 0, 0, true},
+		{"0", 0, 0, true},
+		{"-", 0, 0, true},
+		{"a-b", 0, 0, true},
+	}
+	for _, tt := range tests {
+		first, last, err := ParsePageRange(tt.in)
+		if (err != nil) != tt.wantErr || first != tt.first || last != tt.last {
+			t.Errorf("ParsePageRange(%q) = %d, %d, %v; want %d, %d, err %v", tt.in, first, last, err, tt.first, tt.last, tt.wantErr)
+		}
+	}
+}
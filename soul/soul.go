@@ -4,6 +4,8 @@ package soul
 import (
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/tomasmach/vespra/config"
 )
@@ -29,7 +31,7 @@ Before saving a new memory, use memory_recall to check whether it already exists
 
 ## Web Tools
 
-You have two web tools: web_search (async, returns summaries/URLs) and web_fetch (sync, reads a page).
+You have two web tools: web_search (returns numbered results with titles, URLs and snippets) and web_fetch (reads a page).
 
 Use web_fetch when:
 - Search results have a URL with the specific data you need (live weather, prices, article body)
@@ -47,41 +49,110 @@ You can generate and edit images using the generate_image tool. Rules:
 - Edit images whenever the user asks to edit, change, transform, restyle, or modify an attached or replied-to image — including phrasing like "edit this", "change this image", "make this into X", or similar. Use mode="edit" for these requests.
 - **IMPORTANT**: When the user requests an image generation or edit, you MUST call generate_image immediately. Never describe what you would generate or say you are generating in plain text — always call the tool and include a brief status message as inline text content alongside the call (do NOT call the reply tool separately)
 - Before generating, use memory_recall if the subject is someone/something you may have memories about
-- If the user identifies an attached/replied-to image as a person or reusable visual reference (for example "this is Alice", "this is him", "remember this face"), call visual_memory_save with a concise label and description. Do not save random images without clear identity/reference intent.
-- Before generating an image of a remembered person/object, call visual_memory_recall. If visual references are found, pass their IDs to generate_image as reference_image_ids.
+- If the user identifies an attached/replied-to image as a person or reusable visual reference (for example "this is Alice", "this is him", "remember this face"), call visual_memory_save with a concise label and description. Do not save random images without clear identity/reference intent. If the save result says the image looks like a memory under another label, ask the user which label is right.
+- Before generating an image of a remembered person/object, call visual_memory_recall; it matches names and also descriptions of how someone looks. If visual references are found, pass their IDs to generate_image as reference_image_ids.
+- When the user refers to an image generated earlier (for example "that dragon picture from last week"), call image_gallery_search and pass the ID you find to generate_image as gallery_image_ids to edit it, or its job ID with mode="variation" or mode="upscale".
 - Craft a detailed English prompt describing the scene, style, composition, lighting, and mood
-- You may generate NSFW or adult content when explicitly requested by the user
+- You may generate NSFW or adult content when explicitly requested by the user; the channel's safety policy decides whether it is sent
+- When generate_image refuses because of a daily limit or because images are turned off in the channel, tell the user briefly and do not retry
 - Do NOT generate images unprompted or as a surprise`
 
-// Load returns the soul/system prompt for the given server.
+// ResolvePath returns the file that provides the soul for a channel, or "" when
+// the built-in default applies. lineage is the channel ID followed by its
+// ancestors (thread parent, category); the first one with a channel config
+// naming a soul wins. Missing or empty files are skipped.
 // Resolution order:
-// 1. Agent-specific soul file (from cfg.Agents match on serverID)
-// 2. Global soul file (cfg.Bot.SoulFile)
-// 3. Built-in default constant
-func Load(cfg *config.Config, serverID string) string {
-	// 1. Agent-specific soul file
+// 1. Named soul from the agent's soul directory, selected per channel or category
+// 2. Agent-specific soul file
+// 3. Global soul file
+func ResolvePath(cfg *config.Config, cfgPath, serverID string, lineage []string) string {
 	for _, a := range cfg.Agents {
-		if a.ServerID == serverID && a.SoulFile != "" {
-			if content := readFile(a.SoulFile); content != "" {
-				return content
+		if a.ServerID != serverID {
+			continue
+		}
+		if name := channelSoul(a.Channels, lineage); name != "" {
+			if dir := AgentDir(cfgPath, a.ID); dir != "" {
+				if path := filepath.Join(dir, name+".md"); readable(path) {
+					return path
+				}
 			}
-			slog.Warn("configured soul file not readable, falling back", "path", a.SoulFile, "server_id", serverID)
-			break
 		}
+		if a.SoulFile != "" && readable(a.SoulFile) {
+			return config.ExpandPath(a.SoulFile)
+		}
+		break
+	}
+	if cfg.Bot.SoulFile != "" && readable(cfg.Bot.SoulFile) {
+		return config.ExpandPath(cfg.Bot.SoulFile)
 	}
+	return ""
+}
 
-	// 2. Global soul file
-	if cfg.Bot.SoulFile != "" {
-		if content := readFile(cfg.Bot.SoulFile); content != "" {
-			return content
+// PersonaPath returns the file that provides a persona's soul: its named soul
+// from the agent's soul directory, then its soul_file. Returns "" when neither is
+// readable, in which case the channel's ResolvePath result applies.
+func PersonaPath(cfgPath, agentID string, p *config.PersonaConfig) string {
+	if p.Soul != "" {
+		if dir := AgentDir(cfgPath, agentID); dir != "" {
+			if path := filepath.Join(dir, p.Soul+".md"); readable(path) {
+				return path
+			}
 		}
-		slog.Warn("configured global soul file not readable, falling back", "path", cfg.Bot.SoulFile)
 	}
+	if p.SoulFile != "" && readable(p.SoulFile) {
+		return config.ExpandPath(p.SoulFile)
+	}
+	return ""
+}
 
-	// 3. Built-in default
+// LoadPath returns the content of a path from ResolvePath, or the built-in
+// default for "" or an unreadable file.
+func LoadPath(path string) string {
+	if path == "" {
+		return defaultSoul
+	}
+	if content := readFile(path); content != "" {
+		return content
+	}
+	slog.Warn("soul file not readable, using default", "path", path)
 	return defaultSoul
 }
 
+// channelSoul returns the soul name configured for the closest entry in lineage.
+func channelSoul(channels []config.ChannelConfig, lineage []string) string {
+	for _, id := range lineage {
+		for _, ch := range channels {
+			if ch.ID == id && ch.Soul != "" {
+				return ch.Soul
+			}
+		}
+	}
+	return ""
+}
+
+// AgentDir returns the directory holding an agent's named souls:
+// <config dir>/souls/<agentID>. Returns "" if agentID would escape the souls directory.
+func AgentDir(cfgPath, agentID string) string {
+	if agentID == "" {
+		return ""
+	}
+	base := filepath.Join(filepath.Dir(cfgPath), "souls")
+	dir := filepath.Join(base, agentID)
+	// Prevent path traversal: clean dir must start with base/
+	cleanDir := filepath.Clean(dir)
+	cleanBase := filepath.Clean(base)
+	if cleanDir == cleanBase || !strings.HasPrefix(cleanDir, cleanBase+string(filepath.Separator)) {
+		return ""
+	}
+	return dir
+}
+
+// readable reports whether path exists and is a non-empty regular file.
+func readable(path string) bool {
+	info, err := os.Stat(config.ExpandPath(path))
+	return err == nil && info.Mode().IsRegular() && info.Size() > 0
+}
+
 // readFile expands env vars and ~, then reads the file.
 // Returns empty string on any error.
 func readFile(path string) string {
@@ -0,0 +1,112 @@
+package soul_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tomasmach/vespra/config"
+	"github.com/tomasmach/vespra/soul"
+)
+
+func writeSoul(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.toml")
+	soulDir := filepath.Join(dir, "souls", "bot1")
+	writeSoul(t, filepath.Join(soulDir, "helper.md"), "You are terse.")
+	writeSoul(t, filepath.Join(soulDir, "playful.md"), "You are playful.")
+	agentSoul := filepath.Join(dir, "agent.md")
+	writeSoul(t, agentSoul, "Agent soul.")
+	globalSoul := filepath.Join(dir, "global.md")
+	writeSoul(t, globalSoul, "Global soul.")
+
+	cfg := &config.Config{
+		Bot: config.BotConfig{SoulFile: globalSoul},
+		Agents: []config.AgentConfig{{
+			ID:       "bot1",
+			ServerID: "srv1",
+			SoulFile: agentSoul,
+			Channels: []config.ChannelConfig{
+				{ID: "support", Soul: "helper"},
+				{ID: "social-category", Soul: "playful"},
+				{ID: "broken", Soul: "missing"},
+			},
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		serverID string
+		lineage  []string
+		want     string
+	}{
+		{"channel soul", "srv1", []string{"support"}, filepath.Join(soulDir, "helper.md")},
+		{"category soul", "srv1", []string{"lounge", "social-category"}, filepath.Join(soulDir, "playful.md")},
+		{"thread inherits parent channel", "srv1", []string{"thread", "support", "social-category"}, filepath.Join(soulDir, "helper.md")},
+		{"missing named soul falls back to agent soul", "srv1", []string{"broken"}, agentSoul},
+		{"unconfigured channel uses agent soul", "srv1", []string{"general"}, agentSoul},
+		{"unknown server uses global soul", "srv2", []string{"general"}, globalSoul},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := soul.ResolvePath(cfg, cfgPath, tt.serverID, tt.lineage); got != tt.want {
+				t.Errorf("ResolvePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := soul.ResolvePath(&config.Config{}, cfgPath, "srv1", nil); got != "" {
+		t.Errorf("ResolvePath() with nothing configured = %q, want built-in default", got)
+	}
+	if got := soul.LoadPath(filepath.Join(soulDir, "helper.md")); got != "You are terse." {
+		t.Errorf("LoadPath() = %q", got)
+	}
+}
+
+func TestAgentDirRejectsTraversal(t *testing.T) {
+	for _, id := range []string{"", "..", "../other", "."} {
+		if got := soul.AgentDir("/etc/vespra/config.toml", id); got != "" {
+			t.Errorf("AgentDir(%q) = %q, want empty", id, got)
+		}
+	}
+	if got := soul.AgentDir("/etc/vespra/config.toml", "bot1"); got != filepath.Join("/etc/vespra/souls/bot1") {
+		t.Errorf("AgentDir(bot1) = %q", got)
+	}
+}
+
+func TestPersonaPath(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.toml")
+	named := filepath.Join(dir, "souls", "bot1", "luna.md")
+	writeSoul(t, named, "You are Luna.")
+	file := filepath.Join(dir, "max.md")
+	writeSoul(t, file, "You are Max.")
+
+	tests := []struct {
+		name    string
+		persona config.PersonaConfig
+		want    string
+	}{
+		{"named soul", config.PersonaConfig{ID: "luna", Soul: "luna", SoulFile: file}, named},
+		{"soul file", config.PersonaConfig{ID: "max", SoulFile: file}, file},
+		{"missing named soul falls back to soul file", config.PersonaConfig{ID: "max", Soul: "missing", SoulFile: file}, file},
+		{"no soul", config.PersonaConfig{ID: "plain"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := soul.PersonaPath(cfgPath, "bot1", &tt.persona); got != tt.want {
+				t.Errorf("PersonaPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
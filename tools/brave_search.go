@@ -7,68 +7,58 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
-	"strings"
+	"strconv"
 )
 
 const braveSearchAPIBase = "https://api.search.brave.com/res/v1/web/search"
 
-// braveSearchResult represents a single search result from Brave API.
-type braveSearchResult struct {
-	Title string `json:"title"`
-	URL   string `json:"url"`
-	Desc  string `json:"description"`
-}
-
-// braveWebBlock is the wrapper object under the "web" key in the Brave API response.
-type braveWebBlock struct {
-	Results []braveWebResult `json:"results"`
-}
-
 // braveWebResult is a single item within the web results block.
 type braveWebResult struct {
 	Title       string `json:"title"`
 	URL         string `json:"url"`
 	Description string `json:"description"`
+	PageAge     string `json:"page_age"` // ISO timestamp
+	Age         string `json:"age"`      // human-readable, e.g. "2 days ago"
 }
 
 // braveSearchResponse represents the full response from Brave API.
 type braveSearchResponse struct {
-	Web braveWebBlock `json:"web"`
+	Web struct {
+		Results []braveWebResult `json:"results"`
+	} `json:"web"`
 }
 
-// braveClient handles Brave Search API requests.
-type braveClient struct {
+// braveSearch searches with the Brave Search API.
+type braveSearch struct {
 	apiKey     string
+	baseURL    string
 	httpClient *http.Client
 }
 
-// newBraveClient creates a new Brave search client.
-func newBraveClient(apiKey string) *braveClient {
-	return &braveClient{
-		apiKey:     apiKey,
-		httpClient: &http.Client{},
+// NewBraveSearch returns a provider backed by the Brave Search API. A nil
+// client uses http.DefaultClient.
+func NewBraveSearch(apiKey string, client *http.Client) SearchProvider {
+	if client == nil {
+		client = http.DefaultClient
 	}
+	return &braveSearch{apiKey: apiKey, baseURL: braveSearchAPIBase, httpClient: client}
 }
 
-// search performs a web search using Brave API.
-func (c *braveClient) search(ctx context.Context, query string, count int) ([]braveSearchResult, error) {
+func (c *braveSearch) Name() string { return "brave" }
+
+func (c *braveSearch) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
 	if c.apiKey == "" {
 		return nil, fmt.Errorf("brave API key not configured")
 	}
-	if count <= 0 {
-		count = 10
-	}
-	if count > 20 {
-		count = 20 // Brave max is 20
-	}
+	count = min(max(count, 1), 20) // Brave max is 20
 
-	u, err := url.Parse(braveSearchAPIBase)
+	u, err := url.Parse(c.baseURL)
 	if err != nil {
 		return nil, fmt.Errorf("parse brave API URL: %w", err)
 	}
 	q := u.Query()
 	q.Set("q", query)
-	q.Set("count", fmt.Sprintf("%d", count))
+	q.Set("count", strconv.Itoa(count))
 	q.Set("offset", "0")
 	q.Set("mkt", "en-US") // Market (can be made configurable)
 	u.RawQuery = q.Encode()
@@ -77,7 +67,6 @@ func (c *braveClient) search(ctx context.Context, query string, count int) ([]br
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
-
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("X-Subscription-Token", c.apiKey)
 
@@ -96,33 +85,15 @@ func (c *braveClient) search(ctx context.Context, query string, count int) ([]br
 		return nil, fmt.Errorf("decode brave response: %w", err)
 	}
 
-	results := make([]braveSearchResult, 0, len(braveResp.Web.Results))
+	results := make([]SearchResult, 0, len(braveResp.Web.Results))
 	for _, r := range braveResp.Web.Results {
-		results = append(results, braveSearchResult{
-			Title: r.Title,
-			URL:   r.URL,
-			Desc:  r.Description,
-		})
+		date := r.PageAge
+		if date == "" {
+			date = r.Age
+		}
+		results = append(results, normalizeResult(SearchResult{Title: r.Title, URL: r.URL, Snippet: stripTags(r.Description), Date: date}))
 	}
 
 	slog.Debug("brave search completed", "query", query, "results", len(results))
 	return results, nil
 }
-
-// searchToMarkdown performs a search and returns results as markdown text.
-func (c *braveClient) searchToMarkdown(ctx context.Context, query string, count int) (string, error) {
-	results, err := c.search(ctx, query, count)
-	if err != nil {
-		return "", err
-	}
-
-	if len(results) == 0 {
-		return "No results found.", nil
-	}
-
-	var sb strings.Builder
-	for i, r := range results {
-		fmt.Fprintf(&sb, "**%d. %s**\n\n%s\n\n%s\n\n", i+1, r.Title, r.Desc, r.URL)
-	}
-	return sb.String(), nil
-}
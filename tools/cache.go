@@ -0,0 +1,399 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHeuristicFreshness caps how long a response without explicit freshness
+// information is reused, based on how long ago it was last modified.
+const maxHeuristicFreshness = 24 * time.Hour
+
+// Cache is a size-bounded on-disk cache of fetched pages and search results,
+// shared by all agents. Each entry is a file named by the SHA-256 of its key;
+// when the files exceed the size limit, the least recently used are removed.
+// A nil *Cache caches nothing.
+type Cache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	files   map[string]*cacheFile // file name → size and last use
+	size    int64
+	counter cacheCounters
+}
+
+type cacheFile struct {
+	size int64
+	used time.Time
+}
+
+type cacheCounters struct {
+	fetchHits, fetchRevalidated, fetchMisses int64
+	searchHits, searchMisses                 int64
+	evictions                                int64
+}
+
+// cacheEntry is a stored response or search result.
+type cacheEntry struct {
+	Key          string    `json:"key"`
+	Stored       time.Time `json:"stored"`
+	Expires      time.Time `json:"expires"` // reuse without asking the origin until then
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	URL          string    `json:"url,omitempty"` // final URL of a fetch, after redirects
+	Body         []byte    `json:"body"`
+}
+
+func (e *cacheEntry) fresh(now time.Time) bool { return now.Before(e.Expires) }
+
+// CacheStats summarizes the cache since startup.
+type CacheStats struct {
+	Entries          int   `json:"entries"`
+	SizeBytes        int64 `json:"size_bytes"`
+	MaxBytes         int64 `json:"max_bytes"`
+	FetchHits        int64 `json:"fetch_hits"`
+	FetchRevalidated int64 `json:"fetch_revalidated"` // stale pages the origin confirmed unchanged
+	FetchMisses      int64 `json:"fetch_misses"`
+	SearchHits       int64 `json:"search_hits"`
+	SearchMisses     int64 `json:"search_misses"`
+	Evictions        int64 `json:"evictions"`
+}
+
+// NewCache opens the cache in dir, creating the directory if needed, and
+// indexes the entries already there.
+func NewCache(dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read cache dir: %w", err)
+	}
+	c := &Cache{dir: dir, maxBytes: maxBytes, files: make(map[string]*cacheFile)}
+	for _, de := range entries {
+		if de.IsDir() || filepath.Ext(de.Name()) != ".json" {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		c.files[de.Name()] = &cacheFile{size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Stats returns the entry count, size and hit counters. It is safe to call
+// on a nil *Cache.
+func (c *Cache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Entries:          len(c.files),
+		SizeBytes:        c.size,
+		MaxBytes:         c.maxBytes,
+		FetchHits:        c.counter.fetchHits,
+		FetchRevalidated: c.counter.fetchRevalidated,
+		FetchMisses:      c.counter.fetchMisses,
+		SearchHits:       c.counter.searchHits,
+		SearchMisses:     c.counter.searchMisses,
+		Evictions:        c.counter.evictions,
+	}
+}
+
+func (c *Cache) count(f func(*cacheCounters)) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	f(&c.counter)
+	c.mu.Unlock()
+}
+
+func cacheFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+// get returns the entry stored under key, fresh or not.
+func (c *Cache) get(key string) (*cacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	name := cacheFileName(key)
+	c.mu.Lock()
+	f, ok := c.files[name]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		c.remove(name)
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || e.Key != key {
+		c.remove(name)
+		return nil, false
+	}
+	now := time.Now()
+	c.mu.Lock()
+	f.used = now
+	c.mu.Unlock()
+	// The modification time records the last use, so eviction order
+	// survives restarts.
+	_ = os.Chtimes(filepath.Join(c.dir, name), now, now)
+	return &e, true
+}
+
+// put stores e, replacing any entry with the same key, and evicts the least
+// recently used entries if the cache is over its size limit. Entries larger
+// than a quarter of the limit are not stored.
+func (c *Cache) put(e *cacheEntry) {
+	if c == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	size := int64(len(data))
+	if size > c.maxBytes/4 {
+		return
+	}
+	name := cacheFileName(e.Key)
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		slog.Warn("web cache write failed", "error", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(c.dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		slog.Warn("web cache write failed", "error", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if old, ok := c.files[name]; ok {
+		c.size -= old.size
+	}
+	c.files[name] = &cacheFile{size: size, used: time.Now()}
+	c.size += size
+	c.evictLocked()
+}
+
+func (c *Cache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.files[name]; ok {
+		c.size -= f.size
+		delete(c.files, name)
+	}
+	os.Remove(filepath.Join(c.dir, name))
+}
+
+// evictLocked removes the least recently used entries until the cache fits
+// its size limit. c.mu must be held.
+func (c *Cache) evictLocked() {
+	if c.size <= c.maxBytes {
+		return
+	}
+	names := make([]string, 0, len(c.files))
+	for name := range c.files {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return c.files[a].used.Compare(c.files[b].used)
+	})
+	for _, name := range names {
+		if c.size <= c.maxBytes {
+			break
+		}
+		c.size -= c.files[name].size
+		delete(c.files, name)
+		os.Remove(filepath.Join(c.dir, name))
+		c.counter.evictions++
+	}
+}
+
+// cachedSearch is a cached web_search answer.
+type cachedSearch struct {
+	Provider string         `json:"provider"` // the provider that answered
+	Results  []SearchResult `json:"results"`
+}
+
+// lookupSearch returns cached results for a query, counting the hit or miss.
+func (c *Cache) lookupSearch(providers, query string) (cachedSearch, bool) {
+	if c == nil {
+		return cachedSearch{}, false
+	}
+	if e, ok := c.get(searchCacheKey(providers, query)); ok && e.fresh(time.Now()) {
+		var hit cachedSearch
+		if err := json.Unmarshal(e.Body, &hit); err == nil && len(hit.Results) > 0 {
+			c.count(func(n *cacheCounters) { n.searchHits++ })
+			return hit, true
+		}
+	}
+	c.count(func(n *cacheCounters) { n.searchMisses++ })
+	return cachedSearch{}, false
+}
+
+// storeSearch caches the results for a query for ttl.
+func (c *Cache) storeSearch(providers, query string, hit cachedSearch, ttl time.Duration) {
+	if c == nil || ttl <= 0 {
+		return
+	}
+	body, err := json.Marshal(hit)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	c.put(&cacheEntry{Key: searchCacheKey(providers, query), Stored: now, Expires: now.Add(ttl), Body: body})
+}
+
+// searchCacheKey identifies a query regardless of case and spacing.
+func searchCacheKey(provider, query string) string {
+	return "search " + provider + " " + strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+// fetchCacheKey identifies a URL after normalization, or returns "" if the
+// URL cannot be cached.
+func fetchCacheKey(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment, u.RawFragment = "", ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = u.Query().Encode() // sorted by key
+	return "fetch " + u.String()
+}
+
+// fetchEntry builds the cache entry for a successful response, or returns
+// nil if the response must not be stored or could never be reused.
+func fetchEntry(key string, resp *http.Response, body []byte, now time.Time) *cacheEntry {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Vary") == "*" {
+		return nil
+	}
+	directives := cacheControl(resp.Header)
+	if _, ok := directives["no-store"]; ok {
+		return nil
+	}
+	e := &cacheEntry{
+		Key:          key,
+		Stored:       now,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		URL:          resp.Request.URL.String(),
+		Body:         body,
+	}
+	e.Expires = now.Add(freshness(resp.Header, directives, now))
+	if !e.fresh(now) && e.ETag == "" && e.LastModified == "" {
+		return nil
+	}
+	return e
+}
+
+// revalidated updates an entry after the origin answered 304 Not Modified.
+func (e *cacheEntry) revalidated(h http.Header, now time.Time) {
+	if etag := h.Get("ETag"); etag != "" {
+		e.ETag = etag
+	}
+	if lm := h.Get("Last-Modified"); lm != "" {
+		e.LastModified = lm
+	}
+	e.Stored = now
+	e.Expires = now.Add(freshness(h, cacheControl(h), now))
+}
+
+// freshness returns how long a response may be reused without revalidation:
+// s-maxage or max-age minus Age, then Expires, then a tenth of the time
+// since Last-Modified, up to a day. no-cache means zero.
+func freshness(h http.Header, directives map[string]string, now time.Time) time.Duration {
+	if _, ok := directives["no-cache"]; ok {
+		return 0
+	}
+	age := time.Duration(0)
+	if v, err := strconv.Atoi(h.Get("Age")); err == nil && v > 0 {
+		age = time.Duration(v) * time.Second
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := directives[d]; ok {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs <= 0 {
+				return 0
+			}
+			return time.Duration(secs)*time.Second - age
+		}
+	}
+	date := now
+	if d, err := http.ParseTime(h.Get("Date")); err == nil {
+		date = d
+	}
+	if v := h.Get("Expires"); v != "" {
+		exp, err := http.ParseTime(v)
+		if err != nil {
+			return 0 // an invalid Expires means already expired
+		}
+		return exp.Sub(date) - age
+	}
+	if lm, err := http.ParseTime(h.Get("Last-Modified")); err == nil && lm.Before(date) {
+		return min(date.Sub(lm)/10, maxHeuristicFreshness)
+	}
+	return 0
+}
+
+// cacheControl parses the Cache-Control header into lower-case directive
+// names and their values.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				directives[name] = strings.Trim(strings.TrimSpace(value), `"`)
+			}
+		}
+	}
+	return directives
+}
@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tomasmach/vespra/netguard"
+)
+
+func newTestCache(t *testing.T, maxBytes int64) *Cache {
+	t.Helper()
+	c, err := NewCache(t.TempDir(), maxBytes)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	return c
+}
+
+func fetchURL(t *testing.T, tool *webFetchTool, url string) string {
+	t.Helper()
+	args, _ := json.Marshal(map[string]string{"url": url})
+	result, err := tool.Call(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	return result
+}
+
+func TestWebFetchCacheMaxAge(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write([]byte(`<html><body><p>Patch notes for version 1.2.</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	tool := &webFetchTool{cache: newTestCache(t, 1<<20)}
+	first := fetchURL(t, tool, srv.URL+"/notes?b=2&a=1")
+	second := fetchURL(t, tool, srv.URL+"/notes?a=1&b=2#top")
+	if first != second || !strings.Contains(second, "Patch notes") {
+		t.Errorf("cached result differs:\n%s\n---\n%s", first, second)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("origin requests = %d, want 1", n)
+	}
+	if s := tool.cache.Stats(); s.FetchHits != 1 || s.FetchMisses != 1 || s.Entries != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestWebFetchCacheRechecksRequestedURL(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write([]byte(`<html><body><p>Landing page.</p></body></html>`))
+	}))
+	defer target.Close()
+	redirector := httptest.NewServer(http.RedirectHandler(target.URL+"/landing", http.StatusFound))
+	defer redirector.Close()
+
+	var policy atomic.Pointer[netguard.Policy]
+	policy.Store(&netguard.Policy{AllowPrivate: true})
+	tool := &webFetchTool{
+		client: netguard.NewClient(func() netguard.Policy { return *policy.Load() }, 5*time.Second),
+		cache:  newTestCache(t, 1<<20),
+	}
+	// The redirector is requested as localhost and lands on 127.0.0.1.
+	requested := strings.Replace(redirector.URL, "127.0.0.1", "localhost", 1)
+	if result := fetchURL(t, tool, requested); !strings.Contains(result, "Landing page") {
+		t.Fatalf("first fetch = %q", result)
+	}
+
+	policy.Store(&netguard.Policy{AllowPrivate: true, DenyDomains: []string{"localhost"}})
+	if result := fetchURL(t, tool, requested); strings.Contains(result, "Landing page") || !strings.Contains(result, "cannot be fetched") {
+		t.Errorf("fetch of a denied host served from cache: %q", result)
+	}
+}
+
+func TestWebFetchCacheRevalidatesETag(t *testing.T) {
+	var requests, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><p>Server status: all systems operational.</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	tool := &webFetchTool{cache: newTestCache(t, 1<<20)}
+	fetchURL(t, tool, srv.URL)
+	result := fetchURL(t, tool, srv.URL)
+	if !strings.Contains(result, "all systems operational") {
+		t.Errorf("revalidated result = %q", result)
+	}
+	if requests.Load() != 2 || notModified.Load() != 1 {
+		t.Errorf("requests = %d, 304s = %d; want 2 and 1", requests.Load(), notModified.Load())
+	}
+	if s := tool.cache.Stats(); s.FetchRevalidated != 1 || s.FetchMisses != 1 {
+		t.Errorf("stats = %+v", s)
+	}
+}
+
+func TestWebFetchCacheNoStore(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "no-store, max-age=300")
+		w.Write([]byte(`<html><body><p>Your account balance.</p></body></html>`))
+	}))
+	defer srv.Close()
+
+	tool := &webFetchTool{cache: newTestCache(t, 1<<20)}
+	fetchURL(t, tool, srv.URL)
+	fetchURL(t, tool, srv.URL)
+	if n := requests.Load(); n != 2 {
+		t.Errorf("origin requests = %d, want 2", n)
+	}
+	if s := tool.cache.Stats(); s.Entries != 0 {
+		t.Errorf("stats = %+v, want no entries", s)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewCache(dir, 4000)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	expires := time.Now().Add(time.Hour)
+	put := func(key string) {
+		c.put(&cacheEntry{Key: key, Expires: expires, Body: []byte(strings.Repeat("x", 600))})
+	}
+	put("a")
+	put("b")
+	put("c")
+	if _, ok := c.get("a"); !ok { // "a" is now the most recently used
+		t.Fatal("a missing before eviction")
+	}
+	put("d")
+	put("e")
+
+	if _, ok := c.get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("a should have been kept")
+	}
+	s := c.Stats()
+	if s.SizeBytes > 4000 || s.Evictions == 0 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	// Reopening indexes the files left on disk.
+	reopened, err := NewCache(dir, 4000)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := reopened.Stats(); got.Entries != s.Entries || got.SizeBytes != s.SizeBytes {
+		t.Errorf("reopened stats = %+v, want %d entries, %d bytes", got, s.Entries, s.SizeBytes)
+	}
+	if _, ok := reopened.get("e"); !ok {
+		t.Error("e missing after reopen")
+	}
+}
+
+func TestSearchCache(t *testing.T) {
+	c := newTestCache(t, 1<<20)
+	if _, ok := c.lookupSearch("brave", "go 1.24 release"); ok {
+		t.Fatal("unexpected hit in an empty cache")
+	}
+	hit := cachedSearch{Provider: "brave", Results: []SearchResult{{Title: "Go 1.24 is released", URL: "https://go.dev/blog/go1.24"}}}
+	c.storeSearch("brave", "go 1.24 release", hit, time.Hour)
+	if got, ok := c.lookupSearch("brave", "  Go   1.24 RELEASE "); !ok || got.Provider != "brave" || len(got.Results) != 1 || got.Results[0] != hit.Results[0] {
+		t.Errorf("lookup = %+v, %v", got, ok)
+	}
+	if _, ok := c.lookupSearch("glm", "go 1.24 release"); ok {
+		t.Error("results leaked across providers")
+	}
+	c.storeSearch("brave", "stale", hit, -time.Minute)
+	if _, ok := c.lookupSearch("brave", "stale"); ok {
+		t.Error("a non-positive TTL should not be stored")
+	}
+	if s := c.Stats(); s.SearchHits != 1 || s.SearchMisses != 3 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	var nilCache *Cache
+	nilCache.storeSearch("brave", "q", hit, time.Hour)
+	if _, ok := nilCache.lookupSearch("brave", "q"); ok {
+		t.Error("a nil cache should never hit")
+	}
+}
+
+func TestFetchCacheKey(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"https://Example.com/a?y=2&x=1", "https://example.com:443/a?x=1&y=2#frag", true},
+		{"http://example.com", "http://example.com:80/", true},
+		{"https://example.com/a", "http://example.com/a", false},
+		{"https://example.com/a", "https://example.com/A", false},
+	}
+	for _, tt := range tests {
+		if got := fetchCacheKey(tt.a) == fetchCacheKey(tt.b); got != tt.same {
+			t.Errorf("same key for %q and %q = %v, want %v", tt.a, tt.b, got, tt.same)
+		}
+	}
+	if key := fetchCacheKey("file:///etc/passwd"); key != "" {
+		t.Errorf("file URL key = %q, want empty", key)
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	date := now.Format(http.TimeFormat)
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   time.Duration
+	}{
+		{"max-age minus age", map[string]string{"Cache-Control": "max-age=600", "Age": "100"}, 500 * time.Second},
+		{"s-maxage wins", map[string]string{"Cache-Control": "max-age=600, s-maxage=60"}, time.Minute},
+		{"no-cache", map[string]string{"Cache-Control": "no-cache, max-age=600"}, 0},
+		{"expires", map[string]string{"Date": date, "Expires": now.Add(time.Hour).Format(http.TimeFormat)}, time.Hour},
+		{"invalid expires", map[string]string{"Expires": "0"}, 0},
+		{"last-modified heuristic", map[string]string{"Date": date, "Last-Modified": now.Add(-10 * time.Hour).Format(http.TimeFormat)}, time.Hour},
+		{"heuristic cap", map[string]string{"Date": date, "Last-Modified": now.Add(-1000 * time.Hour).Format(http.TimeFormat)}, 24 * time.Hour},
+		{"nothing", map[string]string{}, 0},
+	}
+	for _, tt := range tests {
+		h := make(http.Header)
+		for k, v := range tt.header {
+			h.Set(k, v)
+		}
+		if got := freshness(h, cacheControl(h), now); got != tt.want {
+			t.Errorf("%s: freshness = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
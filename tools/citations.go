@@ -0,0 +1,48 @@
+package tools
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// citationRe matches numbered source references such as [1] or [2, 3].
+var citationRe = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// appendCitations appends the sources that text cites by number, in order of
+// first citation. Links are wrapped in <> so Discord does not embed a preview
+// for each of them. Sources the text already links, and numbers that match no
+// source, are left out.
+func appendCitations(text string, sources []SearchResult) string {
+	if len(sources) == 0 {
+		return text
+	}
+	seen := make(map[int]bool)
+	var lines []string
+	for _, m := range citationRe.FindAllStringSubmatch(text, -1) {
+		for _, field := range strings.Split(m[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || n < 1 || n > len(sources) || seen[n] {
+				continue
+			}
+			seen[n] = true
+			src := sources[n-1]
+			switch {
+			case src.URL == "":
+				lines = append(lines, "["+strconv.Itoa(n)+"] "+src.Title)
+			case !strings.Contains(text, src.URL):
+				lines = append(lines, "["+strconv.Itoa(n)+"] <"+src.URL+">")
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return text
+	}
+	return strings.TrimRight(text, "\n") + "\n\n-# Sources:\n" + strings.Join(lines, "\n")
+}
+
+// Cite appends the sources text cites from this turn's web searches; see
+// appendCitations.
+func (r *Registry) Cite(text string) string {
+	return appendCitations(text, r.sources)
+}
@@ -0,0 +1,140 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomasmach/vespra/tools"
+)
+
+// stubTool is a tool whose behaviour is supplied by the test.
+type stubTool struct {
+	name    string
+	schema  string
+	timeout time.Duration
+	call    func(ctx context.Context) (string, error)
+}
+
+func (t *stubTool) Name() string                { return t.name }
+func (t *stubTool) Description() string         { return "test tool" }
+func (t *stubTool) Parameters() json.RawMessage { return json.RawMessage(t.schema) }
+func (t *stubTool) Timeout() time.Duration      { return t.timeout }
+func (t *stubTool) Call(ctx context.Context, _ json.RawMessage) (string, error) {
+	return t.call(ctx)
+}
+
+func toolStats(t *testing.T, name string) tools.ToolStats {
+	t.Helper()
+	for _, s := range tools.Stats() {
+		if s.Tool == name {
+			return s
+		}
+	}
+	t.Fatalf("no stats for %s", name)
+	return tools.ToolStats{}
+}
+
+func TestDispatchValidatesArguments(t *testing.T) {
+	called := false
+	reg := tools.NewRegistry()
+	reg.Register(&stubTool{
+		name: "validate_stub",
+		schema: `{
+			"type": "object",
+			"properties": {
+				"query": {"type": "string", "minLength": 1},
+				"limit": {"type": "integer", "minimum": 1, "maximum": 50},
+				"mode": {"type": "string", "enum": ["fast", "deep"]},
+				"tags": {"type": "array", "items": {"type": "string"}}
+			},
+			"required": ["query"],
+			"additionalProperties": false
+		}`,
+		call: func(context.Context) (string, error) { called = true; return "ok", nil },
+	})
+
+	tests := []struct {
+		name string
+		args string
+		want []string // substrings of the error; none means the call goes through
+	}{
+		{"valid", `{"query":"cats","limit":5,"mode":"deep","tags":["a"]}`, nil},
+		{"empty args", ``, []string{"query: required property is missing"}},
+		{"not JSON", `{"query":`, []string{"not valid JSON"}},
+		{"wrong types", `{"query":3,"limit":2.5}`, []string{"limit: must be integer, got number", "query: must be string, got number"}},
+		{"bounds and enum", `{"query":"","limit":99,"mode":"slow"}`, []string{"query: must be at least 1 characters", "limit: must be at most 50", `mode: must be one of "fast", "deep"`}},
+		{"array items", `{"query":"x","tags":["a",1]}`, []string{"tags[1]: must be string"}},
+		{"unknown property", `{"query":"x","extra":true}`, []string{"extra: unknown property"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			got, err := reg.Dispatch(context.Background(), "validate_stub", json.RawMessage(tt.args))
+			if tt.want == nil {
+				if err != nil || got != "ok" || !called {
+					t.Fatalf("Dispatch = %q, %v; want the tool to run", got, err)
+				}
+				return
+			}
+			var argErr *tools.ArgumentError
+			if !errors.As(err, &argErr) {
+				t.Fatalf("Dispatch error = %v, want *ArgumentError", err)
+			}
+			if called {
+				t.Error("tool ran despite invalid arguments")
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not mention %q", err, w)
+				}
+			}
+			if !strings.Contains(err.Error(), "call validate_stub again") {
+				t.Errorf("error %q does not tell the model how to recover", err)
+			}
+		})
+	}
+}
+
+func TestDispatchTimeoutAndPanic(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	reg := tools.NewRegistry()
+	reg.Register(&stubTool{
+		name:    "hang_stub",
+		schema:  `{"type":"object","properties":{}}`,
+		timeout: 50 * time.Millisecond,
+		call: func(context.Context) (string, error) {
+			<-release // ignores its context, like a stuck tool
+			return "late", nil
+		},
+	})
+	reg.Register(&stubTool{
+		name:   "panic_stub",
+		schema: `{"type":"object","properties":{}}`,
+		call:   func(context.Context) (string, error) { panic("boom") },
+	})
+
+	start := time.Now()
+	_, err := reg.Dispatch(context.Background(), "hang_stub", nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("hang_stub error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Dispatch took %s, want it bounded by the tool timeout", elapsed)
+	}
+
+	if _, err := reg.Dispatch(context.Background(), "panic_stub", nil); err == nil || !strings.Contains(err.Error(), "failed unexpectedly") {
+		t.Fatalf("panic_stub error = %v, want a recovered panic", err)
+	}
+
+	if s := toolStats(t, "hang_stub"); s.Calls != 1 || s.Timeouts != 1 || s.Errors != 1 || s.MaxLatencyMs < 50 {
+		t.Errorf("hang_stub stats = %+v", s)
+	}
+	if s := toolStats(t, "panic_stub"); s.Calls != 1 || s.Panics != 1 || s.Errors != 1 {
+		t.Errorf("panic_stub stats = %+v", s)
+	}
+}
@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// glmSearchEngine is the Zhipu search engine used for GLM searches.
+const glmSearchEngine = "search_pro"
+
+// glmSearchResponse is the body returned by the GLM web_search endpoint.
+type glmSearchResponse struct {
+	SearchResult []struct {
+		Title       string `json:"title"`
+		Content     string `json:"content"`
+		Link        string `json:"link"`
+		Media       string `json:"media"`
+		PublishDate string `json:"publish_date"`
+	} `json:"search_result"`
+}
+
+// glmSearch searches with the web_search endpoint of the GLM (Zhipu) API.
+type glmSearch struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewGLMSearch returns a provider backed by the GLM web search API at
+// baseURL, e.g. "https://open.bigmodel.cn/api/paas/v4". A nil client uses
+// http.DefaultClient.
+func NewGLMSearch(baseURL, apiKey string, client *http.Client) SearchProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &glmSearch{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, httpClient: client}
+}
+
+func (g *glmSearch) Name() string { return "glm" }
+
+func (g *glmSearch) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	if g.apiKey == "" {
+		return nil, fmt.Errorf("glm API key not configured")
+	}
+	body, err := json.Marshal(map[string]any{
+		"search_query":  query,
+		"search_engine": glmSearchEngine,
+		"count":         min(max(count, 1), 50),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/web_search", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+g.apiKey)
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("glm search request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("glm search returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var glmResp glmSearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&glmResp); err != nil {
+		return nil, fmt.Errorf("decode glm response: %w", err)
+	}
+
+	results := make([]SearchResult, 0, len(glmResp.SearchResult))
+	for _, r := range glmResp.SearchResult {
+		title := r.Title
+		if r.Media != "" && !strings.Contains(title, r.Media) {
+			title += " - " + r.Media
+		}
+		results = append(results, normalizeResult(SearchResult{Title: title, URL: r.Link, Snippet: r.Content, Date: r.PublishDate}))
+	}
+	if len(results) > count {
+		results = results[:count]
+	}
+
+	slog.Debug("glm search completed", "query", query, "results", len(results))
+	return results, nil
+}
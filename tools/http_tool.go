@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPToolTimeout = 15 * time.Second
+	maxHTTPToolResponse    = 1 << 20 // 1 MB read from the endpoint
+)
+
+// urlPlaceholder matches {name} placeholders in an HTTP tool's URL template.
+var urlPlaceholder = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// HTTPToolSpec declares a tool that calls an HTTP endpoint. It is built from
+// [[agents.tools.http]] config entries.
+type HTTPToolSpec struct {
+	Name        string
+	Description string
+	Parameters  json.RawMessage   // JSON schema of the arguments; empty = no arguments
+	Method      string            // default GET
+	URL         string            // template; {name} is replaced by the escaped argument
+	Headers     map[string]string // secrets already expanded from the environment
+	Extract     string            // JSONPath into a JSON response; "" returns the raw body
+	MaxLength   int               // characters returned to the model; 0 = 8000
+	Timeout     time.Duration     // 0 = 15s
+}
+
+// AgentToolsDeps holds per-agent tool configuration for NewDefaultRegistry.
+type AgentToolsDeps struct {
+	HTTP           []HTTPToolSpec
+	Policies       []ToolPolicy // every policy must allow a tool for it to be registered
+	KnowledgeScope string       // server ID whose knowledge base knowledge_search queries; "" leaves it out
+}
+
+type httpTool struct {
+	spec HTTPToolSpec
+}
+
+func (t *httpTool) Name() string        { return t.spec.Name }
+func (t *httpTool) Description() string { return t.spec.Description }
+func (t *httpTool) Parameters() json.RawMessage {
+	if len(t.spec.Parameters) == 0 {
+		return json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+	return t.spec.Parameters
+}
+
+func (t *httpTool) Timeout() time.Duration {
+	if t.spec.Timeout > 0 {
+		return t.spec.Timeout + timeoutGrace
+	}
+	return defaultHTTPToolTimeout + timeoutGrace
+}
+
+// Call fills the URL template from the arguments and sends the request.
+// Arguments not used by the template go in the query string for GET and
+// DELETE, and in a JSON body otherwise. Failures are reported to the model
+// as text, like web_fetch does.
+func (t *httpTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	params := map[string]any{}
+	if len(args) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(args))
+		dec.UseNumber()
+		if err := dec.Decode(&params); err != nil {
+			return "", fmt.Errorf("parse args: %w", err)
+		}
+	}
+
+	target, used, err := expandURLTemplate(t.spec.URL, params)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err), nil
+	}
+	method := strings.ToUpper(t.spec.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	rest := make(map[string]any)
+	for k, v := range params {
+		if !slices.Contains(used, k) {
+			rest[k] = v
+		}
+	}
+
+	var body io.Reader
+	if len(rest) > 0 {
+		if method == http.MethodGet || method == http.MethodDelete {
+			u, err := url.Parse(target)
+			if err != nil {
+				return fmt.Sprintf("Error: invalid URL: %s", err), nil
+			}
+			q := u.Query()
+			for k, v := range rest {
+				q.Set(k, argString(v))
+			}
+			u.RawQuery = q.Encode()
+			target = u.String()
+		} else {
+			b, err := json.Marshal(rest)
+			if err != nil {
+				return "", fmt.Errorf("marshal body: %w", err)
+			}
+			body = bytes.NewReader(b)
+		}
+	}
+
+	timeout := t.spec.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPToolTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid request: %s", err), nil
+	}
+	req.Header.Set("User-Agent", "Vespra/1.0 (Discord Bot)")
+	req.Header.Set("Accept", "application/json, text/plain;q=0.9, */*;q=0.8")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range t.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		slog.Warn("http tool request failed", "tool", t.spec.Name, "error", err)
+		return fmt.Sprintf("Error: request failed: %s", err), nil
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPToolResponse))
+	if err != nil {
+		return fmt.Sprintf("Error: failed to read response: %s", err), nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Sprintf("Error: HTTP %d: %s", resp.StatusCode, t.truncate(strings.TrimSpace(string(data)), 500)), nil
+	}
+
+	text := string(data)
+	if t.spec.Extract != "" {
+		if text, err = extractJSON(data, t.spec.Extract); err != nil {
+			return fmt.Sprintf("Error: %s", err), nil
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return "The endpoint returned no content.", nil
+	}
+	return t.truncate(text, t.spec.MaxLength), nil
+}
+
+// truncate cuts text to at most max characters (runes), not bytes, so that
+// non-ASCII responses get as much text as configured.
+func (t *httpTool) truncate(text string, max int) string {
+	if max <= 0 {
+		max = maxOutputChars
+	}
+	n := 0
+	for i := range text {
+		if n == max {
+			return truncateText(text, i)
+		}
+		n++
+	}
+	return text
+}
+
+// expandURLTemplate replaces {name} placeholders with escaped argument values
+// and returns the names it consumed. Placeholders after the "?" are
+// query-escaped, the rest path-escaped.
+func expandURLTemplate(tmpl string, params map[string]any) (string, []string, error) {
+	var used []string
+	var missing string
+	queryStart := strings.IndexByte(tmpl, '?')
+	var b strings.Builder
+	last := 0
+	for _, m := range urlPlaceholder.FindAllStringSubmatchIndex(tmpl, -1) {
+		name := tmpl[m[2]:m[3]]
+		v, ok := params[name]
+		if !ok {
+			missing = name
+			break
+		}
+		s := argString(v)
+		if queryStart != -1 && m[0] > queryStart {
+			s = url.QueryEscape(s)
+		} else {
+			s = url.PathEscape(s)
+		}
+		b.WriteString(tmpl[last:m[0]])
+		b.WriteString(s)
+		last = m[1]
+		used = append(used, name)
+	}
+	if missing != "" {
+		return "", nil, fmt.Errorf("missing argument %q", missing)
+	}
+	b.WriteString(tmpl[last:])
+	return b.String(), used, nil
+}
+
+// argString formats an argument for a URL: strings and numbers as-is,
+// anything else as JSON.
+func argString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// extractJSON applies a JSONPath to a JSON response. Strings are returned
+// as-is; other values as JSON. Multiple matches are joined by newlines.
+func extractJSON(data []byte, path string) (string, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid extract path %q: %w", path, err)
+	}
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("response is not JSON")
+	}
+	matches := evalJSONPath(doc, steps)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("nothing in the response matched %s", path)
+	}
+	parts := make([]string, len(matches))
+	for i, m := range matches {
+		if s, ok := m.(string); ok {
+			parts[i] = s
+			continue
+		}
+		b, _ := json.Marshal(m)
+		parts[i] = string(b)
+	}
+	return strings.Join(parts, "\n"), nil
+}
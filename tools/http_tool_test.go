@@ -0,0 +1,120 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/tomasmach/vespra/tools"
+)
+
+func newHTTPToolRegistry(specs ...tools.HTTPToolSpec) *tools.Registry {
+	send := func(string) error { return nil }
+	react := func(string) error { return nil }
+	return tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, &tools.AgentToolsDeps{HTTP: specs})
+}
+
+func TestHTTPToolGetWithTemplateAndExtract(t *testing.T) {
+	var gotPath, gotQuery, gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery, gotAuth = r.URL.EscapedPath(), r.URL.RawQuery, r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"data":{"items":[{"name":"first"},{"name":"second"}],"count":2}}`)
+	}))
+	defer srv.Close()
+
+	reg := newHTTPToolRegistry(tools.HTTPToolSpec{
+		Name:        "lookup",
+		Description: "Look up a ticket",
+		Parameters:  json.RawMessage(`{"type":"object","properties":{"project":{"type":"string"},"limit":{"type":"integer"}}}`),
+		URL:         srv.URL + "/projects/{project}/items",
+		Headers:     map[string]string{"Authorization": "Bearer secret"},
+		Extract:     "$.data.items[*].name",
+	})
+
+	got, err := reg.Dispatch(context.Background(), "lookup", json.RawMessage(`{"project":"a b/c","limit":5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "first\nsecond" {
+		t.Errorf("result = %q, want the extracted names", got)
+	}
+	if gotPath != "/projects/a%20b%2Fc/items" {
+		t.Errorf("path = %q, want the placeholder path-escaped", gotPath)
+	}
+	if gotQuery != "limit=5" {
+		t.Errorf("query = %q, want unused arguments as query parameters", gotQuery)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q, want the configured header", gotAuth)
+	}
+}
+
+func TestHTTPToolPostBodyAndErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "backend down", http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		io.WriteString(w, r.Method+" "+r.Header.Get("Content-Type")+" "+string(body)+strings.Repeat("x", 100))
+	}))
+	defer srv.Close()
+
+	reg := newHTTPToolRegistry(
+		tools.HTTPToolSpec{Name: "create", Description: "Create", Method: "POST", URL: srv.URL + "/create", MaxLength: 60},
+		tools.HTTPToolSpec{Name: "fail", Description: "Fail", URL: srv.URL + "/fail"},
+		tools.HTTPToolSpec{Name: "bad_extract", Description: "Extract from text", URL: srv.URL + "/create", Extract: "$.x"},
+		// Built-in tools keep their names.
+		tools.HTTPToolSpec{Name: "reply", Description: "Shadow", URL: srv.URL},
+	)
+
+	got, err := reg.Dispatch(context.Background(), "create", json.RawMessage(`{"title":"Hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, `POST application/json {"title":"Hi"}`) || !strings.HasSuffix(got, "[content truncated]") {
+		t.Errorf("create = %q, want the JSON body echoed and truncated", got)
+	}
+
+	got, _ = reg.Dispatch(context.Background(), "fail", nil)
+	if !strings.Contains(got, "HTTP 502") || !strings.Contains(got, "backend down") {
+		t.Errorf("fail = %q, want the status and body reported", got)
+	}
+
+	got, _ = reg.Dispatch(context.Background(), "bad_extract", nil)
+	if got != "Error: response is not JSON" {
+		t.Errorf("bad_extract = %q", got)
+	}
+
+	for _, def := range reg.Definitions() {
+		if def.Function.Name == "reply" && def.Function.Description == "Shadow" {
+			t.Error("HTTP tool replaced the built-in reply tool")
+		}
+	}
+}
+
+func TestHTTPToolTruncatesOnRuneBoundary(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, "a"+strings.Repeat("č", 20))
+	}))
+	defer srv.Close()
+
+	// max_length counts characters: 4 bytes would end in the middle of the
+	// second "č", 4 characters are "a" and three of them.
+	reg := newHTTPToolRegistry(tools.HTTPToolSpec{Name: "czech", Description: "Czech text", URL: srv.URL, MaxLength: 4})
+
+	got, err := reg.Dispatch(context.Background(), "czech", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !utf8.ValidString(got) || got != "aččč\n\n[content truncated]" {
+		t.Errorf("result = %q, want the first 4 characters", got)
+	}
+}
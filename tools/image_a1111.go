@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// a1111ImageProvider generates images with a local Stable Diffusion server
+// that speaks the Automatic1111 web UI API (/sdapi/v1/txt2img and img2img),
+// as do Forge, SD.Next and ComfyUI with an A1111-compatible API node.
+type a1111ImageProvider struct {
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// NewA1111ImageProvider returns a provider for the Automatic1111 API at
+// baseURL, e.g. "http://127.0.0.1:7860". A non-empty model selects the
+// checkpoint per request; otherwise the server's loaded checkpoint is used.
+// A nil client uses http.DefaultClient.
+func NewA1111ImageProvider(baseURL, model string, client *http.Client) ImageProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &a1111ImageProvider{baseURL: strings.TrimRight(baseURL, "/"), model: model, client: client}
+}
+
+func (p *a1111ImageProvider) Name() string { return "a1111" }
+
+// Unscreened reports that the API has no safety checker.
+func (p *a1111ImageProvider) Unscreened() bool { return true }
+
+type a1111Request struct {
+	Prompt            string         `json:"prompt"`
+	Width             int            `json:"width"`
+	Height            int            `json:"height"`
+	BatchSize         int            `json:"batch_size"`
+	Seed              int64          `json:"seed,omitempty"`
+	DenoisingStrength float64        `json:"denoising_strength,omitempty"`
+	InitImages        []string       `json:"init_images,omitempty"`
+	OverrideSettings  map[string]any `json:"override_settings,omitempty"`
+}
+
+type a1111Response struct {
+	Images []string `json:"images"`
+	Info   string   `json:"info"` // JSON-encoded generation parameters
+}
+
+func (p *a1111ImageProvider) Generate(ctx context.Context, req ImageRequest) (*ImageResult, error) {
+	if p.baseURL == "" {
+		return nil, fmt.Errorf("a1111 base URL not configured")
+	}
+	width, height := imageDimensions(req.AspectRatio, req.Resolution)
+	body := a1111Request{Prompt: req.Prompt, Width: width, Height: height, BatchSize: req.count(), Seed: req.Seed}
+	if p.model != "" {
+		body.OverrideSettings = map[string]any{"sd_model_checkpoint": p.model}
+	}
+	endpoint := "/sdapi/v1/txt2img"
+	if req.Mode == "edit" {
+		endpoint = "/sdapi/v1/img2img"
+		body.DenoisingStrength = req.Strength
+		for i, src := range req.SourceImageURLs {
+			_, data, err := parseDataURL(src)
+			if err != nil {
+				return nil, fmt.Errorf("source image %d: %w", i+1, err)
+			}
+			body.InitImages = append(body.InitImages, base64.StdEncoding.EncodeToString(data))
+		}
+	}
+
+	var resp a1111Response
+	if err := postImageJSON(ctx, p.client, p.Name(), p.baseURL+endpoint, nil, body, &resp); err != nil {
+		return nil, err
+	}
+
+	// A local server has no safety checker, so results are unchecked.
+	result := &ImageResult{Model: p.model}
+	var info struct {
+		Seed        int64  `json:"seed"`
+		SDModelName string `json:"sd_model_name"`
+	}
+	if json.Unmarshal([]byte(resp.Info), &info) == nil {
+		result.Seed = info.Seed
+		if result.Model == "" {
+			result.Model = info.SDModelName
+		}
+	}
+	for _, encoded := range resp.Images {
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decode a1111 image: %w", err)
+		}
+		result.Images = append(result.Images, GeneratedImage{Data: data, ContentType: "image/png"})
+	}
+	return result, nil
+}
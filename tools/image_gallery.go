@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tomasmach/vespra/memory"
+)
+
+type imageGallerySearchTool struct {
+	store    *memory.Store
+	serverID string
+}
+
+func (t *imageGallerySearchTool) Name() string { return ToolNameImageGallerySearch }
+func (t *imageGallerySearchTool) Description() string {
+	return "Search images generated earlier by words of their prompt, e.g. to find 'that dragon picture from last week'. " +
+		"Returns gallery IDs to pass to generate_image as gallery_image_ids for edits, and job IDs for variation or upscale."
+}
+func (t *imageGallerySearchTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"query": {"type": "string", "description": "Words from the prompt of the image. Empty lists the newest images."},
+			"user_id": {"type": "string", "description": "Only images requested by this Discord user ID."},
+			"top_n": {"type": "integer", "description": "Max results to return. Default: 5."}
+		}
+	}`)
+}
+func (t *imageGallerySearchTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Query  string `json:"query"`
+		UserID string `json:"user_id"`
+		TopN   int    `json:"top_n"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", err
+	}
+	if p.TopN <= 0 {
+		p.TopN = 5
+	}
+	rows, total, err := t.store.ListGeneratedImages(ctx, memory.GeneratedImageListOptions{
+		ServerID: t.serverID,
+		UserID:   p.UserID,
+		Query:    p.Query,
+		Limit:    min(p.TopN, 20),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "No generated images found.", nil
+	}
+	var sb strings.Builder
+	for _, row := range rows {
+		fmt.Fprintf(&sb, "[%s] job %s #%d, %s", row.ID, row.JobID, row.Index, row.CreatedAt.Format("2006-01-02"))
+		if row.UserID != "" {
+			fmt.Fprintf(&sb, ", by user %s", row.UserID)
+		}
+		fmt.Fprintf(&sb, " — %s\n", row.Prompt)
+	}
+	if total > len(rows) {
+		fmt.Fprintf(&sb, "(%d more not shown)\n", total-len(rows))
+	}
+	return sb.String(), nil
+}
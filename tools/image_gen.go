@@ -8,18 +8,24 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/tomasmach/vespra/memory"
 )
 
-// SendImageFunc sends an image file attachment to the Discord channel.
-type SendImageFunc func(filename string, data io.Reader, caption string) error
+// ImageFile is one image attachment of an outgoing message.
+type ImageFile struct {
+	Name string
+	Data io.Reader
+}
+
+// SendImageFunc sends image attachments to the Discord channel as one message
+// and returns the ID of that message.
+type SendImageFunc func(files []ImageFile, caption string) (string, error)
 
 // ImageGenDeps groups dependencies for the async image generation tool.
 // Pass nil to NewDefaultRegistry to omit image generation from the registry.
@@ -27,32 +33,80 @@ type ImageGenDeps struct {
 	SendImage       SendImageFunc
 	SendText        SendFunc
 	ImageWg         *sync.WaitGroup
-	ImageRunning    *atomic.Bool
+	Queue           *ImageQueue // shared by all of the agent's channels
 	Ctx             context.Context
-	APIKey          string
-	Model           string
-	EditModel       string
+	Provider        ImageProvider
 	SourceImageURLs []string
-	SafetyChecker   bool
+	SafetyChecker   bool // strict channel: flagged images are withheld, unscreened results blocked
+	AllowUnscreened bool // strict channel that accepts results the provider could not screen
+	Disabled        bool // image generation is turned off in the channel
+	DailyLimit      int  // images UserID may generate per UTC day; 0 is unlimited
 	TimeoutSeconds  int
 	Resolution      string
-	BaseURL         string // for testing; overrides https://fal.run
-	VisualStore     *memory.Store
+	VisualStore     *memory.Store // also holds the gallery of generated images
 	ServerID        string
+	GalleryServerID string // server ID generated images are saved under; "" disables the gallery
+	UserID          string // user who asked for the image
 	SourceChannelID string
 	SourceMessageID string
 }
 
 type imageGenTool struct {
-	deps        *ImageGenDeps
-	imageCalled *bool
+	deps *ImageGenDeps
+}
+
+// Image safety levels of channels, recorded on jobs and gallery images so
+// that a stricter channel does not build on images a laxer one let through.
+const (
+	imageSafetyStrict     = "strict"     // results are screened; flagged images are withheld
+	imageSafetyUnscreened = "unscreened" // strict, but accepts results the provider could not screen
+	imageSafetyNSFW       = "nsfw"       // flagged images are sent behind spoilers
+)
+
+// imageSafetyRank orders safety levels from strictest to laxest. Images
+// without a recorded level rank as nsfw.
+func imageSafetyRank(level string) int {
+	switch level {
+	case imageSafetyStrict:
+		return 0
+	case imageSafetyUnscreened:
+		return 1
+	}
+	return 2
+}
+
+// safety returns the image safety level of the channel.
+func (t *imageGenTool) safety() string {
+	switch {
+	case !t.deps.SafetyChecker:
+		return imageSafetyNSFW
+	case t.deps.AllowUnscreened:
+		return imageSafetyUnscreened
+	}
+	return imageSafetyStrict
+}
+
+// mayReuse reports whether images made at level may be edited in the channel.
+func (t *imageGenTool) mayReuse(level string) bool {
+	return imageSafetyRank(level) <= imageSafetyRank(t.safety())
 }
 
-const maxImageEditSourceURLs = 14
+const (
+	maxImageEditSourceURLs = 14
+	maxImagesPerRequest    = 4
+)
+
+// Edit strengths for follow-ups on a previous job; only providers with an
+// img2img strength setting use them.
+const (
+	variationStrength = 0.6
+	upscaleStrength   = 0.3
+)
 
 func (t *imageGenTool) Name() string { return ToolNameImageGen }
 func (t *imageGenTool) Description() string {
 	return "Generate an image from a text prompt, or edit attached/replied-to source images. Call this tool whenever the user asks you to draw, create, make, generate, visualize, show, edit, transform, or change an image or picture — including requests phrased as 'make an image of X', 'show me what X looks like', 'draw X', 'edit this', 'change this image', or similar. " +
+		"Each generation gets a job ID, shown under the sent images; use mode variation or upscale with that job_id when the user asks for variations of, or a bigger version of, an earlier result. " +
 		"Do NOT describe the image generation in your text — always call this tool first. " +
 		"Include a brief status message as inline text content alongside this tool call (e.g. 'Generating your image…') — do NOT call the reply tool separately after this one."
 }
@@ -60,29 +114,144 @@ func (t *imageGenTool) Parameters() json.RawMessage {
 	return json.RawMessage(`{
 		"type": "object",
 		"properties": {
-			"prompt": {"type": "string", "description": "A detailed English prompt describing the image to generate."},
-			"mode": {"type": "string", "description": "Use edit when modifying attached or replied-to source images; otherwise use generate. Options: generate, edit."},
+			"prompt": {"type": "string", "description": "A detailed English prompt describing the image to generate. Optional for variation and upscale, which reuse the job's prompt."},
+			"mode": {"type": "string", "description": "Use edit when modifying attached or replied-to source images, variation or upscale to build on a previous job; otherwise use generate. Options: generate, edit, variation, upscale."},
 			"aspect_ratio": {"type": "string", "description": "Image aspect ratio. Options: auto, 21:9, 16:9, 3:2, 4:3, 5:4, 1:1, 4:5, 3:4, 2:3, 9:16. Default: auto."},
+			"count": {"type": "integer", "description": "Number of images to generate, 1 to 4. Default: 1."},
+			"seed": {"type": "integer", "description": "Seed to reproduce a previous result. Omit for a random seed."},
+			"job_id": {"type": "string", "description": "ID of a previous image job; required for variation and upscale."},
+			"image_index": {"type": "integer", "description": "Which image of that job to use, starting at 1. Default: 1."},
 			"reference_image_ids": {"type": "array", "items": {"type": "string"}, "description": "IDs returned by visual_memory_recall for remembered visual references to use as source images."},
+			"gallery_image_ids": {"type": "array", "items": {"type": "string"}, "description": "IDs returned by image_gallery_search for previously generated images to edit."},
 			"image_size": {"type": "string", "description": "Deprecated legacy aspect ratio; accepted for backwards compatibility."}
-		},
-		"required": ["prompt"]
+		}
 	}`)
 }
 
+// imageGenParams are the arguments of a generate_image call.
+type imageGenParams struct {
+	Prompt       string   `json:"prompt"`
+	Mode         string   `json:"mode"`
+	AspectRatio  string   `json:"aspect_ratio"`
+	ImageSize    string   `json:"image_size"`
+	Count        int      `json:"count"`
+	Seed         int64    `json:"seed"`
+	JobID        string   `json:"job_id"`
+	ImageIndex   int      `json:"image_index"`
+	ReferenceIDs []string `json:"reference_image_ids"`
+	GalleryIDs   []string `json:"gallery_image_ids"`
+}
+
 func (t *imageGenTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
-	var p struct {
-		Prompt       string   `json:"prompt"`
-		Mode         string   `json:"mode"`
-		AspectRatio  string   `json:"aspect_ratio"`
-		ImageSize    string   `json:"image_size"`
-		ReferenceIDs []string `json:"reference_image_ids"`
-	}
+	var p imageGenParams
 	if err := json.Unmarshal(args, &p); err != nil {
 		return "", err
 	}
+	if t.deps.Disabled {
+		return "Image generation is turned off in this channel. Tell the user without retrying.", nil
+	}
+	if t.deps.SafetyChecker && !t.deps.AllowUnscreened && !screensImages(t.deps.Provider) {
+		return "Image generation is not available in this channel: the image provider cannot safety-check images. Tell the user without retrying.", nil
+	}
+	if p.Count == 0 {
+		p.Count = 1
+	}
+	if p.Count < 1 || p.Count > maxImagesPerRequest {
+		return fmt.Sprintf("Error: count must be between 1 and %d", maxImagesPerRequest), nil
+	}
+	mode := p.Mode
+	if mode == "" {
+		mode = "generate"
+	}
+
+	var (
+		req ImageRequest
+		job *ImageJob
+	)
+	switch mode {
+	case "generate", "edit":
+		var refusal string
+		req, refusal = t.newRequest(ctx, mode, p)
+		if refusal != "" {
+			return refusal, nil
+		}
+		job = &ImageJob{Prompt: p.Prompt, AspectRatio: req.AspectRatio, Resolution: req.Resolution}
+	case "variation", "upscale":
+		prev, refusal := t.previousJob(ctx, p)
+		if refusal != "" {
+			return refusal, nil
+		}
+		if mode == "upscale" && nextImageResolution(prev.Resolution) == "" {
+			return fmt.Sprintf("Image job %s is already at the highest resolution.", prev.ID), nil
+		}
+		req, job = t.followUpRequest(mode, prev, p)
+	default:
+		return "Error: mode must be one of generate, edit, variation or upscale", nil
+	}
+
+	if refusal := t.reserveQuota(ctx, job, req.count()); refusal != "" {
+		return refusal, nil
+	}
+	slot, position, ok := t.deps.Queue.enqueue()
+	if !ok {
+		t.releaseQuota(job)
+		return "The image queue is full, please try again in a moment.", nil
+	}
+	callState(ctx).imageGenCalled = true
+	job.ID = newImageJobID()
+	job.Safety = t.safety()
+
+	t.deps.ImageWg.Add(1)
+	go t.runGenerate(job, req, slot)
+	if position > 0 {
+		t.notify(fmt.Sprintf("Your image is #%d in the queue.", position))
+		return fmt.Sprintf("Image generation queued (job %s, position %d) for prompt: %q — the image will be sent when its turn comes.", job.ID, position, job.Prompt), nil
+	}
+	return fmt.Sprintf("Image generation started (job %s) for prompt: %q — the image will be sent shortly.", job.ID, job.Prompt), nil
+}
+
+// reserveQuota holds n images of the user's daily limit for job, or returns
+// a refusal for the model. Images sent to the user today, as counted by the
+// store's daily usage, and those of their unfinished jobs count against the
+// limit; images withheld by the safety checker do not.
+func (t *imageGenTool) reserveQuota(ctx context.Context, job *ImageJob, n int) string {
+	limit := t.deps.DailyLimit
+	if limit <= 0 {
+		return ""
+	}
+	var used int
+	if t.deps.VisualStore != nil && t.deps.GalleryServerID != "" {
+		var err error
+		used, err = t.deps.VisualStore.ImageUsage(ctx, t.deps.GalleryServerID, t.deps.UserID, time.Now())
+		if err != nil {
+			slog.Error("get image usage failed", "error", err, "user", t.deps.UserID)
+			return "Error: could not check the user's daily image limit, please try again later."
+		}
+	}
+	left, ok := t.deps.Queue.reserve(t.deps.UserID, n, limit-used)
+	if !ok {
+		if left == 0 {
+			return fmt.Sprintf("The user has reached their daily limit of %d generated images; it resets at 00:00 UTC. Tell them without retrying.", limit)
+		}
+		return fmt.Sprintf("The user can generate only %d more image(s) today (daily limit %d); ask for fewer images or wait until 00:00 UTC.", left, limit)
+	}
+	job.reserved = n
+	return ""
+}
+
+// releaseQuota frees the images reserveQuota held for job.
+func (t *imageGenTool) releaseQuota(job *ImageJob) {
+	if job.reserved > 0 {
+		t.deps.Queue.unreserve(t.deps.UserID, job.reserved)
+		job.reserved = 0
+	}
+}
+
+// newRequest builds a generate or edit request, or returns a refusal for
+// the model.
+func (t *imageGenTool) newRequest(ctx context.Context, mode string, p imageGenParams) (ImageRequest, string) {
 	if p.Prompt == "" {
-		return "Error: prompt is required", nil
+		return ImageRequest{}, "Error: prompt is required"
 	}
 	aspectRatio := p.AspectRatio
 	if aspectRatio == "" {
@@ -91,42 +260,118 @@ func (t *imageGenTool) Call(ctx context.Context, args json.RawMessage) (string,
 	if aspectRatio == "" {
 		aspectRatio = "auto"
 	}
-	mode := p.Mode
-	if mode == "" {
-		mode = "generate"
-	}
-	if mode != "generate" && mode != "edit" {
-		return "Error: mode must be either generate or edit", nil
-	}
 	sourceImageURLs := t.deps.SourceImageURLs
 	if len(p.ReferenceIDs) > 0 {
 		if t.deps.VisualStore == nil || t.deps.ServerID == "" {
-			return "Remembered image references are not available.", nil
+			return ImageRequest{}, "Remembered image references are not available."
 		}
 		referenceURLs, err := t.referenceImageDataURLs(ctx, p.ReferenceIDs)
 		if err != nil {
-			return fmt.Sprintf("Failed to load remembered image reference: %s", err), nil
+			return ImageRequest{}, fmt.Sprintf("Failed to load remembered image reference: %s", err)
 		}
 		sourceImageURLs = append(referenceURLs, sourceImageURLs...)
 		if mode == "generate" {
 			mode = "edit"
 		}
 	}
+	if len(p.GalleryIDs) > 0 {
+		if t.deps.VisualStore == nil || t.deps.GalleryServerID == "" {
+			return ImageRequest{}, "The image gallery is not available."
+		}
+		galleryURLs, err := t.galleryImageDataURLs(ctx, p.GalleryIDs)
+		if err != nil {
+			return ImageRequest{}, fmt.Sprintf("Failed to load gallery image: %s", err)
+		}
+		sourceImageURLs = append(galleryURLs, sourceImageURLs...)
+		mode = "edit"
+	}
 	if len(sourceImageURLs) > maxImageEditSourceURLs {
 		sourceImageURLs = sourceImageURLs[:maxImageEditSourceURLs]
 	}
 	if mode == "edit" && len(sourceImageURLs) == 0 {
-		return "Image editing requires an attached or replied-to image.", nil
+		return ImageRequest{}, "Image editing requires an attached or replied-to image."
+	}
+	req := ImageRequest{
+		Prompt:        p.Prompt,
+		Mode:          mode,
+		AspectRatio:   aspectRatio,
+		Resolution:    t.deps.Resolution,
+		SafetyChecker: t.deps.SafetyChecker,
+		Count:         p.Count,
+		Seed:          p.Seed,
 	}
+	if mode == "edit" {
+		req.SourceImageURLs = sourceImageURLs
+	}
+	return req, ""
+}
 
-	if !t.deps.ImageRunning.CompareAndSwap(false, true) {
-		return "An image generation is already running, please wait.", nil
+// previousJob looks up the job a variation or upscale builds on, or returns
+// a refusal for the model. Jobs no longer held by the queue are rebuilt from
+// the gallery. Jobs made under a laxer safety level than the channel's are
+// refused.
+func (t *imageGenTool) previousJob(ctx context.Context, p imageGenParams) (*ImageJob, string) {
+	id := strings.TrimSpace(p.JobID)
+	if id == "" {
+		return nil, "Error: job_id is required for variation and upscale"
+	}
+	job := t.deps.Queue.Job(id)
+	if job == nil {
+		job = t.galleryJob(ctx, id)
+	}
+	if job == nil {
+		return nil, fmt.Sprintf("Image job %s is unknown or too old to reuse.", id)
+	}
+	if !t.mayReuse(job.Safety) {
+		return nil, fmt.Sprintf("Image job %s was made in a channel with less strict image safety settings and cannot be reused here. Tell the user without retrying.", id)
+	}
+	index := max(p.ImageIndex, 1)
+	if index > len(job.Images) {
+		return nil, fmt.Sprintf("Error: image_index must be between 1 and %d for job %s", len(job.Images), id)
+	}
+	return job, ""
+}
+
+// followUpRequest builds an edit of one of prev's images: variations keep
+// its subject and style, upscales re-render it one resolution step higher.
+func (t *imageGenTool) followUpRequest(mode string, prev *ImageJob, p imageGenParams) (ImageRequest, *ImageJob) {
+	prompt := p.Prompt
+	if prompt == "" {
+		prompt = prev.Prompt
+	}
+	src := prev.Images[max(p.ImageIndex, 1)-1]
+	req := ImageRequest{
+		Mode:            "edit",
+		AspectRatio:     prev.AspectRatio,
+		Resolution:      prev.Resolution,
+		SourceImageURLs: []string{dataURL(src.ContentType, src.Data)},
+		SafetyChecker:   t.deps.SafetyChecker,
+		Count:           p.Count,
+		Seed:            p.Seed,
+	}
+	if mode == "upscale" {
+		req.Prompt = "Reproduce this image at a higher resolution with sharper detail, without changing its content or composition: " + prompt
+		req.Resolution = nextImageResolution(prev.Resolution)
+		req.Count = 1
+		req.Strength = upscaleStrength
+	} else {
+		req.Prompt = "Create a variation of this image that keeps its subject and style: " + prompt
+		req.Strength = variationStrength
 	}
-	*t.imageCalled = true
+	return req, &ImageJob{Prompt: prompt, AspectRatio: req.AspectRatio, Resolution: req.Resolution}
+}
 
-	t.deps.ImageWg.Add(1)
-	go t.runGenerate(p.Prompt, aspectRatio, mode, sourceImageURLs)
-	return fmt.Sprintf("Image generation started for prompt: %q — the image will be sent shortly.", p.Prompt), nil
+// nextImageResolution returns the resolution one step above res, or "" at
+// the top.
+func nextImageResolution(res string) string {
+	switch res {
+	case "2K":
+		return "4K"
+	case "4K":
+		return ""
+	default:
+		return "2K"
+	}
 }
 
 func (t *imageGenTool) referenceImageDataURLs(ctx context.Context, ids []string) ([]string, error) {
@@ -176,186 +421,195 @@ func legacyImageSizeToAspectRatio(imageSize string) string {
 	}
 }
 
-type falRequest struct {
-	Prompt             string   `json:"prompt"`
-	NumImages          int      `json:"num_images"`
-	AspectRatio        string   `json:"aspect_ratio"`
-	OutputFormat       string   `json:"output_format"`
-	SafetyTolerance    string   `json:"safety_tolerance,omitempty"`
-	ImageURLs          []string `json:"image_urls,omitempty"`
-	Resolution         string   `json:"resolution"`
-	LimitGenerations   bool     `json:"limit_generations"`
-	EnableWebSearch    bool     `json:"enable_web_search,omitempty"`
-	EnableGoogleSearch bool     `json:"enable_google_search,omitempty"`
-}
-
-type falResponse struct {
-	Images []struct {
-		URL string `json:"url"`
-	} `json:"images"`
-	HasNSFWConcepts []bool `json:"has_nsfw_concepts"`
-}
-
-func (t *imageGenTool) runGenerate(prompt, aspectRatio, mode string, sourceImageURLs []string) {
+func (t *imageGenTool) runGenerate(job *ImageJob, req ImageRequest, slot chan struct{}) {
 	defer t.deps.ImageWg.Done()
-	defer t.deps.ImageRunning.Store(false)
-
-	model := t.deps.Model
-	if mode == "edit" && t.deps.EditModel != "" {
-		model = t.deps.EditModel
+	// Runs after the sent images are added to the user's daily usage, which
+	// counts them against the limit from then on.
+	defer t.releaseQuota(job)
+	if err := t.deps.Queue.wait(t.deps.Ctx, slot); err != nil {
+		slog.Debug("queued image job dropped", "job", job.ID, "error", err)
+		return
 	}
-	slog.Debug("image gen goroutine started", "prompt", prompt, "model", model, "mode", mode, "timeout", t.deps.TimeoutSeconds)
+	defer t.deps.Queue.release()
+
+	slog.Debug("image gen goroutine started", "job", job.ID, "prompt", req.Prompt, "provider", t.deps.Provider.Name(), "mode", req.Mode, "count", req.count(), "timeout", t.deps.TimeoutSeconds)
 
 	ctx, cancel := context.WithTimeout(t.deps.Ctx, time.Duration(t.deps.TimeoutSeconds)*time.Second)
 	defer cancel()
 
-	resolution := t.deps.Resolution
-	if resolution == "" {
-		resolution = "1K"
-	}
-	reqBody := falRequest{
-		Prompt:           prompt,
-		NumImages:        1,
-		AspectRatio:      aspectRatio,
-		OutputFormat:     "png",
-		Resolution:       resolution,
-		LimitGenerations: true,
-	}
-	if mode == "edit" {
-		reqBody.ImageURLs = sourceImageURLs
-	}
-	if t.deps.SafetyChecker {
-		reqBody.SafetyTolerance = "4"
-	}
-	bodyBytes, err := json.Marshal(reqBody)
+	result, err := t.deps.Provider.Generate(ctx, req)
 	if err != nil {
-		slog.Error("image gen marshal error", "error", err)
-		if err := t.deps.SendText(fmt.Sprintf("Failed to generate image: %s", err)); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
-		}
+		slog.Error("image gen failed", "error", err, "provider", t.deps.Provider.Name(), "prompt", req.Prompt)
+		t.notify(fmt.Sprintf("Failed to generate image: %s.", err))
 		return
 	}
 
-	baseURL := t.deps.BaseURL
-	if baseURL == "" {
-		baseURL = "https://fal.run"
-	}
-	url := fmt.Sprintf("%s/%s", baseURL, model)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
-	if err != nil {
-		slog.Error("image gen request creation error", "error", err)
-		if err := t.deps.SendText(fmt.Sprintf("Failed to generate image: %s", err)); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
-		}
+	if t.deps.SafetyChecker && !t.deps.AllowUnscreened && req.Mode != "edit" && !result.Checked {
+		slog.Warn("image gen safety check: result was not screened, blocking image", "provider", t.deps.Provider.Name(), "prompt", req.Prompt)
+		t.notify("The generated image could not be safety-checked and was not sent.")
 		return
 	}
-	req.Header.Set("Authorization", "Key "+t.deps.APIKey)
-	req.Header.Set("Content-Type", "application/json")
 
-	slog.Debug("image gen calling fal API", "url", url)
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		slog.Error("image gen API call failed", "error", err, "prompt", prompt)
-		if err := t.deps.SendText(fmt.Sprintf("Failed to generate image: %s", err)); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
+	var withheld int
+	for _, img := range result.Images {
+		if t.deps.SafetyChecker && img.NSFW {
+			withheld++
+			continue
 		}
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		slog.Error("image gen API error", "status", resp.StatusCode, "body", string(body), "prompt", prompt)
-		if err := t.deps.SendText(fmt.Sprintf("Failed to generate image (HTTP %d).", resp.StatusCode)); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
+		if len(img.Data) > 0 {
+			job.Images = append(job.Images, img)
 		}
-		return
 	}
-
-	var falResp falResponse
-	if err := json.NewDecoder(resp.Body).Decode(&falResp); err != nil {
-		slog.Error("image gen response decode error", "error", err)
-		if err := t.deps.SendText("Failed to generate image: could not parse response."); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
+	if len(job.Images) == 0 {
+		if withheld > 0 {
+			slog.Warn("image gen NSFW content blocked", "prompt", req.Prompt)
+			t.notify("The generated image was flagged as inappropriate and was not sent. NSFW images are only sent in age-restricted channels that allow them.")
+			return
 		}
+		slog.Error("image gen returned no images", "prompt", req.Prompt)
+		t.notify("Failed to generate image: no image was returned.")
 		return
 	}
+	job.Seed = result.Seed
 
-	slog.Debug("image gen fal response", "images", len(falResp.Images), "nsfw", falResp.HasNSFWConcepts, "safety_checker", t.deps.SafetyChecker)
-
-	if t.deps.SafetyChecker && (mode != "edit" || len(falResp.HasNSFWConcepts) > 0) {
-		if len(falResp.HasNSFWConcepts) == 0 {
-			slog.Warn("image gen safety check: has_nsfw_concepts absent, blocking image", "prompt", prompt)
-			if err := t.deps.SendText("The generated image could not be safety-checked and was not sent."); err != nil {
-				slog.Warn("image gen notify failed", "error", err)
-			}
-			return
+	files := make([]ImageFile, len(job.Images))
+	for i, img := range job.Images {
+		name := "generated.png"
+		if len(job.Images) > 1 {
+			name = fmt.Sprintf("generated-%d.png", i+1)
 		}
-		if falResp.HasNSFWConcepts[0] {
-			slog.Warn("image gen NSFW content blocked", "prompt", prompt)
-			if err := t.deps.SendText("The generated image was flagged as inappropriate and was not sent."); err != nil {
-				slog.Warn("image gen notify failed", "error", err)
-			}
-			return
+		// When safety checker is disabled, send NSFW images as spoilers.
+		if !t.deps.SafetyChecker && img.NSFW {
+			name = "SPOILER_" + name
 		}
+		files[i] = ImageFile{Name: name, Data: bytes.NewReader(img.Data)}
 	}
+	slog.Debug("image gen sending to Discord", "job", job.ID, "images", len(files), "withheld", withheld)
+	messageID, err := t.deps.SendImage(files, imageJobCaption(job, withheld))
+	if err != nil {
+		slog.Error("image send to Discord failed", "error", err)
+		t.notify("Failed to send the generated image.")
+		return
+	}
+	t.deps.Queue.record(job)
+	t.addUsage(len(job.Images))
+	t.saveToGallery(job, result.Model, messageID)
+	slog.Info("image gen completed successfully", "job", job.ID, "prompt", req.Prompt, "images", len(files), "seed", job.Seed)
+}
 
-	if len(falResp.Images) == 0 || falResp.Images[0].URL == "" {
-		slog.Error("image gen returned no images", "prompt", prompt)
-		if err := t.deps.SendText("Failed to generate image: no image was returned."); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
-		}
+// addUsage counts n sent images towards the user's daily limit.
+func (t *imageGenTool) addUsage(n int) {
+	if t.deps.VisualStore == nil || t.deps.GalleryServerID == "" {
 		return
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := t.deps.VisualStore.AddImageUsage(ctx, t.deps.GalleryServerID, t.deps.UserID, time.Now(), n); err != nil {
+		slog.Warn("add image usage failed", "error", err, "user", t.deps.UserID)
+	}
+}
 
-	// Download the image immediately (fal.ai URLs expire).
-	imgReq, err := http.NewRequestWithContext(ctx, http.MethodGet, falResp.Images[0].URL, nil)
-	if err != nil {
-		slog.Error("image download request error", "error", err)
-		if err := t.deps.SendText("Failed to download generated image."); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
-		}
+// saveToGallery keeps the sent images of job with their prompt and origin.
+func (t *imageGenTool) saveToGallery(job *ImageJob, model, messageID string) {
+	if t.deps.VisualStore == nil || t.deps.GalleryServerID == "" {
 		return
 	}
-	imgResp, err := http.DefaultClient.Do(imgReq)
-	if err != nil {
-		slog.Error("image download failed", "error", err)
-		if err := t.deps.SendText("Failed to download generated image."); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
+	// The job is done; its own context may already be cancelled.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i, img := range job.Images {
+		_, err := t.deps.VisualStore.SaveGeneratedImage(ctx, memory.GeneratedImageSaveOptions{
+			ServerID:    t.deps.GalleryServerID,
+			JobID:       job.ID,
+			Index:       i + 1,
+			Prompt:      job.Prompt,
+			Provider:    t.deps.Provider.Name(),
+			Model:       model,
+			AspectRatio: job.AspectRatio,
+			Resolution:  job.Resolution,
+			Seed:        job.Seed,
+			UserID:      t.deps.UserID,
+			ChannelID:   t.deps.SourceChannelID,
+			MessageID:   messageID,
+			Safety:      job.Safety,
+			ContentType: img.ContentType,
+			Data:        img.Data,
+		})
+		if err != nil {
+			slog.Warn("save generated image to gallery failed", "error", err, "job", job.ID)
 		}
-		return
 	}
-	defer imgResp.Body.Close()
+}
 
-	if imgResp.StatusCode != http.StatusOK {
-		slog.Error("image download HTTP error", "status", imgResp.StatusCode)
-		if err := t.deps.SendText("Failed to download generated image."); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
+// galleryJob rebuilds a finished job from the gallery, or returns nil.
+func (t *imageGenTool) galleryJob(ctx context.Context, id string) *ImageJob {
+	if t.deps.VisualStore == nil || t.deps.GalleryServerID == "" {
+		return nil
+	}
+	rows, _, err := t.deps.VisualStore.ListGeneratedImages(ctx, memory.GeneratedImageListOptions{ServerID: t.deps.GalleryServerID, JobID: id, Limit: maxImagesPerRequest})
+	if err != nil || len(rows) == 0 {
+		return nil
+	}
+	slices.SortFunc(rows, func(a, b memory.GeneratedImageRow) int { return a.Index - b.Index })
+	job := &ImageJob{ID: id, Prompt: rows[0].Prompt, AspectRatio: rows[0].AspectRatio, Resolution: rows[0].Resolution, Seed: rows[0].Seed, Safety: rows[0].Safety}
+	for _, row := range rows {
+		if imageSafetyRank(row.Safety) > imageSafetyRank(job.Safety) {
+			job.Safety = row.Safety
 		}
-		return
+		data, err := os.ReadFile(row.FilePath)
+		if err != nil {
+			slog.Warn("read gallery image failed", "error", err, "id", row.ID)
+			return nil
+		}
+		job.Images = append(job.Images, GeneratedImage{Data: data, ContentType: row.ContentType})
 	}
+	return job
+}
 
-	imgData, err := io.ReadAll(io.LimitReader(imgResp.Body, 20*1024*1024)) // 20 MB max
-	if err != nil {
-		slog.Error("image read error", "error", err)
-		if err := t.deps.SendText("Failed to read generated image."); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
+// galleryImageDataURLs loads gallery images as data URLs for an edit.
+// Images made under a laxer safety level than the channel's are refused.
+func (t *imageGenTool) galleryImageDataURLs(ctx context.Context, ids []string) ([]string, error) {
+	var urls []string
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
 		}
-		return
+		row, err := t.deps.VisualStore.GetGeneratedImage(ctx, t.deps.GalleryServerID, id)
+		if err != nil {
+			return nil, err
+		}
+		if !t.mayReuse(row.Safety) {
+			return nil, fmt.Errorf("gallery image %s was made in a channel with less strict image safety settings and cannot be used here", id)
+		}
+		data, err := os.ReadFile(row.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("read gallery image %s: %w", id, err)
+		}
+		urls = append(urls, dataURL(row.ContentType, data))
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no gallery image IDs provided")
 	}
+	return urls, nil
+}
 
-	// When safety checker is disabled, send NSFW images as spoilers.
-	filename := "generated.png"
-	if !t.deps.SafetyChecker && len(falResp.HasNSFWConcepts) > 0 && falResp.HasNSFWConcepts[0] {
-		filename = "SPOILER_generated.png"
+// imageJobCaption labels sent images with their job ID, so the user can ask
+// for variations or an upscale, and the seed when the provider reported one.
+func imageJobCaption(job *ImageJob, withheld int) string {
+	caption := "-# Job " + job.ID
+	if job.Seed != 0 {
+		caption += fmt.Sprintf(" · seed %d", job.Seed)
 	}
-	slog.Debug("image gen sending to Discord", "filename", filename, "size", len(imgData))
-	if err := t.deps.SendImage(filename, bytes.NewReader(imgData), ""); err != nil {
-		slog.Error("image send to Discord failed", "error", err)
-		if err := t.deps.SendText("Failed to send the generated image."); err != nil {
-			slog.Warn("image gen notify failed", "error", err)
-		}
-	} else {
-		slog.Info("image gen completed successfully", "prompt", prompt, "size", len(imgData))
+	if withheld > 0 {
+		caption += fmt.Sprintf(" · %d withheld as inappropriate", withheld)
+	}
+	return caption
+}
+
+// notify tells the channel how an image generation ended.
+func (t *imageGenTool) notify(text string) {
+	if err := t.deps.SendText(text); err != nil {
+		slog.Warn("image gen notify failed", "error", err)
 	}
 }
@@ -1,9 +1,14 @@
 package tools_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -23,7 +28,21 @@ func newToolTestStore(t *testing.T) *memory.Store {
 	t.Helper()
 	embSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		fmt.Fprint(w, `{"data":[{"embedding":[0.1,0.2,0.3,0.4]}]}`)
+		// One vector per input, for batched knowledge embeddings.
+		var req struct {
+			Input json.RawMessage `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		n := 1
+		var inputs []string
+		if json.Unmarshal(req.Input, &inputs) == nil {
+			n = len(inputs)
+		}
+		vecs := make([]string, n)
+		for i := range vecs {
+			vecs[i] = fmt.Sprintf(`{"index":%d,"embedding":[0.1,0.2,0.3,0.4]}`, i)
+		}
+		fmt.Fprint(w, `{"data":[`+strings.Join(vecs, ",")+`]}`)
 	}))
 	t.Cleanup(embSrv.Close)
 
@@ -44,27 +63,25 @@ func newToolTestStore(t *testing.T) *memory.Store {
 }
 
 func TestImageGenCalledFlagSetOnSuccessfulCAS(t *testing.T) {
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 
 	cancelledCtx, cancel := context.WithCancel(context.Background())
 	cancel()
 
 	deps := &tools.ImageGenDeps{
-		SendImage:      func(string, io.Reader, string) error { return nil },
+		SendImage:      func([]tools.ImageFile, string) (string, error) { return "", nil },
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            cancelledCtx,
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider("", "test-key", "test-model", "", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 1,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	if r.ImageGenCalled {
 		t.Fatal("ImageGenCalled should be false before any tool call")
@@ -85,23 +102,21 @@ func TestImageGenCalledFlagSetOnSuccessfulCAS(t *testing.T) {
 }
 
 func TestImageGenDefinitionAdvertisesReferenceImageIDs(t *testing.T) {
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	deps := &tools.ImageGenDeps{
-		SendImage:      func(string, io.Reader, string) error { return nil },
+		SendImage:      func([]tools.ImageFile, string) (string, error) { return "", nil },
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider("", "test-key", "test-model", "", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	var generateImageParams json.RawMessage
 	for _, def := range r.Definitions() {
@@ -139,57 +154,182 @@ func TestImageGenDefinitionAdvertisesReferenceImageIDs(t *testing.T) {
 	}
 }
 
-func TestImageGenCASRejectedWhenAlreadyRunning(t *testing.T) {
-	var imageRunning atomic.Bool
-	imageRunning.Store(true)
+func TestImageGenQueuesWhileAnotherJobRuns(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	falServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"images":[],"has_nsfw_concepts":[]}`)
+	}))
+	defer falServer.Close()
+
+	// Two channels of one agent share its queue.
+	queue := tools.NewImageQueue(1)
+	var wg sync.WaitGroup
+	var notices []string
+	newRegistry := func() *tools.Registry {
+		deps := &tools.ImageGenDeps{
+			SendImage:      func([]tools.ImageFile, string) (string, error) { return "", nil },
+			SendText:       func(content string) error { notices = append(notices, content); return nil },
+			ImageWg:        &wg,
+			Queue:          queue,
+			Ctx:            context.Background(),
+			Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "test-model", "", nil),
+			SafetyChecker:  true,
+			TimeoutSeconds: 5,
+		}
+		return tools.NewDefaultRegistry(nil, "", 0, 0, func(string) error { return nil }, func(string) error { return nil }, nil, deps, 2, nil)
+	}
+
+	first, second := newRegistry(), newRegistry()
+	result, err := first.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"first"}`))
+	if err != nil {
+		t.Fatalf("Dispatch() returned unexpected error: %v", err)
+	}
+	if !strings.Contains(result, "Image generation started") {
+		t.Errorf("first result = %q, want started", result)
+	}
+	<-started
+	result, err = second.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"second"}`))
+	if err != nil {
+		t.Fatalf("Dispatch() returned unexpected error: %v", err)
+	}
+	if !strings.Contains(result, "position 1") {
+		t.Errorf("second result = %q, want queued at position 1", result)
+	}
+	if !second.ImageGenCalled {
+		t.Error("ImageGenCalled should be true when the job is queued")
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "#1 in the queue") {
+		t.Errorf("notices = %q, want a queue position notice", notices)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("provider calls while the first job runs = %d, want 1", n)
+	}
+
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 2 {
+		t.Errorf("provider calls = %d, want 2", n)
+	}
+}
+
+func TestImageGenMultipleImagesAndFollowUps(t *testing.T) {
+	imgServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer imgServer.Close()
+
+	var requestPath string
+	var requestBody map[string]any
+	falServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		requestBody = nil
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"images":[{"url":"%[1]s/one"},{"url":"%[1]s/two"}],"has_nsfw_concepts":[false,false],"seed":42}`, imgServer.URL)
+	}))
+	defer falServer.Close()
 
 	var wg sync.WaitGroup
+	var names []string
+	var caption string
 	deps := &tools.ImageGenDeps{
-		SendImage:      func(string, io.Reader, string) error { return nil },
+		SendImage: func(files []tools.ImageFile, c string) (string, error) {
+			names = names[:0]
+			for _, f := range files {
+				names = append(names, f.Name)
+			}
+			caption = c
+			return "", nil
+		},
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "text-model", "edit-model", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
+		Resolution:     "1K",
 	}
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, func(string) error { return nil }, func(string) error { return nil }, nil, deps, 2, nil)
 
-	send := func(string) error { return nil }
-	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	if _, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"a fox","count":5}`)); err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	if r.ImageGenCalled {
+		t.Fatal("ImageGenCalled should be false when count is out of range")
+	}
 
-	result, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"test"}`))
+	result, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"a fox","count":2,"seed":7}`))
 	if err != nil {
-		t.Fatalf("Dispatch() returned unexpected error: %v", err)
+		t.Fatalf("Dispatch() error: %v", err)
 	}
-	if !strings.Contains(result, "already running") {
-		t.Errorf("expected 'already running' message, got %q", result)
+	wg.Wait()
+	if requestBody["num_images"] != float64(2) || requestBody["seed"] != float64(7) {
+		t.Errorf("request num_images = %v, seed = %v; want 2 and 7", requestBody["num_images"], requestBody["seed"])
 	}
-	if r.ImageGenCalled {
-		t.Error("ImageGenCalled should be false when CAS fails")
+	if strings.Join(names, ",") != "generated-1.png,generated-2.png" {
+		t.Errorf("sent files = %q, want both images in one message", names)
+	}
+	jobID := strings.TrimSuffix(strings.Fields(strings.SplitN(result, "job ", 2)[1])[0], ")")
+	if !strings.Contains(caption, "Job "+jobID) || !strings.Contains(caption, "seed 42") {
+		t.Errorf("caption = %q, want job %s and seed 42", caption, jobID)
+	}
+
+	if _, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"mode":"variation","job_id":"`+jobID+`","image_index":2,"count":2}`)); err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	wg.Wait()
+	if requestPath != "/edit-model" {
+		t.Errorf("variation path = %q, want /edit-model", requestPath)
+	}
+	urls, _ := requestBody["image_urls"].([]any)
+	if len(urls) != 1 || urls[0] != "data:image/png;base64,"+base64.StdEncoding.EncodeToString([]byte("two")) {
+		t.Errorf("variation image_urls = %v, want the job's second image", requestBody["image_urls"])
+	}
+	if prompt, _ := requestBody["prompt"].(string); !strings.Contains(prompt, "a fox") {
+		t.Errorf("variation prompt = %q, want the job's prompt", prompt)
+	}
+
+	if _, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"mode":"upscale","job_id":"`+jobID+`"}`)); err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	wg.Wait()
+	if requestBody["resolution"] != "2K" || requestBody["num_images"] != float64(1) {
+		t.Errorf("upscale resolution = %v, num_images = %v; want 2K and 1", requestBody["resolution"], requestBody["num_images"])
+	}
+
+	result, err = r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"mode":"upscale","job_id":"missing"}`))
+	if err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	if !strings.Contains(result, "unknown") {
+		t.Errorf("unknown job result = %q", result)
 	}
 }
 
 func TestImageGenEmptyPromptReturnsError(t *testing.T) {
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	deps := &tools.ImageGenDeps{
-		SendImage:      func(string, io.Reader, string) error { return nil },
+		SendImage:      func([]tools.ImageFile, string) (string, error) { return "", nil },
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider("", "test-key", "test-model", "", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	result, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":""}`))
 	if err != nil {
@@ -201,9 +341,6 @@ func TestImageGenEmptyPromptReturnsError(t *testing.T) {
 	if r.ImageGenCalled {
 		t.Error("ImageGenCalled should be false when prompt is empty")
 	}
-	if imageRunning.Load() {
-		t.Error("ImageRunning should not be set when prompt is empty")
-	}
 }
 
 func TestImageGenNSFWBlocked(t *testing.T) {
@@ -213,33 +350,30 @@ func TestImageGenNSFWBlocked(t *testing.T) {
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	var sentText string
 	var sendImageCalled atomic.Bool
 
 	deps := &tools.ImageGenDeps{
-		SendImage: func(string, io.Reader, string) error {
+		SendImage: func([]tools.ImageFile, string) (string, error) {
 			sendImageCalled.Store(true)
-			return nil
+			return "", nil
 		},
 		SendText: func(content string) error {
 			sentText = content
 			return nil
 		},
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "test-model", "", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
-		BaseURL:        falServer.URL,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"test"}`))
 	if err != nil {
@@ -263,29 +397,26 @@ func TestImageGenHTTPError(t *testing.T) {
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	var sentText string
 
 	deps := &tools.ImageGenDeps{
-		SendImage: func(string, io.Reader, string) error { return nil },
+		SendImage: func([]tools.ImageFile, string) (string, error) { return "", nil },
 		SendText: func(content string) error {
 			sentText = content
 			return nil
 		},
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "test-model", "", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
-		BaseURL:        falServer.URL,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"test"}`))
 	if err != nil {
@@ -314,29 +445,26 @@ func TestImageGenNSFWSpoilerWhenSafetyCheckerOff(t *testing.T) {
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	var receivedFilename string
 
 	deps := &tools.ImageGenDeps{
-		SendImage: func(filename string, data io.Reader, caption string) error {
-			receivedFilename = filename
-			return nil
+		SendImage: func(files []tools.ImageFile, caption string) (string, error) {
+			receivedFilename = files[0].Name
+			return "", nil
 		},
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "test-model", "", nil),
 		SafetyChecker:  false,
 		TimeoutSeconds: 5,
-		BaseURL:        falServer.URL,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"test"}`))
 	if err != nil {
@@ -365,29 +493,26 @@ func TestImageGenNonNSFWWithSafetyCheckerOffSendsPlainFilename(t *testing.T) {
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	var receivedFilename string
 
 	deps := &tools.ImageGenDeps{
-		SendImage: func(filename string, data io.Reader, caption string) error {
-			receivedFilename = filename
-			return nil
+		SendImage: func(files []tools.ImageFile, caption string) (string, error) {
+			receivedFilename = files[0].Name
+			return "", nil
 		},
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "test-model", "", nil),
 		SafetyChecker:  false,
 		TimeoutSeconds: 5,
-		BaseURL:        falServer.URL,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"test"}`))
 	if err != nil {
@@ -417,29 +542,26 @@ func TestImageGenAbsentNSFWArrayWithSafetyCheckerOffSendsPlainFilename(t *testin
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	var receivedFilename string
 
 	deps := &tools.ImageGenDeps{
-		SendImage: func(filename string, data io.Reader, caption string) error {
-			receivedFilename = filename
-			return nil
+		SendImage: func(files []tools.ImageFile, caption string) (string, error) {
+			receivedFilename = files[0].Name
+			return "", nil
 		},
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "test-model", "", nil),
 		SafetyChecker:  false,
 		TimeoutSeconds: 5,
-		BaseURL:        falServer.URL,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"test"}`))
 	if err != nil {
@@ -475,32 +597,29 @@ func TestImageGenSuccess(t *testing.T) {
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	var receivedFilename string
 	var receivedData []byte
 
 	deps := &tools.ImageGenDeps{
-		SendImage: func(filename string, data io.Reader, caption string) error {
-			receivedFilename = filename
+		SendImage: func(files []tools.ImageFile, caption string) (string, error) {
+			receivedFilename = files[0].Name
 			var err error
-			receivedData, err = io.ReadAll(data)
-			return err
+			receivedData, err = io.ReadAll(files[0].Data)
+			return "", err
 		},
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "test-model",
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "test-model", "", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
-		BaseURL:        falServer.URL,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"a sunset"}`))
 	if err != nil {
@@ -551,32 +670,28 @@ func TestImageGenOmittedModeWithSourceImagesDefaultsToGenerate(t *testing.T) {
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	var receivedData []byte
 
 	deps := &tools.ImageGenDeps{
-		SendImage: func(filename string, data io.Reader, caption string) error {
+		SendImage: func(files []tools.ImageFile, caption string) (string, error) {
 			var err error
-			receivedData, err = io.ReadAll(data)
-			return err
+			receivedData, err = io.ReadAll(files[0].Data)
+			return "", err
 		},
 		SendText:        func(string) error { return nil },
 		ImageWg:         &wg,
-		ImageRunning:    &imageRunning,
+		Queue:           tools.NewImageQueue(1),
 		Ctx:             context.Background(),
-		APIKey:          "test-key",
-		Model:           "text-model",
-		EditModel:       "fal-ai/nano-banana-2/edit",
+		Provider:        tools.NewFalImageProvider(falServer.URL, "test-key", "text-model", "fal-ai/nano-banana-2/edit", nil),
 		SourceImageURLs: []string{"data:image/png;base64,abc123"},
 		SafetyChecker:   true,
 		TimeoutSeconds:  5,
-		BaseURL:         falServer.URL,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"a fresh landscape"}`))
 	if err != nil {
@@ -618,32 +733,28 @@ func TestImageGenEditModeUsesEditModelAndSourceImages(t *testing.T) {
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	var receivedData []byte
 
 	deps := &tools.ImageGenDeps{
-		SendImage: func(filename string, data io.Reader, caption string) error {
+		SendImage: func(files []tools.ImageFile, caption string) (string, error) {
 			var err error
-			receivedData, err = io.ReadAll(data)
-			return err
+			receivedData, err = io.ReadAll(files[0].Data)
+			return "", err
 		},
 		SendText:        func(string) error { return nil },
 		ImageWg:         &wg,
-		ImageRunning:    &imageRunning,
+		Queue:           tools.NewImageQueue(1),
 		Ctx:             context.Background(),
-		APIKey:          "test-key",
-		Model:           "text-model",
-		EditModel:       "fal-ai/nano-banana-2/edit",
+		Provider:        tools.NewFalImageProvider(falServer.URL, "test-key", "text-model", "fal-ai/nano-banana-2/edit", nil),
 		SourceImageURLs: []string{"data:image/png;base64,abc123"},
 		SafetyChecker:   true,
 		TimeoutSeconds:  5,
-		BaseURL:         falServer.URL,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"make it cinematic","mode":"edit","aspect_ratio":"1:1"}`))
 	if err != nil {
@@ -669,16 +780,14 @@ func TestImageGenEditModeUsesEditModelAndSourceImages(t *testing.T) {
 
 func TestVisualMemorySaveToolStoresCurrentSourceImages(t *testing.T) {
 	store := newToolTestStore(t)
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	deps := &tools.ImageGenDeps{
-		SendImage:       func(string, io.Reader, string) error { return nil },
+		SendImage:       func([]tools.ImageFile, string) (string, error) { return "", nil },
 		SendText:        func(string) error { return nil },
 		ImageWg:         &wg,
-		ImageRunning:    &imageRunning,
+		Queue:           tools.NewImageQueue(1),
 		Ctx:             context.Background(),
-		APIKey:          "test-key",
-		Model:           "text-model",
+		Provider:        tools.NewFalImageProvider("", "test-key", "text-model", "", nil),
 		SourceImageURLs: []string{"data:image/png;base64,YWxpY2U="},
 		SafetyChecker:   true,
 		TimeoutSeconds:  5,
@@ -688,7 +797,7 @@ func TestVisualMemorySaveToolStoresCurrentSourceImages(t *testing.T) {
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(store, "srv1", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(store, "srv1", 0, 0, send, react, nil, deps, 2, nil)
 
 	result, err := r.Dispatch(context.Background(), "visual_memory_save", json.RawMessage(`{"label":"Alice","description":"Alice in a red jacket","user_id":"user1"}`))
 	if err != nil {
@@ -707,6 +816,56 @@ func TestVisualMemorySaveToolStoresCurrentSourceImages(t *testing.T) {
 	}
 }
 
+func TestVisualMemorySaveToolReportsLookalikeUnderOtherLabel(t *testing.T) {
+	store := newToolTestStore(t)
+	img := image.NewGray(image.Rect(0, 0, 48, 48))
+	for y := range 48 {
+		for x := range 48 {
+			img.SetGray(x, y, color.Gray{Y: uint8((x/6 + y/8) % 2 * 200)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode image: %v", err)
+	}
+	bob, err := store.SaveVisual(context.Background(), memory.VisualSaveOptions{
+		Label:       "Bob",
+		ServerID:    "srv1",
+		ContentType: "image/png",
+		Data:        buf.Bytes(),
+	})
+	if err != nil {
+		t.Fatalf("SaveVisual() error: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	deps := &tools.ImageGenDeps{
+		SendImage:       func([]tools.ImageFile, string) (string, error) { return "", nil },
+		SendText:        func(string) error { return nil },
+		ImageWg:         &wg,
+		Queue:           tools.NewImageQueue(1),
+		Ctx:             context.Background(),
+		Provider:        tools.NewFalImageProvider("", "test-key", "text-model", "", nil),
+		SourceImageURLs: []string{"data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())},
+		SafetyChecker:   true,
+		TimeoutSeconds:  5,
+		VisualStore:     store,
+		ServerID:        "srv1",
+	}
+
+	send := func(string) error { return nil }
+	react := func(string) error { return nil }
+	r := tools.NewDefaultRegistry(store, "srv1", 0, 0, send, react, nil, deps, 2, nil)
+
+	result, err := r.Dispatch(context.Background(), "visual_memory_save", json.RawMessage(`{"label":"Alice"}`))
+	if err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	if !strings.Contains(result, "Visual memory saved") || !strings.Contains(result, bob.ID) || !strings.Contains(result, `"Bob"`) {
+		t.Fatalf("expected save with a lookalike note for Bob, got %q", result)
+	}
+}
+
 func TestVisualMemoryRecallToolReturnsReferenceIDs(t *testing.T) {
 	store := newToolTestStore(t)
 	save, err := store.SaveVisual(context.Background(), memory.VisualSaveOptions{
@@ -720,16 +879,14 @@ func TestVisualMemoryRecallToolReturnsReferenceIDs(t *testing.T) {
 		t.Fatalf("SaveVisual() error: %v", err)
 	}
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	deps := &tools.ImageGenDeps{
-		SendImage:      func(string, io.Reader, string) error { return nil },
+		SendImage:      func([]tools.ImageFile, string) (string, error) { return "", nil },
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "text-model",
+		Provider:       tools.NewFalImageProvider("", "test-key", "text-model", "", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
 		VisualStore:    store,
@@ -738,7 +895,7 @@ func TestVisualMemoryRecallToolReturnsReferenceIDs(t *testing.T) {
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(store, "srv1", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(store, "srv1", 0, 0, send, react, nil, deps, 2, nil)
 
 	result, err := r.Dispatch(context.Background(), "visual_memory_recall", json.RawMessage(`{"query":"alice"}`))
 	if err != nil {
@@ -782,27 +939,23 @@ func TestImageGenUsesStoredReferenceImageIDs(t *testing.T) {
 	}))
 	defer falServer.Close()
 
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	deps := &tools.ImageGenDeps{
-		SendImage:      func(string, io.Reader, string) error { return nil },
+		SendImage:      func([]tools.ImageFile, string) (string, error) { return "", nil },
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "text-model",
-		EditModel:      "fal-ai/nano-banana-2/edit",
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "text-model", "fal-ai/nano-banana-2/edit", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
-		BaseURL:        falServer.URL,
 		VisualStore:    store,
 		ServerID:       "srv1",
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(store, "srv1", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(store, "srv1", 0, 0, send, react, nil, deps, 2, nil)
 
 	_, err = r.Dispatch(context.Background(), "generate_image", json.RawMessage(fmt.Sprintf(`{"prompt":"Alice as a detective","reference_image_ids":["%s"]}`, save.ID)))
 	if err != nil {
@@ -824,24 +977,21 @@ func TestImageGenUsesStoredReferenceImageIDs(t *testing.T) {
 }
 
 func TestImageGenEditModeWithoutSourceImagesReturnsError(t *testing.T) {
-	var imageRunning atomic.Bool
 	var wg sync.WaitGroup
 	deps := &tools.ImageGenDeps{
-		SendImage:      func(string, io.Reader, string) error { return nil },
+		SendImage:      func([]tools.ImageFile, string) (string, error) { return "", nil },
 		SendText:       func(string) error { return nil },
 		ImageWg:        &wg,
-		ImageRunning:   &imageRunning,
+		Queue:          tools.NewImageQueue(1),
 		Ctx:            context.Background(),
-		APIKey:         "test-key",
-		Model:          "text-model",
-		EditModel:      "fal-ai/nano-banana-2/edit",
+		Provider:       tools.NewFalImageProvider("", "test-key", "text-model", "fal-ai/nano-banana-2/edit", nil),
 		SafetyChecker:  true,
 		TimeoutSeconds: 5,
 	}
 
 	send := func(string) error { return nil }
 	react := func(string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, deps, 2, nil)
 
 	result, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"make it cinematic","mode":"edit"}`))
 	if err != nil {
@@ -854,7 +1004,406 @@ func TestImageGenEditModeWithoutSourceImagesReturnsError(t *testing.T) {
 	if r.ImageGenCalled {
 		t.Error("ImageGenCalled should be false when edit mode has no source images")
 	}
-	if imageRunning.Load() {
-		t.Error("ImageRunning should not be set when edit mode has no source images")
+}
+
+func TestImageGenUncheckedProviderRespectsSafetyChecker(t *testing.T) {
+	var calls atomic.Int32
+	sdServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"images":["bG9jYWw="]}`)
+	}))
+	defer sdServer.Close()
+
+	tests := []struct {
+		name            string
+		safety          bool
+		allowUnscreened bool
+		wantSent        bool
+	}{
+		{"strict channel refuses before generating", true, false, false},
+		{"strict channel allowing unscreened images", true, true, true},
+		{"nsfw channel", false, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			var wg sync.WaitGroup
+			var receivedFilename string
+			deps := &tools.ImageGenDeps{
+				SendImage: func(files []tools.ImageFile, caption string) (string, error) {
+					receivedFilename = files[0].Name
+					return "", nil
+				},
+				SendText:        func(string) error { return nil },
+				ImageWg:         &wg,
+				Queue:           tools.NewImageQueue(1),
+				Ctx:             context.Background(),
+				Provider:        tools.NewA1111ImageProvider(sdServer.URL, "", nil),
+				SafetyChecker:   tt.safety,
+				AllowUnscreened: tt.allowUnscreened,
+				TimeoutSeconds:  5,
+			}
+			r := tools.NewDefaultRegistry(nil, "", 0, 0, func(string) error { return nil }, func(string) error { return nil }, nil, deps, 2, nil)
+			result, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"a castle"}`))
+			if err != nil {
+				t.Fatalf("Dispatch() error: %v", err)
+			}
+			wg.Wait()
+
+			if !tt.wantSent {
+				if !strings.Contains(result, "cannot safety-check") || calls.Load() != 0 || r.ImageGenCalled {
+					t.Errorf("result %q with %d provider calls; want a refusal before generating", result, calls.Load())
+				}
+				return
+			}
+			if receivedFilename != "generated.png" {
+				t.Errorf("sent %q, result %q; want generated.png", receivedFilename, result)
+			}
+		})
+	}
+}
+
+func TestImageGenCustomOpenAIBaseURLIsUnscreened(t *testing.T) {
+	var calls atomic.Int32
+	localAI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"data":[{"b64_json":"bG9jYWw="}]}`)
+	}))
+	defer localAI.Close()
+
+	tests := []struct {
+		name            string
+		moderated       bool
+		allowUnscreened bool
+		wantSent        bool
+	}{
+		{"strict channel refuses before generating", false, false, false},
+		{"strict channel allowing unscreened images", false, true, true},
+		{"operator vouches for moderation", true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			var wg sync.WaitGroup
+			var sent bool
+			deps := &tools.ImageGenDeps{
+				SendImage: func(files []tools.ImageFile, caption string) (string, error) {
+					sent = true
+					return "", nil
+				},
+				SendText:        func(string) error { return nil },
+				ImageWg:         &wg,
+				Queue:           tools.NewImageQueue(1),
+				Ctx:             context.Background(),
+				Provider:        tools.NewOpenAIImageProvider(localAI.URL+"/v1", "", "", "", tt.moderated, localAI.Client()),
+				SafetyChecker:   true,
+				AllowUnscreened: tt.allowUnscreened,
+				TimeoutSeconds:  5,
+			}
+			r := tools.NewDefaultRegistry(nil, "", 0, 0, func(string) error { return nil }, func(string) error { return nil }, nil, deps, 2, nil)
+			result, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"a castle"}`))
+			if err != nil {
+				t.Fatalf("Dispatch() error: %v", err)
+			}
+			wg.Wait()
+
+			if !tt.wantSent {
+				if !strings.Contains(result, "cannot safety-check") || calls.Load() != 0 || sent {
+					t.Errorf("result %q with %d provider calls; want a refusal before generating", result, calls.Load())
+				}
+				return
+			}
+			if !sent {
+				t.Errorf("no image sent, result %q", result)
+			}
+		})
+	}
+}
+
+func TestImageGenSavesToGalleryAndReusesIt(t *testing.T) {
+	imgServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, "dragon-png")
+	}))
+	defer imgServer.Close()
+
+	var requestPath string
+	var requestBody map[string]any
+	falServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		requestBody = nil
+		json.NewDecoder(r.Body).Decode(&requestBody)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"images":[{"url":"%s/dragon.png"}],"has_nsfw_concepts":[false],"seed":9}`, imgServer.URL)
+	}))
+	defer falServer.Close()
+
+	store := newToolTestStore(t)
+	var wg sync.WaitGroup
+	newRegistry := func(queue *tools.ImageQueue) *tools.Registry {
+		deps := &tools.ImageGenDeps{
+			SendImage:       func([]tools.ImageFile, string) (string, error) { return "discord-msg-1", nil },
+			SendText:        func(string) error { return nil },
+			ImageWg:         &wg,
+			Queue:           queue,
+			Ctx:             context.Background(),
+			Provider:        tools.NewFalImageProvider(falServer.URL, "test-key", "text-model", "edit-model", nil),
+			SafetyChecker:   true,
+			TimeoutSeconds:  5,
+			Resolution:      "1K",
+			VisualStore:     store,
+			ServerID:        "srv1",
+			GalleryServerID: "srv1",
+			UserID:          "user1",
+			SourceChannelID: "chan1",
+		}
+		return tools.NewDefaultRegistry(store, "srv1", 0, 0, func(string) error { return nil }, func(string) error { return nil }, nil, deps, 2, nil)
+	}
+
+	r := newRegistry(tools.NewImageQueue(1))
+	if _, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"a dragon over the sea","aspect_ratio":"16:9"}`)); err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	wg.Wait()
+
+	rows, _, err := store.ListGeneratedImages(context.Background(), memory.GeneratedImageListOptions{ServerID: "srv1"})
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("gallery rows = %+v, err %v; want one image", rows, err)
+	}
+	row := rows[0]
+	if row.Prompt != "a dragon over the sea" || row.Model != "text-model" || row.AspectRatio != "16:9" || row.Seed != 9 ||
+		row.UserID != "user1" || row.ChannelID != "chan1" || row.MessageID != "discord-msg-1" || row.Safety != "strict" {
+		t.Errorf("gallery row = %+v", row)
+	}
+
+	result, err := r.Dispatch(context.Background(), "image_gallery_search", json.RawMessage(`{"query":"dragon"}`))
+	if err != nil {
+		t.Fatalf("image_gallery_search error: %v", err)
+	}
+	if !strings.Contains(result, row.ID) || !strings.Contains(result, "job "+row.JobID) {
+		t.Errorf("gallery search = %q, want gallery and job IDs", result)
+	}
+
+	// After a restart the queue has forgotten the job; the gallery has not.
+	r = newRegistry(tools.NewImageQueue(1))
+	if _, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"mode":"upscale","job_id":"`+row.JobID+`"}`)); err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	wg.Wait()
+	if requestPath != "/edit-model" || requestBody["resolution"] != "2K" || requestBody["aspect_ratio"] != "16:9" {
+		t.Errorf("upscale from gallery: path %q, body %v", requestPath, requestBody)
+	}
+
+	r = newRegistry(tools.NewImageQueue(1))
+	if _, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"add a rider","gallery_image_ids":["`+row.ID+`"]}`)); err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	wg.Wait()
+	urls, _ := requestBody["image_urls"].([]any)
+	if requestPath != "/edit-model" || len(urls) != 1 || urls[0] != "data:image/png;base64,"+base64.StdEncoding.EncodeToString([]byte("dragon-png")) {
+		t.Errorf("gallery edit: path %q, image_urls %v", requestPath, requestBody["image_urls"])
+	}
+}
+
+func TestImageGenRefusesFollowUpsOfLaxerImages(t *testing.T) {
+	imgServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, "png")
+	}))
+	defer imgServer.Close()
+
+	var calls atomic.Int32
+	falServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"images":[{"url":"%s/a.png"}],"has_nsfw_concepts":[true]}`, imgServer.URL)
+	}))
+	defer falServer.Close()
+
+	store := newToolTestStore(t)
+	queue := tools.NewImageQueue(1)
+	var wg sync.WaitGroup
+	newRegistry := func(safetyChecker bool) *tools.Registry {
+		deps := &tools.ImageGenDeps{
+			SendImage:       func([]tools.ImageFile, string) (string, error) { return "msg", nil },
+			SendText:        func(string) error { return nil },
+			ImageWg:         &wg,
+			Queue:           queue,
+			Ctx:             context.Background(),
+			Provider:        tools.NewFalImageProvider(falServer.URL, "test-key", "text-model", "edit-model", nil),
+			SafetyChecker:   safetyChecker,
+			TimeoutSeconds:  5,
+			VisualStore:     store,
+			ServerID:        "srv1",
+			GalleryServerID: "srv1",
+			UserID:          "user1",
+		}
+		return tools.NewDefaultRegistry(store, "srv1", 0, 0, func(string) error { return nil }, func(string) error { return nil }, nil, deps, 2, nil)
+	}
+
+	if _, err := newRegistry(false).Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"something spicy"}`)); err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	wg.Wait()
+	rows, _, err := store.ListGeneratedImages(context.Background(), memory.GeneratedImageListOptions{ServerID: "srv1"})
+	if err != nil || len(rows) != 1 || rows[0].Safety != "nsfw" {
+		t.Fatalf("gallery rows = %+v, err %v; want one nsfw image", rows, err)
+	}
+
+	strict := newRegistry(true)
+	for name, args := range map[string]string{
+		"queued job":    `{"mode":"variation","job_id":"` + rows[0].JobID + `"}`,
+		"gallery image": `{"prompt":"add a hat","gallery_image_ids":["` + rows[0].ID + `"]}`,
+	} {
+		result, err := strict.Dispatch(context.Background(), "generate_image", json.RawMessage(args))
+		if err != nil {
+			t.Fatalf("%s: Dispatch() error: %v", name, err)
+		}
+		if !strings.Contains(result, "less strict image safety settings") {
+			t.Errorf("%s: result = %q, want a refusal", name, result)
+		}
+	}
+	// After a restart the job is rebuilt from the gallery, level included.
+	queue = tools.NewImageQueue(1)
+	result, err := newRegistry(true).Dispatch(context.Background(), "generate_image", json.RawMessage(`{"mode":"upscale","job_id":"`+rows[0].JobID+`"}`))
+	if err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	if !strings.Contains(result, "less strict image safety settings") {
+		t.Errorf("gallery job: result = %q, want a refusal", result)
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("provider called %d times, want only the original generation", n)
+	}
+}
+
+func TestImageGenDailyLimit(t *testing.T) {
+	imgServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		fmt.Fprint(w, "png")
+	}))
+	defer imgServer.Close()
+
+	release := make(chan struct{})
+	var hold atomic.Bool
+	falServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hold.Load() {
+			<-release
+		}
+		var body struct {
+			NumImages int `json:"num_images"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		images := make([]string, body.NumImages)
+		nsfw := make([]string, body.NumImages)
+		for i := range images {
+			images[i] = fmt.Sprintf(`{"url":"%s/img.png"}`, imgServer.URL)
+			nsfw[i] = "false"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"images":[%s],"has_nsfw_concepts":[%s]}`, strings.Join(images, ","), strings.Join(nsfw, ","))
+	}))
+	defer falServer.Close()
+
+	store := newToolTestStore(t)
+	queue := tools.NewImageQueue(2)
+	var wg sync.WaitGroup
+	generate := func(userID string, limit int, args string) string {
+		t.Helper()
+		deps := &tools.ImageGenDeps{
+			SendImage:       func([]tools.ImageFile, string) (string, error) { return "msg", nil },
+			SendText:        func(string) error { return nil },
+			ImageWg:         &wg,
+			Queue:           queue,
+			Ctx:             context.Background(),
+			Provider:        tools.NewFalImageProvider(falServer.URL, "test-key", "text-model", "edit-model", nil),
+			SafetyChecker:   true,
+			TimeoutSeconds:  5,
+			DailyLimit:      limit,
+			VisualStore:     store,
+			GalleryServerID: "srv1",
+			UserID:          userID,
+		}
+		r := tools.NewDefaultRegistry(store, "srv1", 0, 0, func(string) error { return nil }, func(string) error { return nil }, nil, deps, 2, nil)
+		result, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(args))
+		if err != nil {
+			t.Fatalf("Dispatch() error: %v", err)
+		}
+		return result
+	}
+
+	if got := generate("user1", 3, `{"prompt":"a fox","count":2}`); !strings.Contains(got, "started") {
+		t.Fatalf("first request = %q, want started", got)
+	}
+	wg.Wait()
+	if got := generate("user1", 3, `{"prompt":"a fox","count":2}`); !strings.Contains(got, "only 1 more image(s) today") {
+		t.Errorf("over-limit request = %q, want the remaining count", got)
+	}
+	if got := generate("user1", 3, `{"prompt":"a fox"}`); !strings.Contains(got, "started") {
+		t.Fatalf("last allowed request = %q, want started", got)
+	}
+	wg.Wait()
+	if got := generate("user1", 3, `{"prompt":"a fox"}`); !strings.Contains(got, "reached their daily limit of 3") {
+		t.Errorf("request after limit = %q, want refusal", got)
+	}
+	// Deleting gallery images does not give them back.
+	rows, _, err := store.ListGeneratedImages(context.Background(), memory.GeneratedImageListOptions{ServerID: "srv1", UserID: "user1"})
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("gallery rows = %d, %v; want 3", len(rows), err)
+	}
+	for _, row := range rows {
+		if err := store.DeleteGeneratedImage(context.Background(), "srv1", row.ID); err != nil {
+			t.Fatalf("DeleteGeneratedImage: %v", err)
+		}
+	}
+	if got := generate("user1", 3, `{"prompt":"a fox"}`); !strings.Contains(got, "reached their daily limit of 3") {
+		t.Errorf("request after deleting images = %q, want refusal", got)
+	}
+	if got := generate("user1", 0, `{"prompt":"a fox"}`); !strings.Contains(got, "started") {
+		t.Errorf("unlimited request = %q, want started", got)
+	}
+	wg.Wait()
+
+	// Images of unfinished jobs count before they are sent.
+	hold.Store(true)
+	if got := generate("user2", 1, `{"prompt":"a fox"}`); !strings.Contains(got, "started") {
+		t.Fatalf("user2 first request = %q, want started", got)
+	}
+	if got := generate("user2", 1, `{"prompt":"a fox"}`); !strings.Contains(got, "reached their daily limit of 1") {
+		t.Errorf("user2 request during running job = %q, want refusal", got)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestImageGenDisabledInChannel(t *testing.T) {
+	var calls atomic.Int32
+	falServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer falServer.Close()
+
+	var wg sync.WaitGroup
+	deps := &tools.ImageGenDeps{
+		SendImage:      func([]tools.ImageFile, string) (string, error) { return "", nil },
+		SendText:       func(string) error { return nil },
+		ImageWg:        &wg,
+		Queue:          tools.NewImageQueue(1),
+		Ctx:            context.Background(),
+		Provider:       tools.NewFalImageProvider(falServer.URL, "test-key", "text-model", "edit-model", nil),
+		Disabled:       true,
+		TimeoutSeconds: 5,
+	}
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, func(string) error { return nil }, func(string) error { return nil }, nil, deps, 2, nil)
+	result, err := r.Dispatch(context.Background(), "generate_image", json.RawMessage(`{"prompt":"a fox"}`))
+	if err != nil {
+		t.Fatalf("Dispatch() error: %v", err)
+	}
+	wg.Wait()
+	if !strings.Contains(result, "turned off in this channel") || calls.Load() != 0 {
+		t.Errorf("result = %q with %d provider calls, want a refusal without calls", result, calls.Load())
 	}
 }
@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultOpenAIImageModel is used when no model is configured.
+const defaultOpenAIImageModel = "gpt-image-1"
+
+// openAIHost is the only host whose image results are trusted as moderated
+// without the operator saying so.
+const openAIHost = "api.openai.com"
+
+// openAIImageProvider generates images with an OpenAI-compatible
+// /images/generations and /images/edits API.
+type openAIImageProvider struct {
+	baseURL   string
+	apiKey    string
+	model     string
+	editModel string
+	moderated bool // the API screens prompts and outputs itself
+	client    *http.Client
+}
+
+// NewOpenAIImageProvider returns a provider for an OpenAI-compatible images
+// API. An empty baseURL uses https://api.openai.com/v1, an empty model uses
+// gpt-image-1, an empty editModel uses model and a nil client uses
+// http.DefaultClient. Results count as screened only from api.openai.com,
+// or from another server when moderated is set: self-hosted OpenAI-compatible
+// backends usually check nothing.
+func NewOpenAIImageProvider(baseURL, apiKey, model, editModel string, moderated bool, client *http.Client) ImageProvider {
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+	if model == "" {
+		model = defaultOpenAIImageModel
+	}
+	if editModel == "" {
+		editModel = model
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if u, err := url.Parse(baseURL); err == nil && strings.EqualFold(u.Hostname(), openAIHost) {
+		moderated = true
+	}
+	return &openAIImageProvider{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, model: model, editModel: editModel, moderated: moderated, client: client}
+}
+
+func (p *openAIImageProvider) Name() string { return "openai" }
+
+// Unscreened reports whether the API at the base URL is not known to
+// moderate its output.
+func (p *openAIImageProvider) Unscreened() bool { return !p.moderated }
+
+type openAIImageResponse struct {
+	Data []struct {
+		B64JSON string `json:"b64_json"`
+		URL     string `json:"url"`
+	} `json:"data"`
+}
+
+func (p *openAIImageProvider) Generate(ctx context.Context, req ImageRequest) (*ImageResult, error) {
+	var resp openAIImageResponse
+	if req.Mode == "edit" {
+		if err := p.edit(ctx, req, &resp); err != nil {
+			return nil, err
+		}
+	} else {
+		body := map[string]any{"model": p.model, "prompt": req.Prompt, "n": req.count()}
+		if size := openAIImageSize(p.model, req.AspectRatio); size != "" {
+			body["size"] = size
+		}
+		header := http.Header{"Authorization": {"Bearer " + p.apiKey}}
+		if err := postImageJSON(ctx, p.client, p.Name(), p.baseURL+"/images/generations", header, body, &resp); err != nil {
+			return nil, err
+		}
+	}
+
+	// OpenAI moderates prompts and outputs itself and refuses unsafe
+	// requests, so its images count as checked; other servers' only when
+	// the operator vouches for them.
+	result := &ImageResult{Checked: p.moderated, Model: p.model}
+	if req.Mode == "edit" {
+		result.Model = p.editModel
+	}
+	for _, d := range resp.Data {
+		switch {
+		case d.B64JSON != "":
+			data, err := base64.StdEncoding.DecodeString(d.B64JSON)
+			if err != nil {
+				return nil, fmt.Errorf("decode openai image: %w", err)
+			}
+			result.Images = append(result.Images, GeneratedImage{Data: data, ContentType: "image/png"})
+		case d.URL != "":
+			img, err := downloadImage(ctx, p.client, d.URL)
+			if err != nil {
+				return nil, err
+			}
+			result.Images = append(result.Images, img)
+		}
+	}
+	return result, nil
+}
+
+// edit sends the source images to /images/edits as a multipart form.
+func (p *openAIImageProvider) edit(ctx context.Context, req ImageRequest, out *openAIImageResponse) error {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("model", p.editModel)
+	w.WriteField("prompt", req.Prompt)
+	w.WriteField("n", strconv.Itoa(req.count()))
+	if size := openAIImageSize(p.editModel, req.AspectRatio); size != "" {
+		w.WriteField("size", size)
+	}
+	field := "image"
+	if len(req.SourceImageURLs) > 1 {
+		field = "image[]"
+	}
+	for i, src := range req.SourceImageURLs {
+		contentType, data, err := parseDataURL(src)
+		if err != nil {
+			return fmt.Errorf("source image %d: %w", i+1, err)
+		}
+		ext := ".png"
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename="source%d%s"`, field, i+1, ext))
+		h.Set("Content-Type", contentType)
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return fmt.Errorf("create form part: %w", err)
+		}
+		part.Write(data)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("close form: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/images/edits", &buf)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	httpReq.Header.Set("Content-Type", w.FormDataContentType())
+	return doImageRequest(p.client, p.Name(), httpReq, out)
+}
+
+// openAIImageSize maps an aspect ratio to the nearest size the model
+// supports, or "" to leave the size to the API.
+func openAIImageSize(model, aspectRatio string) string {
+	w, h := parseAspectRatio(aspectRatio)
+	if w <= 0 || h <= 0 {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(model, "dall-e-2"):
+		return "1024x1024"
+	case strings.HasPrefix(model, "dall-e-3"):
+		switch {
+		case w > h:
+			return "1792x1024"
+		case h > w:
+			return "1024x1792"
+		}
+		return "1024x1024"
+	}
+	switch {
+	case w > h:
+		return "1536x1024"
+	case h > w:
+		return "1024x1536"
+	}
+	return "1024x1024"
+}
@@ -0,0 +1,287 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxGeneratedImageBytes caps the size of one generated image.
+const maxGeneratedImageBytes = 20 * 1024 * 1024
+
+// ImageRequest is a provider-neutral image generation or edit request.
+type ImageRequest struct {
+	Prompt          string
+	Mode            string   // "generate" | "edit"
+	AspectRatio     string   // "auto" or W:H, e.g. "16:9"
+	Resolution      string   // "1K" | "2K" | "4K"
+	SourceImageURLs []string // base64 data URLs of the images to edit
+	SafetyChecker   bool     // ask the provider to filter unsafe content where it can
+	Count           int      // images to return, 1–4; 0 means 1
+	Seed            int64    // 0 lets the provider pick
+	Strength        float64  // how far an edit may stray from the source, 0–1; 0 uses the provider default
+}
+
+// count returns how many images req asks for.
+func (req ImageRequest) count() int {
+	return max(req.Count, 1)
+}
+
+// GeneratedImage is one image returned by a provider.
+type GeneratedImage struct {
+	Data        []byte
+	ContentType string
+	NSFW        bool // flagged by the provider's safety checker
+}
+
+// ImageResult holds the images a provider returned for a request.
+type ImageResult struct {
+	Images []GeneratedImage
+	// Checked reports whether the provider screened the images for unsafe
+	// content, so NSFW flags (or their absence) can be trusted.
+	Checked bool
+	Seed    int64  // seed the provider used; 0 when it does not say
+	Model   string // model that produced the images, if known
+}
+
+// ImageProvider generates and edits images for generate_image.
+type ImageProvider interface {
+	Name() string
+	Generate(ctx context.Context, req ImageRequest) (*ImageResult, error)
+}
+
+// unscreenedProvider is implemented by providers that never screen their
+// results for unsafe content, so strict channels can refuse them up front.
+type unscreenedProvider interface {
+	Unscreened() bool
+}
+
+// screensImages reports whether p can screen the images it generates.
+func screensImages(p ImageProvider) bool {
+	u, ok := p.(unscreenedProvider)
+	return !ok || !u.Unscreened()
+}
+
+// imageAPIError reports a non-200 response from an image API.
+type imageAPIError struct {
+	Provider string
+	Status   int
+	Body     string
+}
+
+func (e *imageAPIError) Error() string {
+	return fmt.Sprintf("%s returned HTTP %d", e.Provider, e.Status)
+}
+
+// postImageJSON sends body as JSON to url and decodes the JSON response into
+// out. header is applied to the request.
+func postImageJSON(ctx context.Context, client *http.Client, provider, url string, header http.Header, body, out any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doImageRequest(client, provider, req, out)
+}
+
+// doImageRequest sends req and decodes the JSON response into out.
+func doImageRequest(client *http.Client, provider string, req *http.Request, out any) error {
+	slog.Debug("image provider request", "provider", provider, "url", req.URL.Redacted())
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		slog.Error("image API error", "provider", provider, "status", resp.StatusCode, "body", string(body))
+		return &imageAPIError{Provider: provider, Status: resp.StatusCode, Body: string(body)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s response: %w", provider, err)
+	}
+	return nil
+}
+
+// downloadImage fetches a generated image from url.
+func downloadImage(ctx context.Context, client *http.Client, url string) (GeneratedImage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return GeneratedImage{}, fmt.Errorf("create download request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return GeneratedImage{}, fmt.Errorf("download image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return GeneratedImage{}, fmt.Errorf("download image: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxGeneratedImageBytes))
+	if err != nil {
+		return GeneratedImage{}, fmt.Errorf("read image: %w", err)
+	}
+	return GeneratedImage{Data: data, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+// imageDimensions returns the width and height for an aspect ratio at a
+// resolution: the long side is 1024 pixels for "1K", 2048 for "2K" and 4096
+// for "4K", and both sides are multiples of 64. "auto" and unknown ratios are
+// square.
+func imageDimensions(aspectRatio, resolution string) (width, height int) {
+	long := 1024
+	switch resolution {
+	case "2K":
+		long = 2048
+	case "4K":
+		long = 4096
+	}
+	w, h := parseAspectRatio(aspectRatio)
+	if w <= 0 || h <= 0 {
+		return long, long
+	}
+	round := func(v float64) int { return max(64, int(v/64+0.5)*64) }
+	if w >= h {
+		return long, round(float64(long) * h / w)
+	}
+	return round(float64(long) * w / h), long
+}
+
+// parseAspectRatio splits "W:H" into its parts, or returns zeros.
+func parseAspectRatio(s string) (w, h float64) {
+	a, b, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0
+	}
+	w, errW := strconv.ParseFloat(a, 64)
+	h, errH := strconv.ParseFloat(b, 64)
+	if errW != nil || errH != nil {
+		return 0, 0
+	}
+	return w, h
+}
+
+// falImageProvider generates images with fal.ai model endpoints.
+type falImageProvider struct {
+	baseURL   string
+	apiKey    string
+	model     string
+	editModel string
+	client    *http.Client
+}
+
+// Default fal.ai models for generation and editing.
+const (
+	defaultFalModel     = "fal-ai/flux/schnell"
+	defaultFalEditModel = "fal-ai/nano-banana-2/edit"
+)
+
+// NewFalImageProvider returns a provider for fal.ai. An empty baseURL uses
+// https://fal.run, empty models use the defaults and a nil client uses
+// http.DefaultClient.
+func NewFalImageProvider(baseURL, apiKey, model, editModel string, client *http.Client) ImageProvider {
+	if baseURL == "" {
+		baseURL = "https://fal.run"
+	}
+	if model == "" {
+		model = defaultFalModel
+	}
+	if editModel == "" {
+		editModel = defaultFalEditModel
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &falImageProvider{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, model: model, editModel: editModel, client: client}
+}
+
+func (p *falImageProvider) Name() string { return "fal" }
+
+type falRequest struct {
+	Prompt             string   `json:"prompt"`
+	NumImages          int      `json:"num_images"`
+	AspectRatio        string   `json:"aspect_ratio"`
+	OutputFormat       string   `json:"output_format"`
+	SafetyTolerance    string   `json:"safety_tolerance,omitempty"`
+	ImageURLs          []string `json:"image_urls,omitempty"`
+	Resolution         string   `json:"resolution"`
+	Seed               int64    `json:"seed,omitempty"`
+	LimitGenerations   bool     `json:"limit_generations"`
+	EnableWebSearch    bool     `json:"enable_web_search,omitempty"`
+	EnableGoogleSearch bool     `json:"enable_google_search,omitempty"`
+}
+
+type falResponse struct {
+	Images []struct {
+		URL string `json:"url"`
+	} `json:"images"`
+	HasNSFWConcepts []bool `json:"has_nsfw_concepts"`
+	Seed            int64  `json:"seed"`
+}
+
+func (p *falImageProvider) Generate(ctx context.Context, req ImageRequest) (*ImageResult, error) {
+	model := p.model
+	if req.Mode == "edit" {
+		model = p.editModel
+	}
+	resolution := req.Resolution
+	if resolution == "" {
+		resolution = "1K"
+	}
+	body := falRequest{
+		Prompt:           req.Prompt,
+		NumImages:        req.count(),
+		AspectRatio:      req.AspectRatio,
+		OutputFormat:     "png",
+		Resolution:       resolution,
+		Seed:             req.Seed,
+		LimitGenerations: true,
+	}
+	if req.Mode == "edit" {
+		body.ImageURLs = req.SourceImageURLs
+	}
+	if req.SafetyChecker {
+		body.SafetyTolerance = "4"
+	}
+
+	var falResp falResponse
+	header := http.Header{"Authorization": {"Key " + p.apiKey}}
+	if err := postImageJSON(ctx, p.client, p.Name(), fmt.Sprintf("%s/%s", p.baseURL, model), header, body, &falResp); err != nil {
+		return nil, err
+	}
+	slog.Debug("image gen fal response", "images", len(falResp.Images), "nsfw", falResp.HasNSFWConcepts)
+
+	result := &ImageResult{Checked: len(falResp.HasNSFWConcepts) > 0, Seed: falResp.Seed, Model: model}
+	for i, img := range falResp.Images {
+		if img.URL == "" {
+			continue
+		}
+		nsfw := i < len(falResp.HasNSFWConcepts) && falResp.HasNSFWConcepts[i]
+		if nsfw && req.SafetyChecker {
+			// Withheld anyway; skip the download.
+			result.Images = append(result.Images, GeneratedImage{NSFW: true})
+			continue
+		}
+		// Download right away; fal.ai URLs expire.
+		generated, err := downloadImage(ctx, p.client, img.URL)
+		if err != nil {
+			return nil, err
+		}
+		generated.NSFW = nsfw
+		result.Images = append(result.Images, generated)
+	}
+	return result, nil
+}
@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAIImageProviderGenerate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/images/generations" || r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("request %s with auth %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["model"] != "gpt-image-1" || body["prompt"] != "a lighthouse" || body["size"] != "1536x1024" {
+			t.Errorf("body = %v", body)
+		}
+		fmt.Fprintf(w, `{"data":[{"b64_json":%q}]}`, base64.StdEncoding.EncodeToString([]byte("png-bytes")))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIImageProvider(srv.URL+"/v1", "sk-test", "", "", true, srv.Client())
+	result, err := p.Generate(context.Background(), ImageRequest{Prompt: "a lighthouse", Mode: "generate", AspectRatio: "16:9"})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if !result.Checked || len(result.Images) != 1 || string(result.Images[0].Data) != "png-bytes" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestOpenAIImageProviderEdit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/images/edits" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("ParseMultipartForm: %v", err)
+		}
+		if r.FormValue("model") != "gpt-image-1" || r.FormValue("prompt") != "add a hat" {
+			t.Errorf("form = %v", r.MultipartForm.Value)
+		}
+		files := r.MultipartForm.File["image"]
+		if len(files) != 1 || files[0].Header.Get("Content-Type") != "image/png" {
+			t.Fatalf("files = %+v", files)
+		}
+		f, _ := files[0].Open()
+		data, _ := io.ReadAll(f)
+		if string(data) != "source" {
+			t.Errorf("source image = %q", data)
+		}
+		w.Write([]byte(`{"data":[{"b64_json":"ZWRpdGVk"}]}`))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIImageProvider(srv.URL, "sk-test", "", "", false, srv.Client())
+	result, err := p.Generate(context.Background(), ImageRequest{
+		Prompt:          "add a hat",
+		Mode:            "edit",
+		AspectRatio:     "auto",
+		SourceImageURLs: []string{dataURL("image/png", []byte("source"))},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(result.Images) != 1 || string(result.Images[0].Data) != "edited" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestOpenAIImageProviderScreening(t *testing.T) {
+	tests := []struct {
+		baseURL   string
+		moderated bool
+		want      bool
+	}{
+		{"", false, true},
+		{"https://api.openai.com/v1", false, true},
+		{"http://127.0.0.1:8080/v1", false, false},
+		{"http://127.0.0.1:8080/v1", true, true},
+		{"https://api.openai.com.evil.example/v1", false, false},
+	}
+	for _, tt := range tests {
+		p := NewOpenAIImageProvider(tt.baseURL, "sk-test", "", "", tt.moderated, nil)
+		if got := screensImages(p); got != tt.want {
+			t.Errorf("screensImages(%q, moderated=%v) = %v, want %v", tt.baseURL, tt.moderated, got, tt.want)
+		}
+	}
+}
+
+func TestA1111ImageProvider(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		var body a1111Request
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Width != 1024 || body.Height != 576 || body.OverrideSettings["sd_model_checkpoint"] != "sdxl.safetensors" {
+			t.Errorf("body = %+v", body)
+		}
+		if r.URL.Path == "/sdapi/v1/img2img" && (len(body.InitImages) != 1 || body.InitImages[0] != base64.StdEncoding.EncodeToString([]byte("source")) || body.DenoisingStrength != 0.3) {
+			t.Errorf("init images = %v, strength = %v", body.InitImages, body.DenoisingStrength)
+		}
+		fmt.Fprintf(w, `{"images":[%q],"info":"{\"seed\": 1234}"}`, base64.StdEncoding.EncodeToString([]byte("local")))
+	}))
+	defer srv.Close()
+
+	p := NewA1111ImageProvider(srv.URL+"/", "sdxl.safetensors", srv.Client())
+	for _, req := range []ImageRequest{
+		{Prompt: "a castle", Mode: "generate", AspectRatio: "16:9"},
+		{Prompt: "a castle at night", Mode: "edit", AspectRatio: "16:9", SourceImageURLs: []string{dataURL("image/png", []byte("source"))}, Strength: 0.3},
+	} {
+		result, err := p.Generate(context.Background(), req)
+		if err != nil {
+			t.Fatalf("Generate(%s): %v", req.Mode, err)
+		}
+		if result.Checked || len(result.Images) != 1 || string(result.Images[0].Data) != "local" || result.Seed != 1234 {
+			t.Errorf("%s result = %+v", req.Mode, result)
+		}
+	}
+	if len(paths) != 2 || paths[0] != "/sdapi/v1/txt2img" || paths[1] != "/sdapi/v1/img2img" {
+		t.Errorf("paths = %v", paths)
+	}
+}
+
+func TestImageProviderHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"bad key"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := NewOpenAIImageProvider(srv.URL, "sk-bad", "", "", false, srv.Client()).Generate(context.Background(), ImageRequest{Prompt: "x", Mode: "generate"})
+	if apiErr, ok := err.(*imageAPIError); !ok || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestImageDimensions(t *testing.T) {
+	tests := []struct {
+		ratio, resolution string
+		w, h              int
+	}{
+		{"auto", "1K", 1024, 1024},
+		{"16:9", "1K", 1024, 576},
+		{"9:16", "1K", 576, 1024},
+		{"3:2", "2K", 2048, 1344},
+		{"21:9", "", 1024, 448},
+		{"bogus", "1K", 1024, 1024},
+	}
+	for _, tt := range tests {
+		if w, h := imageDimensions(tt.ratio, tt.resolution); w != tt.w || h != tt.h {
+			t.Errorf("imageDimensions(%q, %q) = %dx%d, want %dx%d", tt.ratio, tt.resolution, w, h, tt.w, tt.h)
+		}
+	}
+}
+
+func TestOpenAIImageSize(t *testing.T) {
+	tests := []struct{ model, ratio, want string }{
+		{"gpt-image-1", "auto", ""},
+		{"gpt-image-1", "4:5", "1024x1536"},
+		{"gpt-image-1", "1:1", "1024x1024"},
+		{"dall-e-3", "16:9", "1792x1024"},
+		{"dall-e-2", "16:9", "1024x1024"},
+	}
+	for _, tt := range tests {
+		if got := openAIImageSize(tt.model, tt.ratio); got != tt.want {
+			t.Errorf("openAIImageSize(%q, %q) = %q, want %q", tt.model, tt.ratio, got, tt.want)
+		}
+	}
+}
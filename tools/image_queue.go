@@ -0,0 +1,177 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"slices"
+	"sync"
+)
+
+const (
+	// maxQueuedImageJobs bounds the generations waiting for a free slot.
+	maxQueuedImageJobs = 10
+	// maxRecentImageJobs bounds the finished jobs kept for follow-ups.
+	maxRecentImageJobs = 20
+)
+
+// ImageJob records a finished generation so that later requests can ask for
+// variations or an upscale of its outputs.
+type ImageJob struct {
+	ID          string
+	Prompt      string
+	AspectRatio string
+	Resolution  string
+	Seed        int64  // 0 when the provider does not report one
+	Safety      string // safety level of the channel the job ran in
+	Images      []GeneratedImage
+
+	reserved int // images held against the user's daily limit until the job ends
+}
+
+// ImageQueue runs an agent's image generations in request order, at most
+// limit at a time. One queue is shared by all of an agent's channels.
+type ImageQueue struct {
+	mu      sync.Mutex
+	limit   int
+	running int
+	waiting []chan struct{} // closed when the job may start; oldest first
+	recent  []*ImageJob     // oldest first
+	pending map[string]int  // images of unfinished jobs by user, for daily limits
+}
+
+// NewImageQueue returns a queue that runs up to limit generations at once.
+// A limit below 1 is treated as 1.
+func NewImageQueue(limit int) *ImageQueue {
+	return &ImageQueue{limit: max(limit, 1)}
+}
+
+// Limit returns how many generations may run at once.
+func (q *ImageQueue) Limit() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.limit
+}
+
+// SetLimit changes how many generations may run at once, so that config
+// reloads apply without a restart.
+func (q *ImageQueue) SetLimit(limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limit = max(limit, 1)
+	q.dispatch()
+}
+
+// enqueue reserves a place for a job. The returned channel is closed when
+// the job may start; position is the number of jobs ahead of it, 0 when it
+// starts right away. ok is false when the queue is full.
+func (q *ImageQueue) enqueue() (slot chan struct{}, position int, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	slot = make(chan struct{})
+	if q.running < q.limit && len(q.waiting) == 0 {
+		q.running++
+		close(slot)
+		return slot, 0, true
+	}
+	if len(q.waiting) >= maxQueuedImageJobs {
+		return nil, 0, false
+	}
+	q.waiting = append(q.waiting, slot)
+	return slot, len(q.waiting), true
+}
+
+// wait blocks until slot may start. If ctx ends first, the job gives up its
+// place and wait returns the context's error.
+func (q *ImageQueue) wait(ctx context.Context, slot chan struct{}) error {
+	select {
+	case <-slot:
+		return nil
+	case <-ctx.Done():
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := slices.Index(q.waiting, slot); i >= 0 {
+		q.waiting = slices.Delete(q.waiting, i, i+1)
+	} else {
+		// Started just as ctx ended; hand the slot on.
+		q.running--
+		q.dispatch()
+	}
+	return ctx.Err()
+}
+
+// release frees the slot of a finished job.
+func (q *ImageQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.running--
+	q.dispatch()
+}
+
+// dispatch starts waiting jobs while slots are free. Callers hold q.mu.
+func (q *ImageQueue) dispatch() {
+	for q.running < q.limit && len(q.waiting) > 0 {
+		close(q.waiting[0])
+		q.waiting = q.waiting[1:]
+		q.running++
+	}
+}
+
+// reserve holds n images of userID's daily limit for a job that has not
+// finished yet. allowed is how many more images the user may generate today
+// apart from unfinished jobs; left is the room that remains for new jobs. ok
+// is false, and nothing is held, when n does not fit.
+func (q *ImageQueue) reserve(userID string, n, allowed int) (left int, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	left = allowed - q.pending[userID]
+	if n > left {
+		return max(left, 0), false
+	}
+	if q.pending == nil {
+		q.pending = make(map[string]int)
+	}
+	q.pending[userID] += n
+	return left, true
+}
+
+// unreserve releases images held by reserve once their job has ended.
+func (q *ImageQueue) unreserve(userID string, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending[userID] -= n
+	if q.pending[userID] <= 0 {
+		delete(q.pending, userID)
+	}
+}
+
+// record keeps job for follow-ups, dropping the oldest beyond
+// maxRecentImageJobs.
+func (q *ImageQueue) record(job *ImageJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.recent = append(q.recent, job)
+	if len(q.recent) > maxRecentImageJobs {
+		q.recent = q.recent[len(q.recent)-maxRecentImageJobs:]
+	}
+}
+
+// Job returns the recent job with id, or nil if it is unknown or expired.
+func (q *ImageQueue) Job(id string) *ImageJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.recent {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// newImageJobID returns a short random job ID users can quote back.
+func newImageJobID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"context"
+	"testing"
+)
+
+func TestImageQueue(t *testing.T) {
+	q := NewImageQueue(1)
+	first, pos, ok := q.enqueue()
+	if !ok || pos != 0 {
+		t.Fatalf("first enqueue: position %d, ok %v; want 0, true", pos, ok)
+	}
+	if err := q.wait(context.Background(), first); err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+	second, pos, _ := q.enqueue()
+	third, pos3, _ := q.enqueue()
+	if pos != 1 || pos3 != 2 {
+		t.Fatalf("positions = %d, %d; want 1, 2", pos, pos3)
+	}
+
+	// A cancelled job gives up its place without taking a slot.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := q.wait(ctx, second); err == nil {
+		t.Fatal("wait with cancelled context should fail")
+	}
+	q.release()
+	select {
+	case <-third:
+	default:
+		t.Fatal("third job should start once the first is released")
+	}
+
+	q.SetLimit(2)
+	if _, pos, _ := q.enqueue(); pos != 0 {
+		t.Errorf("enqueue with a free slot: position %d, want 0", pos)
+	}
+	for range maxQueuedImageJobs {
+		q.enqueue()
+	}
+	if _, _, ok := q.enqueue(); ok {
+		t.Error("enqueue on a full queue should fail")
+	}
+}
+
+func TestImageQueueRecentJobs(t *testing.T) {
+	q := NewImageQueue(1)
+	for i := range maxRecentImageJobs + 1 {
+		q.record(&ImageJob{ID: string(rune('a' + i))})
+	}
+	if q.Job("a") != nil {
+		t.Error("oldest job should have been dropped")
+	}
+	if q.Job("b") == nil {
+		t.Error("recent job should be kept")
+	}
+}
@@ -0,0 +1,226 @@
+// Package fakemcp is a minimal in-process MCP server for testing the MCP
+// client. It serves the same tools and resources over stdio and over the
+// streamable HTTP transport.
+package fakemcp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Tool pages returned by tools/list; two pages exercise pagination.
+var toolPages = [][]map[string]any{
+	{
+		{
+			"name":        "add",
+			"description": "Add two numbers",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"a": map[string]any{"type": "number"},
+					"b": map[string]any{"type": "number"},
+				},
+				"required": []string{"a", "b"},
+			},
+		},
+		{"name": "boom", "description": "Always fails"},
+	},
+	{
+		{"name": "snapshot", "description": "Returns mixed content"},
+	},
+}
+
+// WelcomeText is the content of the memo://welcome resource.
+const WelcomeText = "Welcome to the fake MCP server."
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// Server is a fake MCP server. The zero value is not usable; call New.
+type Server struct {
+	mu       sync.Mutex
+	sessions map[string]bool
+	nextSess int
+	calls    map[string]int // method → count
+}
+
+// New returns a fake server with no sessions.
+func New() *Server {
+	return &Server{sessions: make(map[string]bool), calls: make(map[string]int)}
+}
+
+// Calls reports how many times method was requested.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// ExpireSessions forgets every HTTP session, as a restarted server would.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.sessions)
+}
+
+// handle answers one request. It returns nil result and error for
+// notifications.
+func (s *Server) handle(req request) (result any, rpcErr map[string]any) {
+	s.mu.Lock()
+	s.calls[req.Method]++
+	s.mu.Unlock()
+
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"protocolVersion": "2025-03-26",
+			"capabilities":    map[string]any{"tools": map[string]any{}, "resources": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "fakemcp", "version": "0.1"},
+		}, nil
+	case "tools/list":
+		var p struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(req.Params, &p)
+		if p.Cursor == "page2" {
+			return map[string]any{"tools": toolPages[1]}, nil
+		}
+		return map[string]any{"tools": toolPages[0], "nextCursor": "page2"}, nil
+	case "tools/call":
+		var p struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				A float64 `json:"a"`
+				B float64 `json:"b"`
+			} `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, map[string]any{"code": -32602, "message": "invalid params"}
+		}
+		switch p.Name {
+		case "add":
+			return textResult(fmt.Sprint(p.Arguments.A+p.Arguments.B), false), nil
+		case "boom":
+			return textResult("boom failed", true), nil
+		case "snapshot":
+			return map[string]any{"content": []map[string]any{
+				{"type": "text", "text": "snapshot taken"},
+				{"type": "image", "data": "iVBORw0KGgo=", "mimeType": "image/png"},
+			}}, nil
+		}
+		return nil, map[string]any{"code": -32602, "message": "unknown tool " + p.Name}
+	case "resources/list":
+		return map[string]any{"resources": []map[string]any{
+			{"uri": "memo://welcome", "name": "welcome", "description": "Greeting", "mimeType": "text/plain"},
+		}}, nil
+	case "resources/read":
+		var p struct {
+			URI string `json:"uri"`
+		}
+		json.Unmarshal(req.Params, &p)
+		if p.URI != "memo://welcome" {
+			return nil, map[string]any{"code": -32002, "message": "resource not found"}
+		}
+		return map[string]any{"contents": []map[string]any{
+			{"uri": p.URI, "mimeType": "text/plain", "text": WelcomeText},
+		}}, nil
+	case "ping":
+		return map[string]any{}, nil
+	}
+	if req.ID == nil {
+		return nil, nil // notification
+	}
+	return nil, map[string]any{"code": -32601, "message": "method not found"}
+}
+
+func textResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+func response(id int64, result any, rpcErr map[string]any) []byte {
+	msg := map[string]any{"jsonrpc": "2.0", "id": id}
+	if rpcErr != nil {
+		msg["error"] = rpcErr
+	} else {
+		msg["result"] = result
+	}
+	b, _ := json.Marshal(msg)
+	return b
+}
+
+// ServeStdio serves newline-delimited JSON-RPC from r to w until r ends.
+func (s *Server) ServeStdio(r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var req request
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			continue
+		}
+		result, rpcErr := s.handle(req)
+		if req.ID == nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", response(*req.ID, result, rpcErr)); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// ServeHTTP implements the streamable HTTP transport. Sessions are issued on
+// initialize; requests with an unknown session get 404. tools/call replies as
+// an event stream preceded by a progress notification, everything else as JSON.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method == "initialize" {
+		s.mu.Lock()
+		s.nextSess++
+		id := fmt.Sprintf("session-%d", s.nextSess)
+		s.sessions[id] = true
+		s.mu.Unlock()
+		w.Header().Set("Mcp-Session-Id", id)
+	} else {
+		s.mu.Lock()
+		ok := s.sessions[r.Header.Get("Mcp-Session-Id")]
+		s.mu.Unlock()
+		if !ok {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+
+	result, rpcErr := s.handle(req)
+	if req.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	body := response(*req.ID, result, rpcErr)
+	if req.Method == "tools/call" {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", `{"jsonrpc":"2.0","method":"notifications/progress","params":{"progress":1}}`)
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", body)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
@@ -0,0 +1,107 @@
+package tools
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is one segment of a parsed JSONPath: a member name, an array
+// index, or a wildcard over all elements/members.
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the subset of JSONPath used for response extraction:
+// a leading "$" followed by ".name", "['name']", "[n]" (negative counts from
+// the end), ".*" or "[*]".
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("path must start with $")
+	}
+	var steps []jsonPathStep
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("empty member name")
+			case "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			default:
+				steps = append(steps, jsonPathStep{key: name})
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed [")
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q", inner)
+				}
+				steps = append(steps, jsonPathStep{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest[0])
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath applies steps to a decoded JSON document and returns every
+// matching value. Missing members and out-of-range indexes match nothing.
+func evalJSONPath(doc any, steps []jsonPathStep) []any {
+	current := []any{doc}
+	for _, step := range steps {
+		var next []any
+		for _, v := range current {
+			switch node := v.(type) {
+			case map[string]any:
+				if step.wildcard {
+					for _, k := range slices.Sorted(maps.Keys(node)) {
+						next = append(next, node[k])
+					}
+				} else if child, ok := node[step.key]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []any:
+				switch {
+				case step.wildcard:
+					next = append(next, node...)
+				case step.isIndex:
+					i := step.index
+					if i < 0 {
+						i += len(node)
+					}
+					if i >= 0 && i < len(node) {
+						next = append(next, node[i])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
@@ -0,0 +1,345 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// JSON-RPC 2.0 plumbing shared by tool plugins and MCP servers.
+
+const (
+	maxProcessBackoff = time.Minute
+	maxRPCLine        = 4 << 20 // 4 MB per JSON-RPC message
+)
+
+// rpcCaller sends JSON-RPC requests and notifications over some transport.
+type rpcCaller interface {
+	call(ctx context.Context, method string, params, out any) error
+	notify(ctx context.Context, method string, params any) error
+}
+
+// rpcError is a JSON-RPC 2.0 error object.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return fmt.Sprintf("%s (code %d)", e.Message, e.Code) }
+
+// rpcResponse is a JSON-RPC 2.0 response. Method is only set when the peer
+// sends a request or notification of its own instead.
+type rpcResponse struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// decodeResult unmarshals a response's result into out (which may be nil).
+func (resp *rpcResponse) decodeResult(method string, out any) error {
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		return fmt.Errorf("decode %s result: %w", method, err)
+	}
+	return nil
+}
+
+// rpcConn is a JSON-RPC 2.0 client over newline-delimited JSON streams.
+type rpcConn struct {
+	w      io.Writer
+	wmu    sync.Mutex
+	nextID atomic.Int64
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	pending map[int64]chan rpcResponse
+
+	readerDone chan struct{} // closed when the output stream ends
+	readErr    error         // why reading stopped early; set before readerDone closes
+	done       chan struct{} // closed by close; err is set before
+	err        error
+}
+
+func newRPCConn(w io.Writer, r io.Reader, logger *slog.Logger) *rpcConn {
+	c := &rpcConn{
+		w:          w,
+		logger:     logger,
+		pending:    make(map[int64]chan rpcResponse),
+		readerDone: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go c.read(r)
+	return c
+}
+
+// read dispatches responses to waiting calls until the stream ends.
+// Notifications from the peer are ignored; its requests are answered by
+// answerPeer.
+func (c *rpcConn) read(r io.Reader) {
+	defer close(c.readerDone)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxRPCLine)
+	for sc.Scan() {
+		var resp rpcResponse
+		if err := json.Unmarshal(sc.Bytes(), &resp); err != nil {
+			c.logger.Debug("ignoring malformed JSON-RPC line", "error", err)
+			continue
+		}
+		if resp.ID == nil {
+			continue
+		}
+		if resp.Method != "" {
+			c.answerPeer(*resp.ID, resp.Method)
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[*resp.ID]
+		delete(c.pending, *resp.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- resp
+		}
+	}
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("message too large (over %d bytes)", maxRPCLine)
+		}
+		c.readErr = err
+	}
+}
+
+// answerPeer replies to a request sent by the peer. Only ping is supported;
+// anything else (e.g. MCP sampling) gets a method-not-found error.
+func (c *rpcConn) answerPeer(id int64, method string) {
+	msg := map[string]any{"jsonrpc": "2.0", "id": id}
+	if method == "ping" {
+		msg["result"] = struct{}{}
+	} else {
+		msg["error"] = rpcError{Code: -32601, Message: "method not found: " + method}
+	}
+	if err := c.write(msg); err != nil {
+		c.logger.Debug("failed to answer peer request", "method", method, "error", err)
+	}
+}
+
+// close marks the connection dead with err, failing every later call.
+func (c *rpcConn) close(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	c.err = err
+	close(c.done)
+}
+
+func (c *rpcConn) write(msg map[string]any) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal message: %w", err)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	return nil
+}
+
+// call sends a request and decodes its result into out (which may be nil).
+func (c *rpcConn) call(ctx context.Context, method string, params, out any) error {
+	id := c.nextID.Add(1)
+	ch := make(chan rpcResponse, 1)
+	c.mu.Lock()
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		return resp.decodeResult(method, out)
+	case <-c.done:
+		return fmt.Errorf("process exited: %w", c.err)
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s timed out", method)
+		}
+		return ctx.Err()
+	}
+}
+
+// notify sends a notification, which gets no response.
+func (c *rpcConn) notify(_ context.Context, method string, params any) error {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	return c.write(msg)
+}
+
+// supervisor keeps a JSON-RPC subprocess running until its context is
+// cancelled, restarting it with exponential backoff after crashes. After every
+// start, setup runs against the new connection (handshake, discovery); the
+// connection is only handed out once setup succeeds.
+type supervisor struct {
+	kind   string // "plugin" or "MCP server", used in log messages
+	spec   PluginSpec
+	ctx    context.Context
+	cancel context.CancelFunc
+	ready  chan struct{} // closed after the first launch attempt
+	logger *slog.Logger
+	setup  func(ctx context.Context, c rpcCaller) error
+
+	mu   sync.Mutex
+	conn *rpcConn // nil while the process is down
+}
+
+func newSupervisor(parent context.Context, kind string, spec PluginSpec, logger *slog.Logger, setup func(ctx context.Context, c rpcCaller) error) *supervisor {
+	ctx, cancel := context.WithCancel(parent)
+	return &supervisor{kind: kind, spec: spec, ctx: ctx, cancel: cancel, ready: make(chan struct{}), logger: logger, setup: setup}
+}
+
+// launch starts supervising in the background.
+func (s *supervisor) launch() { go s.run() }
+
+func (s *supervisor) timeout() time.Duration {
+	if s.spec.Timeout > 0 {
+		return s.spec.Timeout
+	}
+	return defaultPluginTimeout
+}
+
+// caller returns the live connection, or an error while the process is down.
+func (s *supervisor) caller() (rpcCaller, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil, fmt.Errorf("%s %s is not running", s.kind, s.spec.Name)
+	}
+	return s.conn, nil
+}
+
+func (s *supervisor) run() {
+	var readyOnce sync.Once
+	markReady := func() { readyOnce.Do(func() { close(s.ready) }) }
+	defer markReady()
+
+	backoff := time.Second
+	for {
+		started := time.Now()
+		conn, err := s.start()
+		markReady()
+		if err != nil {
+			s.logger.Warn(s.kind+" failed to start", "error", err)
+		} else {
+			<-conn.done
+			s.mu.Lock()
+			s.conn = nil
+			s.mu.Unlock()
+			if s.ctx.Err() != nil {
+				return
+			}
+			s.logger.Warn(s.kind+" exited, restarting", "error", conn.err, "backoff", backoff)
+			if time.Since(started) > maxProcessBackoff {
+				backoff = time.Second // it ran for a while; not a crash loop
+			}
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxProcessBackoff)
+	}
+}
+
+// start launches the process and runs setup against it.
+func (s *supervisor) start() (*rpcConn, error) {
+	cmd := exec.CommandContext(s.ctx, s.spec.Command, s.spec.Args...)
+	cmd.Env = append(os.Environ(), s.spec.Env...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stderr pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start process: %w", err)
+	}
+	s.logger.Info(s.kind+" started", "pid", cmd.Process.Pid)
+
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		s.logStderr(stderr)
+	}()
+	conn := newRPCConn(stdin, stdout, s.logger)
+	go func() {
+		// Wait closes the pipes, so both readers must finish first. A
+		// process whose output can no longer be read would block writing
+		// it, so it is killed and restarted.
+		<-conn.readerDone
+		if conn.readErr != nil {
+			_ = cmd.Process.Kill()
+		}
+		<-stderrDone
+		err := cmd.Wait()
+		if conn.readErr != nil {
+			err = conn.readErr
+		}
+		conn.close(err)
+	}()
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.timeout())
+	defer cancel()
+	if err := s.setup(ctx, conn); err != nil {
+		_ = cmd.Process.Kill()
+		<-conn.done
+		return nil, err
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	return conn, nil
+}
+
+// logStderr logs each line the process writes to stderr. After a line too
+// long to log, the rest is discarded so the process never blocks on it.
+func (s *supervisor) logStderr(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxRPCLine)
+	for sc.Scan() {
+		s.logger.Info(s.kind+" stderr", "line", sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		s.logger.Warn(s.kind+" stderr unreadable, discarding the rest", "error", err)
+		_, _ = io.Copy(io.Discard, r)
+	}
+}
@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tomasmach/vespra/memory"
+)
+
+const defaultKnowledgeResults = 5
+
+type knowledgeSearchTool struct {
+	store    *memory.Store
+	serverID string
+}
+
+func (t *knowledgeSearchTool) Name() string { return "knowledge_search" }
+func (t *knowledgeSearchTool) Description() string {
+	return "Search the server's knowledge base (rules, FAQ, lore and other uploaded documents). " +
+		"Use it for questions the documents may answer, and cite the bracketed source of each passage you rely on."
+}
+func (t *knowledgeSearchTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+        "type": "object",
+        "properties": {
+            "query": {"type": "string", "description": "What to look up."},
+            "limit": {"type": "integer", "minimum": 1, "maximum": 10, "description": "Max passages to return (default 5)."}
+        },
+        "required": ["query"]
+    }`)
+}
+func (t *knowledgeSearchTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", err
+	}
+	if p.Limit == 0 {
+		p.Limit = defaultKnowledgeResults
+	}
+	// Like memory_recall, an explicit search is not filtered by a similarity threshold.
+	chunks, err := t.store.SearchKnowledge(ctx, p.Query, t.serverID, p.Limit, 0)
+	if err != nil {
+		return "", err
+	}
+	if len(chunks) == 0 {
+		return "No matching passages in the knowledge base.", nil
+	}
+	var sb strings.Builder
+	for _, c := range chunks {
+		fmt.Fprintf(&sb, "[%s]\n%s\n\n", c.Citation(), c.Content)
+	}
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
@@ -0,0 +1,59 @@
+package tools_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/tomasmach/vespra/tools"
+)
+
+func TestKnowledgeSearchTool(t *testing.T) {
+	ctx := context.Background()
+	store := newToolTestStore(t)
+	send := func(string) error { return nil }
+	react := func(string) error { return nil }
+
+	if _, err := store.AddKnowledge(ctx, "guild", "faq.md", "# Events\n\nMovie night is every Friday.\n\n# Roles\n\nAsk a moderator for roles."); err != nil {
+		t.Fatalf("AddKnowledge: %v", err)
+	}
+
+	if names := tools.NewDefaultRegistry(store, "guild", 0, 5, send, react, nil, nil, 2, nil).Names(); slices.Contains(names, "knowledge_search") {
+		t.Fatalf("knowledge_search registered without a knowledge scope: %v", names)
+	}
+
+	// Persona memory scopes differ from the server ID; the knowledge scope is separate.
+	reg := tools.NewDefaultRegistry(store, "guild#luna", 0, 5, send, react, nil, nil, 2, &tools.AgentToolsDeps{KnowledgeScope: "guild"})
+	out, err := reg.Dispatch(ctx, "knowledge_search", []byte(`{"query":"movie night","limit":1}`))
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if out != "[faq.md › Events]\nMovie night is every Friday." {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestKnowledgeSearchProvider(t *testing.T) {
+	ctx := context.Background()
+	store := newToolTestStore(t)
+	if _, err := store.AddKnowledge(ctx, "guild", "faq.md", "# Events\n\nMovie night is every Friday."); err != nil {
+		t.Fatalf("AddKnowledge: %v", err)
+	}
+
+	p := tools.NewKnowledgeSearch(store, "guild", 0)
+	if p.Name() != "knowledge" {
+		t.Errorf("Name() = %q", p.Name())
+	}
+	results, err := p.Search(ctx, "movie night", 3)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	want := tools.SearchResult{Title: "faq.md › Events", Snippet: "Movie night is every Friday."}
+	if len(results) != 1 || results[0] != want {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+
+	if results, _ := tools.NewKnowledgeSearch(store, "other", 0).Search(ctx, "movie night", 3); len(results) != 0 {
+		t.Errorf("other server results = %+v, want none", results)
+	}
+}
@@ -0,0 +1,512 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Model Context Protocol client
+//
+// MCP servers are reached either as a subprocess over stdio (newline-delimited
+// JSON-RPC, supervised like plugins) or over the streamable HTTP transport. After
+// the initialize handshake the server's tools are listed and exposed as
+// "<server>_<tool>"; if the server offers resources, a "<server>_read_resource"
+// tool lets the model read them by URI.
+
+const (
+	mcpProtocolVersion = "2025-03-26"
+	mcpMaxPages        = 20 // cap on paginated list requests
+	mcpRetryInterval   = 30 * time.Second
+	maxToolNameLen     = 64
+)
+
+// MCPServerSpec describes an MCP server. Exactly one of Command (stdio
+// transport) and URL (streamable HTTP transport) is set.
+type MCPServerSpec struct {
+	Name    string
+	Command string
+	Args    []string
+	Env     []string // extra KEY=VALUE entries on top of Vespra's environment
+	URL     string
+	Headers map[string]string // sent with every HTTP request, e.g. Authorization
+	Timeout time.Duration     // per call; 0 = 30s
+}
+
+func (s MCPServerSpec) equal(o MCPServerSpec) bool {
+	return s.Name == o.Name && s.Command == o.Command && slices.Equal(s.Args, o.Args) &&
+		slices.Equal(s.Env, o.Env) && s.URL == o.URL && maps.Equal(s.Headers, o.Headers) &&
+		s.Timeout == o.Timeout
+}
+
+func (s MCPServerSpec) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return defaultPluginTimeout
+}
+
+// MCPSelection picks which of a server's tools an agent exposes. Tools lists
+// remote tool names; "read_resource" selects the resource reader. An empty
+// list exposes everything the server offers.
+type MCPSelection struct {
+	Server MCPServerSpec
+	Tools  []string
+}
+
+func (s MCPSelection) allows(name string) bool {
+	return len(s.Tools) == 0 || slices.Contains(s.Tools, name)
+}
+
+// RegisterMCP adds the selected tools of each MCP server to r, connecting to
+// the server for scope on first use. The first connection is awaited for up
+// to the server's call timeout. MCP tools never replace tools already in r.
+// Clients of scope for servers not in selections are closed.
+func (h *PluginHost) RegisterMCP(ctx context.Context, r *Registry, scope string, selections []MCPSelection) {
+	h.retireMCP(scope, selections)
+	for _, sel := range selections {
+		c := h.mcpClient(scope, sel.Server)
+		waitCtx, cancel := context.WithTimeout(ctx, sel.Server.timeout())
+		err := c.waitReady(waitCtx)
+		cancel()
+		if err != nil {
+			c.logger.Warn("MCP server not ready, skipping its tools", "error", err)
+			continue
+		}
+		defs, resources := c.catalog()
+		for _, def := range defs {
+			if sel.allows(def.Name) {
+				r.registerExternal(&mcpTool{client: c, def: def}, c.logger)
+			}
+		}
+		if len(resources) > 0 && sel.allows("read_resource") {
+			r.registerExternal(&mcpResourceTool{client: c, resources: resources}, c.logger)
+		}
+	}
+}
+
+// mcpClient returns the client for scope and spec, replacing one whose spec
+// changed since it was created.
+func (h *PluginHost) mcpClient(scope string, spec MCPServerSpec) *mcpClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := scope + "/" + spec.Name
+	if c, ok := h.mcp[key]; ok {
+		if c.spec.equal(spec) {
+			return c
+		}
+		c.close()
+	}
+	c := newMCPClient(h.ctx, spec, slog.With("server_id", scope, "mcp_server", spec.Name))
+	h.mcp[key] = c
+	return c
+}
+
+// retireMCP closes and forgets the clients of scope whose servers are not in
+// selections, e.g. after they were removed from the config.
+func (h *PluginHost) retireMCP(scope string, selections []MCPSelection) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, c := range h.mcp {
+		name, ok := strings.CutPrefix(key, scope+"/")
+		if !ok || slices.ContainsFunc(selections, func(s MCPSelection) bool { return s.Server.Name == name }) {
+			continue
+		}
+		c.close()
+		delete(h.mcp, key)
+	}
+}
+
+// mcpToolDef is one entry of a tools/list result.
+type mcpToolDef struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+// mcpResource is one entry of a resources/list result.
+type mcpResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MimeType    string `json:"mimeType"`
+}
+
+// mcpClient is a connection to one MCP server for one scope. Stdio servers
+// run under a supervisor that redoes the handshake after every restart; HTTP
+// servers connect lazily and reconnect when their session expires.
+type mcpClient struct {
+	spec   MCPServerSpec
+	logger *slog.Logger
+	sup    *supervisor // stdio transport
+	http   *mcpHTTP    // streamable HTTP transport
+
+	connMu      sync.Mutex // serializes HTTP (re)connects
+	connected   bool
+	lastAttempt time.Time
+
+	mu        sync.Mutex
+	tools     []mcpToolDef
+	resources []mcpResource
+}
+
+func newMCPClient(ctx context.Context, spec MCPServerSpec, logger *slog.Logger) *mcpClient {
+	c := &mcpClient{spec: spec, logger: logger}
+	if spec.URL != "" {
+		c.http = newMCPHTTP(spec.URL, spec.Headers)
+		return c
+	}
+	c.sup = newSupervisor(ctx, "MCP server", PluginSpec{
+		Name:    spec.Name,
+		Command: spec.Command,
+		Args:    spec.Args,
+		Env:     spec.Env,
+		Timeout: spec.Timeout,
+	}, logger, c.setup)
+	c.sup.launch()
+	return c
+}
+
+func (c *mcpClient) close() {
+	if c.sup != nil {
+		c.sup.cancel()
+	}
+}
+
+// waitReady waits for the first stdio launch, or connects an HTTP server.
+func (c *mcpClient) waitReady(ctx context.Context) error {
+	if c.sup != nil {
+		select {
+		case <-c.sup.ready:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	_, err := c.connect(ctx, false)
+	return err
+}
+
+func (c *mcpClient) catalog() ([]mcpToolDef, []mcpResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tools, c.resources
+}
+
+// connect returns the HTTP transport after making sure a session exists.
+// Failed attempts are retried at most every mcpRetryInterval; force starts
+// a new session regardless (used when the server forgot ours).
+func (c *mcpClient) connect(ctx context.Context, force bool) (rpcCaller, error) {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.connected && !force {
+		return c.http, nil
+	}
+	if !force && !c.lastAttempt.IsZero() && time.Since(c.lastAttempt) < mcpRetryInterval {
+		return nil, fmt.Errorf("MCP server %s is unavailable", c.spec.Name)
+	}
+	c.lastAttempt = time.Now()
+	c.connected = false
+	c.http.resetSession()
+	if err := c.setup(ctx, c.http); err != nil {
+		return nil, err
+	}
+	c.connected = true
+	return c.http, nil
+}
+
+// setup performs the initialize handshake and lists tools and resources.
+func (c *mcpClient) setup(ctx context.Context, rc rpcCaller) error {
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		Capabilities    struct {
+			Tools     *struct{} `json:"tools"`
+			Resources *struct{} `json:"resources"`
+		} `json:"capabilities"`
+		ServerInfo struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	err := rc.call(ctx, "initialize", map[string]any{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "vespra", "version": "1.0"},
+	}, &init)
+	if err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+	if c.http != nil {
+		c.http.setProtocolVersion(init.ProtocolVersion)
+	}
+	if err := rc.notify(ctx, "notifications/initialized", nil); err != nil {
+		return fmt.Errorf("send initialized: %w", err)
+	}
+
+	var defs []mcpToolDef
+	if init.Capabilities.Tools != nil {
+		err := listPages(ctx, rc, "tools/list", func(raw json.RawMessage) (string, error) {
+			var page struct {
+				Tools      []mcpToolDef `json:"tools"`
+				NextCursor string       `json:"nextCursor"`
+			}
+			if err := json.Unmarshal(raw, &page); err != nil {
+				return "", err
+			}
+			defs = append(defs, page.Tools...)
+			return page.NextCursor, nil
+		})
+		if err != nil {
+			return fmt.Errorf("list tools: %w", err)
+		}
+	}
+	for i := range defs {
+		if len(defs[i].InputSchema) == 0 {
+			defs[i].InputSchema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+	}
+
+	var resources []mcpResource
+	if init.Capabilities.Resources != nil {
+		err := listPages(ctx, rc, "resources/list", func(raw json.RawMessage) (string, error) {
+			var page struct {
+				Resources  []mcpResource `json:"resources"`
+				NextCursor string        `json:"nextCursor"`
+			}
+			if err := json.Unmarshal(raw, &page); err != nil {
+				return "", err
+			}
+			resources = append(resources, page.Resources...)
+			return page.NextCursor, nil
+		})
+		if err != nil {
+			// Resources are optional; keep the tools.
+			c.logger.Warn("failed to list MCP resources", "error", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.tools = defs
+	c.resources = resources
+	c.mu.Unlock()
+	c.logger.Info("MCP server connected", "server", init.ServerInfo.Name, "protocol", init.ProtocolVersion, "tools", len(defs), "resources", len(resources))
+	return nil
+}
+
+// listPages follows nextCursor through a paginated list method, handing each
+// raw result to page, which returns the next cursor.
+func listPages(ctx context.Context, rc rpcCaller, method string, page func(json.RawMessage) (string, error)) error {
+	cursor := ""
+	for range mcpMaxPages {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var raw json.RawMessage
+		if err := rc.call(ctx, method, params, &raw); err != nil {
+			return err
+		}
+		next, err := page(raw)
+		if err != nil {
+			return fmt.Errorf("decode %s page: %w", method, err)
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+	}
+	return nil
+}
+
+// call invokes method with the per-call timeout. An expired HTTP session is
+// re-established once before giving up.
+func (c *mcpClient) call(ctx context.Context, method string, params, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.spec.timeout())
+	defer cancel()
+
+	if c.sup != nil {
+		rc, err := c.sup.caller()
+		if err != nil {
+			return err
+		}
+		return rc.call(ctx, method, params, out)
+	}
+
+	rc, err := c.connect(ctx, false)
+	if err != nil {
+		return err
+	}
+	err = rc.call(ctx, method, params, out)
+	if errors.Is(err, errMCPSessionExpired) {
+		c.logger.Info("MCP session expired, reconnecting")
+		if rc, err = c.connect(ctx, true); err != nil {
+			return err
+		}
+		err = rc.call(ctx, method, params, out)
+	}
+	return err
+}
+
+// mcpContent is one content block of a tool result or resource.
+type mcpContent struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	MimeType string `json:"mimeType"`
+	URI      string `json:"uri"`
+	Blob     string `json:"blob"`
+	Resource *struct {
+		URI      string `json:"uri"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	} `json:"resource"`
+}
+
+// renderMCPContent flattens content blocks into text for the model. Binary
+// blocks become placeholders since tool results are text-only.
+func renderMCPContent(blocks []mcpContent) string {
+	parts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		switch {
+		case b.Type == "text" || (b.Type == "" && b.Text != ""):
+			parts = append(parts, b.Text)
+		case b.Type == "image" || b.Type == "audio":
+			parts = append(parts, fmt.Sprintf("[%s content: %s]", b.Type, b.MimeType))
+		case b.Type == "resource" && b.Resource != nil:
+			if b.Resource.Text != "" {
+				parts = append(parts, b.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource: %s]", b.Resource.URI))
+			}
+		case b.Type == "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource link: %s]", b.URI))
+		case b.Blob != "":
+			parts = append(parts, fmt.Sprintf("[binary content: %s]", b.MimeType))
+		}
+	}
+	return truncateOutput(strings.Join(parts, "\n"))
+}
+
+func truncateOutput(text string) string {
+	return truncateText(text, maxOutputChars)
+}
+
+// mcpToolName builds the registry name for a server's tool, restricted to the
+// characters and length LLM APIs accept for function names.
+func mcpToolName(server, tool string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, server+"_"+tool)
+	if len(name) > maxToolNameLen {
+		name = name[:maxToolNameLen]
+	}
+	return name
+}
+
+// mcpTool adapts one MCP server tool to the Tool interface.
+type mcpTool struct {
+	client *mcpClient
+	def    mcpToolDef
+}
+
+func (t *mcpTool) Name() string                { return mcpToolName(t.client.spec.Name, t.def.Name) }
+func (t *mcpTool) Description() string         { return t.def.Description }
+func (t *mcpTool) Parameters() json.RawMessage { return t.def.InputSchema }
+func (t *mcpTool) Timeout() time.Duration      { return t.client.spec.timeout() + timeoutGrace }
+func (t *mcpTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	if len(args) == 0 {
+		args = json.RawMessage(`{}`)
+	}
+	var res struct {
+		Content           []mcpContent    `json:"content"`
+		StructuredContent json.RawMessage `json:"structuredContent"`
+		IsError           bool            `json:"isError"`
+	}
+	if err := t.client.call(ctx, "tools/call", map[string]any{"name": t.def.Name, "arguments": args}, &res); err != nil {
+		return "", fmt.Errorf("mcp %s: %w", t.client.spec.Name, err)
+	}
+	text := renderMCPContent(res.Content)
+	if text == "" && len(res.StructuredContent) > 0 {
+		text = truncateOutput(string(res.StructuredContent))
+	}
+	if res.IsError {
+		return "", fmt.Errorf("mcp %s: tool %s failed: %s", t.client.spec.Name, t.def.Name, text)
+	}
+	return text, nil
+}
+
+// mcpResourceTool lets the model read a server's resources by URI.
+type mcpResourceTool struct {
+	client    *mcpClient
+	resources []mcpResource
+}
+
+func (t *mcpResourceTool) Name() string {
+	return mcpToolName(t.client.spec.Name, "read_resource")
+}
+
+func (t *mcpResourceTool) Description() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Read a resource from the %s MCP server. Available resources:", t.client.spec.Name)
+	for _, r := range t.resources {
+		fmt.Fprintf(&b, "\n- %s", r.URI)
+		if r.Name != "" {
+			fmt.Fprintf(&b, " (%s)", r.Name)
+		}
+		if r.Description != "" {
+			fmt.Fprintf(&b, ": %s", r.Description)
+		}
+	}
+	return b.String()
+}
+
+func (t *mcpResourceTool) Parameters() json.RawMessage {
+	uris := make([]string, len(t.resources))
+	for i, r := range t.resources {
+		uris[i] = r.URI
+	}
+	schema, _ := json.Marshal(map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"uri": map[string]any{"type": "string", "enum": uris, "description": "URI of the resource to read"},
+		},
+		"required": []string{"uri"},
+	})
+	return schema
+}
+
+func (t *mcpResourceTool) Timeout() time.Duration {
+	return t.client.spec.timeout() + timeoutGrace
+}
+
+func (t *mcpResourceTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", fmt.Errorf("parse args: %w", err)
+	}
+	if p.URI == "" {
+		return "", fmt.Errorf("uri is required")
+	}
+	var res struct {
+		Contents []mcpContent `json:"contents"`
+	}
+	if err := t.client.call(ctx, "resources/read", map[string]any{"uri": p.URI}, &res); err != nil {
+		return "", fmt.Errorf("mcp %s: %w", t.client.spec.Name, err)
+	}
+	text := renderMCPContent(res.Contents)
+	if text == "" {
+		return "Resource is empty.", nil
+	}
+	return text, nil
+}
@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// errMCPSessionExpired is returned when the server no longer knows our
+// session; the caller starts a new one.
+var errMCPSessionExpired = errors.New("MCP session expired")
+
+// mcpHTTP is the client side of the MCP streamable HTTP transport: every
+// message is POSTed to one endpoint and the reply arrives either as a JSON
+// body or as a server-sent event stream.
+type mcpHTTP struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	nextID  atomic.Int64
+
+	mu        sync.Mutex
+	sessionID string
+	version   string
+}
+
+func newMCPHTTP(url string, headers map[string]string) *mcpHTTP {
+	// No client timeout: calls are bounded by their context.
+	return &mcpHTTP{url: url, headers: headers, client: &http.Client{}}
+}
+
+func (t *mcpHTTP) resetSession() {
+	t.mu.Lock()
+	t.sessionID = ""
+	t.version = ""
+	t.mu.Unlock()
+}
+
+func (t *mcpHTTP) setProtocolVersion(v string) {
+	t.mu.Lock()
+	t.version = v
+	t.mu.Unlock()
+}
+
+// post sends one JSON-RPC message and returns the response, which the caller
+// must close.
+func (t *mcpHTTP) post(ctx context.Context, msg map[string]any) (*http.Response, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshal message: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.mu.Lock()
+	sessionID, version := t.sessionID, t.version
+	t.mu.Unlock()
+	if sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	if version != "" {
+		req.Header.Set("Mcp-Protocol-Version", version)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%v timed out", msg["method"])
+		}
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound && sessionID != "" {
+		resp.Body.Close()
+		return nil, errMCPSessionExpired
+	}
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// call sends a request and decodes its result into out (which may be nil).
+func (t *mcpHTTP) call(ctx context.Context, method string, params, out any) error {
+	id := t.nextID.Add(1)
+	resp, err := t.post(ctx, map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var msg rpcResponse
+	if mediaType == "text/event-stream" {
+		msg, err = readSSEResponse(resp.Body, id)
+	} else {
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxRPCLine)).Decode(&msg)
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%s timed out", method)
+		}
+		return fmt.Errorf("read %s response: %w", method, err)
+	}
+	return msg.decodeResult(method, out)
+}
+
+// readSSEResponse reads server-sent events until the response with id
+// arrives. Other messages on the stream (progress notifications, server
+// requests) are skipped.
+func readSSEResponse(r io.Reader, id int64) (rpcResponse, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxRPCLine)
+	var data strings.Builder
+	for sc.Scan() {
+		line := sc.Text()
+		if d, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(d, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue // other fields (event, id, retry) or a blank line between events
+		}
+		var msg rpcResponse
+		err := json.Unmarshal([]byte(data.String()), &msg)
+		data.Reset()
+		if err == nil && msg.Method == "" && msg.ID != nil && *msg.ID == id {
+			return msg, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return rpcResponse{}, err
+	}
+	if data.Len() > 0 { // final event without a trailing blank line
+		var msg rpcResponse
+		if json.Unmarshal([]byte(data.String()), &msg) == nil && msg.ID != nil && *msg.ID == id {
+			return msg, nil
+		}
+	}
+	return rpcResponse{}, io.ErrUnexpectedEOF
+}
+
+// notify sends a notification; the server acknowledges it with 202.
+func (t *mcpHTTP) notify(ctx context.Context, method string, params any) error {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
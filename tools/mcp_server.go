@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// MCPServer exposes the tools of a Registry to MCP clients, over stdio or the
+// streamable HTTP transport. The HTTP side is stateless: it issues no session
+// IDs and answers every request with a JSON body.
+type MCPServer struct {
+	name    string
+	version string
+	reg     *Registry
+}
+
+// NewMCPServer creates an MCP server that advertises itself as name/version
+// and serves the tools in reg.
+func NewMCPServer(name, version string, reg *Registry) *MCPServer {
+	return &MCPServer{name: name, version: version, reg: reg}
+}
+
+type mcpRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// handle answers one request; it returns nil for notifications.
+func (s *MCPServer) handle(ctx context.Context, req mcpRequest) map[string]any {
+	if len(req.ID) == 0 {
+		return nil
+	}
+	result, rpcErr := s.dispatch(ctx, req)
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	if rpcErr != nil {
+		resp["error"] = rpcErr
+	} else {
+		resp["result"] = result
+	}
+	return resp
+}
+
+func (s *MCPServer) dispatch(ctx context.Context, req mcpRequest) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &p)
+		version := mcpProtocolVersion
+		if p.ProtocolVersion != "" && p.ProtocolVersion < version {
+			version = p.ProtocolVersion // date-stamped versions order lexically
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": s.name, "version": s.version},
+		}, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		names := make([]string, 0, len(s.reg.tools))
+		for name := range s.reg.tools {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		list := make([]map[string]any, len(names))
+		for i, name := range names {
+			t := s.reg.tools[name]
+			list[i] = map[string]any{"name": name, "description": t.Description(), "inputSchema": t.Parameters()}
+		}
+		return map[string]any{"tools": list}, nil
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &rpcError{Code: -32602, Message: "invalid params"}
+		}
+		if _, ok := s.reg.tools[p.Name]; !ok {
+			return nil, &rpcError{Code: -32602, Message: "unknown tool: " + p.Name}
+		}
+		if len(p.Arguments) == 0 {
+			p.Arguments = json.RawMessage(`{}`)
+		}
+		text, err := s.reg.Dispatch(ctx, p.Name, p.Arguments)
+		if err != nil {
+			slog.Warn("mcp tool call failed", "tool", p.Name, "error", err)
+			return mcpTextResult(err.Error(), true), nil
+		}
+		return mcpTextResult(text, false), nil
+	}
+	return nil, &rpcError{Code: -32601, Message: "method not found: " + req.Method}
+}
+
+func mcpTextResult(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// ServeStdio serves newline-delimited JSON-RPC from r, writing responses to
+// w, until r ends or ctx is cancelled.
+func (s *MCPServer) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxRPCLine)
+	enc := json.NewEncoder(w)
+	for sc.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var req mcpRequest
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			if err := enc.Encode(map[string]any{"jsonrpc": "2.0", "id": nil, "error": rpcError{Code: -32700, Message: "parse error"}}); err != nil {
+				return fmt.Errorf("write response: %w", err)
+			}
+			continue
+		}
+		if resp := s.handle(ctx, req); resp != nil {
+			if err := enc.Encode(resp); err != nil {
+				return fmt.Errorf("write response: %w", err)
+			}
+		}
+	}
+	return sc.Err()
+}
+
+// ServeHTTP implements the POST side of the streamable HTTP transport. Server
+// initiated streams (GET) are not offered.
+func (s *MCPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var req mcpRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRPCLine)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON-RPC message", http.StatusBadRequest)
+		return
+	}
+	resp := s.handle(r.Context(), req)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,81 @@
+package tools_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomasmach/vespra/tools"
+)
+
+// TestMemoryMCPServerOverHTTP drives the memory MCP server with Vespra's own
+// MCP client: tools are discovered with the server name prefix and calls reach
+// the agent's memory scope only.
+func TestMemoryMCPServerOverHTTP(t *testing.T) {
+	store := newToolTestStore(t)
+	srv := httptest.NewServer(tools.NewMCPServer("vespra-memory", "1.0", tools.NewMemoryServerRegistry(store, "srv1", 0.85, 10)))
+	defer srv.Close()
+
+	reg := newMCPRegistry(t, tools.MCPSelection{
+		Server: tools.MCPServerSpec{Name: "vespra", URL: srv.URL, Timeout: 5 * time.Second},
+	})
+	names := toolNames(reg)
+	for _, want := range []string{"vespra_memory_recall", "vespra_memory_list", "vespra_memory_save", "vespra_memory_forget", "vespra_visual_memory_list"} {
+		if !names[want] {
+			t.Fatalf("tool %q not served; got %v", want, names)
+		}
+	}
+
+	ctx := context.Background()
+	got, err := reg.Dispatch(ctx, "vespra_memory_save", json.RawMessage(`{"content":"Alice likes green tea","user_id":"u1"}`))
+	if err != nil || !strings.HasPrefix(got, "Memory saved") {
+		t.Fatalf("memory_save = %q, %v", got, err)
+	}
+	if _, err := store.Save(ctx, "Bob owns a kayak", "other-server", "u2", "", 0.5, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = reg.Dispatch(ctx, "vespra_memory_list", json.RawMessage(`{}`))
+	if err != nil || !strings.Contains(got, "Alice likes green tea") || strings.Contains(got, "kayak") {
+		t.Errorf("memory_list = %q, %v; want only srv1 memories", got, err)
+	}
+
+	got, err = reg.Dispatch(ctx, "vespra_visual_memory_list", json.RawMessage(`{}`))
+	if err != nil || got != "No visual memories found." {
+		t.Errorf("visual_memory_list = %q, %v", got, err)
+	}
+}
+
+func TestMCPServerStdio(t *testing.T) {
+	store := newToolTestStore(t)
+	server := tools.NewMCPServer("vespra-memory", "1.0", tools.NewMemoryServerRegistry(store, "srv1", 0.85, 10))
+
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"memory_forget","arguments":{"memory_id":"missing"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"nope"}}`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := server.ServeStdio(context.Background(), strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d responses, want 3 (none for the notification):\n%s", len(lines), out.String())
+	}
+	if !strings.Contains(lines[0], `"protocolVersion":"2024-11-05"`) {
+		t.Errorf("initialize did not negotiate the client's older version: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "Memory not found.") {
+		t.Errorf("memory_forget response = %s", lines[1])
+	}
+	if !strings.Contains(lines[2], `"error"`) || !strings.Contains(lines[2], "unknown tool") {
+		t.Errorf("unknown tool response = %s, want a JSON-RPC error", lines[2])
+	}
+}
@@ -0,0 +1,119 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tomasmach/vespra/tools"
+	"github.com/tomasmach/vespra/tools/internal/fakemcp"
+)
+
+// TestMCPHelperProcess is not a real test: it is the fake stdio MCP server
+// that the MCP tests launch by re-executing the test binary.
+func TestMCPHelperProcess(t *testing.T) {
+	if os.Getenv("VESPRA_MCP_HELPER") != "1" {
+		return
+	}
+	fakemcp.New().ServeStdio(os.Stdin, os.Stdout)
+	os.Exit(0)
+}
+
+func newMCPRegistry(t *testing.T, selections ...tools.MCPSelection) *tools.Registry {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	host := tools.NewPluginHost(ctx)
+	reg := tools.NewRegistry()
+	host.RegisterMCP(context.Background(), reg, "srv1", selections)
+	return reg
+}
+
+func toolNames(reg *tools.Registry) map[string]bool {
+	names := make(map[string]bool)
+	for _, def := range reg.Definitions() {
+		names[def.Function.Name] = true
+	}
+	return names
+}
+
+func TestMCPStdioToolsAndResources(t *testing.T) {
+	reg := newMCPRegistry(t, tools.MCPSelection{Server: tools.MCPServerSpec{
+		Name:    "fake",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestMCPHelperProcess$"},
+		Env:     []string{"VESPRA_MCP_HELPER=1"},
+		Timeout: 5 * time.Second,
+	}})
+
+	names := toolNames(reg)
+	for _, want := range []string{"fake_add", "fake_boom", "fake_snapshot", "fake_read_resource"} {
+		if !names[want] {
+			t.Fatalf("tool %q not registered; got %v", want, names)
+		}
+	}
+
+	got, err := reg.Dispatch(context.Background(), "fake_add", json.RawMessage(`{"a":2,"b":3}`))
+	if err != nil || got != "5" {
+		t.Errorf("fake_add = %q, %v; want %q", got, err, "5")
+	}
+
+	if _, err := reg.Dispatch(context.Background(), "fake_boom", nil); err == nil || !strings.Contains(err.Error(), "boom failed") {
+		t.Errorf("fake_boom error = %v, want the tool's error text", err)
+	}
+
+	got, err = reg.Dispatch(context.Background(), "fake_snapshot", nil)
+	if err != nil || !strings.Contains(got, "snapshot taken") || !strings.Contains(got, "[image content: image/png]") {
+		t.Errorf("fake_snapshot = %q, %v; want text plus an image placeholder", got, err)
+	}
+
+	got, err = reg.Dispatch(context.Background(), "fake_read_resource", json.RawMessage(`{"uri":"memo://welcome"}`))
+	if err != nil || got != fakemcp.WelcomeText {
+		t.Errorf("fake_read_resource = %q, %v; want %q", got, err, fakemcp.WelcomeText)
+	}
+}
+
+func TestMCPHTTPToolSelection(t *testing.T) {
+	srv := httptest.NewServer(fakemcp.New())
+	defer srv.Close()
+
+	reg := newMCPRegistry(t, tools.MCPSelection{
+		Server: tools.MCPServerSpec{Name: "remote", URL: srv.URL, Timeout: 5 * time.Second},
+		Tools:  []string{"add"},
+	})
+
+	names := toolNames(reg)
+	if len(names) != 1 || !names["remote_add"] {
+		t.Fatalf("registered tools = %v, want only remote_add", names)
+	}
+	got, err := reg.Dispatch(context.Background(), "remote_add", json.RawMessage(`{"a":1.5,"b":1}`))
+	if err != nil || got != "2.5" {
+		t.Errorf("remote_add = %q, %v; want %q", got, err, "2.5")
+	}
+}
+
+func TestMCPHTTPReconnectsAfterSessionExpiry(t *testing.T) {
+	fake := fakemcp.New()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	reg := newMCPRegistry(t, tools.MCPSelection{
+		Server: tools.MCPServerSpec{Name: "remote", URL: srv.URL, Timeout: 5 * time.Second},
+	})
+	if _, err := reg.Dispatch(context.Background(), "remote_add", json.RawMessage(`{"a":1,"b":1}`)); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+
+	fake.ExpireSessions()
+	got, err := reg.Dispatch(context.Background(), "remote_add", json.RawMessage(`{"a":2,"b":2}`))
+	if err != nil || got != "4" {
+		t.Fatalf("call after expiry = %q, %v; want %q", got, err, "4")
+	}
+	if n := fake.Calls("initialize"); n != 2 {
+		t.Errorf("initialize called %d times, want 2", n)
+	}
+}
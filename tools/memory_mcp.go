@@ -0,0 +1,132 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tomasmach/vespra/memory"
+)
+
+// NewMemoryServerRegistry returns the tools Vespra serves to external MCP
+// clients: recall, list, save, update and forget over an agent's memories, plus
+// visual memory listing. serverID is the agent's memory scope.
+func NewMemoryServerRegistry(store *memory.Store, serverID string, dedupThreshold float64, defaultRecallLimit int) *Registry {
+	r := NewRegistry()
+	r.Register(&memorySaveTool{store: store, serverID: serverID, dedupThreshold: dedupThreshold})
+	r.Register(&memoryRecallTool{store: store, serverID: serverID, defaultTopN: defaultRecallLimit})
+	r.Register(&memoryForgetTool{store: store, serverID: serverID})
+	// MCP clients act for the operator, so updates skip the ownership check.
+	r.Register(&memoryUpdateTool{store: store, serverID: serverID})
+	r.Register(&memoryListTool{store: store, serverID: serverID})
+	r.Register(&visualMemoryListTool{store: store, serverID: serverID})
+	return r
+}
+
+type memoryListTool struct {
+	store    *memory.Store
+	serverID string
+}
+
+func (t *memoryListTool) Name() string { return "memory_list" }
+func (t *memoryListTool) Description() string {
+	return "List saved memories, newest first, optionally filtered by user or text."
+}
+func (t *memoryListTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+        "type": "object",
+        "properties": {
+            "user_id": {"type": "string", "description": "Only memories about this Discord user ID."},
+            "query": {"type": "string", "description": "Only memories containing this text."},
+            "limit": {"type": "integer", "description": "Max results, default 50."},
+            "offset": {"type": "integer", "description": "Results to skip, for paging."}
+        }
+    }`)
+}
+func (t *memoryListTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		UserID string `json:"user_id"`
+		Query  string `json:"query"`
+		Limit  int    `json:"limit"`
+		Offset int    `json:"offset"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", err
+	}
+	rows, total, err := t.store.List(ctx, memory.ListOptions{
+		ServerID: t.serverID,
+		UserID:   p.UserID,
+		Query:    p.Query,
+		Limit:    p.Limit,
+		Offset:   p.Offset,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "No memories found.", nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d memories:\n", len(rows), total)
+	for _, r := range rows {
+		fmt.Fprintf(&sb, "[%s] (importance: %.1f, %s", r.ID, r.Importance, r.CreatedAt.Format("2006-01-02"))
+		if r.UserID != "" {
+			fmt.Fprintf(&sb, ", user: %s", r.UserID)
+		}
+		fmt.Fprintf(&sb, ") %s\n", r.Content)
+	}
+	return sb.String(), nil
+}
+
+type visualMemoryListTool struct {
+	store    *memory.Store
+	serverID string
+}
+
+func (t *visualMemoryListTool) Name() string { return "visual_memory_list" }
+func (t *visualMemoryListTool) Description() string {
+	return "List saved visual references (people, pets, objects), newest first, optionally filtered by label."
+}
+func (t *visualMemoryListTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+        "type": "object",
+        "properties": {
+            "query": {"type": "string", "description": "Only references whose label or description contains this text."},
+            "limit": {"type": "integer", "description": "Max results, default 50."},
+            "offset": {"type": "integer", "description": "Results to skip, for paging."}
+        }
+    }`)
+}
+func (t *visualMemoryListTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		Query  string `json:"query"`
+		Limit  int    `json:"limit"`
+		Offset int    `json:"offset"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", err
+	}
+	rows, total, err := t.store.ListVisual(ctx, memory.VisualListOptions{
+		ServerID: t.serverID,
+		Query:    p.Query,
+		Limit:    p.Limit,
+		Offset:   p.Offset,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "No visual memories found.", nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d of %d visual memories:\n", len(rows), total)
+	for _, row := range rows {
+		fmt.Fprintf(&sb, "[%s] %s (%s, %d bytes)", row.ID, row.Label, row.ContentType, row.SizeBytes)
+		if row.Description != "" {
+			fmt.Fprintf(&sb, " — %s", row.Description)
+		}
+		fmt.Fprintln(&sb)
+	}
+	return sb.String(), nil
+}
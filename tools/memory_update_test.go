@@ -0,0 +1,67 @@
+package tools_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tomasmach/vespra/tools"
+)
+
+func TestMemoryUpdateTool(t *testing.T) {
+	ctx := context.Background()
+	store := newToolTestStore(t)
+	send := func(string) error { return nil }
+	react := func(string) error { return nil }
+
+	saved, err := store.Save(ctx, "alice likes tea", "guild", "alice", "chan", 0.5, 0)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reg := tools.NewDefaultRegistry(store, "guild", 0, 5, send, react, nil, nil, 2, nil)
+	reg.Requesters = []string{"bob"}
+
+	out, err := reg.Dispatch(ctx, "memory_update", []byte(`{"memory_id":"`+saved.ID+`","content":"alice likes coffee"}`))
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if !strings.Contains(out, "<@alice>") || !strings.Contains(out, "confirm") {
+		t.Fatalf("expected confirmation request, got %q", out)
+	}
+	row, err := store.Get(ctx, "guild", saved.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if row.Content != "alice likes tea" {
+		t.Fatalf("content changed without confirmation: %q", row.Content)
+	}
+
+	reg.Requesters = []string{"bob", "alice"}
+	out, err = reg.Dispatch(ctx, "memory_update", []byte(`{"memory_id":"`+saved.ID+`","content":"alice likes coffee","importance":0.9}`))
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if !strings.Contains(out, "Memory updated (id: "+saved.ID+")") {
+		t.Fatalf("unexpected output %q", out)
+	}
+	row, err = store.Get(ctx, "guild", saved.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if row.Content != "alice likes coffee" || row.Importance != 0.9 {
+		t.Errorf("row = %q (importance %v), want updated content and importance 0.9", row.Content, row.Importance)
+	}
+
+	out, err = reg.Dispatch(ctx, "memory_update", []byte(`{"memory_id":"missing","importance":0.1}`))
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if out != "Memory not found." {
+		t.Errorf("missing memory: got %q", out)
+	}
+
+	if _, err := reg.Dispatch(ctx, "memory_update", []byte(`{"memory_id":"`+saved.ID+`","importance":2}`)); err == nil {
+		t.Error("expected out-of-range importance to be rejected")
+	}
+}
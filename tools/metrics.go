@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// callOutcome classifies a finished Dispatch for the metrics.
+type callOutcome int
+
+const (
+	outcomeOK callOutcome = iota
+	outcomeError
+	outcomeInvalidArgs
+	outcomeTimeout
+	outcomePanic
+)
+
+// ToolStats summarizes the calls of one tool since startup, across all agents.
+type ToolStats struct {
+	Tool         string  `json:"tool"`
+	Calls        int64   `json:"calls"`
+	Errors       int64   `json:"errors"` // every failed call, including the kinds below
+	InvalidArgs  int64   `json:"invalid_args"`
+	Timeouts     int64   `json:"timeouts"`
+	Panics       int64   `json:"panics"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"` // calls rejected for invalid arguments are not timed
+	MaxLatencyMs float64 `json:"max_latency_ms"`
+}
+
+type toolCounters struct {
+	calls, errors, invalidArgs, timeouts, panics int64
+	timed                                        int64
+	total, max                                   time.Duration
+}
+
+var toolMetrics = struct {
+	mu     sync.Mutex
+	byTool map[string]*toolCounters
+}{byTool: make(map[string]*toolCounters)}
+
+// recordCall adds one Dispatch outcome to the metrics. latency is ignored for
+// calls rejected before they ran.
+func recordCall(tool string, latency time.Duration, outcome callOutcome) {
+	toolMetrics.mu.Lock()
+	defer toolMetrics.mu.Unlock()
+	c := toolMetrics.byTool[tool]
+	if c == nil {
+		c = &toolCounters{}
+		toolMetrics.byTool[tool] = c
+	}
+	c.calls++
+	switch outcome {
+	case outcomeError:
+		c.errors++
+	case outcomeInvalidArgs:
+		c.errors++
+		c.invalidArgs++
+		return
+	case outcomeTimeout:
+		c.errors++
+		c.timeouts++
+	case outcomePanic:
+		c.errors++
+		c.panics++
+	}
+	c.timed++
+	c.total += latency
+	c.max = max(c.max, latency)
+}
+
+// Stats returns the per-tool call metrics, sorted by tool name.
+func Stats() []ToolStats {
+	toolMetrics.mu.Lock()
+	defer toolMetrics.mu.Unlock()
+	out := make([]ToolStats, 0, len(toolMetrics.byTool))
+	for name, c := range toolMetrics.byTool {
+		s := ToolStats{
+			Tool:         name,
+			Calls:        c.calls,
+			Errors:       c.errors,
+			InvalidArgs:  c.invalidArgs,
+			Timeouts:     c.timeouts,
+			Panics:       c.panics,
+			MaxLatencyMs: float64(c.max) / float64(time.Millisecond),
+		}
+		if c.timed > 0 {
+			s.AvgLatencyMs = float64(c.total) / float64(c.timed) / float64(time.Millisecond)
+		}
+		out = append(out, s)
+	}
+	slices.SortFunc(out, func(a, b ToolStats) int { return strings.Compare(a.Tool, b.Tool) })
+	return out
+}
@@ -0,0 +1,197 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plugin protocol
+//
+// A plugin is an executable that speaks JSON-RPC 2.0 over stdin/stdout, one
+// JSON object per line. Vespra sends requests; the plugin answers each with a
+// response carrying the same id. Two methods are used:
+//
+//	tools/list → {"tools": [{"name": "...", "description": "...", "parameters": {JSON schema}}]}
+//	tools/call   {"name": "...", "arguments": {...}} → {"content": "text shown to the model"}
+//
+// A JSON-RPC error response to tools/call is reported to the model as a tool
+// error. Lines written to stderr are logged. If the process exits it is
+// restarted with exponential backoff and its tools are listed again.
+
+const defaultPluginTimeout = 30 * time.Second
+
+// PluginSpec describes an external tool plugin to launch.
+type PluginSpec struct {
+	Name    string
+	Command string
+	Args    []string
+	Env     []string      // extra KEY=VALUE entries on top of Vespra's environment
+	Timeout time.Duration // per call; 0 = 30s
+}
+
+func (s PluginSpec) equal(o PluginSpec) bool {
+	return s.Name == o.Name && s.Command == o.Command && slices.Equal(s.Args, o.Args) &&
+		slices.Equal(s.Env, o.Env) && s.Timeout == o.Timeout
+}
+
+// PluginHost launches and supervises plugin processes and MCP server
+// connections, one per scope (agent) and server, and registers their tools
+// into registries.
+type PluginHost struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	plugins map[string]*plugin    // key: scope + "/" + spec name
+	mcp     map[string]*mcpClient // key: scope + "/" + spec name
+}
+
+// NewPluginHost creates a host whose plugin processes live until ctx is cancelled.
+func NewPluginHost(ctx context.Context) *PluginHost {
+	return &PluginHost{ctx: ctx, plugins: make(map[string]*plugin), mcp: make(map[string]*mcpClient)}
+}
+
+// Register adds the tools of each plugin in specs to r, launching the plugin
+// for scope on first use. The first launch is awaited for up to the plugin's
+// call timeout. Plugin tools never replace tools already in r. Plugins of
+// scope that are not in specs are stopped.
+func (h *PluginHost) Register(ctx context.Context, r *Registry, scope string, specs []PluginSpec) {
+	h.retirePlugins(scope, specs)
+	for _, spec := range specs {
+		p := h.plugin(scope, spec)
+		select {
+		case <-p.sup.ready:
+		case <-ctx.Done():
+			return
+		case <-time.After(p.sup.timeout()):
+			p.sup.logger.Warn("plugin not ready, skipping its tools")
+			continue
+		}
+		for _, def := range p.toolDefs() {
+			r.registerExternal(&pluginTool{plugin: p, def: def}, p.sup.logger)
+		}
+	}
+}
+
+// plugin returns the supervised plugin for scope and spec, replacing a running
+// one whose spec changed since it was launched.
+func (h *PluginHost) plugin(scope string, spec PluginSpec) *plugin {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := scope + "/" + spec.Name
+	if p, ok := h.plugins[key]; ok {
+		if p.sup.spec.equal(spec) {
+			return p
+		}
+		p.sup.cancel()
+	}
+	p := &plugin{}
+	p.sup = newSupervisor(h.ctx, "plugin", spec, slog.With("server_id", scope, "plugin", spec.Name), p.listTools)
+	h.plugins[key] = p
+	p.sup.launch()
+	return p
+}
+
+// retirePlugins stops and forgets the plugins of scope whose names are not
+// in specs, e.g. after they were removed from the config.
+func (h *PluginHost) retirePlugins(scope string, specs []PluginSpec) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for key, p := range h.plugins {
+		name, ok := strings.CutPrefix(key, scope+"/")
+		if !ok || slices.ContainsFunc(specs, func(s PluginSpec) bool { return s.Name == name }) {
+			continue
+		}
+		p.sup.cancel()
+		delete(h.plugins, key)
+	}
+}
+
+// registerExternal adds a plugin or MCP tool unless a tool with the same name
+// is already registered; built-in tools always win.
+func (r *Registry) registerExternal(t Tool, logger *slog.Logger) {
+	if _, exists := r.tools[t.Name()]; exists {
+		logger.Warn("external tool shadows an existing tool, skipping", "tool", t.Name())
+		return
+	}
+	r.Register(t)
+}
+
+// pluginToolDef is one entry of a tools/list result.
+type pluginToolDef struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// plugin is a supervised plugin process for one scope.
+type plugin struct {
+	sup *supervisor
+
+	mu    sync.Mutex
+	tools []pluginToolDef
+}
+
+func (p *plugin) toolDefs() []pluginToolDef {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tools
+}
+
+// listTools runs after every (re)start and refreshes the plugin's tools.
+func (p *plugin) listTools(ctx context.Context, c rpcCaller) error {
+	var list struct {
+		Tools []pluginToolDef `json:"tools"`
+	}
+	if err := c.call(ctx, "tools/list", struct{}{}, &list); err != nil {
+		return fmt.Errorf("list tools: %w", err)
+	}
+	for i := range list.Tools {
+		if len(list.Tools[i].Parameters) == 0 {
+			list.Tools[i].Parameters = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+	}
+	p.mu.Lock()
+	p.tools = list.Tools
+	p.mu.Unlock()
+	p.sup.logger.Info("plugin tools listed", "count", len(list.Tools))
+	return nil
+}
+
+// call invokes a plugin tool with the per-call timeout.
+func (p *plugin) call(ctx context.Context, name string, args json.RawMessage) (string, error) {
+	c, err := p.sup.caller()
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		args = json.RawMessage(`{}`)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.sup.timeout())
+	defer cancel()
+	var res struct {
+		Content string `json:"content"`
+	}
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": args}, &res); err != nil {
+		return "", fmt.Errorf("plugin %s: %w", p.sup.spec.Name, err)
+	}
+	return res.Content, nil
+}
+
+// pluginTool adapts one plugin tool to the Tool interface.
+type pluginTool struct {
+	plugin *plugin
+	def    pluginToolDef
+}
+
+func (t *pluginTool) Name() string                { return t.def.Name }
+func (t *pluginTool) Description() string         { return t.def.Description }
+func (t *pluginTool) Parameters() json.RawMessage { return t.def.Parameters }
+func (t *pluginTool) Timeout() time.Duration      { return t.plugin.sup.timeout() + timeoutGrace }
+func (t *pluginTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	return t.plugin.call(ctx, t.def.Name, args)
+}
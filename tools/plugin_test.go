@@ -0,0 +1,271 @@
+package tools_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tomasmach/vespra/tools"
+)
+
+// TestPluginHelperProcess is not a real test: it is the fake plugin that the
+// plugin tests launch by re-executing the test binary.
+func TestPluginHelperProcess(t *testing.T) {
+	if os.Getenv("VESPRA_PLUGIN_HELPER") != "1" {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "helper plugin ready")
+	sc := bufio.NewScanner(os.Stdin)
+	for sc.Scan() {
+		var req struct {
+			ID     int64  `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Name      string          `json:"name"`
+				Arguments json.RawMessage `json:"arguments"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			continue
+		}
+		var result any
+		var rpcErr any
+		switch req.Method {
+		case "tools/list":
+			result = map[string]any{"tools": []map[string]any{
+				{"name": "echo", "description": "Echo the text back", "parameters": map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}}},
+				{"name": "sleep", "description": "Never answers in time"},
+				{"name": "fail", "description": "Always fails"},
+				{"name": "crash", "description": "Exits the plugin"},
+				{"name": "flood", "description": "Answers with a line over the message limit"},
+				{"name": "shout", "description": "Writes a line over the message limit to stderr"},
+				{"name": "pid", "description": "Reports the plugin's process ID"},
+			}}
+		case "tools/call":
+			switch req.Params.Name {
+			case "echo":
+				var args struct {
+					Text string `json:"text"`
+				}
+				json.Unmarshal(req.Params.Arguments, &args)
+				result = map[string]any{"content": "echo: " + args.Text}
+			case "sleep":
+				time.Sleep(10 * time.Second)
+				continue
+			case "fail":
+				rpcErr = map[string]any{"code": -32000, "message": "backend unavailable"}
+			case "crash":
+				fmt.Fprintln(os.Stderr, "helper plugin crashing")
+				os.Exit(3)
+			case "flood":
+				result = map[string]any{"content": strings.Repeat("x", 5<<20)}
+			case "pid":
+				result = map[string]any{"content": strconv.Itoa(os.Getpid())}
+			case "shout":
+				fmt.Fprintln(os.Stderr, strings.Repeat("x", 5<<20))
+				result = map[string]any{"content": "shouted"}
+			}
+		}
+		resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+		if rpcErr != nil {
+			resp["error"] = rpcErr
+		} else {
+			resp["result"] = result
+		}
+		line, _ := json.Marshal(resp)
+		fmt.Println(string(line))
+	}
+	os.Exit(0)
+}
+
+func helperSpec(timeout time.Duration) tools.PluginSpec {
+	return tools.PluginSpec{
+		Name:    "helper",
+		Command: os.Args[0],
+		Args:    []string{"-test.run=^TestPluginHelperProcess$"},
+		Env:     []string{"VESPRA_PLUGIN_HELPER=1"},
+		Timeout: timeout,
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent log writes.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return buf
+}
+
+func newPluginRegistry(t *testing.T, timeout time.Duration) *tools.Registry {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	host := tools.NewPluginHost(ctx)
+	reg := tools.NewRegistry()
+	host.Register(context.Background(), reg, "srv1", []tools.PluginSpec{helperSpec(timeout)})
+	return reg
+}
+
+func TestPluginToolsRegisterAndCall(t *testing.T) {
+	logs := captureLogs(t)
+	reg := newPluginRegistry(t, 2*time.Second)
+
+	names := make(map[string]bool)
+	for _, def := range reg.Definitions() {
+		names[def.Function.Name] = true
+		if len(def.Function.Parameters) == 0 {
+			t.Errorf("tool %s has no parameter schema", def.Function.Name)
+		}
+	}
+	for _, want := range []string{"echo", "sleep", "fail", "crash", "flood", "shout", "pid"} {
+		if !names[want] {
+			t.Fatalf("plugin tool %q not registered; got %v", want, names)
+		}
+	}
+
+	got, err := reg.Dispatch(context.Background(), "echo", json.RawMessage(`{"text":"hi"}`))
+	if err != nil || got != "echo: hi" {
+		t.Fatalf("echo = %q, %v; want %q", got, err, "echo: hi")
+	}
+
+	if _, err := reg.Dispatch(context.Background(), "fail", nil); err == nil || !strings.Contains(err.Error(), "backend unavailable") {
+		t.Errorf("fail error = %v, want the plugin's JSON-RPC error", err)
+	}
+
+	if !strings.Contains(logs.String(), "helper plugin ready") {
+		t.Errorf("plugin stderr not logged; logs:\n%s", logs.String())
+	}
+}
+
+func TestPluginCallTimeout(t *testing.T) {
+	reg := newPluginRegistry(t, 300*time.Millisecond)
+
+	start := time.Now()
+	_, err := reg.Dispatch(context.Background(), "sleep", nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("sleep error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout took %s, want about 300ms", elapsed)
+	}
+}
+
+func TestPluginRestartsAfterCrash(t *testing.T) {
+	logs := captureLogs(t)
+	reg := newPluginRegistry(t, 2*time.Second)
+
+	if _, err := reg.Dispatch(context.Background(), "crash", nil); err == nil {
+		t.Fatal("crash call succeeded, want an error")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := reg.Dispatch(context.Background(), "echo", json.RawMessage(`{"text":"back"}`))
+		if err == nil && got == "echo: back" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin did not come back after crash: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !strings.Contains(logs.String(), "plugin exited, restarting") {
+		t.Errorf("restart not logged; logs:\n%s", logs.String())
+	}
+}
+
+func TestPluginOversizedLineRestartsPlugin(t *testing.T) {
+	logs := captureLogs(t)
+	reg := newPluginRegistry(t, 5*time.Second)
+
+	start := time.Now()
+	_, err := reg.Dispatch(context.Background(), "flood", nil)
+	if err == nil || !strings.Contains(err.Error(), "message too large") {
+		t.Fatalf("flood error = %v, want message too large", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("flood failed after %s, want well before the 5s timeout", elapsed)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := reg.Dispatch(context.Background(), "echo", json.RawMessage(`{"text":"back"}`))
+		if err == nil && got == "echo: back" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin did not come back after an oversized line: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !strings.Contains(logs.String(), "plugin exited, restarting") {
+		t.Errorf("restart not logged; logs:\n%s", logs.String())
+	}
+}
+
+func TestPluginOversizedStderrLineDoesNotWedge(t *testing.T) {
+	reg := newPluginRegistry(t, 2*time.Second)
+
+	if got, err := reg.Dispatch(context.Background(), "shout", nil); err != nil || got != "shouted" {
+		t.Fatalf("shout = %q, %v; want %q", got, err, "shouted")
+	}
+	if got, err := reg.Dispatch(context.Background(), "echo", json.RawMessage(`{"text":"hi"}`)); err != nil || got != "echo: hi" {
+		t.Fatalf("echo after shout = %q, %v", got, err)
+	}
+}
+
+func TestPluginRemovedFromSpecsIsStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	host := tools.NewPluginHost(ctx)
+	reg := tools.NewRegistry()
+	host.Register(context.Background(), reg, "srv1", []tools.PluginSpec{helperSpec(2 * time.Second)})
+
+	got, err := reg.Dispatch(context.Background(), "pid", nil)
+	if err != nil {
+		t.Fatalf("pid: %v", err)
+	}
+	pid, err := strconv.Atoi(got)
+	if err != nil {
+		t.Fatalf("pid = %q: %v", got, err)
+	}
+
+	host.Register(context.Background(), tools.NewRegistry(), "srv1", nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("plugin process %d still running after its spec was removed", pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,42 @@
+package tools
+
+import (
+	"path"
+	"slices"
+)
+
+// ToolPolicy restricts the tools a registry offers. Entries are tool names or
+// path.Match patterns such as "wiki_*". Deny wins; a non-empty Allow list must
+// match.
+type ToolPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// Allows reports whether the policy lets the named tool through.
+func (p ToolPolicy) Allows(name string) bool {
+	if matchAny(p.Deny, name) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchAny(p.Allow, name)
+}
+
+// PoliciesAllow reports whether every policy allows the named tool. The reply
+// tool is always allowed: a turn cannot answer without it.
+func PoliciesAllow(policies []ToolPolicy, name string) bool {
+	if name == ToolNameReply {
+		return true
+	}
+	return !slices.ContainsFunc(policies, func(p ToolPolicy) bool { return !p.Allows(name) })
+}
+
+// matchAny reports whether name matches any of the patterns. Malformed
+// patterns match nothing; config validation rejects them.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
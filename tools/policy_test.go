@@ -0,0 +1,55 @@
+package tools_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/tomasmach/vespra/tools"
+)
+
+func TestRegistryPolicies(t *testing.T) {
+	send := func(string) error { return nil }
+	react := func(string) error { return nil }
+	reg := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, &tools.AgentToolsDeps{
+		HTTP: []tools.HTTPToolSpec{
+			{Name: "wiki_search", Description: "Search the wiki.", URL: "http://127.0.0.1/search"},
+			{Name: "weather", Description: "Get the weather.", URL: "http://127.0.0.1/weather"},
+		},
+		Policies: []tools.ToolPolicy{
+			{Deny: []string{"memory_forget", "react"}},
+			{Allow: []string{"memory_*", "wiki_*"}},
+		},
+	})
+
+	want := []string{"memory_recall", "memory_save", "memory_update", "reply", "wiki_search"}
+	if got := reg.Names(); !slices.Equal(got, want) {
+		t.Errorf("Names() = %v, want %v", got, want)
+	}
+	if len(reg.Definitions()) != len(want) {
+		t.Errorf("Definitions() has %d tools, want %d", len(reg.Definitions()), len(want))
+	}
+}
+
+func TestPoliciesAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []tools.ToolPolicy
+		tool     string
+		want     bool
+	}{
+		{"no policies", nil, "generate_image", true},
+		{"denied by name", []tools.ToolPolicy{{Deny: []string{"generate_image"}}}, "generate_image", false},
+		{"deny wins over allow", []tools.ToolPolicy{{Allow: []string{"web_*"}, Deny: []string{"web_fetch"}}}, "web_fetch", false},
+		{"allow list glob", []tools.ToolPolicy{{Allow: []string{"web_*"}}}, "web_search", true},
+		{"outside allow list", []tools.ToolPolicy{{Allow: []string{"web_*"}}}, "memory_save", false},
+		{"every layer must allow", []tools.ToolPolicy{{}, {Deny: []string{"react"}}}, "react", false},
+		{"reply always allowed", []tools.ToolPolicy{{Deny: []string{"*"}}}, "reply", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tools.PoliciesAllow(tt.policies, tt.tool); got != tt.want {
+				t.Errorf("PoliciesAllow(%v, %q) = %v, want %v", tt.policies, tt.tool, got, tt.want)
+			}
+		})
+	}
+}
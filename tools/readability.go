@@ -0,0 +1,862 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// article is the main content of a web page, as found by extractArticle.
+type article struct {
+	Title   string
+	Byline  string
+	Content string // markdown
+}
+
+// minArticleChars is the length below which an extraction is retried
+// without removing unlikely-looking elements, which sometimes hold the
+// content on unusual pages.
+const minArticleChars = 250
+
+var (
+	// unlikelyCandidates matches class names and IDs of page chrome.
+	unlikelyCandidates = regexp.MustCompile(`(?i)-ad-|advert|banner|breadcrumb|combx|comment|community|consent|cookie|disqus|footer|gdpr|header|legends|menu|modal|nav|newsletter|pager|pagination|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skip|skyscraper|social|sponsor|subscribe|toolbar|widget`)
+	// maybeCandidate rescues elements that match unlikelyCandidates but
+	// probably wrap the content, such as "article-header".
+	maybeCandidate = regexp.MustCompile(`(?i)article|body|column|content|main|shadow`)
+	positiveWeight = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`)
+	negativeWeight = regexp.MustCompile(`(?i)-ad-|hidden|banner|combx|comment|com-|contact|cookie|foot|footnote|gdpr|masthead|media|meta|modal|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	bylineClass    = regexp.MustCompile(`(?i)byline|author|dateline|writtenby|p-author`)
+	htmlSpace      = regexp.MustCompile(`[ \t\n\r\f]+`)
+	extraNewlines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// removedTags are never part of the content.
+var removedTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "nav": true,
+	"footer": true, "aside": true, "svg": true, "iframe": true, "object": true,
+	"embed": true, "form": true, "button": true, "input": true, "select": true,
+	"textarea": true, "dialog": true, "canvas": true, "link": true, "meta": true,
+}
+
+// chromeRoles are ARIA roles of page chrome.
+var chromeRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"dialog": true, "alertdialog": true, "menu": true, "menubar": true, "search": true,
+}
+
+// blockTags are rendered as separate markdown blocks.
+var blockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "header": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"pre": true, "blockquote": true, "table": true, "tr": true, "hr": true,
+	"figure": true, "figcaption": true, "details": true, "summary": true,
+	"address": true, "center": true, "body": true, "html": true,
+}
+
+// extractArticle finds the main content of an HTML page the way browser
+// reader modes do: page chrome is removed, paragraphs are scored by length
+// and comma count, scores flow to their ancestors weighted by tag, class and
+// ID, and the best ancestor (discounted by link density) is rendered as
+// markdown together with related siblings. base resolves relative links.
+func extractArticle(htmlContent string, base *url.URL) article {
+	a := extractArticleWith(htmlContent, base, true)
+	if utf8.RuneCountInString(a.Content) < minArticleChars {
+		if retry := extractArticleWith(htmlContent, base, false); len(retry.Content) > len(a.Content) {
+			return retry
+		}
+	}
+	return a
+}
+
+func extractArticleWith(htmlContent string, base *url.URL, stripUnlikely bool) article {
+	doc, err := html.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		return article{}
+	}
+	if href := findBaseHref(doc); href != "" && base != nil {
+		if u, err := base.Parse(href); err == nil {
+			base = u
+		}
+	}
+	title, byline := pageMetadata(doc)
+	body := findElement(doc, "body")
+	if body == nil {
+		return article{Title: title, Byline: byline}
+	}
+
+	domByline := prepareDocument(body, stripUnlikely)
+	if byline == "" {
+		byline = domByline
+	}
+	title = refineTitle(title, body)
+
+	s := &articleScorer{scores: make(map[*html.Node]float64)}
+	top := s.topCandidate(body)
+	nodes := []*html.Node{top}
+	if top != body {
+		nodes = s.withSiblings(top)
+	}
+	if stripUnlikely {
+		for _, n := range nodes {
+			s.cleanConditionally(n)
+		}
+	}
+
+	r := &markdownRenderer{base: base, title: title}
+	var parts []string
+	for _, n := range nodes {
+		if md := r.block(n); md != "" {
+			parts = append(parts, md)
+		}
+	}
+	content := extraNewlines.ReplaceAllString(strings.Join(parts, "\n\n"), "\n\n")
+	return article{Title: title, Byline: byline, Content: strings.TrimSpace(content)}
+}
+
+// pageMetadata returns the title and author named in the document head.
+func pageMetadata(doc *html.Node) (title, byline string) {
+	var docTitle string
+	walk(doc, func(n *html.Node) bool {
+		switch n.Data {
+		case "title":
+			if docTitle == "" {
+				docTitle = textContent(n)
+			}
+		case "meta":
+			key := strings.ToLower(attr(n, "property") + attr(n, "name"))
+			content := normalizeSpace(attr(n, "content"))
+			switch key {
+			case "og:title", "twitter:title":
+				if title == "" {
+					title = content
+				}
+			case "author", "byline", "dc.creator", "article:author", "parsely-author":
+				if byline == "" && !strings.HasPrefix(content, "http") {
+					byline = content
+				}
+			}
+		case "body":
+			return false
+		}
+		return true
+	})
+	if title == "" {
+		title = docTitle
+	}
+	return title, cleanByline(byline)
+}
+
+// titleSeparators divide an article title from the site name in a page
+// title.
+var titleSeparators = regexp.MustCompile(` [|\-–—·:»/] `)
+
+// refineTitle drops a site name from the title: if a heading on the page
+// repeats the title minus its site name, that heading is the article's title.
+func refineTitle(title string, body *html.Node) string {
+	parts := titleSeparators.Split(title, -1)
+	var heading string
+	walk(body, func(n *html.Node) bool {
+		if n.Data != "h1" && n.Data != "h2" {
+			return true
+		}
+		t := textContent(n)
+		if t == "" || t == title {
+			return true
+		}
+		for _, part := range parts {
+			if len(parts) > 1 && strings.EqualFold(strings.TrimSpace(part), t) {
+				heading = t
+			}
+		}
+		if strings.Contains(title, t) && strings.Count(t, " ") >= 2 {
+			heading = t
+		}
+		return heading == ""
+	})
+	if heading != "" {
+		return heading
+	}
+	if title == "" {
+		if h1 := findElement(body, "h1"); h1 != nil {
+			return textContent(h1)
+		}
+	}
+	return title
+}
+
+// prepareDocument removes page chrome and hidden elements from body and
+// returns the first byline found in the markup, which is removed as well so
+// it is not repeated in the content.
+func prepareDocument(body *html.Node, stripUnlikely bool) (byline string) {
+	var remove []*html.Node
+	walk(body, func(n *html.Node) bool {
+		if n == body {
+			return true
+		}
+		if removedTags[n.Data] || isHidden(n) || chromeRoles[attr(n, "role")] {
+			remove = append(remove, n)
+			return false
+		}
+		match := attr(n, "class") + " " + attr(n, "id")
+		if byline == "" && (attr(n, "rel") == "author" || strings.Contains(attr(n, "itemprop"), "author") || bylineClass.MatchString(match)) {
+			if t := textContent(n); t != "" && len(t) < 100 {
+				byline = cleanByline(t)
+				remove = append(remove, n)
+				return false
+			}
+		}
+		if stripUnlikely && n.Data != "article" && n.Data != "main" && !hasAncestor(n, "table", "pre", "code") &&
+			unlikelyCandidates.MatchString(match) && !maybeCandidate.MatchString(match) {
+			remove = append(remove, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+	paragraphize(body)
+	return byline
+}
+
+// paragraphize gives loose text the structure of paragraphs, as old and
+// hand-written pages often lack it: a div holding only inline content
+// becomes a p, and in other divs runs of inline content between blocks or
+// between two or more line breaks are wrapped in p elements.
+func paragraphize(body *html.Node) {
+	var divs []*html.Node
+	walk(body, func(n *html.Node) bool {
+		if n.Data == "div" {
+			divs = append(divs, n)
+		}
+		return true
+	})
+	for _, div := range divs {
+		if !hasBlockChild(div) && !hasDoubleBreak(div) {
+			div.Data, div.DataAtom = "p", atom.P
+			continue
+		}
+		wrapInlineRuns(div)
+	}
+}
+
+func wrapInlineRuns(n *html.Node) {
+	var run []*html.Node
+	flush := func(before *html.Node) {
+		var text strings.Builder
+		for _, c := range run {
+			text.WriteString(rawText(c))
+		}
+		if strings.TrimSpace(text.String()) != "" {
+			p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+			n.InsertBefore(p, before)
+			for _, c := range run {
+				n.RemoveChild(c)
+				p.AppendChild(c)
+			}
+		}
+		run = nil
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.ElementNode && blockTags[c.Data]:
+			flush(c)
+		case isBreak(c) && isBreak(nextNonSpace(c)):
+			flush(c)
+			for c != nil && (isBreak(c) || isSpace(c)) {
+				after := c.NextSibling
+				n.RemoveChild(c)
+				c = after
+			}
+			next = c
+		default:
+			run = append(run, c)
+		}
+		c = next
+	}
+	flush(nil)
+}
+
+func hasDoubleBreak(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isBreak(c) && isBreak(nextNonSpace(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBreak(n *html.Node) bool {
+	return n != nil && n.Type == html.ElementNode && n.Data == "br"
+}
+
+func isSpace(n *html.Node) bool {
+	return n.Type == html.TextNode && strings.TrimSpace(n.Data) == ""
+}
+
+func nextNonSpace(n *html.Node) *html.Node {
+	c := n.NextSibling
+	for c != nil && isSpace(c) {
+		c = c.NextSibling
+	}
+	return c
+}
+
+func isHidden(n *html.Node) bool {
+	if hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(attr(n, "style")), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+func cleanByline(s string) string {
+	s = normalizeSpace(s)
+	for _, prefix := range []string{"By ", "by ", "BY ", "Written by ", "written by "} {
+		s = strings.TrimPrefix(s, prefix)
+	}
+	return s
+}
+
+// articleScorer scores elements by the paragraphs they contain.
+type articleScorer struct {
+	scores map[*html.Node]float64
+}
+
+// scoredTags hold paragraph-like text whose score flows to ancestors.
+var scoredTags = map[string]bool{"p": true, "pre": true, "td": true, "blockquote": true}
+
+// topCandidate returns the element most likely to hold the content, or body
+// if no element stands out.
+func (s *articleScorer) topCandidate(body *html.Node) *html.Node {
+	var candidates []*html.Node
+	walk(body, func(n *html.Node) bool {
+		if !scoredTags[n.Data] || (n.Data != "p" && hasBlockChild(n)) {
+			return true
+		}
+		text := textContent(n)
+		if utf8.RuneCountInString(text) < 25 {
+			return false
+		}
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，"))
+		score += math.Min(float64(utf8.RuneCountInString(text)/100), 3)
+		level := 0
+		for anc := n.Parent; anc != nil && anc.Type == html.ElementNode && level < 3; anc = anc.Parent {
+			if _, ok := s.scores[anc]; !ok {
+				s.scores[anc] = initialScore(anc)
+				candidates = append(candidates, anc)
+			}
+			switch level {
+			case 0:
+				s.scores[anc] += score
+			case 1:
+				s.scores[anc] += score / 2
+			default:
+				s.scores[anc] += score / float64(level*3)
+			}
+			level++
+		}
+		return false
+	})
+	var top *html.Node
+	best := 0.0
+	for _, c := range candidates {
+		score := s.scores[c] * (1 - linkDensity(c))
+		s.scores[c] = score
+		if top == nil || score > best {
+			top, best = c, score
+		}
+	}
+	if top == nil || top.Data == "html" {
+		return body
+	}
+	return top
+}
+
+// withSiblings returns top together with the siblings that look like part
+// of the same content, in document order.
+func (s *articleScorer) withSiblings(top *html.Node) []*html.Node {
+	threshold := math.Max(10, s.scores[top]*0.2)
+	var nodes []*html.Node
+	for c := top.Parent.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		include := c == top
+		if score, ok := s.scores[c]; ok && score >= threshold {
+			include = true
+		} else if c.Data == "p" {
+			text := textContent(c)
+			density := linkDensity(c)
+			n := utf8.RuneCountInString(text)
+			include = (n > 80 && density < 0.25) || (n > 0 && density == 0 && strings.Contains(text, ". "))
+		}
+		if include {
+			nodes = append(nodes, c)
+		}
+	}
+	return nodes
+}
+
+// cleanConditionally removes link lists, forms and other boilerplate that
+// sits inside the content, such as "related stories" boxes.
+func (s *articleScorer) cleanConditionally(root *html.Node) {
+	var remove []*html.Node
+	walk(root, func(n *html.Node) bool {
+		if n == root {
+			return true
+		}
+		switch n.Data {
+		case "div", "section", "ul", "ol", "table", "figure", "header":
+		default:
+			return true
+		}
+		if hasAncestor(n, "pre", "code") || findElement(n, "pre") != nil {
+			return false
+		}
+		weight := classWeight(n)
+		if float64(weight)+s.scores[n] < 0 {
+			remove = append(remove, n)
+			return false
+		}
+		text := textContent(n)
+		if strings.Count(text, ",") >= 10 {
+			return true
+		}
+		density := linkDensity(n)
+		if (weight < 25 && density > 0.2 && n.Data != "table") || density > 0.5 {
+			remove = append(remove, n)
+			return false
+		}
+		return true
+	})
+	for _, n := range remove {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+func initialScore(n *html.Node) float64 {
+	score := float64(classWeight(n))
+	switch n.Data {
+	case "article":
+		score += 10
+	case "div", "main":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	return score
+}
+
+// classWeight scores an element's class and ID: content-like names add 25,
+// chrome-like names subtract 25.
+func classWeight(n *html.Node) int {
+	weight := 0
+	for _, v := range []string{attr(n, "class"), attr(n, "id")} {
+		if v == "" {
+			continue
+		}
+		if negativeWeight.MatchString(v) {
+			weight -= 25
+		}
+		if positiveWeight.MatchString(v) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity is the share of n's text that is inside links. Links to
+// fragments of the same page count for less.
+func linkDensity(n *html.Node) float64 {
+	total := utf8.RuneCountInString(textContent(n))
+	if total == 0 {
+		return 0
+	}
+	var linked float64
+	walk(n, func(c *html.Node) bool {
+		if c.Data != "a" {
+			return true
+		}
+		coefficient := 1.0
+		if strings.HasPrefix(attr(c, "href"), "#") {
+			coefficient = 0.3
+		}
+		linked += float64(utf8.RuneCountInString(textContent(c))) * coefficient
+		return false
+	})
+	return linked / float64(total)
+}
+
+func hasBlockChild(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockTags[c.Data] {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownRenderer turns the content elements into lightly formatted
+// markdown: headings, paragraphs, lists, quotes, code blocks, tables, links
+// and emphasis.
+type markdownRenderer struct {
+	base  *url.URL
+	title string // a heading repeating the title is left out
+}
+
+// block renders n, which may be a block or inline element.
+func (r *markdownRenderer) block(n *html.Node) string {
+	if n.Type != html.ElementNode {
+		return collapseInline(r.inline(n))
+	}
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := collapseInline(r.children(n))
+		if text == "" || strings.EqualFold(text, r.title) {
+			return ""
+		}
+		level, _ := strconv.Atoi(n.Data[1:])
+		return strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\n", " ")
+	case "p", "dt", "summary", "figcaption":
+		return collapseInline(r.children(n))
+	case "pre":
+		return codeBlock(n)
+	case "blockquote":
+		inner := r.blocks(n)
+		if inner == "" {
+			return ""
+		}
+		lines := strings.Split(inner, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return strings.Join(lines, "\n")
+	case "ul", "ol":
+		return r.list(n)
+	case "table":
+		return r.table(n)
+	case "hr":
+		return "---"
+	}
+	if blockTags[n.Data] {
+		return r.blocks(n)
+	}
+	return collapseInline(r.inline(n))
+}
+
+// blocks renders the children of n as blocks separated by blank lines, with
+// runs of inline content forming paragraphs.
+func (r *markdownRenderer) blocks(n *html.Node) string {
+	var out []string
+	var para strings.Builder
+	flush := func() {
+		if t := collapseInline(para.String()); t != "" {
+			out = append(out, t)
+		}
+		para.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockTags[c.Data] {
+			flush()
+			if b := r.block(c); b != "" {
+				out = append(out, b)
+			}
+			continue
+		}
+		para.WriteString(r.inline(c))
+	}
+	flush()
+	return strings.Join(out, "\n\n")
+}
+
+func (r *markdownRenderer) list(n *html.Node) string {
+	num := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		num = start
+	}
+	var items []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.Data != "li" {
+			continue
+		}
+		content := r.blocks(c)
+		if content == "" {
+			continue
+		}
+		marker := "- "
+		if n.Data == "ol" {
+			marker = strconv.Itoa(num) + ". "
+			num++
+		}
+		indent := strings.Repeat(" ", len(marker))
+		lines := strings.Split(content, "\n")
+		for i := range lines {
+			if i == 0 {
+				lines[i] = marker + lines[i]
+			} else if lines[i] != "" {
+				lines[i] = indent + lines[i]
+			}
+		}
+		items = append(items, strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+func (r *markdownRenderer) table(n *html.Node) string {
+	var rows [][]string
+	var walkRows func(*html.Node)
+	walkRows = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.Data {
+			case "thead", "tbody", "tfoot":
+				walkRows(c)
+			case "tr":
+				var cells []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Data == "td" || cell.Data == "th" {
+						text := strings.ReplaceAll(collapseInline(r.children(cell)), "\n", " ")
+						cells = append(cells, strings.ReplaceAll(text, "|", `\|`))
+					}
+				}
+				if len(cells) > 0 {
+					rows = append(rows, cells)
+				}
+			}
+		}
+	}
+	walkRows(n)
+	if len(rows) == 0 {
+		return ""
+	}
+	// A single-column table is layout, not data.
+	if len(rows[0]) == 1 {
+		var lines []string
+		for _, row := range rows {
+			if row[0] != "" {
+				lines = append(lines, row[0])
+			}
+		}
+		return strings.Join(lines, "\n\n")
+	}
+	var sb strings.Builder
+	for i, row := range rows {
+		sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", len(row)) + "\n")
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// children renders the children of n as inline content.
+func (r *markdownRenderer) children(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(r.inline(c))
+	}
+	return sb.String()
+}
+
+func (r *markdownRenderer) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return htmlSpace.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "img":
+		return ""
+	case "a":
+		text := strings.ReplaceAll(r.children(n), "\n", " ")
+		href := r.resolve(attr(n, "href"))
+		if strings.TrimSpace(text) == "" || href == "" {
+			return text
+		}
+		return wrapInline(text, "[", "]("+href+")")
+	case "strong", "b":
+		return wrapInline(r.children(n), "**", "**")
+	case "em", "i":
+		return wrapInline(r.children(n), "_", "_")
+	case "code", "kbd", "samp":
+		return wrapInline(textContent(n), "`", "`")
+	}
+	if blockTags[n.Data] {
+		return " " + r.children(n) + " "
+	}
+	return r.children(n)
+}
+
+// resolve returns an absolute URL for a link, or "" for links that lead
+// nowhere useful outside the page.
+func (r *markdownRenderer) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if r.base != nil {
+		u = r.base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto" {
+		return ""
+	}
+	return u.String()
+}
+
+// wrapInline surrounds the trimmed text with open and close, keeping the
+// surrounding spaces outside the markers.
+func wrapInline(s, open, close string) string {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return s
+	}
+	var sb strings.Builder
+	if strings.HasPrefix(s, " ") {
+		sb.WriteByte(' ')
+	}
+	sb.WriteString(open + t + close)
+	if strings.HasSuffix(s, " ") {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+// collapseInline trims each line of inline content and collapses runs of
+// spaces, dropping empty lines.
+func collapseInline(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// codeBlock renders a pre element as a fenced code block, naming the
+// language when a "language-" class gives it.
+func codeBlock(n *html.Node) string {
+	code := strings.Trim(rawText(n), "\n")
+	if strings.TrimSpace(code) == "" {
+		return ""
+	}
+	lang := ""
+	for _, el := range []*html.Node{n, findElement(n, "code")} {
+		if el == nil {
+			continue
+		}
+		for _, class := range strings.Fields(attr(el, "class")) {
+			if l, ok := strings.CutPrefix(class, "language-"); ok && lang == "" {
+				lang = l
+			}
+		}
+	}
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, lang, code, fence)
+}
+
+// walk calls fn for each element in the tree rooted at n, depth first,
+// descending into an element's children only when fn returns true.
+func walk(n *html.Node, fn func(*html.Node) bool) {
+	if n.Type == html.ElementNode && !fn(n) {
+		return
+	}
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		walk(c, fn)
+		c = next
+	}
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	var found *html.Node
+	walk(n, func(c *html.Node) bool {
+		if found == nil && c.Data == tag && c != n {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+func findBaseHref(doc *html.Node) string {
+	if b := findElement(doc, "base"); b != nil {
+		return attr(b, "href")
+	}
+	return ""
+}
+
+func hasAncestor(n *html.Node, tags ...string) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		for _, t := range tags {
+			if p.Data == t && p.Type == html.ElementNode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent returns the text of n with whitespace collapsed.
+func textContent(n *html.Node) string {
+	return normalizeSpace(rawText(n))
+}
+
+// rawText returns the raw text of n.
+func rawText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(rawText(c))
+	}
+	return sb.String()
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,224 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// ArgumentError reports tool arguments that do not match the tool's
+// Parameters schema. Its message is written for the model so it can correct
+// the call.
+type ArgumentError struct {
+	Tool     string
+	Problems []string // one per mismatch, e.g. "content: required property is missing"
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("invalid arguments for %s: %s. Fix the arguments and call %s again.", e.Tool, strings.Join(e.Problems, "; "), e.Tool)
+}
+
+// validateArgs checks args against t's Parameters schema. Empty args count as
+// an empty object. Tools without a usable schema are not checked.
+func validateArgs(t Tool, args json.RawMessage) error {
+	raw := t.Parameters()
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return nil
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil
+	}
+	if len(bytes.TrimSpace(args)) == 0 {
+		args = json.RawMessage(`{}`)
+	}
+	dec := json.NewDecoder(bytes.NewReader(args))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return &ArgumentError{Tool: t.Name(), Problems: []string{"arguments are not valid JSON"}}
+	}
+	if problems := validateSchema(schema, value, ""); len(problems) > 0 {
+		return &ArgumentError{Tool: t.Name(), Problems: problems}
+	}
+	return nil
+}
+
+// validateSchema checks value against the subset of JSON Schema that tool
+// definitions use: type, properties, required, additionalProperties, items,
+// enum, minimum/maximum, minLength/maxLength and minItems/maxItems. Other
+// keywords are ignored, so schemas from plugins and MCP servers that use more
+// of the spec are checked as far as this subset goes. Numbers in value must
+// be json.Number.
+func validateSchema(schema map[string]any, value any, path string) []string {
+	at := path
+	if at == "" {
+		at = "arguments"
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(typ string) bool { return hasType(value, typ) }) {
+		return []string{fmt.Sprintf("%s: must be %s, got %s", at, strings.Join(types, " or "), jsonType(value))}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool { return jsonEqual(e, value) }) {
+		opts := make([]string, len(enum))
+		for i, e := range enum {
+			b, _ := json.Marshal(e)
+			opts[i] = string(b)
+		}
+		return []string{fmt.Sprintf("%s: must be one of %s", at, strings.Join(opts, ", "))}
+	}
+
+	var problems []string
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, present := v[name]; !present {
+						problems = append(problems, fmt.Sprintf("%s: required property is missing", joinPath(path, name)))
+					}
+				}
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			sub, ok := props[name].(map[string]any)
+			if !ok {
+				if schema["additionalProperties"] == false {
+					problems = append(problems, fmt.Sprintf("%s: unknown property", joinPath(path, name)))
+				}
+				continue
+			}
+			problems = append(problems, validateSchema(sub, v[name], joinPath(path, name))...)
+		}
+	case []any:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			problems = append(problems, fmt.Sprintf("%s: must have at least %g items", at, n))
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			problems = append(problems, fmt.Sprintf("%s: must have at most %g items", at, n))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				problems = append(problems, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %g characters", at, n))
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %g characters", at, n))
+		}
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			break
+		}
+		if n, ok := schemaNumber(schema, "minimum"); ok && f < n {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %g", at, n))
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && f > n {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %g", at, n))
+		}
+	}
+	return problems
+}
+
+// schemaTypes returns the type keyword as a list; it may be a string or an array.
+func schemaTypes(t any) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// hasType reports whether value is of the JSON Schema type typ. Unknown types
+// match anything.
+func hasType(value any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	}
+	return true
+}
+
+// jsonType names the JSON type of a decoded value for error messages.
+func jsonType(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// jsonEqual compares an enum entry from a schema with a decoded argument:
+// numbers by value, anything else by its JSON encoding.
+func jsonEqual(a, b any) bool {
+	if n, ok := b.(json.Number); ok {
+		f, err := n.Float64()
+		af, isNum := a.(float64)
+		return err == nil && isNum && af == f
+	}
+	ab, err1 := json.Marshal(a)
+	bb, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && bytes.Equal(ab, bb)
+}
+
+func schemaNumber(schema map[string]any, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
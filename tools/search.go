@@ -0,0 +1,162 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+
+	"github.com/tomasmach/vespra/memory"
+)
+
+const (
+	defaultSearchResults = 8
+	maxSnippetChars      = 400
+)
+
+// SearchResult is one hit from a search provider, normalized across
+// providers.
+type SearchResult struct {
+	Title   string
+	URL     string // empty for results that are not web pages, such as knowledge base passages
+	Snippet string
+	Date    string // publication date as YYYY-MM-DD when the provider gives one in a known format
+}
+
+// SearchProvider runs the searches behind web_search.
+type SearchProvider interface {
+	Name() string
+	Search(ctx context.Context, query string, count int) ([]SearchResult, error)
+}
+
+// searchProviders returns results from the first provider that finds any,
+// trying the others in order when one fails or comes back empty. It returns
+// the name of the provider that answered.
+func searchProviders(ctx context.Context, providers []SearchProvider, query string, count int) ([]SearchResult, string, error) {
+	var errs []error
+	for _, p := range providers {
+		results, err := p.Search(ctx, query, count)
+		if err != nil {
+			slog.Warn("search provider failed", "error", err, "provider", p.Name(), "query", query)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if len(results) > 0 {
+			return results, p.Name(), nil
+		}
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// providerNames joins the names of providers, in order.
+func providerNames(providers []SearchProvider) string {
+	names := make([]string, len(providers))
+	for i, p := range providers {
+		names[i] = p.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// formatSearchResults renders results as a numbered list starting at first,
+// as shown to the model by web_search.
+func formatSearchResults(results []SearchResult, provider string, first int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "(via %s)\n", provider)
+	for i, r := range results {
+		fmt.Fprintf(&sb, "\n%d. %s", first+i, r.Title)
+		if r.Date != "" {
+			fmt.Fprintf(&sb, " (%s)", r.Date)
+		}
+		sb.WriteByte('\n')
+		if r.URL != "" {
+			sb.WriteString("   " + r.URL + "\n")
+		}
+		if r.Snippet != "" {
+			sb.WriteString("   " + r.Snippet + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// normalizeResult cleans up the fields of a provider result: whitespace is
+// collapsed, snippets are shortened and dates reduced to YYYY-MM-DD.
+func normalizeResult(r SearchResult) SearchResult {
+	r.Title = strings.Join(strings.Fields(r.Title), " ")
+	if r.Title == "" {
+		r.Title = r.URL
+	}
+	r.URL = strings.TrimSpace(r.URL)
+	r.Snippet = strings.Join(strings.Fields(r.Snippet), " ")
+	if utf8.RuneCountInString(r.Snippet) > maxSnippetChars {
+		r.Snippet = string([]rune(r.Snippet)[:maxSnippetChars]) + "…"
+	}
+	r.Date = normalizeDate(r.Date)
+	return r
+}
+
+// normalizeDate reduces the timestamp formats providers use to YYYY-MM-DD and
+// keeps anything else, such as "2 days ago", as it is.
+func normalizeDate(s string) string {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02")
+		}
+	}
+	return s
+}
+
+// stripTags removes the markup some providers put in snippets, such as
+// <strong> around matched words, and decodes entities.
+func stripTags(s string) string {
+	if !strings.Contains(s, "<") {
+		return html.UnescapeString(s)
+	}
+	var sb strings.Builder
+	z := html.NewTokenizer(strings.NewReader(s))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return sb.String()
+		case html.TextToken:
+			sb.Write(z.Text())
+		}
+	}
+}
+
+// knowledgeSearch searches the agent's knowledge base, so uploaded documents
+// can answer before, or instead of, the web.
+type knowledgeSearch struct {
+	store     *memory.Store
+	serverID  string
+	threshold float64
+}
+
+// NewKnowledgeSearch returns a provider that searches the knowledge base of
+// serverID. Passages less similar to the query than threshold are left out,
+// so unrelated queries fall through to the next provider.
+func NewKnowledgeSearch(store *memory.Store, serverID string, threshold float64) SearchProvider {
+	return &knowledgeSearch{store: store, serverID: serverID, threshold: threshold}
+}
+
+func (k *knowledgeSearch) Name() string { return "knowledge" }
+
+func (k *knowledgeSearch) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	chunks, err := k.store.SearchKnowledge(ctx, query, k.serverID, count, k.threshold)
+	if err != nil {
+		return nil, fmt.Errorf("search knowledge base: %w", err)
+	}
+	results := make([]SearchResult, 0, len(chunks))
+	for _, c := range chunks {
+		results = append(results, normalizeResult(SearchResult{Title: c.Citation(), Snippet: c.Content}))
+	}
+	return results, nil
+}
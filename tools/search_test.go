@@ -0,0 +1,234 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type fakeSearch struct {
+	name    string
+	results []SearchResult
+	err     error
+	calls   int
+}
+
+func (f *fakeSearch) Name() string { return f.name }
+
+func (f *fakeSearch) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	f.calls++
+	return f.results, f.err
+}
+
+func TestBraveSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Subscription-Token") != "key" {
+			t.Errorf("token = %q", r.Header.Get("X-Subscription-Token"))
+		}
+		if q := r.URL.Query(); q.Get("q") != "go release" || q.Get("count") != "2" {
+			t.Errorf("query = %v", q)
+		}
+		w.Write([]byte(`{"web":{"results":[
+			{"title":"Go 1.24 is released","url":"https://go.dev/blog/go1.24","description":"The <strong>Go</strong> team &amp; friends","page_age":"2025-02-11T00:00:00"},
+			{"title":"Release history","url":"https://go.dev/doc/devel/release","description":"Older releases","age":"3 days ago"}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	p := NewBraveSearch("key", srv.Client()).(*braveSearch)
+	p.baseURL = srv.URL
+	results, err := p.Search(context.Background(), "go release", 2)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	want := []SearchResult{
+		{Title: "Go 1.24 is released", URL: "https://go.dev/blog/go1.24", Snippet: "The Go team & friends", Date: "2025-02-11"},
+		{Title: "Release history", URL: "https://go.dev/doc/devel/release", Snippet: "Older releases", Date: "3 days ago"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, results[i], want[i])
+		}
+	}
+}
+
+func TestGLMSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/web_search" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("request %s with auth %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["search_query"] != "prague weather" || body["search_engine"] != glmSearchEngine {
+			t.Errorf("body = %v", body)
+		}
+		w.Write([]byte(`{"search_result":[
+			{"title":"Prague forecast","content":"Sunny,\n  22 °C","link":"https://weather.example/prague","media":"Weather Example","publish_date":"2026-05-01"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	results, err := NewGLMSearch(srv.URL+"/", "key", srv.Client()).Search(context.Background(), "prague weather", 5)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	want := SearchResult{Title: "Prague forecast - Weather Example", URL: "https://weather.example/prague", Snippet: "Sunny, 22 °C", Date: "2026-05-01"}
+	if len(results) != 1 || results[0] != want {
+		t.Errorf("results = %+v, want %+v", results, want)
+	}
+}
+
+func TestSearXNGSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query(); r.URL.Path != "/search" || q.Get("q") != "sqlite fts5" || q.Get("format") != "json" {
+			t.Errorf("request = %s", r.URL)
+		}
+		w.Write([]byte(`{"results":[
+			{"title":"FTS5","url":"https://sqlite.org/fts5.html","content":"Full-text search","publishedDate":"2024-10-21T08:00:00Z"},
+			{"title":"","url":"https://example.com/fts","content":""},
+			{"title":"Third","url":"https://example.com/3","content":"cut by count"}
+		]}`))
+	}))
+	defer srv.Close()
+
+	results, err := NewSearXNGSearch(srv.URL, srv.Client()).Search(context.Background(), "sqlite fts5", 2)
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %+v, want 2", results)
+	}
+	if results[0].Date != "2024-10-21" {
+		t.Errorf("date = %q", results[0].Date)
+	}
+	if results[1].Title != "https://example.com/fts" {
+		t.Errorf("untitled result title = %q, want its URL", results[1].Title)
+	}
+}
+
+func TestSearXNGSearchJSONDisabled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := NewSearXNGSearch(srv.URL, srv.Client()).Search(context.Background(), "q", 5)
+	if err == nil || !strings.Contains(err.Error(), "json format") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestSearchProvidersFallback(t *testing.T) {
+	failing := &fakeSearch{name: "brave", err: errors.New("quota exceeded")}
+	empty := &fakeSearch{name: "knowledge"}
+	answering := &fakeSearch{name: "searxng", results: []SearchResult{{Title: "hit"}}}
+	unused := &fakeSearch{name: "glm", results: []SearchResult{{Title: "unused"}}}
+
+	results, name, err := searchProviders(context.Background(), []SearchProvider{failing, empty, answering, unused}, "q", 5)
+	if err != nil || name != "searxng" || len(results) != 1 {
+		t.Fatalf("searchProviders = %v, %q, %v", results, name, err)
+	}
+	if unused.calls != 0 {
+		t.Error("providers after the answering one should not be called")
+	}
+
+	_, _, err = searchProviders(context.Background(), []SearchProvider{failing, empty}, "q", 5)
+	if err == nil || !strings.Contains(err.Error(), "brave: quota exceeded") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestFormatSearchResults(t *testing.T) {
+	got := formatSearchResults([]SearchResult{
+		{Title: "Go 1.24 is released", URL: "https://go.dev/blog/go1.24", Snippet: "Release notes.", Date: "2025-02-11"},
+		{Title: "faq.md › Events", Snippet: "Movie night is every Friday."},
+	}, "brave", 1)
+	want := "(via brave)\n\n" +
+		"1. Go 1.24 is released (2025-02-11)\n   https://go.dev/blog/go1.24\n   Release notes.\n\n" +
+		"2. faq.md › Events\n   Movie night is every Friday."
+	if got != want {
+		t.Errorf("formatSearchResults =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNormalizeResult(t *testing.T) {
+	r := normalizeResult(SearchResult{Title: "  A\n title ", URL: " https://a.example ", Snippet: strings.Repeat("word ", 200), Date: "2026-01-02 15:04:05"})
+	if r.Title != "A title" || r.URL != "https://a.example" || r.Date != "2026-01-02" {
+		t.Errorf("normalized = %+v", r)
+	}
+	if n := len([]rune(r.Snippet)); n != maxSnippetChars+1 || !strings.HasSuffix(r.Snippet, "…") {
+		t.Errorf("snippet has %d runes: %q", n, r.Snippet)
+	}
+}
+
+func TestAppendCitations(t *testing.T) {
+	sources := []SearchResult{
+		{Title: "Go 1.24 is released", URL: "https://go.dev/blog/go1.24"},
+		{Title: "faq.md › Events"},
+		{Title: "Release history", URL: "https://go.dev/doc/devel/release"},
+	}
+	tests := []struct {
+		name, text, want string
+	}{
+		{"cited in order of first use", "Go 1.24 is out [3]; see also [1, 3].",
+			"Go 1.24 is out [3]; see also [1, 3].\n\n-# Sources:\n[3] <https://go.dev/doc/devel/release>\n[1] <https://go.dev/blog/go1.24>"},
+		{"knowledge source by title", "Movie night is on Friday [2].",
+			"Movie night is on Friday [2].\n\n-# Sources:\n[2] faq.md › Events"},
+		{"already linked", "See [1](https://go.dev/blog/go1.24).", "See [1](https://go.dev/blog/go1.24)."},
+		{"unknown number", "As noted [7].", "As noted [7]."},
+		{"no citations", "Hello!", "Hello!"},
+	}
+	for _, tt := range tests {
+		if got := appendCitations(tt.text, sources); got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+	if got := appendCitations("Nothing searched [1].", nil); got != "Nothing searched [1]." {
+		t.Errorf("without sources: %q", got)
+	}
+}
+
+func TestWebSearchSync(t *testing.T) {
+	provider := &fakeSearch{name: "searxng", results: []SearchResult{
+		{Title: "Go 1.24 is released", URL: "https://go.dev/blog/go1.24", Snippet: "Release notes."},
+	}}
+	var sent []string
+	send := func(s string) error { sent = append(sent, s); return nil }
+	deps := &WebSearchDeps{Ctx: context.Background(), TimeoutSeconds: 5, Providers: []SearchProvider{provider}, Sync: true}
+	r := NewDefaultRegistry(nil, "", 0, 0, send, func(string) error { return nil }, deps, nil, 2, nil)
+
+	first, err := r.Dispatch(context.Background(), ToolNameWebSearch, json.RawMessage(`{"query":"go release"}`))
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	second, _ := r.Dispatch(context.Background(), ToolNameWebSearch, json.RawMessage(`{"query":"go 1.24"}`))
+	if !strings.Contains(first, "1. Go 1.24 is released") || !strings.Contains(second, "2. Go 1.24 is released") {
+		t.Errorf("results are not numbered across searches:\n%s\n---\n%s", first, second)
+	}
+	if r.WebSearchCalled {
+		t.Error("a sync search should not end the turn")
+	}
+
+	if _, err := r.Dispatch(context.Background(), ToolNameReply, json.RawMessage(`{"content":"Go 1.24 is out [2]."}`)); err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	want := "Go 1.24 is out [2].\n\n-# Sources:\n[2] <https://go.dev/blog/go1.24>"
+	if len(sent) != 1 || sent[0] != want {
+		t.Errorf("sent = %q, want %q", sent, want)
+	}
+	if got := r.Cite("Plain text [1]."); !strings.HasSuffix(got, "[1] <https://go.dev/blog/go1.24>") {
+		t.Errorf("Cite = %q", got)
+	}
+
+	provider.results = nil
+	if out, _ := r.Dispatch(context.Background(), ToolNameWebSearch, json.RawMessage(`{"query":"nothing"}`)); out != `No results found for "nothing".` {
+		t.Errorf("empty search = %q", out)
+	}
+}
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// searxngResponse is the body returned by a SearXNG instance for format=json.
+type searxngResponse struct {
+	Results []struct {
+		Title         string `json:"title"`
+		URL           string `json:"url"`
+		Content       string `json:"content"`
+		PublishedDate string `json:"publishedDate"`
+	} `json:"results"`
+}
+
+// searxngSearch searches with a self-hosted SearXNG instance. The instance
+// must have the json format enabled under search.formats in its settings.
+type searxngSearch struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewSearXNGSearch returns a provider backed by the SearXNG instance at
+// baseURL. A nil client uses http.DefaultClient.
+func NewSearXNGSearch(baseURL string, client *http.Client) SearchProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &searxngSearch{baseURL: strings.TrimRight(baseURL, "/"), httpClient: client}
+}
+
+func (s *searxngSearch) Name() string { return "searxng" }
+
+func (s *searxngSearch) Search(ctx context.Context, query string, count int) ([]SearchResult, error) {
+	if s.baseURL == "" {
+		return nil, fmt.Errorf("searxng URL not configured")
+	}
+	u, err := url.Parse(s.baseURL + "/search")
+	if err != nil {
+		return nil, fmt.Errorf("parse searxng URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("q", query)
+	q.Set("format", "json")
+	q.Set("pageno", "1")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("searxng request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("searxng returned %s; enable the json format in its settings", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("searxng returned %s", resp.Status)
+	}
+
+	var sxResp searxngResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sxResp); err != nil {
+		return nil, fmt.Errorf("decode searxng response: %w", err)
+	}
+
+	results := make([]SearchResult, 0, min(len(sxResp.Results), count))
+	for _, r := range sxResp.Results {
+		if len(results) == count {
+			break
+		}
+		results = append(results, normalizeResult(SearchResult{Title: r.Title, URL: r.URL, Snippet: r.Content, Date: r.PublishedDate}))
+	}
+
+	slog.Debug("searxng search completed", "query", query, "results", len(results))
+	return results, nil
+}
@@ -7,7 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"net/http"
 	"regexp"
+	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -19,11 +23,13 @@ import (
 
 // Tool name constants used across packages to avoid stringly-typed checks.
 const (
+	ToolNameReply              = "reply"
 	ToolNameWebSearch          = "web_search"
 	ToolNameWebFetch           = "web_fetch"
 	ToolNameImageGen           = "generate_image"
 	ToolNameVisualMemorySave   = "visual_memory_save"
 	ToolNameVisualMemoryRecall = "visual_memory_recall"
+	ToolNameImageGallerySearch = "image_gallery_search"
 )
 
 // Tool is the interface every tool must implement.
@@ -36,13 +42,68 @@ type Tool interface {
 
 // Registry holds registered tools and provides dispatch.
 type Registry struct {
-	tools           map[string]Tool
+	tools    map[string]Tool
+	policies []ToolPolicy // tools they exclude are never registered
+
 	Replied         bool   // set to true when the reply tool is called
 	ReplyText       string // the content argument passed to the reply tool
 	ReplyCount      int    // number of reply tool calls in this turn
 	WebSearchCalled bool   // set to true when web_search is invoked
 	ImageGenCalled  bool   // set to true when generate_image is invoked
 	Reacted         bool   // set to true when the react tool is called
+
+	// Requesters holds the author IDs of the turn's messages; memory_update
+	// only rewrites memories about users among them.
+	Requesters []string
+
+	sources []SearchResult // numbered results of synchronous web searches, cited as [n]
+}
+
+// turnState is the part of a Registry's turn state that tools change. Each
+// call works on its own copy, which Dispatch merges back only when the call
+// returns in time, so a call abandoned after its timeout cannot race with
+// the turn or record effects the model was told did not happen.
+type turnState struct {
+	replied         bool
+	replyText       string
+	replyCount      int
+	webSearchCalled bool
+	imageGenCalled  bool
+	reacted         bool
+	sources         []SearchResult
+}
+
+type turnStateKey struct{}
+
+// callState returns the turn state of the Dispatch call ctx belongs to, or a
+// throwaway one for calls made outside Dispatch.
+func callState(ctx context.Context) *turnState {
+	if st, ok := ctx.Value(turnStateKey{}).(*turnState); ok {
+		return st
+	}
+	return &turnState{}
+}
+
+func (r *Registry) snapshot() *turnState {
+	return &turnState{
+		replied:         r.Replied,
+		replyText:       r.ReplyText,
+		replyCount:      r.ReplyCount,
+		webSearchCalled: r.WebSearchCalled,
+		imageGenCalled:  r.ImageGenCalled,
+		reacted:         r.Reacted,
+		sources:         slices.Clip(r.sources), // appends must not reach the registry's array
+	}
+}
+
+func (r *Registry) apply(st *turnState) {
+	r.Replied = st.replied
+	r.ReplyText = st.replyText
+	r.ReplyCount = st.replyCount
+	r.WebSearchCalled = st.webSearchCalled
+	r.ImageGenCalled = st.imageGenCalled
+	r.Reacted = st.reacted
+	r.sources = st.sources
 }
 
 // NewRegistry creates an empty registry.
@@ -50,11 +111,21 @@ func NewRegistry() *Registry {
 	return &Registry{tools: make(map[string]Tool)}
 }
 
-// Register adds a tool to the registry.
+// Register adds a tool to the registry unless the registry's tool policies
+// exclude it.
 func (r *Registry) Register(t Tool) {
+	if !PoliciesAllow(r.policies, t.Name()) {
+		slog.Debug("tool disabled by policy", "tool", t.Name())
+		return
+	}
 	r.tools[t.Name()] = t
 }
 
+// Names returns the names of the registered tools, sorted.
+func (r *Registry) Names() []string {
+	return slices.Sorted(maps.Keys(r.tools))
+}
+
 // Definitions returns all registered tools as LLM tool definitions.
 func (r *Registry) Definitions() []llm.ToolDefinition {
 	defs := make([]llm.ToolDefinition, 0, len(r.tools))
@@ -71,14 +142,90 @@ func (r *Registry) Definitions() []llm.ToolDefinition {
 	return defs
 }
 
-// Dispatch calls the named tool with the given args.
+// defaultToolTimeout bounds a tool call unless the tool sets its own bound.
+const defaultToolTimeout = 60 * time.Second
+
+// timeoutGrace is added to the timeout of tools that enforce their own, so
+// their error reaches the model before Dispatch gives up on the call.
+const timeoutGrace = 5 * time.Second
+
+// timeoutTool is implemented by tools whose calls need a bound other than
+// defaultToolTimeout.
+type timeoutTool interface {
+	Timeout() time.Duration
+}
+
+// Dispatch calls the named tool with the given args. Arguments are checked
+// against the tool's Parameters schema first; a mismatch is returned as an
+// *ArgumentError without calling the tool. The call is bounded by the tool's
+// timeout, and a panicking tool is recovered and reported as an error. Every
+// call is counted in Stats. Changes the call makes to the turn state (replies,
+// search sources, flags) are applied only if it finishes in time.
 func (r *Registry) Dispatch(ctx context.Context, name string, args json.RawMessage) (string, error) {
 	t, ok := r.tools[name]
 	if !ok {
 		slog.Warn("dispatch: unknown tool", "tool", name)
 		return fmt.Sprintf("Tool %q is not available. Respond to the user without it.", name), nil
 	}
-	return t.Call(ctx, args)
+	if err := validateArgs(t, args); err != nil {
+		slog.Info("tool arguments rejected", "tool", name, "error", err)
+		recordCall(name, 0, outcomeInvalidArgs)
+		return "", err
+	}
+	start := time.Now()
+	st := r.snapshot()
+	result, outcome, finished, err := callTool(context.WithValue(ctx, turnStateKey{}, st), t, args)
+	if finished {
+		r.apply(st)
+	}
+	latency := time.Since(start)
+	recordCall(name, latency, outcome)
+	slog.Debug("tool call finished", "tool", name, "latency", latency, "error", err)
+	return result, err
+}
+
+// callTool runs t.Call under the tool's timeout. A call that overruns is
+// abandoned: its context is cancelled and its result, if it ever returns, is
+// dropped. finished reports whether the call returned (or panicked) in time.
+func callTool(ctx context.Context, t Tool, args json.RawMessage) (text string, outcome callOutcome, finished bool, err error) {
+	timeout := defaultToolTimeout
+	if tt, ok := t.(timeoutTool); ok && tt.Timeout() > 0 {
+		timeout = tt.Timeout()
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type callResult struct {
+		text    string
+		outcome callOutcome
+		err     error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				slog.Error("tool panicked", "tool", t.Name(), "panic", p, "stack", string(debug.Stack()))
+				done <- callResult{outcome: outcomePanic, err: fmt.Errorf("tool %s failed unexpectedly", t.Name())}
+			}
+		}()
+		text, err := t.Call(callCtx, args)
+		outcome := outcomeOK
+		if err != nil {
+			outcome = outcomeError
+		}
+		done <- callResult{text: text, outcome: outcome, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.text, res.outcome, true, res.err
+	case <-callCtx.Done():
+		if ctx.Err() != nil {
+			return "", outcomeError, false, ctx.Err()
+		}
+		slog.Warn("tool call timed out", "tool", t.Name(), "timeout", timeout)
+		return "", outcomeTimeout, false, fmt.Errorf("tool %s timed out after %s", t.Name(), timeout)
+	}
 }
 
 // SendFunc sends a text message to the channel.
@@ -220,15 +367,82 @@ func (t *memoryForgetTool) Call(ctx context.Context, args json.RawMessage) (stri
 	return "Memory forgotten.", nil
 }
 
+type memoryUpdateTool struct {
+	store      *memory.Store
+	serverID   string
+	requesters *[]string // authors of the turn; nil skips the ownership check
+}
+
+func (t *memoryUpdateTool) Name() string { return "memory_update" }
+func (t *memoryUpdateTool) Description() string {
+	return "Correct or refine an existing memory in place, keeping its ID and creation date. " +
+		"Use this instead of memory_forget followed by memory_save when a remembered fact changes. " +
+		"Can also raise or lower the memory's importance. " +
+		"A memory about another user is only changed once that user confirms."
+}
+func (t *memoryUpdateTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+        "type": "object",
+        "properties": {
+            "memory_id": {"type": "string", "description": "ID of the memory to update, as shown by memory_recall."},
+            "content": {"type": "string", "description": "The corrected memory content. Omit to keep the current content."},
+            "importance": {"type": "number", "minimum": 0, "maximum": 1, "description": "New importance score 0.0-1.0. Omit to keep the current score."}
+        },
+        "required": ["memory_id"]
+    }`)
+}
+
+// Call applies the update unless the memory is about a user who is not
+// among the turn's authors. In that case nothing changes and the model is
+// told to ask that user; once they confirm, they are an author of the turn
+// that retries the update.
+func (t *memoryUpdateTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
+	var p struct {
+		MemoryID   string   `json:"memory_id"`
+		Content    *string  `json:"content"`
+		Importance *float64 `json:"importance"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return "", err
+	}
+	if p.Content == nil && p.Importance == nil {
+		return "Nothing to update: pass content, importance, or both.", nil
+	}
+	if p.Content != nil && strings.TrimSpace(*p.Content) == "" {
+		return "Error: content must not be empty. Use memory_forget to remove a memory.", nil
+	}
+
+	row, err := t.store.Get(ctx, t.serverID, p.MemoryID)
+	if errors.Is(err, memory.ErrMemoryNotFound) {
+		return "Memory not found.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if t.requesters != nil && row.UserID != "" && !slices.Contains(*t.requesters, row.UserID) {
+		return fmt.Sprintf("Not updated: memory %s is about <@%s>, who has not asked for this change. "+
+			"Ask <@%s> to confirm it, and call memory_update again once they do.", row.ID, row.UserID, row.UserID), nil
+	}
+
+	if p.Content != nil && *p.Content != row.Content {
+		if err := t.store.UpdateContent(ctx, row.ID, t.serverID, *p.Content); err != nil {
+			return "", err
+		}
+	}
+	if p.Importance != nil && *p.Importance != row.Importance {
+		if err := t.store.UpdateImportance(ctx, row.ID, t.serverID, *p.Importance); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("Memory updated (id: %s)", row.ID), nil
+}
+
 type replyTool struct {
 	send          SendFunc
-	replied       *bool
-	replyText     *string
-	replyCount    *int
 	maxReplyParts int
 }
 
-func (t *replyTool) Name() string { return "reply" }
+func (t *replyTool) Name() string { return ToolNameReply }
 func (t *replyTool) Description() string {
 	return "Send a text reply to the Discord channel."
 }
@@ -252,25 +466,32 @@ func (t *replyTool) Call(ctx context.Context, args json.RawMessage) (string, err
 	if isStageDirection(p.Content) {
 		return "Replied.", nil
 	}
+	st := callState(ctx)
 	// Guardrail: cap replies per turn to prevent runaway loops while still
 	// allowing a status message followed by the real answer (max 2).
-	if *t.replyCount >= 2 {
+	if st.replyCount >= 2 {
 		return "Reply limit reached for this turn.", nil
 	}
 	// Suppress exact duplicate of the previous reply — the LLM sometimes
 	// re-emits the same content in the post-reply iteration.
-	if *t.replyCount > 0 && p.Content == *t.replyText {
+	if st.replyCount > 0 && p.Content == st.replyText {
 		return "Replied.", nil
 	}
-	parts := SplitAndCapMessage(p.Content, 2000, t.maxReplyParts)
+	text := appendCitations(p.Content, st.sources)
+	parts := SplitAndCapMessage(text, 2000, t.maxReplyParts)
 	for _, part := range parts {
+		// Stop once the call is abandoned: the model has been told the reply
+		// failed and may send it again.
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
 		if err := t.send(part); err != nil {
 			return "", err
 		}
 	}
-	*t.replied = true
-	*t.replyCount++
-	*t.replyText = p.Content
+	st.replied = true
+	st.replyCount++
+	st.replyText = p.Content
 	return "Replied.", nil
 }
 
@@ -342,8 +563,7 @@ func SplitAndCapMessage(s string, limit int, maxParts int) []string {
 var customEmojiRe = regexp.MustCompile(`^<a?:(\w+:\d+)>$`)
 
 type reactTool struct {
-	react   ReactFunc
-	reacted *bool
+	react ReactFunc
 }
 
 func (t *reactTool) Name() string { return "react" }
@@ -373,31 +593,38 @@ func (t *reactTool) Call(ctx context.Context, args json.RawMessage) (string, err
 	if err := t.react(emoji); err != nil {
 		return "", err
 	}
-	*t.reacted = true
+	callState(ctx).reacted = true
 	return "Reacted.", nil
 }
 
-// WebSearchDeps groups dependencies for the async web search tool.
+// WebSearchDeps groups dependencies for the web search tool.
 // Pass nil to NewDefaultRegistry to omit web search from the registry.
 type WebSearchDeps struct {
 	DeliverResult  func(result string) // injects results back into agent
-	LLM            *llm.Client
-	Model          string
 	Ctx            context.Context
 	SearchWg       *sync.WaitGroup
 	SearchRunning  *atomic.Bool
 	TimeoutSeconds int
-	SearchProvider string // "brave" | "glm"
-	SearchAPIKey   string // Brave API key
+	Providers      []SearchProvider // tried in order until one returns results
+	HTTPClient     *http.Client     // for web_fetch; nil uses http.DefaultClient
+	Cache          *Cache           // shared page and search cache; nil disables caching
+	SearchCacheTTL time.Duration    // how long search results are reused
+
+	// Sync makes web_search return its results as the tool result, within the
+	// turn, instead of delivering them to a later turn through DeliverResult.
+	Sync bool
 }
 
 type webSearchTool struct {
-	deps         *WebSearchDeps
-	searchCalled *bool
+	deps *WebSearchDeps
 }
 
 func (t *webSearchTool) Name() string { return ToolNameWebSearch }
 func (t *webSearchTool) Description() string {
+	if t.deps.Sync {
+		return "Search the web for current information. Returns numbered results; cite the ones you use " +
+			"in your reply as [1], [2] and so on, and links to them are added to the reply automatically."
+	}
 	return "Search the web for current information. You MUST call this tool to trigger a search — " +
 		"results will not appear unless you explicitly invoke it. " +
 		"After calling this tool, use the reply tool to tell the user you are searching (in their language)."
@@ -411,6 +638,16 @@ func (t *webSearchTool) Parameters() json.RawMessage {
         "required": ["query"]
     }`)
 }
+
+// Timeout bounds synchronous searches by the search timeout; async calls
+// return at once.
+func (t *webSearchTool) Timeout() time.Duration {
+	if !t.deps.Sync || t.deps.TimeoutSeconds <= 0 {
+		return 0
+	}
+	return time.Duration(t.deps.TimeoutSeconds)*time.Second + timeoutGrace
+}
+
 func (t *webSearchTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
 	var p struct {
 		Query string `json:"query"`
@@ -421,18 +658,60 @@ func (t *webSearchTool) Call(ctx context.Context, args json.RawMessage) (string,
 	if p.Query == "" {
 		return "Error: query is required", nil
 	}
+	if t.deps.Sync {
+		return t.searchNow(ctx, p.Query), nil
+	}
 	if !t.deps.SearchRunning.CompareAndSwap(false, true) {
 		return "A web search is already running, please wait for results.", nil
 	}
 	// Set only on the successful CAS path so processTurn's loop-break guard
 	// fires exclusively when a new search was actually launched, not on a skip.
-	*t.searchCalled = true
+	callState(ctx).webSearchCalled = true
 
 	t.deps.SearchWg.Add(1)
 	go t.runSearch(p.Query)
 	return fmt.Sprintf("Web search started for: %q — results will arrive shortly.", p.Query), nil
 }
 
+// search returns results for query from the cache or the providers.
+func (t *webSearchTool) search(ctx context.Context, query string) (cachedSearch, error) {
+	providers := providerNames(t.deps.Providers)
+	if hit, ok := t.deps.Cache.lookupSearch(providers, query); ok {
+		return hit, nil
+	}
+	results, answered, err := searchProviders(ctx, t.deps.Providers, query, defaultSearchResults)
+	if err != nil {
+		slog.Error("web search failed", "error", err, "query", query, "providers", providers)
+		return cachedSearch{}, err
+	}
+	hit := cachedSearch{Provider: answered, Results: results}
+	if len(results) > 0 {
+		t.deps.Cache.storeSearch(providers, query, hit, t.deps.SearchCacheTTL)
+	}
+	return hit, nil
+}
+
+// searchNow runs a synchronous search. Results are numbered after those of
+// earlier searches in the turn, so citations stay unambiguous.
+func (t *webSearchTool) searchNow(ctx context.Context, query string) string {
+	if t.deps.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(t.deps.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	hit, err := t.search(ctx, query)
+	if err != nil {
+		return fmt.Sprintf("Web search for %q failed: %s", query, err)
+	}
+	if len(hit.Results) == 0 {
+		return fmt.Sprintf("No results found for %q.", query)
+	}
+	st := callState(ctx)
+	first := len(st.sources) + 1
+	st.sources = append(st.sources, hit.Results...)
+	return fmt.Sprintf("Search results for %q %s\n\nCite the results you use as [n].", query, formatSearchResults(hit.Results, hit.Provider, first))
+}
+
 func (t *webSearchTool) runSearch(query string) {
 	defer t.deps.SearchWg.Done()
 	defer t.deps.SearchRunning.Store(false)
@@ -440,43 +719,16 @@ func (t *webSearchTool) runSearch(query string) {
 	ctx, cancel := context.WithTimeout(t.deps.Ctx, time.Duration(t.deps.TimeoutSeconds)*time.Second)
 	defer cancel()
 
-	// Use Brave Search if configured
-	if t.deps.SearchProvider == "brave" && t.deps.SearchAPIKey != "" {
-		client := newBraveClient(t.deps.SearchAPIKey)
-		result, err := client.searchToMarkdown(ctx, query, 10)
-		if err != nil {
-			slog.Error("brave search failed", "error", err, "query", query)
-			t.deps.DeliverResult(fmt.Sprintf("[SYSTEM:web_search_results]\nWeb search for %q failed: %s", query, err))
-			return
-		}
-		t.deps.DeliverResult(fmt.Sprintf("[SYSTEM:web_search_results]\nSearch results for %q:\n\n%s", query, result))
-		return
-	}
-
-	// Fall back to GLM built-in web search
-	messages := []llm.Message{
-		{Role: "user", Content: fmt.Sprintf("Search the web for: %s\n\nReturn comprehensive results with titles, URLs, and detailed content summaries.", query)},
-	}
-
-	glmSearchSpec := json.RawMessage(`{"type":"web_search","web_search":{"enable":true,"search_result":true,"search_engine":"search_pro","content_size":"high"}}`)
-	opts := &llm.ChatOptions{
-		Provider:   "glm",
-		Model:      t.deps.Model,
-		ExtraTools: []json.RawMessage{glmSearchSpec},
-	}
-
-	choice, err := t.deps.LLM.Chat(ctx, messages, nil, opts)
+	hit, err := t.search(ctx, query)
 	if err != nil {
-		slog.Error("web search background call failed", "error", err, "query", query)
 		t.deps.DeliverResult(fmt.Sprintf("[SYSTEM:web_search_results]\nWeb search for %q failed: %s", query, err))
 		return
 	}
-
-	result := choice.Message.Content
-	if result == "" {
-		result = "No results found."
+	if len(hit.Results) == 0 {
+		t.deps.DeliverResult(fmt.Sprintf("[SYSTEM:web_search_results]\nSearch results for %q:\n\nNo results found.", query))
+		return
 	}
-	t.deps.DeliverResult(fmt.Sprintf("[SYSTEM:web_search_results]\nSearch results for %q:\n\n%s", query, result))
+	t.deps.DeliverResult(fmt.Sprintf("[SYSTEM:web_search_results]\nSearch results for %q %s", query, formatSearchResults(hit.Results, hit.Provider, 1)))
 }
 
 // NewReplyOnlyRegistry creates a minimal registry with only the reply and react tools.
@@ -484,26 +736,32 @@ func (t *webSearchTool) runSearch(query string) {
 // should just summarize and reply without calling memory or search tools.
 func NewReplyOnlyRegistry(send SendFunc, react ReactFunc, maxReplyParts int) *Registry {
 	r := NewRegistry()
-	r.Register(&replyTool{send: send, replied: &r.Replied, replyText: &r.ReplyText, replyCount: &r.ReplyCount, maxReplyParts: maxReplyParts})
-	r.Register(&reactTool{react: react, reacted: &r.Reacted})
+	r.Register(&replyTool{send: send, maxReplyParts: maxReplyParts})
+	r.Register(&reactTool{react: react})
 	return r
 }
 
 // NewDefaultRegistry creates a registry with standard tools.
 // If searchDeps is non-nil, the async web_search and web_fetch tools are also registered.
-func NewDefaultRegistry(store *memory.Store, serverID string, dedupThreshold float64, defaultRecallLimit int, send SendFunc, react ReactFunc, searchDeps *WebSearchDeps, imageGenDeps *ImageGenDeps, maxReplyParts int) *Registry {
+// The policies in agentTools stay with the registry, so they also filter plugin
+// and MCP tools added later.
+func NewDefaultRegistry(store *memory.Store, serverID string, dedupThreshold float64, defaultRecallLimit int, send SendFunc, react ReactFunc, searchDeps *WebSearchDeps, imageGenDeps *ImageGenDeps, maxReplyParts int, agentTools *AgentToolsDeps) *Registry {
 	r := NewRegistry()
+	if agentTools != nil {
+		r.policies = agentTools.Policies
+	}
 	r.Register(&memorySaveTool{store: store, serverID: serverID, dedupThreshold: dedupThreshold})
 	r.Register(&memoryRecallTool{store: store, serverID: serverID, defaultTopN: defaultRecallLimit})
 	r.Register(&memoryForgetTool{store: store, serverID: serverID})
-	r.Register(&replyTool{send: send, replied: &r.Replied, replyText: &r.ReplyText, replyCount: &r.ReplyCount, maxReplyParts: maxReplyParts})
-	r.Register(&reactTool{react: react, reacted: &r.Reacted})
+	r.Register(&memoryUpdateTool{store: store, serverID: serverID, requesters: &r.Requesters})
+	r.Register(&replyTool{send: send, maxReplyParts: maxReplyParts})
+	r.Register(&reactTool{react: react})
 	if searchDeps != nil {
-		r.Register(&webSearchTool{deps: searchDeps, searchCalled: &r.WebSearchCalled})
-		r.Register(&webFetchTool{timeoutSeconds: searchDeps.TimeoutSeconds})
+		r.Register(&webSearchTool{deps: searchDeps})
+		r.Register(&webFetchTool{timeoutSeconds: searchDeps.TimeoutSeconds, client: searchDeps.HTTPClient, cache: searchDeps.Cache})
 	}
 	if imageGenDeps != nil {
-		r.Register(&imageGenTool{deps: imageGenDeps, imageCalled: &r.ImageGenCalled})
+		r.Register(&imageGenTool{deps: imageGenDeps})
 		if imageGenDeps.VisualStore != nil && imageGenDeps.ServerID != "" {
 			r.Register(&visualMemorySaveTool{
 				store:           imageGenDeps.VisualStore,
@@ -514,6 +772,17 @@ func NewDefaultRegistry(store *memory.Store, serverID string, dedupThreshold flo
 			})
 			r.Register(&visualMemoryRecallTool{store: imageGenDeps.VisualStore, serverID: imageGenDeps.ServerID})
 		}
+		if imageGenDeps.VisualStore != nil && imageGenDeps.GalleryServerID != "" {
+			r.Register(&imageGallerySearchTool{store: imageGenDeps.VisualStore, serverID: imageGenDeps.GalleryServerID})
+		}
+	}
+	if agentTools != nil && agentTools.KnowledgeScope != "" {
+		r.Register(&knowledgeSearchTool{store: store, serverID: agentTools.KnowledgeScope})
+	}
+	if agentTools != nil {
+		for _, spec := range agentTools.HTTP {
+			r.registerExternal(&httpTool{spec: spec}, slog.With("server_id", serverID))
+		}
 	}
 	return r
 }
@@ -521,8 +790,8 @@ func NewDefaultRegistry(store *memory.Store, serverID string, dedupThreshold flo
 // RegisterWebFetch adds web_fetch to the registry without web_search.
 // Used in internal search-result turns where the LLM can follow up on URLs
 // but must not trigger new searches (which would cause infinite loops).
-func (r *Registry) RegisterWebFetch(timeoutSeconds int) {
-	r.Register(&webFetchTool{timeoutSeconds: timeoutSeconds})
+func (r *Registry) RegisterWebFetch(timeoutSeconds int, client *http.Client, cache *Cache) {
+	r.Register(&webFetchTool{timeoutSeconds: timeoutSeconds, client: client, cache: cache})
 }
 
 // NewMemoryOnlyRegistry creates a registry with only memory_save and memory_recall.
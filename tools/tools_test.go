@@ -121,7 +121,7 @@ func TestReplyToolSplitMessageCap(t *testing.T) {
 	}
 	react := func(emoji string) error { return nil }
 
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 
 	// Build a message that will produce 4 parts when split at 2000 chars.
 	longContent := strings.Repeat("a", 7000)
@@ -143,7 +143,7 @@ func TestReplyToolRateLimit(t *testing.T) {
 	}
 	react := func(emoji string) error { return nil }
 
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 	ctx := context.Background()
 
 	// First call: should send.
@@ -191,7 +191,7 @@ func TestReplyToolDuplicateSuppression(t *testing.T) {
 	}
 	react := func(emoji string) error { return nil }
 
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 	ctx := context.Background()
 
 	// First reply: should send.
@@ -240,13 +240,11 @@ func newSearchDeps(searchRunning *atomic.Bool, wg *sync.WaitGroup, deliver func(
 	}
 	return &tools.WebSearchDeps{
 		DeliverResult:  deliver,
-		LLM:            nil, // not reached in CAS-failure path; tests guard against the goroutine path
-		Model:          "",
 		Ctx:            context.Background(),
 		SearchWg:       wg,
 		SearchRunning:  searchRunning,
 		TimeoutSeconds: 5,
-		// SearchProvider left empty: falls through to the GLM path which we never reach
+		// Providers left empty: the search goroutine is never reached
 		// because we only test the CAS guard and the early-return branch.
 	}
 }
@@ -258,30 +256,26 @@ func TestWebSearchCalledFlagSetOnSuccessfulCAS(t *testing.T) {
 	var searchRunning atomic.Bool
 	var wg sync.WaitGroup
 
-	// Use a pre-cancelled context so the background goroutine's HTTP/LLM call
-	// fails immediately due to context cancellation rather than panicking on a
-	// nil LLM client. DeliverResult is always called by runSearch before it
+	// Use a pre-cancelled context so the background goroutine's HTTP call
+	// fails immediately due to context cancellation. DeliverResult is always called by runSearch before it
 	// returns, so the WaitGroup will still complete.
 	cancelledCtx, cancel := context.WithCancel(context.Background())
 	cancel() // cancel immediately
 
 	deps := &tools.WebSearchDeps{
 		DeliverResult:  func(string) {}, // no-op; we only care about the CAS path
-		LLM:            nil,
-		Model:          "",
 		Ctx:            cancelledCtx,
 		SearchWg:       &wg,
 		SearchRunning:  &searchRunning,
 		TimeoutSeconds: 5,
-		SearchProvider: "brave",
-		SearchAPIKey:   "fake-key-to-enter-brave-path",
+		Providers:      []tools.SearchProvider{tools.NewBraveSearch("fake-key", nil)},
 		// Brave client will use the cancelled context and fail with a context error
 		// before making any real network call.
 	}
 
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, deps, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, deps, nil, 2, nil)
 
 	if r.WebSearchCalled {
 		t.Fatal("WebSearchCalled should be false before any tool call")
@@ -317,7 +311,7 @@ func TestWebSearchCalledFlagNotSetWhenAlreadyRunning(t *testing.T) {
 
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, deps, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, deps, nil, 2, nil)
 
 	result, err := r.Dispatch(context.Background(), "web_search", json.RawMessage(`{"query":"concurrent query"}`))
 	if err != nil {
@@ -347,7 +341,7 @@ func TestWebSearchCalledFlagEmptyQueryReturnsEarly(t *testing.T) {
 
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, deps, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, deps, nil, 2, nil)
 
 	result, err := r.Dispatch(context.Background(), "web_search", json.RawMessage(`{"query":""}`))
 	if err != nil {
@@ -372,7 +366,7 @@ func TestWebSearchCalledFlagEmptyQueryReturnsEarly(t *testing.T) {
 func TestRegistryLoopBreakConditionBothFlagsSet(t *testing.T) {
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 
 	// Initially neither flag is set.
 	if r.WebSearchCalled || r.Replied {
@@ -448,7 +442,7 @@ func TestRegistryWebSearchCalledIsStickyLatch(t *testing.T) {
 func TestReactToolSetsReactedFlag(t *testing.T) {
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 
 	if r.Reacted {
 		t.Fatal("Reacted should be false before any tool call")
@@ -469,7 +463,7 @@ func TestReactToolSetsReactedFlag(t *testing.T) {
 func TestReactToolDoesNotSetReactedOnError(t *testing.T) {
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { return fmt.Errorf("discord error") }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "react", json.RawMessage(`{"emoji":"👍"}`))
 	if err == nil {
@@ -484,7 +478,7 @@ func TestReactToolSanitizesCustomEmoji(t *testing.T) {
 	var gotEmoji string
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { gotEmoji = emoji; return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "react", json.RawMessage(`{"emoji":"<:fire:971088588706033684>"}`))
 	if err != nil {
@@ -499,7 +493,7 @@ func TestReactToolSanitizesAnimatedEmoji(t *testing.T) {
 	var gotEmoji string
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { gotEmoji = emoji; return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "react", json.RawMessage(`{"emoji":"<a:wave:456>"}`))
 	if err != nil {
@@ -514,7 +508,7 @@ func TestReactToolPassesUnicodeEmojiThrough(t *testing.T) {
 	var gotEmoji string
 	send := func(content string) error { return nil }
 	react := func(emoji string) error { gotEmoji = emoji; return nil }
-	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2)
+	r := tools.NewDefaultRegistry(nil, "", 0, 0, send, react, nil, nil, 2, nil)
 
 	_, err := r.Dispatch(context.Background(), "react", json.RawMessage(`{"emoji":"👍"}`))
 	if err != nil {
@@ -0,0 +1,51 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// quickReplyTool is a reply tool with a short timeout.
+type quickReplyTool struct{ *replyTool }
+
+func (quickReplyTool) Timeout() time.Duration { return 50 * time.Millisecond }
+
+func TestDispatchDropsStateOfAbandonedCall(t *testing.T) {
+	release := make(chan struct{})
+	var sent atomic.Int32
+	send := func(string) error {
+		<-release
+		sent.Add(1)
+		return nil
+	}
+	r := NewRegistry()
+	r.Register(quickReplyTool{&replyTool{send: send, maxReplyParts: 5}})
+
+	long := strings.Repeat("word ", 1000) // several message parts
+	args, _ := json.Marshal(map[string]string{"content": long})
+	if _, err := r.Dispatch(context.Background(), ToolNameReply, args); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Dispatch error = %v, want timeout", err)
+	}
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+
+	if r.Replied || r.ReplyCount != 0 || r.ReplyText != "" {
+		t.Errorf("abandoned reply changed the turn: replied=%v count=%d text=%q", r.Replied, r.ReplyCount, r.ReplyText)
+	}
+	if n := sent.Load(); n != 1 {
+		t.Errorf("sent %d parts after the timeout, want only the one in flight", n)
+	}
+
+	// A call that finishes in time is recorded.
+	r = NewReplyOnlyRegistry(func(string) error { return nil }, func(string) error { return nil }, 5)
+	if _, err := r.Dispatch(context.Background(), ToolNameReply, json.RawMessage(`{"content":"hi"}`)); err != nil {
+		t.Fatalf("Dispatch error: %v", err)
+	}
+	if !r.Replied || r.ReplyCount != 1 || r.ReplyText != "hi" {
+		t.Errorf("reply not recorded: replied=%v count=%d text=%q", r.Replied, r.ReplyCount, r.ReplyText)
+	}
+}
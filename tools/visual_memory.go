@@ -29,7 +29,7 @@ func (t *visualMemorySaveTool) Parameters() json.RawMessage {
 		"type": "object",
 		"properties": {
 			"label": {"type": "string", "description": "Name or short label for the person/object shown."},
-			"description": {"type": "string", "description": "Brief visual description useful for future recall."},
+			"description": {"type": "string", "description": "Optional context the image alone does not show, such as where it is from. The image itself is described automatically."},
 			"user_id": {"type": "string", "description": "Optional Discord user ID this visual memory is about."},
 			"importance": {"type": "number", "description": "Importance score 0.0-1.0, default 0.5."}
 		},
@@ -59,6 +59,7 @@ func (t *visualMemorySaveTool) Call(ctx context.Context, args json.RawMessage) (
 
 	var saved, existing int
 	var ids []string
+	var lookalikes []memory.VisualMemoryRow
 	for _, source := range t.sourceImageURLs {
 		contentType, data, err := parseDataURL(source)
 		if err != nil {
@@ -79,6 +80,7 @@ func (t *visualMemorySaveTool) Call(ctx context.Context, args json.RawMessage) (
 			return "", err
 		}
 		ids = append(ids, result.ID)
+		lookalikes = append(lookalikes, result.NearDuplicates...)
 		if result.Status == memory.SaveStatusExists {
 			existing++
 		} else {
@@ -88,7 +90,17 @@ func (t *visualMemorySaveTool) Call(ctx context.Context, args json.RawMessage) (
 	if saved == 0 && existing > 0 {
 		return fmt.Sprintf("Visual memory already exists (id: %s)", strings.Join(ids, ", ")), nil
 	}
-	return fmt.Sprintf("Visual memory saved (id: %s)", strings.Join(ids, ", ")), nil
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Visual memory saved (id: %s)", strings.Join(ids, ", "))
+	seen := make(map[string]bool)
+	for _, row := range lookalikes {
+		if seen[row.ID] {
+			continue
+		}
+		seen[row.ID] = true
+		fmt.Fprintf(&sb, "\nNote: this image looks nearly identical to visual memory [%s] %q; ask the user whether the label is right.", row.ID, row.Label)
+	}
+	return sb.String(), nil
 }
 
 type visualMemoryRecallTool struct {
@@ -98,7 +110,7 @@ type visualMemoryRecallTool struct {
 
 func (t *visualMemoryRecallTool) Name() string { return ToolNameVisualMemoryRecall }
 func (t *visualMemoryRecallTool) Description() string {
-	return "Search long-term visual references by person/object label or description. " +
+	return "Search long-term visual references by person/object label or by what they look like. " +
 		"Use this before generate_image when a requested image may involve someone or something visually remembered."
 }
 func (t *visualMemoryRecallTool) Parameters() json.RawMessage {
@@ -119,7 +131,7 @@ func (t *visualMemoryRecallTool) Call(ctx context.Context, args json.RawMessage)
 	if err := json.Unmarshal(args, &p); err != nil {
 		return "", err
 	}
-	rows, err := t.store.RecallVisual(ctx, p.Query, t.serverID, p.TopN)
+	rows, err := t.store.RecallVisual(ctx, p.Query, t.serverID, p.TopN, 0)
 	if err != nil {
 		return "", err
 	}
@@ -132,6 +144,9 @@ func (t *visualMemoryRecallTool) Call(ctx context.Context, args json.RawMessage)
 		if row.Description != "" {
 			fmt.Fprintf(&sb, " — %s", row.Description)
 		}
+		if row.Caption != "" {
+			fmt.Fprintf(&sb, " (looks like: %s)", row.Caption)
+		}
 		fmt.Fprintln(&sb)
 	}
 	return sb.String(), nil
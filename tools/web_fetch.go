@@ -3,18 +3,27 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/net/html"
+
+	"github.com/tomasmach/vespra/netguard"
+	"github.com/tomasmach/vespra/pdftext"
 )
 
 const (
-	maxFetchBytes  = 2 << 20 // 2 MB
-	maxOutputChars = 8000
+	maxFetchBytes    = 2 << 20  // 2 MB
+	maxPDFFetchBytes = 20 << 20 // 20 MB
+	maxOutputChars   = 8000
 )
 
 // skipTags is the set of HTML elements whose subtrees are skipped during text extraction.
@@ -31,28 +40,43 @@ var skipTags = map[string]bool{
 
 type webFetchTool struct {
 	timeoutSeconds int
+	client         *http.Client // nil uses http.DefaultClient
+	cache          *Cache       // nil disables caching
 }
 
 func (t *webFetchTool) Name() string { return ToolNameWebFetch }
 func (t *webFetchTool) Description() string {
-	return "Fetch a web page and extract its readable text content. " +
+	return "Fetch a web page or PDF document and extract its readable text content. " +
+		"Web pages are reduced to the main article (title, byline and body as markdown, with links); " +
+		"menus, banners and footers are left out. " +
 		"Use when you need to read actual page content — to get current data, " +
 		"read an article, or inspect a URL the user shared. " +
+		"Long PDFs are cut off; fetch again with pages to read further. " +
 		"Do NOT use just to provide a link to the user."
 }
 func (t *webFetchTool) Parameters() json.RawMessage {
 	return json.RawMessage(`{
         "type": "object",
         "properties": {
-            "url": {"type": "string", "description": "The URL to fetch."}
+            "url": {"type": "string", "description": "The URL to fetch."},
+            "pages": {"type": "string", "description": "For PDF documents, the pages to read, such as \"3\", \"2-5\" or \"10-\". Defaults to the whole document."}
         },
         "required": ["url"]
     }`)
 }
 
+func (t *webFetchTool) Timeout() time.Duration {
+	timeout := t.timeoutSeconds
+	if timeout <= 0 {
+		timeout = 15
+	}
+	return time.Duration(timeout)*time.Second + timeoutGrace
+}
+
 func (t *webFetchTool) Call(ctx context.Context, args json.RawMessage) (string, error) {
 	var p struct {
-		URL string `json:"url"`
+		URL   string `json:"url"`
+		Pages string `json:"pages"`
 	}
 	if err := json.Unmarshal(args, &p); err != nil {
 		return "", err
@@ -60,6 +84,10 @@ func (t *webFetchTool) Call(ctx context.Context, args json.RawMessage) (string,
 	if p.URL == "" {
 		return "Error: url is required", nil
 	}
+	firstPage, lastPage, err := pdftext.ParsePageRange(p.Pages)
+	if err != nil {
+		return fmt.Sprintf("Error: %s", err), nil
+	}
 
 	timeout := t.timeoutSeconds
 	if timeout <= 0 {
@@ -68,39 +96,168 @@ func (t *webFetchTool) Call(ctx context.Context, args json.RawMessage) (string,
 	fetchCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
+	client := t.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	key := fetchCacheKey(p.URL)
+	cached, _ := t.cache.get(key)
+	if cached != nil {
+		// The network policy may have changed since the page was cached; both
+		// the requested URL and the one redirects led to must still pass.
+		for _, raw := range []string{p.URL, cached.URL} {
+			u, _ := url.Parse(raw)
+			if u == nil || netguard.CheckURL(client, u) != nil {
+				cached = nil
+				break
+			}
+		}
+	}
+	if cached != nil && cached.fresh(time.Now()) {
+		t.cache.count(func(n *cacheCounters) { n.fetchHits++ })
+		return fetchedText(cached, firstPage, lastPage), nil
+	}
+
 	req, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, p.URL, nil)
 	if err != nil {
 		return fmt.Sprintf("Error: invalid URL: %s", err), nil
 	}
 	req.Header.Set("User-Agent", "Vespra/1.0 (Discord Bot)")
-	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Accept", "text/html, application/xhtml+xml, application/pdf;q=0.9, text/*;q=0.8")
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
+		if blocked := (*netguard.BlockedError)(nil); errors.As(err, &blocked) {
+			return fmt.Sprintf("Error: this URL cannot be fetched (%s).", blocked), nil
+		}
 		return fmt.Sprintf("Error: failed to fetch URL: %s", err), nil
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		cached.revalidated(resp.Header, time.Now())
+		t.cache.put(cached)
+		t.cache.count(func(n *cacheCounters) { n.fetchRevalidated++ })
+		return fetchedText(cached, firstPage, lastPage), nil
+	}
+	if key != "" {
+		t.cache.count(func(n *cacheCounters) { n.fetchMisses++ })
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return fmt.Sprintf("Error: HTTP %d %s", resp.StatusCode, resp.Status), nil
 	}
 
-	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+	limit := int64(maxFetchBytes)
+	if isPDFResponse(resp.Header.Get("Content-Type"), resp.Request.URL) {
+		limit = maxPDFFetchBytes
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
 	if err != nil {
 		return fmt.Sprintf("Error: failed to read response: %s", err), nil
 	}
+	entry := &cacheEntry{ContentType: resp.Header.Get("Content-Type"), URL: resp.Request.URL.String(), Body: body}
+	if key != "" {
+		if e := fetchEntry(key, resp, body, time.Now()); e != nil {
+			t.cache.put(e)
+		}
+	}
+	return fetchedText(entry, firstPage, lastPage), nil
+}
 
-	text := extractText(string(body))
-	if len(text) > maxOutputChars {
-		text = text[:maxOutputChars] + "\n\n[content truncated]"
+// fetchedText extracts the text of a fetched response, live or cached.
+func fetchedText(e *cacheEntry, firstPage, lastPage int) string {
+	if pdftext.IsPDF(e.Body) {
+		return fetchedPDFText(e.Body, firstPage, lastPage)
 	}
+	base, _ := url.Parse(e.URL)
+	text := formatArticle(extractArticle(string(e.Body), base))
 	if text == "" {
-		return "No readable text content found on the page.", nil
+		text = extractText(string(e.Body))
+	}
+	text = truncateText(text, maxOutputChars)
+	if text == "" {
+		return "No readable text content found on the page."
+	}
+	return text
+}
+
+// truncateText cuts text to at most max bytes on a rune boundary and marks
+// the cut.
+func truncateText(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "\n\n[content truncated]"
+}
+
+// isPDFResponse reports whether a response announces a PDF document, either
+// by content type or, for generic binary types, by the file extension.
+func isPDFResponse(contentType string, u *url.URL) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/pdf", "application/x-pdf":
+		return true
+	case "", "application/octet-stream", "binary/octet-stream":
+		return strings.EqualFold(path.Ext(u.Path), ".pdf")
+	}
+	return false
+}
+
+// fetchedPDFText formats the text of a fetched PDF for the model, noting how
+// to continue when the output is cut off.
+func fetchedPDFText(data []byte, firstPage, lastPage int) string {
+	res, err := pdftext.Extract(data, pdftext.Options{FirstPage: firstPage, LastPage: lastPage, MaxChars: maxOutputChars})
+	if errors.Is(err, pdftext.ErrNoText) {
+		return fmt.Sprintf("No extractable text in pages %d-%d of the PDF; it may contain only scanned images.", res.FirstPage, res.LastPage)
+	}
+	if err != nil {
+		return fmt.Sprintf("Error: could not read PDF: %s", err)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "PDF document, %d pages (showing pages %d-%d).\n\n", res.Pages, res.FirstPage, res.LastPage)
+	sb.WriteString(res.Text)
+	if res.Truncated {
+		fmt.Fprintf(&sb, "\n\n[content truncated in page %d; fetch again with pages=\"%d-\" to continue]", res.LastPage, res.LastPage)
+	}
+	return sb.String()
+}
+
+// formatArticle lays out an extracted article for the model: the title as a
+// heading, the byline, then the content. It returns "" if no content was
+// found.
+func formatArticle(a article) string {
+	if a.Content == "" {
+		return ""
+	}
+	var sb strings.Builder
+	if a.Title != "" {
+		sb.WriteString("# " + a.Title + "\n")
+	}
+	if a.Byline != "" {
+		sb.WriteString("By " + a.Byline + "\n")
+	}
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
 	}
-	return text, nil
+	sb.WriteString(a.Content)
+	return sb.String()
 }
 
-// extractText parses HTML and returns visible text, skipping non-content elements.
+// extractText parses HTML and returns visible text, skipping non-content
+// elements. It is the fallback when extractArticle finds no content.
 func extractText(htmlContent string) string {
 	tokenizer := html.NewTokenizer(strings.NewReader(htmlContent))
 	var sb strings.Builder
@@ -5,8 +5,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/tomasmach/vespra/netguard"
 )
 
 func TestExtractText(t *testing.T) {
@@ -86,6 +92,57 @@ func TestExtractTextSelfClosingSkipTag(t *testing.T) {
 	}
 }
 
+// TestExtractArticleFixtures runs the extractor over saved pages in
+// testdata/readability and compares the result with the .md file next to
+// each page.
+func TestExtractArticleFixtures(t *testing.T) {
+	for _, name := range []string{"news", "docs", "blog"} {
+		t.Run(name, func(t *testing.T) {
+			page, err := os.ReadFile(filepath.Join("testdata", "readability", name+".html"))
+			if err != nil {
+				t.Fatalf("read fixture: %v", err)
+			}
+			want, err := os.ReadFile(filepath.Join("testdata", "readability", name+".md"))
+			if err != nil {
+				t.Fatalf("read expected output: %v", err)
+			}
+			base, _ := url.Parse("https://example.com/section/" + name + ".html")
+			got := formatArticle(extractArticle(string(page), base))
+			if got != strings.TrimSuffix(string(want), "\n") {
+				t.Errorf("got:\n%s\n\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestExtractArticleDropsChrome(t *testing.T) {
+	page, err := os.ReadFile(filepath.Join("testdata", "readability", "news.html"))
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+	a := extractArticle(string(page), nil)
+	if a.Title != "City council approves new tram line to the airport" || a.Byline != "Jana Novak" {
+		t.Errorf("Title = %q, Byline = %q", a.Title, a.Byline)
+	}
+	for _, chrome := range []string{"cookies", "Politics", "Advertisement", "Related", "Share on", "Comments", "Most read", "morning briefing", "All rights reserved"} {
+		if strings.Contains(a.Content, chrome) {
+			t.Errorf("content contains page chrome %q", chrome)
+		}
+	}
+}
+
+func TestExtractArticleDoubleBreaks(t *testing.T) {
+	page := `<html><body><div class="post">First paragraph of the post, which is long enough to count.<br><br>` +
+		`Second paragraph, with a <a href="/next">link</a>.<br>Same paragraph, new line.</div></body></html>`
+	base, _ := url.Parse("https://blog.example/2026/post")
+	a := extractArticle(page, base)
+	want := "First paragraph of the post, which is long enough to count.\n\n" +
+		"Second paragraph, with a [link](https://blog.example/next).\nSame paragraph, new line."
+	if a.Content != want {
+		t.Errorf("Content =\n%s\nwant\n%s", a.Content, want)
+	}
+}
+
 func TestWebFetchToolHTTPError(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
@@ -103,6 +160,23 @@ func TestWebFetchToolHTTPError(t *testing.T) {
 	}
 }
 
+func TestWebFetchToolBlocked(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("internal"))
+	}))
+	defer srv.Close()
+
+	tool := &webFetchTool{client: netguard.NewClient(func() netguard.Policy { return netguard.Policy{} }, 5*time.Second)}
+	args, _ := json.Marshal(map[string]string{"url": srv.URL})
+	result, err := tool.Call(context.Background(), args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result, "cannot be fetched") || strings.Contains(result, "internal") {
+		t.Errorf("expected a blocked message, got: %s", result)
+	}
+}
+
 func TestWebFetchToolSuccess(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
@@ -144,3 +218,61 @@ func TestWebFetchToolTruncation(t *testing.T) {
 		t.Errorf("expected truncation marker, got suffix: %s", result[len(result)-50:])
 	}
 }
+
+// testPDF is a two-page PDF with one line of text per page.
+const testPDF = `%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R >> >> >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R /Contents 6 0 R >> endobj
+4 0 obj << /Type /Page /Parent 2 0 R /Contents 7 0 R >> endobj
+5 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj
+6 0 obj << /Length 44 >>
+stream
+BT /F1 12 Tf 72 700 Td (Annual report) Tj ET
+endstream
+endobj
+7 0 obj << /Length 42 >>
+stream
+BT /F1 12 Tf 72 700 Td (Second page) Tj ET
+endstream
+endobj
+trailer << /Root 1 0 R >>
+%%EOF
+`
+
+func TestWebFetchToolPDF(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/report" {
+			w.Header().Set("Content-Type", "application/pdf")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.Write([]byte(testPDF))
+	}))
+	defer srv.Close()
+
+	tool := &webFetchTool{}
+	args, _ := json.Marshal(map[string]string{"url": srv.URL + "/report"})
+	result, err := tool.Call(context.Background(), args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "PDF document, 2 pages (showing pages 1-2).\n\n[Page 1]\nAnnual report\n\n[Page 2]\nSecond page"
+	if result != want {
+		t.Errorf("result = %q, want %q", result, want)
+	}
+
+	args, _ = json.Marshal(map[string]string{"url": srv.URL + "/files/report.pdf", "pages": "2"})
+	result, err = tool.Call(context.Background(), args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(result, "[Page 2]\nSecond page") || strings.Contains(result, "Annual report") {
+		t.Errorf("pages=2 result = %q", result)
+	}
+
+	args, _ = json.Marshal(map[string]string{"url": srv.URL + "/report", "pages": "3-1"})
+	if result, _ = tool.Call(context.Background(), args); !strings.HasPrefix(result, "Error: invalid page range") {
+		t.Errorf("bad range result = %q", result)
+	}
+}
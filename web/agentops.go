@@ -96,9 +96,14 @@ func (s *Server) UpdateAgentChannel(serverID, channelID, mode string) error {
 	channels := slices.Clone(newAgents[idx].Channels)
 
 	if mode == "" {
-		// Remove the channel override.
+		// Remove the channel override, keeping the entry if it still carries other settings.
+		for i := range channels {
+			if channels[i].ID == channelID {
+				channels[i].ResponseMode = ""
+			}
+		}
 		channels = slices.DeleteFunc(channels, func(c config.ChannelConfig) bool {
-			return c.ID == channelID
+			return c.ID == channelID && !hasOverrides(c)
 		})
 	} else {
 		// Update or add the channel override.
@@ -123,6 +128,107 @@ func (s *Server) UpdateAgentChannel(serverID, channelID, mode string) error {
 	return nil
 }
 
+// UpdateAgentChannelSoul sets the named soul for a channel or category.
+// If soulName is empty, the soul selection is cleared and the entry is removed
+// when it carries no other override.
+// Creates a new agent entry if none exists for the server (auto-upsert).
+func (s *Server) UpdateAgentChannelSoul(serverID, channelID, soulName string) error {
+	if soulName != "" && !config.ValidSoulName(soulName) {
+		return fmt.Errorf("invalid soul name: use letters, digits, - and _ only (max 64 chars)")
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	cfg := s.cfgStore.Get()
+	idx := findAgentByServerID(cfg.Agents, serverID)
+	if idx == -1 {
+		if soulName == "" {
+			return fmt.Errorf("no agent configured for this server")
+		}
+		input := newAutoAgent(serverID)
+		input.Channels = []config.ChannelConfig{{ID: channelID, Soul: soulName}}
+		newAgents := append(slices.Clone(cfg.Agents), input)
+		return s.writeAgents(newAgents)
+	}
+
+	newAgents := slices.Clone(cfg.Agents)
+	channels := slices.Clone(newAgents[idx].Channels)
+	found := false
+	for i := range channels {
+		if channels[i].ID == channelID {
+			channels[i].Soul = soulName
+			found = true
+		}
+	}
+	if !found && soulName != "" {
+		channels = append(channels, config.ChannelConfig{ID: channelID, Soul: soulName})
+	}
+	channels = slices.DeleteFunc(channels, func(c config.ChannelConfig) bool {
+		return c.ID == channelID && !hasOverrides(c)
+	})
+
+	newAgents[idx].Channels = channels
+	if err := s.writeAgents(newAgents); err != nil {
+		return err
+	}
+	s.router.UnloadAgent(serverID)
+	return nil
+}
+
+// UpdateAgentChannelBots turns bot-to-bot conversation on or off for a channel
+// or category. Turning it off clears the loop guard limits and removes the entry
+// when it carries no other override.
+// Creates a new agent entry if none exists for the server (auto-upsert).
+func (s *Server) UpdateAgentChannelBots(serverID, channelID string, allow bool) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	cfg := s.cfgStore.Get()
+	idx := findAgentByServerID(cfg.Agents, serverID)
+	if idx == -1 {
+		if !allow {
+			return fmt.Errorf("no agent configured for this server")
+		}
+		input := newAutoAgent(serverID)
+		input.Channels = []config.ChannelConfig{{ID: channelID, AllowBots: true}}
+		newAgents := append(slices.Clone(cfg.Agents), input)
+		return s.writeAgents(newAgents)
+	}
+
+	newAgents := slices.Clone(cfg.Agents)
+	channels := slices.Clone(newAgents[idx].Channels)
+	found := false
+	for i := range channels {
+		if channels[i].ID == channelID {
+			channels[i].AllowBots = allow
+			if !allow {
+				channels[i].MaxBotTurns = 0
+				channels[i].BotCooldownSeconds = 0
+			}
+			found = true
+		}
+	}
+	if !found && allow {
+		channels = append(channels, config.ChannelConfig{ID: channelID, AllowBots: true})
+	}
+	channels = slices.DeleteFunc(channels, func(c config.ChannelConfig) bool {
+		return c.ID == channelID && !hasOverrides(c)
+	})
+
+	newAgents[idx].Channels = channels
+	if err := s.writeAgents(newAgents); err != nil {
+		return err
+	}
+	s.router.UnloadAgent(serverID)
+	return nil
+}
+
+// hasOverrides reports whether a channel entry carries any setting besides its ID.
+func hasOverrides(c config.ChannelConfig) bool {
+	return c.ResponseMode != "" || c.Soul != "" || c.AllowBots || c.MaxBotTurns > 0 || c.BotCooldownSeconds > 0 || !c.Tools.IsZero() || c.ImageSafety != "" || c.AllowUnscreenedImages
+}
+
 // UpdateAgentLanguage updates the language for the agent matching serverID.
 // Creates a new agent entry if none exists for the server (auto-upsert).
 func (s *Server) UpdateAgentLanguage(serverID, language string) error {
@@ -147,6 +253,51 @@ func (s *Server) UpdateAgentLanguage(serverID, language string) error {
 	return nil
 }
 
+// UpdateAgentAccess replaces the access rules for the agent matching serverID.
+// Creates a new agent entry if none exists for the server (auto-upsert).
+func (s *Server) UpdateAgentAccess(serverID string, access config.AccessConfig) error {
+	_, err := s.ModifyAgentAccess(serverID, func(a *config.AccessConfig) { *a = access })
+	return err
+}
+
+// ModifyAgentAccess applies modify to the access rules of the agent matching
+// serverID and saves the result, all under the config write lock so that
+// concurrent edits are not lost. modify receives a copy it may change freely.
+// Creates a new agent entry if none exists for the server (auto-upsert).
+func (s *Server) ModifyAgentAccess(serverID string, modify func(*config.AccessConfig)) (config.AccessConfig, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	cfg := s.cfgStore.Get()
+	idx := findAgentByServerID(cfg.Agents, serverID)
+	var access config.AccessConfig
+	if idx != -1 {
+		access = cfg.Agents[idx].Access
+	}
+	for _, ids := range []*[]string{&access.AllowUsers, &access.DenyUsers, &access.AllowRoles, &access.DenyRoles, &access.AllowChannels, &access.DenyChannels} {
+		*ids = slices.Clone(*ids)
+	}
+	modify(&access)
+
+	if idx == -1 {
+		input := newAutoAgent(serverID)
+		input.Access = access
+		newAgents := append(slices.Clone(cfg.Agents), input)
+		if err := s.writeAgents(newAgents); err != nil {
+			return config.AccessConfig{}, err
+		}
+		return access, nil
+	}
+
+	newAgents := slices.Clone(cfg.Agents)
+	newAgents[idx].Access = access
+	if err := s.writeAgents(newAgents); err != nil {
+		return config.AccessConfig{}, err
+	}
+	s.router.UnloadAgent(serverID)
+	return access, nil
+}
+
 // findAgentByServerID returns the index of the agent with the given server_id, or -1 if not found.
 func findAgentByServerID(agents []config.AgentConfig, serverID string) int {
 	for i, a := range agents {
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/tomasmach/vespra/memory"
+)
+
+func (s *Server) handleListGeneratedImages(w http.ResponseWriter, r *http.Request) {
+	mem, serverID, ok := s.agentMemory(w, r)
+	if !ok {
+		return
+	}
+	rows, total, err := mem.ListGeneratedImages(r.Context(), memory.GeneratedImageListOptions{
+		ServerID: serverID,
+		UserID:   r.URL.Query().Get("user_id"),
+		JobID:    r.URL.Query().Get("job_id"),
+		Query:    r.URL.Query().Get("q"),
+		Limit:    queryInt(r, "limit", 50, 1),
+		Offset:   queryInt(r, "offset", 0, 0),
+	})
+	if err != nil {
+		slog.Error("list generated images", "error", err, "server_id", serverID)
+		http.Error(w, "failed to list generated images", http.StatusInternalServerError)
+		return
+	}
+	if rows == nil {
+		rows = []memory.GeneratedImageRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"images": rows,
+		"total":  total,
+	})
+}
+
+func (s *Server) handleGetGeneratedImage(w http.ResponseWriter, r *http.Request) {
+	mem, serverID, ok := s.agentMemory(w, r)
+	if !ok {
+		return
+	}
+	row, err := mem.GetGeneratedImage(r.Context(), serverID, r.PathValue("image_id"))
+	if err != nil {
+		if errors.Is(err, memory.ErrGeneratedImageNotFound) {
+			http.Error(w, "image not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("get generated image", "error", err, "server_id", serverID)
+		http.Error(w, "failed to get image", http.StatusInternalServerError)
+		return
+	}
+	f, err := os.Open(row.FilePath)
+	if err != nil {
+		slog.Error("open generated image file", "error", err, "id", row.ID)
+		http.Error(w, "failed to open image", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		slog.Error("stat generated image file", "error", err, "id", row.ID)
+		http.Error(w, "failed to read image", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", row.ContentType)
+	http.ServeContent(w, r, filepath.Base(row.FilePath), stat.ModTime(), f)
+}
+
+func (s *Server) handleDeleteGeneratedImage(w http.ResponseWriter, r *http.Request) {
+	mem, serverID, ok := s.agentMemory(w, r)
+	if !ok {
+		return
+	}
+	if err := mem.DeleteGeneratedImage(r.Context(), serverID, r.PathValue("image_id")); err != nil {
+		if errors.Is(err, memory.ErrGeneratedImageNotFound) {
+			http.Error(w, "image not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("delete generated image", "error", err, "server_id", serverID)
+		http.Error(w, "failed to delete image", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,198 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tomasmach/vespra/memory"
+	"github.com/tomasmach/vespra/pdftext"
+)
+
+// knowledgeExtensions lists the file types accepted as knowledge documents.
+// PDFs are stored as their extracted text.
+var knowledgeExtensions = []string{".md", ".markdown", ".txt", ".pdf"}
+
+// maxKnowledgePDFBytes caps PDF uploads; their extracted text is still
+// limited to memory.MaxKnowledgeBytes.
+const maxKnowledgePDFBytes = 16 << 20
+
+// maxKnowledgeNameBytes caps the length of a document name.
+const maxKnowledgeNameBytes = 255
+
+// agentMemory resolves the memory store and server ID of the agent in the
+// request path, writing an error response when there is none.
+func (s *Server) agentMemory(w http.ResponseWriter, r *http.Request) (*memory.Store, string, bool) {
+	serverID, ok := s.agentServerID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return nil, "", false
+	}
+	mem := s.router.MemoryForServer(serverID)
+	if mem == nil {
+		http.Error(w, "memory store not available", http.StatusServiceUnavailable)
+		return nil, "", false
+	}
+	return mem, serverID, true
+}
+
+func (s *Server) handleListKnowledge(w http.ResponseWriter, r *http.Request) {
+	mem, serverID, ok := s.agentMemory(w, r)
+	if !ok {
+		return
+	}
+	docs, err := mem.ListKnowledge(r.Context(), serverID)
+	if err != nil {
+		slog.Error("list knowledge documents", "error", err, "server_id", serverID)
+		http.Error(w, "failed to list knowledge documents", http.StatusInternalServerError)
+		return
+	}
+	if docs == nil {
+		docs = []memory.KnowledgeDocument{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"documents": docs})
+}
+
+// handleUploadKnowledge stores a multipart "file" upload as a knowledge
+// document, replacing any document with the same name. An optional "name"
+// field overrides the file name. PDFs are stored as their extracted text.
+func (s *Server) handleUploadKnowledge(w http.ResponseWriter, r *http.Request) {
+	mem, serverID, ok := s.agentMemory(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxKnowledgePDFBytes+64<<10)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "document too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "missing file upload", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if !slices.Contains(knowledgeExtensions, ext) {
+		http.Error(w, "unsupported document type: upload .md, .markdown, .txt or .pdf", http.StatusUnsupportedMediaType)
+		return
+	}
+	limit := memory.MaxKnowledgeBytes
+	if ext == ".pdf" {
+		limit = maxKnowledgePDFBytes
+	}
+	if header.Size > int64(limit) {
+		http.Error(w, "document too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		name = header.Filename
+	}
+	name = strings.TrimSpace(filepath.Base(name))
+	if name == "." || name == string(filepath.Separator) || len(name) > maxKnowledgeNameBytes || !utf8.ValidString(name) {
+		http.Error(w, "invalid document name", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(limit)+1))
+	if err != nil {
+		http.Error(w, "failed to read upload", http.StatusBadRequest)
+		return
+	}
+	if len(data) > limit {
+		http.Error(w, "document too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if ext == ".pdf" {
+		res, err := pdftext.Extract(data, pdftext.Options{MaxChars: memory.MaxKnowledgeBytes})
+		switch {
+		case errors.Is(err, pdftext.ErrNoText):
+			http.Error(w, "PDF contains no extractable text (scanned documents are not supported)", http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, "failed to read PDF: "+err.Error(), http.StatusBadRequest)
+			return
+		case res.Truncated || len(res.Text) > memory.MaxKnowledgeBytes:
+			http.Error(w, "document too large: PDF text exceeds 1 MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		data = []byte(res.Text)
+	}
+	if !utf8.Valid(data) {
+		http.Error(w, "document is not UTF-8 text", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		http.Error(w, "document is empty", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := mem.AddKnowledge(r.Context(), serverID, name, string(data))
+	if err != nil {
+		slog.Error("add knowledge document", "error", err, "server_id", serverID, "name", name)
+		http.Error(w, "failed to store document", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(doc)
+}
+
+func (s *Server) handleDeleteKnowledge(w http.ResponseWriter, r *http.Request) {
+	mem, serverID, ok := s.agentMemory(w, r)
+	if !ok {
+		return
+	}
+	if err := mem.DeleteKnowledge(r.Context(), serverID, r.PathValue("doc_id")); err != nil {
+		if errors.Is(err, memory.ErrDocumentNotFound) {
+			http.Error(w, "document not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("delete knowledge document", "error", err, "server_id", serverID)
+		http.Error(w, "failed to delete document", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleSearchKnowledge runs the same retrieval as the knowledge_search tool,
+// so operators can check what the agent will find for a question.
+func (s *Server) handleSearchKnowledge(w http.ResponseWriter, r *http.Request) {
+	mem, serverID, ok := s.agentMemory(w, r)
+	if !ok {
+		return
+	}
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	chunks, err := mem.SearchKnowledge(r.Context(), q, serverID, queryInt(r, "limit", 5, 1), 0)
+	if err != nil {
+		slog.Error("search knowledge", "error", err, "server_id", serverID)
+		http.Error(w, "failed to search knowledge", http.StatusInternalServerError)
+		return
+	}
+	type result struct {
+		memory.KnowledgeChunk
+		Citation string `json:"citation"`
+	}
+	out := make([]result, len(chunks))
+	for i, c := range chunks {
+		out[i] = result{KnowledgeChunk: c, Citation: c.Citation()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"results": out})
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/tomasmach/vespra/tools"
+)
+
+// handleAgentMCP serves an agent's memory over the MCP streamable HTTP
+// transport. It answers 404 unless web.mcp is enabled, and every request must
+// carry web.auth_token as a bearer token. The optional persona query parameter
+// scopes the tools to that persona's memories.
+func (s *Server) handleAgentMCP(w http.ResponseWriter, r *http.Request) {
+	cfg := s.cfgStore.Get()
+	if !cfg.Web.MCP {
+		http.NotFound(w, r)
+		return
+	}
+	if !authorized(r, cfg.Web.AuthToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="vespra"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	idx := findAgentIndex(cfg.Agents, r.PathValue("id"))
+	if idx == -1 {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	agentCfg := &cfg.Agents[idx]
+	scope := agentCfg.ServerID
+	if personaID := r.URL.Query().Get("persona"); personaID != "" {
+		i := -1
+		for j := range agentCfg.Personas {
+			if agentCfg.Personas[j].ID == personaID {
+				i = j
+			}
+		}
+		if i == -1 {
+			http.Error(w, "persona not found", http.StatusNotFound)
+			return
+		}
+		scope = agentCfg.Personas[i].MemoryScope(agentCfg.ServerID)
+	}
+	mem := s.router.MemoryForServer(agentCfg.ServerID)
+	if mem == nil {
+		http.Error(w, "server not configured", http.StatusNotFound)
+		return
+	}
+
+	reg := tools.NewMemoryServerRegistry(mem, scope, cfg.Agent.MemoryDedupThreshold, cfg.Agent.MemoryRecallLimit)
+	tools.NewMCPServer("vespra-memory", "1.0", reg).ServeHTTP(w, r)
+}
+
+// authorized reports whether r carries token as a bearer token. An empty
+// token authorizes nothing.
+func authorized(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
@@ -13,7 +13,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"slices"
 	"strconv"
 	"strings"
@@ -26,6 +25,8 @@ import (
 	"github.com/tomasmach/vespra/config"
 	"github.com/tomasmach/vespra/logstore"
 	"github.com/tomasmach/vespra/memory"
+	"github.com/tomasmach/vespra/soul"
+	"github.com/tomasmach/vespra/tools"
 )
 
 //go:embed static
@@ -74,12 +75,24 @@ func New(addr string, cfgStore *config.Store, cfgPath string, router *agent.Rout
 	mux.HandleFunc("DELETE /api/agents/{id}/souls/{name}", s.handleDeleteAgentSoulByName)
 	mux.HandleFunc("POST /api/agents/{id}/souls/{name}/activate", s.handleActivateAgentSoul)
 	mux.HandleFunc("POST /api/agents/{id}/restart", s.handleRestartAgent)
+	mux.HandleFunc("PUT /api/agents/{id}/access", s.handlePutAgentAccess)
 	mux.HandleFunc("GET /api/agents/{id}/logs", s.handleGetAgentLogs)
 	mux.HandleFunc("GET /api/agents/{id}/conversations", s.handleGetAgentConversations)
+	mux.HandleFunc("GET /api/agents/{id}/spam-blocks", s.handleListSpamBlocks)
+	mux.HandleFunc("GET /api/agents/{id}/tools", s.handleGetAgentTools)
+	mux.HandleFunc("GET /api/agents/{id}/knowledge", s.handleListKnowledge)
+	mux.HandleFunc("POST /api/agents/{id}/knowledge", s.handleUploadKnowledge)
+	mux.HandleFunc("GET /api/agents/{id}/knowledge/search", s.handleSearchKnowledge)
+	mux.HandleFunc("DELETE /api/agents/{id}/knowledge/{doc_id}", s.handleDeleteKnowledge)
+	mux.HandleFunc("DELETE /api/agents/{id}/spam-blocks/{user_id}", s.handleDeleteSpamBlock)
+	mux.HandleFunc("GET /api/agents/{id}/images", s.handleListGeneratedImages)
+	mux.HandleFunc("GET /api/agents/{id}/images/{image_id}", s.handleGetGeneratedImage)
+	mux.HandleFunc("DELETE /api/agents/{id}/images/{image_id}", s.handleDeleteGeneratedImage)
 	mux.HandleFunc("GET /api/soul", s.handleGetGlobalSoul)
 	mux.HandleFunc("PUT /api/soul", s.handlePutGlobalSoul)
 	mux.HandleFunc("GET /api/config/image", s.handleGetImageConfig)
 	mux.HandleFunc("PUT /api/config/image", s.handlePutImageConfig)
+	mux.HandleFunc("/api/agents/{id}/mcp", s.handleAgentMCP)
 	sub, _ := fs.Sub(staticFiles, "static")
 	fileServer := http.FileServer(http.FS(sub))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -213,11 +226,13 @@ func (s *Server) handlePostConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err := s.cfgStore.Reload(); err != nil {
+	cfg, err := s.cfgStore.Reload()
+	if err != nil {
 		slog.Error("reload config", "error", err)
 		http.Error(w, fmt.Sprintf("reload failed: %v", err), http.StatusInternalServerError)
 		return
 	}
+	s.router.ApplyConfig(cfg)
 
 	s.broadcast("event: config_reloaded\ndata: {}\n\n")
 	w.WriteHeader(http.StatusNoContent)
@@ -411,6 +426,8 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{
 		"agents": s.router.Status(),
 		"config": s.cfgStore.Get(),
+		"tools":  tools.Stats(),
+		"cache":  s.router.WebCacheStats(),
 	})
 }
 
@@ -442,27 +459,47 @@ func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
 	cfg := s.cfgStore.Get()
 	type agentImageView struct {
-		HasAPIKey           bool   `json:"has_api_key"`
-		Model               string `json:"model,omitempty"`
-		EditModel           string `json:"edit_model,omitempty"`
-		EnableSafetyChecker *bool  `json:"enable_safety_checker,omitempty"`
+		Provider            string              `json:"provider,omitempty"`
+		BaseURL             string              `json:"base_url,omitempty"`
+		HasAPIKey           bool                `json:"has_api_key"`
+		Model               string              `json:"model,omitempty"`
+		EditModel           string              `json:"edit_model,omitempty"`
+		EnableSafetyChecker *bool               `json:"enable_safety_checker,omitempty"`
+		Moderated           bool                `json:"moderated,omitempty"`
+		Concurrency         int                 `json:"concurrency,omitempty"`
+		DailyLimit          int                 `json:"daily_limit,omitempty"`
+		Limits              []config.ImageLimit `json:"limits,omitempty"`
+	}
+	type personaView struct {
+		config.PersonaConfig
+		HasToken bool `json:"has_token"`
 	}
 	type agentView struct {
-		ID           string                 `json:"id"`
-		ServerID     string                 `json:"server_id"`
-		HasToken     bool                   `json:"has_token"`
-		SoulFile     string                 `json:"soul_file,omitempty"`
-		DBPath       string                 `json:"db_path,omitempty"`
-		ResponseMode string                 `json:"response_mode,omitempty"`
-		Language     string                 `json:"language,omitempty"`
-		Provider     string                 `json:"provider,omitempty"`
-		Model        string                 `json:"model,omitempty"`
-		Channels     []config.ChannelConfig `json:"channels,omitempty"`
-		IgnoreUsers  []string               `json:"ignore_users,omitempty"`
-		Image        agentImageView         `json:"image"`
+		ID           string                  `json:"id"`
+		ServerID     string                  `json:"server_id"`
+		HasToken     bool                    `json:"has_token"`
+		SoulFile     string                  `json:"soul_file,omitempty"`
+		DBPath       string                  `json:"db_path,omitempty"`
+		ResponseMode string                  `json:"response_mode,omitempty"`
+		Language     string                  `json:"language,omitempty"`
+		Provider     string                  `json:"provider,omitempty"`
+		Model        string                  `json:"model,omitempty"`
+		Channels     []config.ChannelConfig  `json:"channels,omitempty"`
+		IgnoreUsers  []string                `json:"ignore_users,omitempty"`
+		Image        agentImageView          `json:"image"`
+		Spam         config.SpamConfig       `json:"spam"`
+		Access       config.AccessConfig     `json:"access"`
+		Personas     []personaView           `json:"personas,omitempty"`
+		Plugins      []string                `json:"plugins,omitempty"`
+		MCP          []config.AgentMCPConfig `json:"mcp,omitempty"`
+		Tools        config.ToolPolicy       `json:"tools,omitzero"`
 	}
 	views := make([]agentView, len(cfg.Agents))
 	for i, a := range cfg.Agents {
+		var personas []personaView
+		for _, p := range a.Personas {
+			personas = append(personas, personaView{PersonaConfig: p, HasToken: p.Token != ""})
+		}
 		views[i] = agentView{
 			ID:           a.ID,
 			ServerID:     a.ServerID,
@@ -475,11 +512,23 @@ func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
 			Model:        a.Model,
 			Channels:     a.Channels,
 			IgnoreUsers:  a.IgnoreUsers,
+			Spam:         a.Spam,
+			Access:       a.Access,
+			Personas:     personas,
+			Plugins:      a.Plugins,
+			MCP:          a.MCP,
+			Tools:        a.Tools.ToolPolicy,
 			Image: agentImageView{
+				Provider:            a.Image.Provider,
+				BaseURL:             a.Image.BaseURL,
 				HasAPIKey:           a.Image.APIKey != "",
 				Model:               a.Image.Model,
 				EditModel:           a.Image.EditModel,
 				EnableSafetyChecker: a.Image.EnableSafetyChecker,
+				Moderated:           a.Image.Moderated,
+				Concurrency:         a.Image.Concurrency,
+				DailyLimit:          a.Image.DailyLimit,
+				Limits:              a.Image.Limits,
 			},
 		}
 	}
@@ -545,6 +594,37 @@ func (s *Server) handleUpdateAgent(w http.ResponseWriter, r *http.Request) {
 	if input.Channels == nil {
 		input.Channels = newAgents[idx].Channels // preserve channel overrides if not provided in update
 	}
+	if input.Image.Limits == nil {
+		input.Image.Limits = newAgents[idx].Image.Limits // preserve per-user and per-role image limits if not provided in update
+	}
+	if input.Personas == nil {
+		input.Personas = newAgents[idx].Personas // preserve personas if not provided in update
+	}
+	if input.Plugins == nil {
+		input.Plugins = newAgents[idx].Plugins // preserve plugin selection if not provided in update
+	}
+	if input.MCP == nil {
+		input.MCP = newAgents[idx].MCP // preserve MCP server selection if not provided in update
+	}
+	if input.Tools.HTTP == nil {
+		input.Tools.HTTP = newAgents[idx].Tools.HTTP // preserve HTTP tools if not provided in update
+	}
+	if input.Tools.Allow == nil {
+		input.Tools.Allow = newAgents[idx].Tools.Allow // preserve tool policy if not provided in update
+	}
+	if input.Tools.Deny == nil {
+		input.Tools.Deny = newAgents[idx].Tools.Deny
+	}
+	for i := range input.Personas {
+		if input.Personas[i].Token != "" {
+			continue
+		}
+		for _, old := range newAgents[idx].Personas {
+			if old.ID == input.Personas[i].ID {
+				input.Personas[i].Token = old.Token // preserve existing persona token if not updated
+			}
+		}
+	}
 	input.ID = id // ensure ID unchanged
 	newAgents[idx] = input
 
@@ -603,6 +683,25 @@ func (s *Server) handleRestartAgent(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) handlePutAgentAccess(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := s.agentServerID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	var access config.AccessConfig
+	if err := json.NewDecoder(r.Body).Decode(&access); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if err := s.UpdateAgentAccess(serverID, access); err != nil {
+		slog.Error("update agent access", "error", err, "server_id", serverID)
+		http.Error(w, "failed to save access rules", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // findAgentIndex returns the index of the agent with the given ID, or -1 if not found.
 func findAgentIndex(agents []config.AgentConfig, id string) int {
 	for i, a := range agents {
@@ -708,6 +807,61 @@ func (s *Server) handleGetAgentConversations(w http.ResponseWriter, r *http.Requ
 	})
 }
 
+func (s *Server) handleListSpamBlocks(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := s.agentServerID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"blocks": s.router.SpamBlocks(serverID),
+	})
+}
+
+// toolReportTimeout bounds how long the tools view waits for plugins and MCP
+// servers that are still starting.
+const toolReportTimeout = 5 * time.Second
+
+// handleGetAgentTools reports the tools the agent offers by default and in each
+// configured channel, after tool policies.
+func (s *Server) handleGetAgentTools(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := s.agentServerID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), toolReportTimeout)
+	defer cancel()
+	report, ok := s.router.ToolReport(ctx, serverID)
+	if !ok {
+		http.Error(w, "agent not loaded", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (s *Server) handleDeleteSpamBlock(w http.ResponseWriter, r *http.Request) {
+	serverID, ok := s.agentServerID(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	userID := r.PathValue("user_id")
+	blocked, err := s.router.Unblock(r.Context(), serverID, userID)
+	if err != nil {
+		slog.Error("unblock user", "error", err, "server_id", serverID, "user_id", userID)
+		http.Error(w, "failed to unblock user", http.StatusInternalServerError)
+		return
+	}
+	if !blocked {
+		http.Error(w, "user is not blocked", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (s *Server) handleGetAgentSoul(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	cfg := s.cfgStore.Get()
@@ -862,8 +1016,6 @@ func (s *Server) handlePutGlobalSoul(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{"path": soulPath})
 }
 
-var safeNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
-
 // validAgentID reports whether id is a safe agent identifier.
 // Allows Unicode and spaces but rejects slashes, null bytes, ".", "..", and IDs over 128 runes.
 func validAgentID(id string) bool {
@@ -878,24 +1030,13 @@ func validAgentID(id string) bool {
 
 // validSoulName reports whether name is a safe soul file stem.
 func validSoulName(name string) bool {
-	return safeNameRe.MatchString(name)
+	return config.ValidSoulName(name)
 }
 
 // agentSoulDir returns the directory where an agent's named souls are stored.
 // Returns an empty string if agentID fails validation; callers must check for this.
 func (s *Server) agentSoulDir(agentID string) string {
-	if agentID == "" {
-		return ""
-	}
-	base := filepath.Join(filepath.Dir(s.cfgPath), "souls")
-	dir := filepath.Join(base, agentID)
-	// Prevent path traversal: clean dir must start with base/
-	cleanDir := filepath.Clean(dir)
-	cleanBase := filepath.Clean(base)
-	if cleanDir == cleanBase || !strings.HasPrefix(cleanDir, cleanBase+string(filepath.Separator)) {
-		return ""
-	}
-	return dir
+	return soul.AgentDir(s.cfgPath, agentID)
 }
 
 // requireAgentSoulDir returns the soul directory for the agent and true,
@@ -1202,21 +1343,31 @@ func (s *Server) handleGetImageConfig(w http.ResponseWriter, r *http.Request) {
 	cfg := s.cfgStore.Get()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
+		"provider":              cfg.Tools.Image.Provider,
+		"base_url":              cfg.Tools.Image.BaseURL,
 		"has_api_key":           cfg.Tools.Image.APIKey != "",
 		"model":                 cfg.Tools.Image.Model,
 		"edit_model":            cfg.Tools.Image.EditModel,
 		"enable_safety_checker": cfg.Tools.Image.EnableSafetyChecker,
+		"moderated":             cfg.Tools.Image.Moderated,
 		"timeout_seconds":       cfg.Tools.Image.TimeoutSeconds,
+		"concurrency":           cfg.Tools.Image.Concurrency,
+		"daily_limit":           cfg.Tools.Image.DailyLimit,
 	})
 }
 
 func (s *Server) handlePutImageConfig(w http.ResponseWriter, r *http.Request) {
 	var input struct {
+		Provider            string          `json:"provider"`
+		BaseURL             *string         `json:"base_url"` // "" = clear, absent = no change
 		APIKey              string          `json:"api_key"`
 		Model               string          `json:"model"`
 		EditModel           string          `json:"edit_model"`
 		EnableSafetyChecker json.RawMessage `json:"enable_safety_checker"` // null = clear, true/false = set, absent = no change
+		Moderated           *bool           `json:"moderated"`             // absent = no change
 		TimeoutSeconds      int             `json:"timeout_seconds"`
+		Concurrency         int             `json:"concurrency"`
+		DailyLimit          *int            `json:"daily_limit"` // 0 = unlimited, absent = no change
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		http.Error(w, "invalid JSON body", http.StatusBadRequest)
@@ -1235,6 +1386,16 @@ func (s *Server) handlePutImageConfig(w http.ResponseWriter, r *http.Request) {
 		if img == nil {
 			img = make(map[string]any)
 		}
+		if input.Provider != "" {
+			img["provider"] = input.Provider
+		}
+		if input.BaseURL != nil {
+			if *input.BaseURL == "" {
+				delete(img, "base_url")
+			} else {
+				img["base_url"] = *input.BaseURL
+			}
+		}
 		if input.APIKey != "" {
 			img["api_key"] = input.APIKey
 		}
@@ -1254,9 +1415,26 @@ func (s *Server) handlePutImageConfig(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 		}
+		if input.Moderated != nil {
+			if *input.Moderated {
+				img["moderated"] = true
+			} else {
+				delete(img, "moderated")
+			}
+		}
 		if input.TimeoutSeconds > 0 {
 			img["timeout_seconds"] = int64(input.TimeoutSeconds)
 		}
+		if input.Concurrency > 0 {
+			img["concurrency"] = int64(input.Concurrency)
+		}
+		if input.DailyLimit != nil {
+			if *input.DailyLimit == 0 {
+				delete(img, "daily_limit")
+			} else {
+				img["daily_limit"] = int64(*input.DailyLimit)
+			}
+		}
 		tools["image"] = img
 		raw["tools"] = tools
 	})
@@ -1273,19 +1451,35 @@ func (s *Server) writeAgents(agents []config.AgentConfig) error {
 	// Build token and image key maps before marshaling — both have json:"-" so Marshal drops them
 	tokenByID := make(map[string]string, len(agents))
 	imageKeyByID := make(map[string]string, len(agents))
+	personaTokensByID := make(map[string]map[string]string, len(agents))
 	for _, a := range agents {
 		tokenByID[a.ID] = a.Token
 		imageKeyByID[a.ID] = a.Image.APIKey
+		for _, p := range a.Personas {
+			if p.Token == "" {
+				continue
+			}
+			if personaTokensByID[a.ID] == nil {
+				personaTokensByID[a.ID] = make(map[string]string)
+			}
+			personaTokensByID[a.ID][p.ID] = p.Token
+		}
 	}
 
 	agentsJSON, err := json.Marshal(agents)
 	if err != nil {
 		return err
 	}
+	// Decode numbers as json.Number so integer settings stay integers in TOML.
+	dec := json.NewDecoder(bytes.NewReader(agentsJSON))
+	dec.UseNumber()
 	var agentsRaw []any
-	if err := json.Unmarshal(agentsJSON, &agentsRaw); err != nil {
+	if err := dec.Decode(&agentsRaw); err != nil {
 		return err
 	}
+	for i := range agentsRaw {
+		agentsRaw[i] = tomlNumbers(agentsRaw[i])
+	}
 	// Restore fields dropped by json:"-"
 	for _, item := range agentsRaw {
 		if m, ok := item.(map[string]any); ok {
@@ -1301,6 +1495,15 @@ func (s *Server) writeAgents(agents []config.AgentConfig) error {
 				img["api_key"] = key
 				m["image"] = img
 			}
+			personas, _ := m["personas"].([]any)
+			for _, item := range personas {
+				if p, ok := item.(map[string]any); ok {
+					pid, _ := p["id"].(string)
+					if tok := personaTokensByID[id][pid]; tok != "" {
+						p["token"] = tok
+					}
+				}
+			}
 		}
 	}
 
@@ -1313,6 +1516,28 @@ func (s *Server) writeAgents(agents []config.AgentConfig) error {
 	})
 }
 
+// tomlNumbers replaces the json.Number values in v with int64, or float64 for
+// numbers with a fraction, which the TOML encoder writes as such.
+func tomlNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, item := range v {
+			v[k] = tomlNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = tomlNumbers(item)
+		}
+	}
+	return v
+}
+
 // patchConfig reads the config TOML into a generic map, applies mutate to modify it,
 // then validates, writes atomically, reloads the store, and broadcasts a config_reloaded event.
 func (s *Server) patchConfig(mutate func(raw map[string]any)) error {
@@ -1344,9 +1569,11 @@ func (s *Server) patchConfig(mutate func(raw map[string]any)) error {
 		os.Remove(tmpPath)
 		return err
 	}
-	if _, err := s.cfgStore.Reload(); err != nil {
+	cfg, err := s.cfgStore.Reload()
+	if err != nil {
 		return fmt.Errorf("reload: %w", err)
 	}
+	s.router.ApplyConfig(cfg)
 	s.broadcast("event: config_reloaded\ndata: {}\n\n")
 	return nil
 }
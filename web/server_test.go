@@ -1,16 +1,23 @@
 package web_test
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/tomasmach/vespra/agent"
@@ -74,6 +81,113 @@ func newTestServerWithVisualMemory(t *testing.T, serverID string) (*httptest.Ser
 	return ts, mem
 }
 
+// newTestServerWithAgentMemory creates a test server with one configured agent
+// backed by a real memory store and a fake embedding endpoint. seed, if non-nil,
+// runs before the router is created so state restored at startup (e.g. spam
+// blocks) is picked up.
+func newTestServerWithAgentMemory(t *testing.T, agentID, serverID string, seed func(*memory.Store)) (*httptest.Server, *memory.Store) {
+	t.Helper()
+	embSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// One vector per input, for batched knowledge embeddings.
+		var req struct {
+			Input json.RawMessage `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		n := 1
+		var inputs []string
+		if json.Unmarshal(req.Input, &inputs) == nil {
+			n = len(inputs)
+		}
+		vecs := make([]string, n)
+		for i := range vecs {
+			vecs[i] = fmt.Sprintf(`{"index":%d,"embedding":[0.1,0.2,0.3,0.4]}`, i)
+		}
+		io.WriteString(w, `{"data":[`+strings.Join(vecs, ",")+`]}`)
+	}))
+	t.Cleanup(embSrv.Close)
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "config.toml")
+	cfgText := "[bot]\ntoken=\"x\"\n[llm]\nopenrouter_key=\"test\"\nembedding_model=\"test-embed\"\nbase_url=\"" + embSrv.URL + "\"\n[memory]\ndb_path=\"" + filepath.ToSlash(filepath.Join(dir, "dm.db")) + "\"\n" +
+		"[[agents]]\nid=\"" + agentID + "\"\nserver_id=\"" + serverID + "\"\n"
+	if err := os.WriteFile(cfgPath, []byte(cfgText), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfgStore, err := config.NewStore(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	llmClient := llm.New(cfgStore)
+	mem, err := memory.New(&config.MemoryConfig{DBPath: filepath.Join(dir, "agent.db")}, llmClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seed != nil {
+		seed(mem)
+	}
+	router, err := agent.NewRouter(t.Context(), cfgStore, llmClient, &discordgo.Session{}, map[string]*agent.AgentResources{
+		serverID: {Config: &cfgStore.Get().Agents[0], Memory: mem, Session: &discordgo.Session{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := web.New(":0", cfgStore, cfgPath, router, nil)
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts, mem
+}
+
+func TestSpamBlockEndpointsListAndUnblock(t *testing.T) {
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	ts, mem := newTestServerWithAgentMemory(t, "bot1", "srv1", func(mem *memory.Store) {
+		if err := mem.SaveSpamBlock(t.Context(), memory.SpamBlock{ServerID: "srv1", UserID: "user1", BlockedUntil: until, Offenses: 1}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	resp, err := http.Get(ts.URL + "/api/agents/bot1/spam-blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Blocks []memory.SpamBlock `json:"blocks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(list.Blocks) != 1 || list.Blocks[0].UserID != "user1" || !list.Blocks[0].BlockedUntil.Equal(until) {
+		t.Fatalf("unexpected spam blocks: %+v", list.Blocks)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/agents/bot1/spam-blocks/user1", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unblock: expected 204, got %d", resp.StatusCode)
+	}
+	rows, err := mem.ListSpamBlocks(t.Context(), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 0 {
+		t.Fatalf("expected persisted block to be removed, got %+v", rows)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, ts.URL+"/api/agents/bot1/spam-blocks/user1", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unblock of unblocked user: expected 404, got %d", resp.StatusCode)
+	}
+}
+
 func TestVisualMemoryEndpointsListThumbnailAndDelete(t *testing.T) {
 	ts, mem := newTestServerWithVisualMemory(t, "srv1")
 	result, err := mem.SaveVisual(t.Context(), memory.VisualSaveOptions{
@@ -504,6 +618,157 @@ func TestUpdateAgentPreservesChannels(t *testing.T) {
 	}
 }
 
+func TestUpdateAgentPreservesPersonaTokens(t *testing.T) {
+	agentsTOML := "\n[[agents]]\nid = \"cast\"\nserver_id = \"111\"\n" +
+		"[[agents.personas]]\nid = \"luna\"\nname = \"Luna\"\ntoken = \"luna-token\"\n" +
+		"[[agents.personas]]\nid = \"max\"\nname = \"Max\"\n"
+	ts, dir := newTestServerWithAgents(t, agentsTOML)
+
+	// The dashboard never sees tokens, so it sends personas without them.
+	body := `{"server_id":"111","personas":[{"id":"luna","name":"Luna Lovegood"},{"id":"max","name":"Max"}]}`
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/agents/cast", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update agent: expected 204, got %d", resp.StatusCode)
+	}
+
+	cfg, err := config.Load(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	personas := cfg.Agents[0].Personas
+	if len(personas) != 2 || personas[0].Name != "Luna Lovegood" {
+		t.Fatalf("personas = %+v, want updated names", personas)
+	}
+	if personas[0].Token != "luna-token" || personas[1].Token != "" {
+		t.Errorf("persona tokens = %q, %q; want luna-token preserved and none added", personas[0].Token, personas[1].Token)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/agents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var agents []struct {
+		Personas []struct {
+			ID       string `json:"id"`
+			HasToken bool   `json:"has_token"`
+			Token    string `json:"token"`
+		} `json:"personas"`
+	}
+	json.NewDecoder(resp.Body).Decode(&agents)
+	if len(agents) != 1 || len(agents[0].Personas) != 2 || !agents[0].Personas[0].HasToken || agents[0].Personas[0].Token != "" {
+		t.Errorf("agent view personas = %+v, want has_token without the token itself", agents)
+	}
+}
+
+func TestUpdateAgentPreservesToolSelection(t *testing.T) {
+	agentsTOML := "[[tools.mcp]]\nname = \"wiki\"\nurl = \"http://localhost:9000/mcp\"\n" +
+		"\n[[agents]]\nid = \"a\"\nserver_id = \"111\"\n" +
+		"[[agents.mcp]]\nserver = \"wiki\"\ntools = [\"search\"]\n" +
+		"[agents.tools]\ndeny = [\"react\"]\n"
+	ts, dir := newTestServerWithAgents(t, agentsTOML)
+
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/agents/a", strings.NewReader(`{"server_id":"111","language":"cs"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update agent: expected 204, got %d", resp.StatusCode)
+	}
+
+	cfg, err := config.Load(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcp := cfg.Agents[0].MCP
+	if len(mcp) != 1 || mcp[0].Server != "wiki" || len(mcp[0].Tools) != 1 || mcp[0].Tools[0] != "search" {
+		t.Errorf("agent mcp = %+v, want the wiki selection preserved", mcp)
+	}
+	if deny := cfg.Agents[0].Tools.Deny; !slices.Equal(deny, []string{"react"}) {
+		t.Errorf("agent tools deny = %v, want the tool policy preserved", deny)
+	}
+}
+
+func TestUpdateAgentPreservesImageLimits(t *testing.T) {
+	agentsTOML := "\n[[agents]]\nid = \"a\"\nserver_id = \"111\"\n" +
+		"[[agents.image.limits]]\nrole = \"mods\"\ndaily_limit = 0\n" +
+		"[[agents.channels]]\nid = \"999\"\nimage_safety = \"nsfw\"\n"
+	ts, dir := newTestServerWithAgents(t, agentsTOML)
+
+	// The dashboard's image form has no field for per-role limits.
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/agents/a", strings.NewReader(`{"server_id":"111","image":{"daily_limit":5}}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update agent: expected 204, got %d", resp.StatusCode)
+	}
+
+	cfg, err := config.Load(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := cfg.Agents[0].Image
+	if img.DailyLimit != 5 || len(img.Limits) != 1 || img.Limits[0].Role != "mods" {
+		t.Errorf("agent image = %+v, want daily_limit 5 and the mods limit preserved", img)
+	}
+	if got := cfg.ResolveImageSafety("111", []string{"999"}); got != config.ImageSafetyNSFW {
+		t.Errorf("channel image safety = %q, want nsfw", got)
+	}
+}
+
+func TestGetAgentToolsPerChannel(t *testing.T) {
+	ts, _ := newTestServerWithAgentMemory(t, "a1", "srv1", nil)
+
+	body := `{"server_id":"srv1","tools":{"deny":["memory_forget"]},"channels":[{"id":"work","response_mode":"all","tools":{"deny":["react"]}}]}`
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/agents/a1", strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update agent: expected 204, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/agents/a1/tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var report agent.ToolReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(report.Tools, "memory_forget") || slices.Contains(report.Default, "memory_forget") {
+		t.Errorf("memory_forget: tools = %v, default = %v; want it listed but disabled", report.Tools, report.Default)
+	}
+	if want := []string{"memory_recall", "memory_save", "memory_update", "reply"}; !slices.Equal(report.Channels["work"], want) {
+		t.Errorf("work channel tools = %v, want %v", report.Channels["work"], want)
+	}
+
+	resp2, err := http.Get(ts.URL + "/api/agents/missing/tools")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown agent: expected 404, got %d", resp2.StatusCode)
+	}
+}
+
 func TestUpsertAgent(t *testing.T) {
 	t.Run("valid input creates agent", func(t *testing.T) {
 		srv := newTestWebServer(t)
@@ -776,3 +1041,431 @@ func TestUpdateAgentLanguage(t *testing.T) {
 		}
 	})
 }
+
+func TestUpdateAgentAccess(t *testing.T) {
+	t.Run("replaces access rules on existing agent", func(t *testing.T) {
+		srv := newTestWebServer(t)
+		if err := srv.UpsertAgent(config.AgentConfig{ID: "agent1", ServerID: "100"}); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		access := config.AccessConfig{AllowRoles: []string{"members"}, DenyRoles: []string{"muted"}, AllowChannels: []string{"general"}}
+		if err := srv.UpdateAgentAccess("100", access); err != nil {
+			t.Fatalf("UpdateAgentAccess: %v", err)
+		}
+		got := srv.CfgStore().Get().Agents[0].Access
+		if !slices.Equal(got.AllowRoles, access.AllowRoles) || !slices.Equal(got.DenyRoles, access.DenyRoles) || !slices.Equal(got.AllowChannels, access.AllowChannels) {
+			t.Errorf("access = %+v, want %+v", got, access)
+		}
+	})
+
+	t.Run("PUT /api/agents/{id}/access", func(t *testing.T) {
+		ts, dir := newTestServerWithAgents(t, "\n[[agents]]\nid = \"agent1\"\nserver_id = \"100\"\n")
+		body := `{"deny_users":["troll"],"allow_channels":["general"]}`
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+"/api/agents/agent1/access", strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", resp.StatusCode)
+		}
+		cfg, err := config.Load(filepath.Join(dir, "config.toml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		access := cfg.Agents[0].Access
+		if !slices.Equal(access.DenyUsers, []string{"troll"}) || !slices.Equal(access.AllowChannels, []string{"general"}) {
+			t.Errorf("persisted access = %+v", access)
+		}
+	})
+
+	t.Run("concurrent modifications are all kept", func(t *testing.T) {
+		srv := newTestWebServer(t)
+		if err := srv.UpsertAgent(config.AgentConfig{ID: "agent1", ServerID: "100"}); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		var wg sync.WaitGroup
+		for i := range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				user := fmt.Sprintf("user%d", i)
+				if _, err := srv.ModifyAgentAccess("100", func(a *config.AccessConfig) { a.AllowUsers = append(a.AllowUsers, user) }); err != nil {
+					t.Errorf("ModifyAgentAccess: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if got := srv.CfgStore().Get().Agents[0].Access.AllowUsers; len(got) != 10 {
+			t.Errorf("allow_users = %v, want all 10 users", got)
+		}
+	})
+
+	t.Run("failed writes return no rules", func(t *testing.T) {
+		srv := newTestWebServer(t)
+		if err := srv.UpsertAgent(config.AgentConfig{ID: "agent1", ServerID: "100"}); err != nil {
+			t.Fatalf("setup: %v", err)
+		}
+		// A directory in the way of the temporary file makes every write fail.
+		if err := os.Mkdir(srv.CfgStore().Path()+".tmp", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, serverID := range []string{"100", "200"} {
+			access, err := srv.ModifyAgentAccess(serverID, func(a *config.AccessConfig) { a.DenyUsers = append(a.DenyUsers, "troll") })
+			if err == nil || len(access.DenyUsers) != 0 {
+				t.Errorf("server %s: access = %+v, err = %v; want the zero value and an error", serverID, access, err)
+			}
+		}
+	})
+}
+
+func TestUpdateAgentChannelSoul(t *testing.T) {
+	srv := newTestWebServer(t)
+	if err := srv.UpsertAgent(config.AgentConfig{ID: "agent1", ServerID: "100"}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := srv.UpdateAgentChannel("100", "555", "all"); err != nil {
+		t.Fatalf("UpdateAgentChannel: %v", err)
+	}
+	if err := srv.UpdateAgentChannelSoul("100", "555", "helper"); err != nil {
+		t.Fatalf("UpdateAgentChannelSoul: %v", err)
+	}
+	if err := srv.UpdateAgentChannelSoul("100", "category1", "playful"); err != nil {
+		t.Fatalf("UpdateAgentChannelSoul category: %v", err)
+	}
+	channels := srv.CfgStore().Get().Agents[0].Channels
+	want := []config.ChannelConfig{{ID: "555", ResponseMode: "all", Soul: "helper"}, {ID: "category1", Soul: "playful"}}
+	if !reflect.DeepEqual(channels, want) {
+		t.Fatalf("channels = %+v, want %+v", channels, want)
+	}
+
+	// Removing the mode override keeps the soul selection.
+	if err := srv.UpdateAgentChannel("100", "555", ""); err != nil {
+		t.Fatalf("UpdateAgentChannel remove: %v", err)
+	}
+	// Clearing the soul of an entry without a mode drops the entry.
+	if err := srv.UpdateAgentChannelSoul("100", "category1", ""); err != nil {
+		t.Fatalf("UpdateAgentChannelSoul clear: %v", err)
+	}
+	channels = srv.CfgStore().Get().Agents[0].Channels
+	want = []config.ChannelConfig{{ID: "555", Soul: "helper"}}
+	if !reflect.DeepEqual(channels, want) {
+		t.Fatalf("channels after removal = %+v, want %+v", channels, want)
+	}
+
+	if err := srv.UpdateAgentChannelSoul("100", "555", "../escape"); err == nil {
+		t.Error("expected invalid soul name to be rejected")
+	}
+}
+
+func TestUpdateAgentChannelBots(t *testing.T) {
+	srv := newTestWebServer(t)
+	if err := srv.UpsertAgent(config.AgentConfig{ID: "agent1", ServerID: "100"}); err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	if err := srv.UpdateAgentChannelBots("100", "roleplay", true); err != nil {
+		t.Fatalf("UpdateAgentChannelBots: %v", err)
+	}
+	if err := srv.UpdateAgentChannel("100", "roleplay", "all"); err != nil {
+		t.Fatalf("UpdateAgentChannel: %v", err)
+	}
+	channels := srv.CfgStore().Get().Agents[0].Channels
+	want := []config.ChannelConfig{{ID: "roleplay", ResponseMode: "all", AllowBots: true}}
+	if !reflect.DeepEqual(channels, want) {
+		t.Fatalf("channels = %+v, want %+v", channels, want)
+	}
+
+	// Removing the mode override keeps the bot opt-in; disabling it then drops the entry.
+	if err := srv.UpdateAgentChannel("100", "roleplay", ""); err != nil {
+		t.Fatalf("UpdateAgentChannel remove: %v", err)
+	}
+	if got := srv.CfgStore().Get().Agents[0].Channels; len(got) != 1 || !got[0].AllowBots {
+		t.Fatalf("channels after mode removal = %+v, want bot opt-in kept", got)
+	}
+	if err := srv.UpdateAgentChannelBots("100", "roleplay", false); err != nil {
+		t.Fatalf("UpdateAgentChannelBots disable: %v", err)
+	}
+	if got := srv.CfgStore().Get().Agents[0].Channels; len(got) != 0 {
+		t.Errorf("channels after disabling = %+v, want none", got)
+	}
+}
+
+func TestAgentMCPEndpoint(t *testing.T) {
+	ts, _ := newTestServerWithAgentMemory(t, "bot1", "srv1", func(mem *memory.Store) {
+		if _, err := mem.Save(t.Context(), "Alice likes green tea", "srv1", "u1", "", 0.5, 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	const initBody = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`
+	post := func(token, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/agents/bot1/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := post("s3cret", initBody)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("MCP endpoint before web.mcp is enabled: got %d, want 404", resp.StatusCode)
+	}
+
+	// Enable the endpoint through the config editor.
+	resp, err := http.Get(ts.URL + "/api/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	updated := string(current) + "\n[web]\nmcp = true\nauth_token = \"s3cret\"\n"
+	resp, err = http.Post(ts.URL+"/api/config", "text/plain", strings.NewReader(updated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("update config: got %d", resp.StatusCode)
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		resp := post(token, initBody)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: got %d, want 401", token, resp.StatusCode)
+		}
+	}
+
+	resp = post("s3cret", `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"memory_recall","arguments":{"query":"tea"}}}`)
+	defer resp.Body.Close()
+	var rpc struct {
+		Result struct {
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+			IsError bool `json:"isError"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rpc); err != nil {
+		t.Fatal(err)
+	}
+	if rpc.Result.IsError || len(rpc.Result.Content) != 1 || !strings.Contains(rpc.Result.Content[0].Text, "Alice likes green tea") {
+		t.Errorf("memory_recall result = %+v, want the agent's memory", rpc.Result)
+	}
+}
+
+func TestKnowledgeEndpoints(t *testing.T) {
+	ts, _ := newTestServerWithAgentMemory(t, "bot1", "srv1", nil)
+	upload := func(filename, name, content string) *http.Response {
+		t.Helper()
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		if name != "" {
+			mw.WriteField("name", name)
+		}
+		fw, err := mw.CreateFormFile("file", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, content)
+		mw.Close()
+		resp, err := http.Post(ts.URL+"/api/agents/bot1/knowledge", mw.FormDataContentType(), strings.NewReader(body.String()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := upload("rules.docx", "", "PK")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("docx upload: got %d, want 415", resp.StatusCode)
+	}
+
+	resp = upload("scan.pdf", "", "%PDF-1.7\ntrailer << >>\n%%EOF\n")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("pdf without text: got %d, want 400", resp.StatusCode)
+	}
+
+	resp = upload("huge.txt", "", strings.Repeat("x", memory.MaxKnowledgeBytes+1))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized text upload: got %d, want 413", resp.StatusCode)
+	}
+
+	resp = upload("notes.md", strings.Repeat("n", 300), "Some notes.")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("overlong name: got %d, want 400", resp.StatusCode)
+	}
+
+	resp = upload("rules.md", "../../rules.md", "# Voice channels\n\nNo soundboards after midnight.\n\n# Art\n\nCredit the artist.")
+	var doc memory.KnowledgeDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || doc.Name != "rules.md" || doc.Chunks != 2 {
+		t.Fatalf("upload: status %d, doc %+v", resp.StatusCode, doc)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/agents/bot1/knowledge/search?q=soundboards&limit=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var search struct {
+		Results []struct {
+			Citation string `json:"citation"`
+			Content  string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&search); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(search.Results) != 1 || search.Results[0].Citation != "rules.md › Voice channels" {
+		t.Fatalf("search results = %+v", search.Results)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/agents/bot1/knowledge/"+doc.ID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/agents/bot1/knowledge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Documents []memory.KnowledgeDocument `json:"documents"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if list.Documents == nil || len(list.Documents) != 0 {
+		t.Fatalf("documents after delete = %+v, want empty list", list.Documents)
+	}
+}
+
+func TestKnowledgeUploadExtractsPDFText(t *testing.T) {
+	ts, mem := newTestServerWithAgentMemory(t, "bot1", "srv1", nil)
+	const doc = "%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >> endobj\n" +
+		"4 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n" +
+		"5 0 obj << /Length 51 >>\nstream\nBT /F1 12 Tf 72 700 Td (Movie night is Friday) Tj ET\nendstream\nendobj\n" +
+		"trailer << /Root 1 0 R >>\n%%EOF\n"
+
+	var body strings.Builder
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "events.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(fw, doc)
+	mw.Close()
+	resp, err := http.Post(ts.URL+"/api/agents/bot1/knowledge", mw.FormDataContentType(), strings.NewReader(body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(resp.Body)
+		t.Fatalf("pdf upload: got %d: %s", resp.StatusCode, msg)
+	}
+
+	chunks, err := mem.SearchKnowledge(context.Background(), "movie night", "srv1", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 1 || chunks[0].Document != "events.pdf" || !strings.Contains(chunks[0].Content, "Movie night is Friday") {
+		t.Fatalf("stored chunks = %+v, want the PDF's text", chunks)
+	}
+}
+
+func TestGeneratedImageEndpoints(t *testing.T) {
+	var dragonID string
+	ts, _ := newTestServerWithAgentMemory(t, "bot1", "srv1", func(mem *memory.Store) {
+		var err error
+		dragonID, err = mem.SaveGeneratedImage(t.Context(), memory.GeneratedImageSaveOptions{
+			ServerID: "srv1", JobID: "job1", Prompt: "a dragon over the sea", Model: "fal-ai/flux/schnell",
+			UserID: "user1", ChannelID: "chan1", MessageID: "msg1", ContentType: "image/png", Data: []byte("dragon"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mem.SaveGeneratedImage(t.Context(), memory.GeneratedImageSaveOptions{
+			ServerID: "srv1", Prompt: "a cat", ContentType: "image/png", Data: []byte("cat"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	resp, err := http.Get(ts.URL + "/api/agents/bot1/images?q=dragon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct {
+		Images []memory.GeneratedImageRow `json:"images"`
+		Total  int                        `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if list.Total != 1 || len(list.Images) != 1 || list.Images[0].ID != dragonID || list.Images[0].MessageID != "msg1" {
+		t.Fatalf("list = %+v", list)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/agents/bot1/images/" + dragonID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "dragon" || resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("image: status %d, type %q, body %q", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/agents/bot1/images/"+dragonID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: got %d, want 204", resp.StatusCode)
+	}
+	resp, err = http.Get(ts.URL + "/api/agents/bot1/images/" + dragonID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("image after delete: got %d, want 404", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/agents/unknown/images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown agent: got %d, want 404", resp.StatusCode)
+	}
+}
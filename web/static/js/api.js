@@ -12,7 +12,9 @@ function qs(params) {
 async function request(method, url, body, contentType) {
   const opts = { method, headers: {} };
   if (body !== undefined) {
-    if (contentType === 'text') {
+    if (body instanceof FormData) {
+      opts.body = body; // the browser sets the multipart boundary
+    } else if (contentType === 'text') {
       opts.headers['Content-Type'] = 'text/plain';
       opts.body = body;
     } else {
@@ -71,6 +73,24 @@ export const API = {
   getLogs:          (id, params)  => get(`/api/agents/${enc(id)}/logs?${qs(params)}`),
   getConversations: (id, params)  => get(`/api/agents/${enc(id)}/conversations?${qs(params)}`),
 
+  // Spam blocks
+  listSpamBlocks:   (id)          => get(`/api/agents/${enc(id)}/spam-blocks`),
+  unblockUser:      (id, uid)     => del(`/api/agents/${enc(id)}/spam-blocks/${enc(uid)}`),
+
+  // Knowledge base
+  listKnowledge:    (id)          => get(`/api/agents/${enc(id)}/knowledge`),
+  uploadKnowledge:  (id, form)    => post(`/api/agents/${enc(id)}/knowledge`, form),
+  deleteKnowledge:  (id, docId)   => del(`/api/agents/${enc(id)}/knowledge/${enc(docId)}`),
+  searchKnowledge:  (id, params)  => get(`/api/agents/${enc(id)}/knowledge/search?${qs(params)}`),
+
+  // Image gallery
+  listImages:       (id, params)  => get(`/api/agents/${enc(id)}/images?${qs(params)}`),
+  imageURL:         (id, imageId) => `/api/agents/${enc(id)}/images/${enc(imageId)}`,
+  deleteImage:      (id, imageId) => del(`/api/agents/${enc(id)}/images/${enc(imageId)}`),
+
+  // Tools
+  getAgentTools:    (id)          => get(`/api/agents/${enc(id)}/tools`),
+
   // Config
   getConfig:     ()              => request('GET', '/api/config'),
   setConfig:     (toml)          => request('POST', '/api/config', toml, 'text'),
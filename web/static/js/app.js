@@ -81,6 +81,8 @@ const agentTabs = [
   { id: 'soul', label: 'Soul', path: '/soul' },
   { id: 'channels', label: 'Channels', path: '/channels' },
   { id: 'memories', label: 'Memories', path: '/memories' },
+  { id: 'knowledge', label: 'Knowledge', path: '/knowledge' },
+  { id: 'images', label: 'Images', path: '/images' },
   { id: 'logs', label: 'Logs', path: '/logs' },
   { id: 'conversations', label: 'Conversations', path: '/conversations' },
 ];
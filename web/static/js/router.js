@@ -3,7 +3,7 @@
 const routes = [
   { pattern: /^\/$/, view: 'dashboard' },
   { pattern: /^\/agents\/new$/, view: 'new-agent' },
-  { pattern: /^\/agents\/([^/]+)\/(config|soul|channels|memories|logs|conversations)$/, view: 'agent-tab', params: ['id', 'tab'] },
+  { pattern: /^\/agents\/([^/]+)\/(config|soul|channels|memories|knowledge|images|logs|conversations)$/, view: 'agent-tab', params: ['id', 'tab'] },
   { pattern: /^\/agents\/([^/]+)$/, view: 'agent-overview', params: ['id'] },
   { pattern: /^\/settings$/, view: 'settings' },
 ];
@@ -7,11 +7,17 @@ export async function render(container, params) {
   container.appendChild(loading());
 
   let agent = null;
+  let soulNames = [];
+  let toolReport = null;
 
   try {
     const agents = await API.listAgents();
     agent = (agents || []).find(a => a.id === agentId || a.server_id === agentId);
     if (!agent) throw new Error('Agent not found');
+    soulNames = await API.listSouls(agent.id)
+      .then(d => (d.souls || []).map(s => s.name))
+      .catch(() => []);
+    await loadTools();
   } catch (err) {
     container.innerHTML = '';
     toast('Failed to load agent: ' + err.message, 'error');
@@ -41,6 +47,14 @@ export async function render(container, params) {
     );
     wrap.appendChild(infoCard);
 
+    // Tools offered where no channel override applies
+    if (toolReport) {
+      wrap.appendChild(el('div', { className: 'card', style: { marginBottom: 'var(--sp-6)' } },
+        el('div', { className: 'mono-label', style: { marginBottom: 'var(--sp-3)' } }, 'Default Tools'),
+        toolBadges(toolReport.default),
+      ));
+    }
+
     // Channel list
     const channels = agent.channels || [];
     const listSection = el('div', { style: { marginBottom: 'var(--sp-6)' } });
@@ -55,7 +69,7 @@ export async function render(container, params) {
 
     for (let i = 0; i < channels.length; i++) {
       const ch = channels[i];
-      const row = el('div', { className: 'channel-row' });
+      const row = el('div', { className: 'channel-row', style: { flexWrap: 'wrap' } });
 
       row.appendChild(el('span', { className: 'channel-id' }, ch.id));
 
@@ -64,6 +78,28 @@ export async function render(container, params) {
         saveChannels(channels);
       });
       row.appendChild(picker);
+      row.appendChild(soulSelect(ch.soul, (soul) => {
+        channels[i] = { ...channels[i], soul };
+        saveChannels(channels);
+      }));
+      row.appendChild(botsSelect(ch.allow_bots, (allowBots) => {
+        channels[i] = { ...channels[i], allow_bots: allowBots };
+        saveChannels(channels);
+      }));
+      row.appendChild(imageSafetySelect(ch.image_safety, (level) => {
+        channels[i] = { ...channels[i], image_safety: level };
+        saveChannels(channels);
+      }));
+      row.appendChild(unscreenedSelect(ch.allow_unscreened_images, (allow) => {
+        channels[i] = { ...channels[i], allow_unscreened_images: allow };
+        saveChannels(channels);
+      }));
+      row.appendChild(denyInput(ch.tools, async (deny) => {
+        channels[i] = { ...channels[i], tools: { ...(channels[i].tools || {}), deny } };
+        await saveChannels(channels);
+        await loadTools();
+        renderView();
+      }));
 
       const removeBtn = el('button', {
         className: 'btn btn-ghost btn-sm btn-danger',
@@ -77,6 +113,11 @@ export async function render(container, params) {
       }, 'Remove');
       row.appendChild(removeBtn);
 
+      const enabled = toolReport && toolReport.channels[ch.id];
+      if (enabled) {
+        row.appendChild(el('div', { style: { flexBasis: '100%' } }, toolBadges(enabled)));
+      }
+
       listSection.appendChild(row);
     }
 
@@ -90,7 +131,7 @@ export async function render(container, params) {
 
     const channelIdInput = el('input', { className: 'input', placeholder: 'e.g. 123456789', type: 'text' });
     const idGroup = el('div', { className: 'input-group' },
-      el('label', { className: 'input-label' }, 'Channel ID'),
+      el('label', { className: 'input-label' }, 'Channel or Category ID'),
       channelIdInput,
     );
 
@@ -100,9 +141,21 @@ export async function render(container, params) {
       modePicker(newMode, null, (m) => { newMode = m; }),
     );
 
+    let newSoul = '';
+    const soulGroup = el('div', { className: 'input-group' },
+      el('label', { className: 'input-label' }, 'Soul'),
+      soulSelect(newSoul, (s) => { newSoul = s; }),
+    );
+
+    let newAllowBots = false;
+    const botsGroup = el('div', { className: 'input-group' },
+      el('label', { className: 'input-label' }, 'Answers'),
+      botsSelect(newAllowBots, (b) => { newAllowBots = b; }),
+    );
+
     const addBtn = el('button', { className: 'btn btn-primary', onClick: () => handleAdd() }, 'Add');
 
-    formRow.append(idGroup, modeGroup, addBtn);
+    formRow.append(idGroup, modeGroup, soulGroup, botsGroup, addBtn);
     formCard.append(formTitle, formRow);
     wrap.appendChild(formCard);
 
@@ -121,13 +174,94 @@ export async function render(container, params) {
         return;
       }
 
-      channels.push({ id: channelId, response_mode: newMode });
+      channels.push({ id: channelId, response_mode: newMode, ...(newSoul && { soul: newSoul }), ...(newAllowBots && { allow_bots: true }) });
       agent.channels = channels;
       await saveChannels(channels);
       renderView();
     }
   }
 
+  // soulSelect renders a dropdown of the agent's named souls; '' means the agent soul.
+  function soulSelect(current, onChange) {
+    const select = el('select', { className: 'input', onChange: (e) => onChange(e.target.value) },
+      el('option', { value: '' }, 'Agent soul'),
+      ...soulNames.map(name => el('option', { value: name }, name)),
+    );
+    if (current && !soulNames.includes(current)) {
+      select.appendChild(el('option', { value: current }, current + ' (missing)'));
+    }
+    select.value = current || '';
+    return select;
+  }
+
+  // botsSelect toggles bot-to-bot conversation; loop guards apply when enabled.
+  function botsSelect(current, onChange) {
+    const select = el('select', { className: 'input', onChange: (e) => onChange(e.target.value === 'bots') },
+      el('option', { value: '' }, 'Humans only'),
+      el('option', { value: 'bots' }, 'Humans and bots'),
+    );
+    select.value = current ? 'bots' : '';
+    return select;
+  }
+
+  // imageSafetySelect sets the channel's image safety level; NSFW images are only
+  // ever sent in channels Discord marks age-restricted.
+  function imageSafetySelect(current, onChange) {
+    const select = el('select', {
+      className: 'input',
+      title: 'NSFW images are only sent in age-restricted channels',
+      onChange: (e) => onChange(e.target.value),
+    },
+      el('option', { value: '' }, 'Images: default'),
+      el('option', { value: 'strict' }, 'Images: strict'),
+      el('option', { value: 'nsfw' }, 'Images: NSFW allowed'),
+      el('option', { value: 'disabled' }, 'Images: off'),
+    );
+    select.value = current || '';
+    return select;
+  }
+
+  // unscreenedSelect lets strict channels use image providers that cannot
+  // safety-check their results, such as Automatic1111.
+  function unscreenedSelect(current, onChange) {
+    const select = el('select', {
+      className: 'input',
+      title: 'Providers such as Automatic1111 cannot safety-check images',
+      onChange: (e) => onChange(e.target.value === 'allow'),
+    },
+      el('option', { value: '' }, 'Unscreened images: refused'),
+      el('option', { value: 'allow' }, 'Unscreened images: allowed'),
+    );
+    select.value = current ? 'allow' : '';
+    return select;
+  }
+
+  // denyInput edits a channel's denied tools as a comma-separated list of names or patterns.
+  function denyInput(policy, onChange) {
+    return el('input', {
+      className: 'input',
+      type: 'text',
+      placeholder: 'Deny tools, e.g. generate_image',
+      title: 'Tool names or patterns such as wiki_*, comma-separated',
+      value: ((policy && policy.deny) || []).join(', '),
+      onChange: (e) => onChange(e.target.value.split(',').map(s => s.trim()).filter(Boolean)),
+    });
+  }
+
+  // toolBadges shows every tool the agent can offer, with the ones outside enabled struck through.
+  function toolBadges(enabled) {
+    const on = new Set(enabled || []);
+    return el('div', { style: { display: 'flex', flexWrap: 'wrap', gap: 'var(--sp-2)' } },
+      ...toolReport.tools.map(name => on.has(name)
+        ? el('span', { className: 'badge badge-success' }, name)
+        : el('span', { className: 'badge badge-muted', style: { textDecoration: 'line-through' }, title: 'Disabled by tool policy' }, name)),
+    );
+  }
+
+  async function loadTools() {
+    toolReport = await API.getAgentTools(agent.id).catch(() => null);
+  }
+
   async function saveChannels(channels) {
     try {
       const all = await API.listAgents();
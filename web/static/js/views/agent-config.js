@@ -201,8 +201,63 @@ export async function render(container, params) {
   );
   wrap.appendChild(ignoreSection);
 
+  // ── ACCESS RULES section ──
+  const access = agent.access || {};
+  const accessFields = [
+    ['allow_roles', 'Allow Roles'],
+    ['deny_roles', 'Deny Roles'],
+    ['allow_users', 'Allow Users'],
+    ['deny_users', 'Deny Users'],
+    ['allow_channels', 'Allow Channels'],
+    ['deny_channels', 'Deny Channels'],
+  ];
+  const accessInputs = {};
+  for (const [key] of accessFields) {
+    accessInputs[key] = el('input', {
+      className: 'input',
+      type: 'text',
+      value: (access[key] || []).join(', '),
+      placeholder: 'Comma-separated IDs',
+    });
+  }
+  const accessSection = section('ACCESS RULES',
+    el('div', { className: 'form-grid' },
+      ...accessFields.map(([key, label]) =>
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, label),
+          accessInputs[key],
+        ),
+      ),
+    ),
+    el('span', { className: 'input-hint' },
+      'Deny rules always win. Non-empty allow lists admit only matching roles/users and channels (a category ID covers its channels).'),
+  );
+  wrap.appendChild(accessSection);
+
+  function readAccess() {
+    const out = {};
+    for (const [key] of accessFields) {
+      const ids = accessInputs[key].value.split(',').map(v => v.trim()).filter(Boolean);
+      if (ids.length) out[key] = ids;
+    }
+    return out;
+  }
+
   // ── IMAGE GENERATION section ──
   const agentImg = agent.image || {};
+  const imgProviderSelect = el('select', { className: 'input' },
+    el('option', { value: '' }, 'Inherit'),
+    el('option', { value: 'fal' }, 'fal.ai'),
+    el('option', { value: 'openai' }, 'OpenAI-compatible'),
+    el('option', { value: 'a1111' }, 'Automatic1111 (local)'),
+  );
+  imgProviderSelect.value = agentImg.provider || '';
+  const imgBaseURLInput = el('input', {
+    className: 'input',
+    type: 'text',
+    value: agentImg.base_url || '',
+    placeholder: 'Leave blank to use global base URL',
+  });
   const imgApiKeyInput = el('input', {
     className: 'input',
     type: 'password',
@@ -221,6 +276,25 @@ export async function render(container, params) {
     placeholder: 'Leave blank to use global edit model',
   });
 
+  const imgConcurrencyInput = el('input', {
+    className: 'input',
+    type: 'number',
+    value: agentImg.concurrency || '',
+    min: '1',
+    max: '8',
+    placeholder: 'Inherit',
+    style: { width: '100px' },
+  });
+
+  const imgDailyLimitInput = el('input', {
+    className: 'input',
+    type: 'number',
+    value: agentImg.daily_limit || '',
+    min: '1',
+    placeholder: 'Inherit',
+    style: { width: '100px' },
+  });
+
   const agentImgSafetyState = { value: agentImg.enable_safety_checker };
   const agentImgSafetyBtn = el('button', {
     className: 'btn btn-sm btn-secondary',
@@ -250,13 +324,23 @@ export async function render(container, params) {
 
   const imageSection = section('IMAGE GENERATION',
     el('div', { style: { display: 'flex', flexDirection: 'column', gap: 'var(--sp-4)' } },
+      el('div', { style: { display: 'flex', gap: 'var(--sp-6)', alignItems: 'flex-start' } },
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, 'Provider'),
+          imgProviderSelect,
+        ),
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, 'Base URL Override'),
+          imgBaseURLInput,
+        ),
+      ),
       el('div', { className: 'input-group' },
         el('label', { className: 'input-label' }, 'API Key Override'),
         imgApiKeyInput,
         el('span', { className: 'input-hint' },
           agentImg.has_api_key
             ? 'A key is set for this agent. Enter a new value to replace it.'
-            : 'Optional. Overrides the global fal.ai API key for this agent.'),
+            : 'Optional. Overrides the global image API key for this agent.'),
       ),
       el('div', { style: { display: 'flex', gap: 'var(--sp-6)', alignItems: 'flex-start' } },
         el('div', { className: 'input-group' },
@@ -272,6 +356,14 @@ export async function render(container, params) {
           agentImgSafetyBtn,
           el('span', { className: 'input-hint' }, 'Inherit = use global setting'),
         ),
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, 'Concurrent Jobs'),
+          imgConcurrencyInput,
+        ),
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, 'Daily Limit per User'),
+          imgDailyLimitInput,
+        ),
       ),
     ),
   );
@@ -287,6 +379,9 @@ export async function render(container, params) {
         const imgApiKeyVal = imgApiKeyInput.value.trim();
         const imgModelVal = imgModelInput.value.trim();
         const imgEditModelVal = imgEditModelInput.value.trim();
+        const imgBaseURLVal = imgBaseURLInput.value.trim();
+        const imgConcurrencyVal = parseInt(imgConcurrencyInput.value, 10);
+        const imgDailyLimitVal = parseInt(imgDailyLimitInput.value, 10);
         const data = {
           server_id: agent.server_id,
           soul_file: agent.soul_file || '',
@@ -296,10 +391,18 @@ export async function render(container, params) {
           model: modelInput.value.trim(),
           db_path: dbPathInput.value.trim(),
           ignore_users: state.ignore_users,
+          spam: agent.spam,
+          access: readAccess(),
           image: {
+            ...(imgProviderSelect.value && { provider: imgProviderSelect.value }),
+            ...(imgBaseURLVal && { base_url: imgBaseURLVal }),
             ...(imgApiKeyVal && { api_key: imgApiKeyVal }),
             ...(imgModelVal && { model: imgModelVal }),
             ...(imgEditModelVal && { edit_model: imgEditModelVal }),
+            ...(imgConcurrencyVal > 0 && { concurrency: imgConcurrencyVal }),
+            ...(imgDailyLimitVal > 0 && { daily_limit: imgDailyLimitVal }),
+            ...(agentImg.limits && { limits: agentImg.limits }),
+            ...(agentImg.moderated && { moderated: true }),
             ...(agentImgSafetyState.value !== null && agentImgSafetyState.value !== undefined && { enable_safety_checker: agentImgSafetyState.value }),
           },
         };
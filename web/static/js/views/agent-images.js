@@ -0,0 +1,124 @@
+import { API } from '../api.js';
+import { el, toast, confirmDialog, loading, emptyState, pagination, timeAgo } from '../components.js';
+
+const LIMIT = 24;
+
+export async function render(container, params) {
+  const agentId = params.id;
+  container.innerHTML = '';
+  container.appendChild(loading());
+
+  let searchQuery = '';
+  let searchUserId = '';
+  let offset = 0;
+  let images = [];
+  let total = 0;
+
+  await fetchImages();
+  renderView();
+
+  async function fetchImages() {
+    try {
+      const params = { limit: LIMIT, offset };
+      if (searchQuery) params.q = searchQuery;
+      if (searchUserId) params.user_id = searchUserId;
+      const data = await API.listImages(agentId, params);
+      images = data.images || [];
+      total = data.total || 0;
+    } catch (err) {
+      toast('Failed to load images: ' + err.message, 'error');
+      images = [];
+      total = 0;
+    }
+  }
+
+  function renderView() {
+    container.innerHTML = '';
+    const wrap = el('div', { className: 'fade-in' });
+
+    // Search bar
+    const userInput = el('input', { className: 'input', placeholder: 'Filter by user', type: 'text', value: searchUserId });
+    const queryInput = el('input', { className: 'input', placeholder: 'Search prompts...', type: 'text', value: searchQuery });
+    wrap.appendChild(el('div', { style: { display: 'flex', gap: 'var(--sp-3)', marginBottom: 'var(--sp-6)', alignItems: 'flex-end', flexWrap: 'wrap' } },
+      el('div', { className: 'input-group' },
+        el('label', { className: 'input-label' }, 'User ID'),
+        userInput,
+      ),
+      el('div', { className: 'input-group', style: { flex: '1', minWidth: '200px' } },
+        el('label', { className: 'input-label' }, 'Search'),
+        queryInput,
+      ),
+      el('button', { className: 'btn btn-primary', onClick: () => handleSearch() }, 'Search'),
+    ));
+
+    if (images.length === 0) {
+      wrap.appendChild(emptyState('~', 'No images', searchQuery || searchUserId
+        ? 'No generated images match this search.'
+        : 'Images the agent generates are kept here with their prompts.'));
+    } else {
+      const grid = el('div', { className: 'card-grid', style: { marginBottom: 'var(--sp-6)' } });
+      for (const img of images) {
+        const card = el('div', { className: 'card memory-card visual-memory-card' });
+        const src = API.imageURL(agentId, img.id);
+        card.appendChild(el('a', { href: src, target: '_blank', rel: 'noopener' },
+          el('img', { className: 'visual-memory-thumb', src, alt: img.prompt, loading: 'lazy' }),
+        ));
+        card.appendChild(el('div', { className: 'memory-content' }, img.prompt));
+
+        const details = el('div', { className: 'memory-meta' });
+        if (img.job_id) details.appendChild(el('span', {}, `job ${img.job_id} #${img.index}`));
+        if (img.model) details.appendChild(el('span', {}, img.model));
+        if (img.aspect_ratio) details.appendChild(el('span', {}, img.aspect_ratio));
+        if (img.seed) details.appendChild(el('span', {}, 'seed ' + img.seed));
+        card.appendChild(details);
+
+        const meta = el('div', { className: 'memory-meta' });
+        if (img.user_id) meta.appendChild(el('span', {}, 'user: ' + img.user_id));
+        if (img.channel_id) meta.appendChild(el('span', {}, 'channel: ' + img.channel_id));
+        meta.appendChild(el('span', { title: new Date(img.created_at).toLocaleString() }, timeAgo(img.created_at)));
+        card.appendChild(meta);
+
+        card.appendChild(el('div', { className: 'memory-actions' },
+          el('span', { className: 'mono-label' }, img.id),
+          el('button', {
+            className: 'btn btn-ghost btn-sm btn-danger',
+            onClick: () => handleDelete(img),
+          }, 'Delete'),
+        ));
+        grid.appendChild(card);
+      }
+      wrap.appendChild(grid);
+
+      wrap.appendChild(pagination(total, offset, LIMIT, async (newOffset) => {
+        offset = newOffset;
+        await fetchImages();
+        renderView();
+      }));
+    }
+
+    container.appendChild(wrap);
+
+    queryInput.addEventListener('keydown', (e) => { if (e.key === 'Enter') handleSearch(); });
+    userInput.addEventListener('keydown', (e) => { if (e.key === 'Enter') handleSearch(); });
+
+    function handleSearch() {
+      searchQuery = queryInput.value.trim();
+      searchUserId = userInput.value.trim();
+      offset = 0;
+      fetchImages().then(() => renderView());
+    }
+  }
+
+  async function handleDelete(img) {
+    const ok = await confirmDialog('Delete Image', `Delete this image from the gallery? The Discord message is not affected.`);
+    if (!ok) return;
+    try {
+      await API.deleteImage(agentId, img.id);
+      toast('Image deleted', 'success');
+      await fetchImages();
+      renderView();
+    } catch (err) {
+      toast('Failed to delete image: ' + err.message, 'error');
+    }
+  }
+}
@@ -0,0 +1,139 @@
+import { API } from '../api.js';
+import { el, toast, confirmDialog, loading, emptyState, timeAgo } from '../components.js';
+
+function formatSize(bytes) {
+  if (bytes < 1024) return bytes + ' B';
+  if (bytes < 1024 * 1024) return (bytes / 1024).toFixed(1) + ' KB';
+  return (bytes / 1024 / 1024).toFixed(1) + ' MB';
+}
+
+export async function render(container, params) {
+  const agentId = params.id;
+  container.innerHTML = '';
+  container.appendChild(loading());
+
+  let documents = [];
+  await fetchDocuments();
+  renderView();
+
+  async function fetchDocuments() {
+    try {
+      documents = (await API.listKnowledge(agentId)).documents || [];
+    } catch (err) {
+      toast('Failed to load knowledge base: ' + err.message, 'error');
+      documents = [];
+    }
+  }
+
+  function renderView() {
+    container.innerHTML = '';
+    const wrap = el('div', { className: 'fade-in' });
+
+    // Upload
+    const fileInput = el('input', { className: 'input', type: 'file', accept: '.md,.markdown,.txt,.pdf' });
+    const uploadBtn = el('button', { className: 'btn btn-primary', onClick: () => handleUpload() }, 'Upload');
+    wrap.appendChild(el('div', { style: { display: 'flex', gap: 'var(--sp-3)', marginBottom: 'var(--sp-2)', alignItems: 'flex-end', flexWrap: 'wrap' } },
+      el('div', { className: 'input-group', style: { flex: '1', minWidth: '200px' } },
+        el('label', { className: 'input-label' }, 'Document'),
+        fileInput,
+      ),
+      uploadBtn,
+    ));
+    wrap.appendChild(el('div', { className: 'overview-card-hint', style: { marginBottom: 'var(--sp-6)' } },
+      'Markdown, plain text or PDF (up to 1 MB of text). Uploading a file with an existing name replaces it.'));
+
+    async function handleUpload() {
+      const file = fileInput.files[0];
+      if (!file) {
+        toast('Choose a file to upload', 'error');
+        return;
+      }
+      const form = new FormData();
+      form.append('file', file);
+      uploadBtn.disabled = true;
+      uploadBtn.textContent = 'Uploading...';
+      try {
+        const doc = await API.uploadKnowledge(agentId, form);
+        toast(`Stored ${doc.name} (${doc.chunks} passages)`, 'success');
+        await fetchDocuments();
+        renderView();
+      } catch (err) {
+        toast('Upload failed: ' + err.message, 'error');
+        uploadBtn.disabled = false;
+        uploadBtn.textContent = 'Upload';
+      }
+    }
+
+    wrap.appendChild(el('h2', { className: 'section-title' }, 'Documents'));
+    if (documents.length === 0) {
+      wrap.appendChild(emptyState('~', 'No documents', 'Upload rules, FAQs or lore for the agent to answer from.'));
+    } else {
+      const grid = el('div', { className: 'card-grid', style: { marginBottom: 'var(--sp-6)' } });
+      for (const doc of documents) {
+        const card = el('div', { className: 'card memory-card' });
+        card.appendChild(el('div', { className: 'memory-content' }, doc.name));
+        card.appendChild(el('div', { className: 'memory-meta' },
+          el('span', {}, `${doc.chunks} passages`),
+          el('span', {}, formatSize(doc.size_bytes)),
+          el('span', { title: new Date(doc.created_at).toLocaleString() }, timeAgo(doc.created_at)),
+        ));
+        card.appendChild(el('div', { className: 'memory-actions' },
+          el('button', {
+            className: 'btn btn-ghost btn-sm btn-danger',
+            onClick: () => handleDelete(doc),
+          }, 'Delete'),
+        ));
+        grid.appendChild(card);
+      }
+      wrap.appendChild(grid);
+    }
+
+    // Retrieval preview
+    wrap.appendChild(el('h2', { className: 'section-title' }, 'Test Search'));
+    const queryInput = el('input', { className: 'input', type: 'text', placeholder: 'Ask what a user might ask...' });
+    const results = el('div', { style: { display: 'flex', flexDirection: 'column', gap: 'var(--sp-3)', marginTop: 'var(--sp-4)' } });
+    wrap.appendChild(el('div', { style: { display: 'flex', gap: 'var(--sp-3)', alignItems: 'flex-end' } },
+      el('div', { className: 'input-group', style: { flex: '1' } }, queryInput),
+      el('button', { className: 'btn btn-secondary', onClick: () => handleSearch() }, 'Search'),
+    ));
+    wrap.appendChild(results);
+    queryInput.addEventListener('keydown', (e) => { if (e.key === 'Enter') handleSearch(); });
+
+    async function handleSearch() {
+      const q = queryInput.value.trim();
+      if (!q) return;
+      results.innerHTML = '';
+      try {
+        const data = await API.searchKnowledge(agentId, { q });
+        const hits = data.results || [];
+        if (hits.length === 0) {
+          results.appendChild(el('div', { className: 'overview-card-hint' }, 'No matching passages'));
+          return;
+        }
+        for (const hit of hits) {
+          results.appendChild(el('div', { className: 'card memory-card' },
+            el('div', { className: 'mono-label' }, hit.citation),
+            el('div', { className: 'memory-content' }, hit.content),
+          ));
+        }
+      } catch (err) {
+        toast('Search failed: ' + err.message, 'error');
+      }
+    }
+
+    container.appendChild(wrap);
+  }
+
+  async function handleDelete(doc) {
+    const ok = await confirmDialog('Delete Document', `Remove ${doc.name} from the knowledge base?`);
+    if (!ok) return;
+    try {
+      await API.deleteKnowledge(agentId, doc.id);
+      toast('Document deleted', 'success');
+      await fetchDocuments();
+      renderView();
+    } catch (err) {
+      toast('Failed to delete document: ' + err.message, 'error');
+    }
+  }
+}
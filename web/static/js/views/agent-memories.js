@@ -72,6 +72,7 @@ export async function render(container, params) {
         const visualId = visual.id || visual.ID || '';
         const label = visual.label || visual.Label || '';
         const description = visual.description || visual.Description || '';
+        const caption = visual.caption || '';
         const createdAt = visual.created_at || visual.CreatedAt || '';
         const userId = visual.user_id || visual.UserID || '';
 
@@ -88,6 +89,9 @@ export async function render(container, params) {
         if (description) {
           card.appendChild(el('div', { className: 'memory-meta' }, el('span', {}, description)));
         }
+        if (caption) {
+          card.appendChild(el('div', { className: 'memory-meta' }, el('span', { title: 'Vision model description' }, caption)));
+        }
 
         const meta = el('div', { className: 'memory-meta' });
         if (userId) meta.appendChild(el('span', {}, 'user: ' + userId));
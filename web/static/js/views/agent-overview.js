@@ -120,5 +120,51 @@ export async function render(container, params) {
   infoCard.appendChild(infoList);
   grid.appendChild(infoCard);
 
+  // 5. Spam blocks card
+  const spamCard = el('div', { className: 'card' });
+  spamCard.appendChild(el('div', { className: 'mono-label overview-card-label' }, 'SPAM BLOCKS'));
+  const spamList = el('div', { style: { display: 'flex', flexDirection: 'column', gap: 'var(--sp-2)' } });
+  spamCard.appendChild(spamList);
+  grid.appendChild(spamCard);
+
+  async function loadSpamBlocks() {
+    spamList.innerHTML = '';
+    let blocks;
+    try {
+      blocks = (await API.listSpamBlocks(agent.id)).blocks || [];
+    } catch (err) {
+      spamList.appendChild(el('div', { className: 'overview-card-hint' }, 'Failed to load: ' + err.message));
+      return;
+    }
+    if (!blocks.length) {
+      spamList.appendChild(el('div', { className: 'overview-card-hint' }, 'No users blocked'));
+      return;
+    }
+    for (const b of blocks) {
+      spamList.appendChild(
+        el('div', { style: { display: 'flex', alignItems: 'center', gap: 'var(--sp-2)' } },
+          el('span', { style: { fontFamily: 'var(--font-mono)', fontSize: 'var(--text-sm)', color: 'var(--cream)' } }, b.user_id),
+          el('span', { style: { fontSize: 'var(--text-xs)', color: 'var(--cream-muted)' } },
+            'offense ' + b.offenses + ', until ' + new Date(b.blocked_until).toLocaleTimeString(),
+          ),
+          el('button', {
+            className: 'btn btn-ghost btn-sm',
+            style: { marginLeft: 'auto' },
+            onClick: async () => {
+              try {
+                await API.unblockUser(agent.id, b.user_id);
+                toast('User unblocked', 'success');
+              } catch (err) {
+                toast('Failed to unblock: ' + err.message, 'error');
+              }
+              loadSpamBlocks();
+            },
+          }, 'Unblock'),
+        ),
+      );
+    }
+  }
+  loadSpamBlocks();
+
   wrap.appendChild(grid);
 }
@@ -97,6 +97,59 @@ export async function render(container, params) {
     wrap.appendChild(grid);
   }
 
+  // ── Tool calls ──
+  const toolStats = (status && status.tools) || [];
+  if (toolStats.length) {
+    const ms = (v) => v < 10 ? v.toFixed(1) + ' ms' : Math.round(v) + ' ms';
+    const table = el('table', {},
+      el('thead', {}, el('tr', {},
+        ...['Tool', 'Calls', 'Errors', 'Invalid args', 'Timeouts', 'Panics', 'Avg', 'Max'].map(h => el('th', {}, h)),
+      )),
+      el('tbody', {}, ...toolStats.map(s => el('tr', {},
+        el('td', { style: { fontFamily: 'var(--font-mono)' } }, esc(s.tool)),
+        el('td', {}, String(s.calls)),
+        el('td', {}, s.errors ? el('span', { className: 'badge badge-danger' }, String(s.errors)) : '0'),
+        el('td', {}, String(s.invalid_args)),
+        el('td', {}, String(s.timeouts)),
+        el('td', {}, String(s.panics)),
+        el('td', {}, ms(s.avg_latency_ms)),
+        el('td', {}, ms(s.max_latency_ms)),
+      ))),
+    );
+    wrap.appendChild(el('div', { className: 'mono-label', style: { marginTop: 'var(--sp-8)', marginBottom: 'var(--sp-3)' } }, 'Tool calls'));
+    wrap.appendChild(el('div', { className: 'table-wrap' }, table));
+  }
+
+  // ── Web cache ──
+  const cache = status && status.cache;
+  if (cache && cache.max_bytes) {
+    const mb = (v) => (v / (1 << 20)).toFixed(1) + ' MB';
+    const rate = (hits, misses) => hits + misses ? Math.round(100 * hits / (hits + misses)) + '%' : '—';
+    const fetchHits = cache.fetch_hits + cache.fetch_revalidated;
+    const table = el('table', {},
+      el('thead', {}, el('tr', {},
+        ...['', 'Hits', 'Misses', 'Hit rate'].map(h => el('th', {}, h)),
+      )),
+      el('tbody', {},
+        el('tr', {},
+          el('td', { style: { fontFamily: 'var(--font-mono)' } }, 'web_fetch'),
+          el('td', {}, cache.fetch_revalidated ? `${fetchHits} (${cache.fetch_revalidated} revalidated)` : String(fetchHits)),
+          el('td', {}, String(cache.fetch_misses)),
+          el('td', {}, rate(fetchHits, cache.fetch_misses)),
+        ),
+        el('tr', {},
+          el('td', { style: { fontFamily: 'var(--font-mono)' } }, 'web_search'),
+          el('td', {}, String(cache.search_hits)),
+          el('td', {}, String(cache.search_misses)),
+          el('td', {}, rate(cache.search_hits, cache.search_misses)),
+        ),
+      ),
+    );
+    wrap.appendChild(el('div', { className: 'mono-label', style: { marginTop: 'var(--sp-8)', marginBottom: 'var(--sp-3)' } },
+      `Web cache · ${cache.entries} entries · ${mb(cache.size_bytes)} of ${mb(cache.max_bytes)}`));
+    wrap.appendChild(el('div', { className: 'table-wrap' }, table));
+  }
+
   // ── Footer link ──
   const footer = el('div', { style: { marginTop: 'var(--sp-8)' } },
     el('a', { href: '/settings' }, 'Settings'),
@@ -89,6 +89,18 @@ export async function render(container, params) {
   wrap.appendChild(soulSection);
 
   // ── 3. Image Generation ──
+  const imgProviderSelect = el('select', { className: 'input' },
+    el('option', { value: 'fal' }, 'fal.ai'),
+    el('option', { value: 'openai' }, 'OpenAI-compatible'),
+    el('option', { value: 'a1111' }, 'Automatic1111 (local)'),
+  );
+  imgProviderSelect.value = (imageConfig && imageConfig.provider) || 'fal';
+  const imgBaseURLInput = el('input', {
+    className: 'input',
+    type: 'text',
+    value: (imageConfig && imageConfig.base_url) || '',
+    placeholder: 'Provider default',
+  });
   const imgApiKeyInput = el('input', {
     className: 'input',
     type: 'password',
@@ -148,6 +160,23 @@ export async function render(container, params) {
     style: { width: '100px' },
   });
 
+  const imgConcurrencyInput = el('input', {
+    className: 'input',
+    type: 'number',
+    value: (imageConfig && imageConfig.concurrency) || 1,
+    min: '1',
+    max: '8',
+    style: { width: '100px' },
+  });
+
+  const imgDailyLimitInput = el('input', {
+    className: 'input',
+    type: 'number',
+    value: (imageConfig && imageConfig.daily_limit) || 0,
+    min: '0',
+    style: { width: '100px' },
+  });
+
   const imgSaveBtn = el('button', {
     className: 'btn btn-sm',
     type: 'button',
@@ -156,7 +185,10 @@ export async function render(container, params) {
       imgSaveBtn.disabled = true;
       imgSaveBtn.textContent = 'Saving...';
       try {
-        const data = {};
+        const data = {
+          provider: imgProviderSelect.value,
+          base_url: imgBaseURLInput.value.trim(),
+        };
         const keyVal = imgApiKeyInput.value.trim();
         if (keyVal) data.api_key = keyVal;
         const modelVal = imgModelInput.value.trim();
@@ -167,6 +199,10 @@ export async function render(container, params) {
         data.enable_safety_checker = imgSafetyState.value;
         const timeoutVal = parseInt(imgTimeoutInput.value, 10);
         if (timeoutVal > 0) data.timeout_seconds = timeoutVal;
+        const concurrencyVal = parseInt(imgConcurrencyInput.value, 10);
+        if (concurrencyVal > 0) data.concurrency = concurrencyVal;
+        const dailyLimitVal = parseInt(imgDailyLimitInput.value, 10);
+        data.daily_limit = dailyLimitVal > 0 ? dailyLimitVal : 0;
         await API.setImageConfig(data);
         if (keyVal) imgApiKeyInput.value = '';
         toast('Image config saved', 'success');
@@ -181,18 +217,29 @@ export async function render(container, params) {
 
   const imgSection = section('IMAGE GENERATION',
     el('div', { style: { display: 'flex', flexDirection: 'column', gap: 'var(--sp-4)' } },
+      el('div', { style: { display: 'flex', gap: 'var(--sp-6)', alignItems: 'flex-start' } },
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, 'Provider'),
+          imgProviderSelect,
+        ),
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, 'Base URL'),
+          imgBaseURLInput,
+          el('span', { className: 'input-hint' }, 'Required for Automatic1111, e.g. http://127.0.0.1:7860'),
+        ),
+      ),
       el('div', { className: 'input-group' },
-        el('label', { className: 'input-label' }, 'API Key (fal.ai)'),
+        el('label', { className: 'input-label' }, 'API Key'),
         imgApiKeyInput,
         el('span', { className: 'input-hint' },
           imageConfig && imageConfig.has_api_key
             ? 'A key is configured. Enter a new value to replace it.'
-            : 'Enter your fal.ai API key to enable image generation.'),
+            : 'Enter the provider API key to enable image generation (not needed for Automatic1111).'),
       ),
       el('div', { className: 'input-group' },
         el('label', { className: 'input-label' }, 'Model'),
         imgModelInput,
-        el('span', { className: 'input-hint' }, 'Default: fal-ai/flux/schnell'),
+        el('span', { className: 'input-hint' }, 'Default: fal-ai/flux/schnell (fal), gpt-image-1 (OpenAI), loaded checkpoint (Automatic1111)'),
       ),
       el('div', { className: 'input-group' },
         el('label', { className: 'input-label' }, 'Edit Model'),
@@ -208,6 +255,16 @@ export async function render(container, params) {
           el('label', { className: 'input-label' }, 'Timeout (seconds)'),
           imgTimeoutInput,
         ),
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, 'Concurrent Jobs'),
+          imgConcurrencyInput,
+          el('span', { className: 'input-hint' }, 'Per agent; further requests wait in a queue'),
+        ),
+        el('div', { className: 'input-group' },
+          el('label', { className: 'input-label' }, 'Daily Limit per User'),
+          imgDailyLimitInput,
+          el('span', { className: 'input-hint' }, '0 = unlimited'),
+        ),
       ),
       imgSaveBtn,
     ),